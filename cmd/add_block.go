@@ -9,22 +9,25 @@ import (
 )
 
 var addBlockCmd = &cobra.Command{
-	Use:     "add",
-	Aliases: []string{"addition"},
-	Short:   "Use to add a new block",
-	Long:    "What is a chain without a block 🧱",
+	Use:        "add",
+	Aliases:    []string{"addition"},
+	Short:      "Use to add a new block",
+	Long:       "What is a chain without a block 🧱, the data is kept in a data output of the block's transaction",
+	Deprecated: "use `block anchor --data <HEX|FILE> --from <WALLET ADDRESS>`, it signs the anchor and can anchor the hash of larger data",
 	Run: func(cmd *cobra.Command, args []string) {
 		input := strings.ToLower(args[0]) // everything on the chain is converted to small letters
 		if input == "" {
 			logger.Error("empty or wrong input passed", slog.String("expected", "<anything>"), slog.String("got", ""))
 			os.Exit(100)
 		}
-		addBlock(input)
+		addBlock(cmd, input)
 	},
 	Args:    cobra.ExactArgs(1),
-	Example: "block add <DATA>",
+	Example: "block add <DATA> --from <WALLET ADDRESS>",
 }
 
 func init() {
+	addBlockCmd.Flags().String("from", "", "Address of the local wallet that signs the transaction, one of its unspent outputs is paid back to it")
+	_ = addBlockCmd.MarkFlagRequired("from")
 	rootCmd.AddCommand(addBlockCmd)
 }
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var anchorCmd = &cobra.Command{
+	Use:   "anchor",
+	Short: "Anchor data or its hash on the chain",
+	Long: "Embeds up to 80 bytes in a provably unspendable output of a transaction signed by a wallet ⚓\n" +
+		"the data is given in hexadecimal or read from a file, anchor the hash of anything larger with --hash",
+	Example: "block anchor --data 48656c6c6f --from <WALLET ADDRESS>\n" +
+		"block anchor --data contract.pdf --hash --from <WALLET ADDRESS>",
+	Args:             cobra.NoArgs,
+	PersistentPreRun: openChain,
+	Run: func(cmd *cobra.Command, args []string) {
+		anchor(cmd)
+	},
+}
+
+var anchorFindCmd = &cobra.Command{
+	Use:     "find [HEX PREFIX]",
+	Short:   "Find the anchors whose data starts with a prefix",
+	Long:    "Reads every block of the chain, newest first, without a prefix every anchor is listed",
+	Example: "block anchor find 4865",
+	Args:    cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		prefix := ""
+		if len(args) > 0 {
+			prefix = args[0]
+		}
+		findAnchors(prefix)
+	},
+}
+
+func init() {
+	anchorCmd.Flags().String("data", "", "Hexadecimal data, or the path of a file whose content is anchored")
+	anchorCmd.Flags().String("from", "", "Address of the local wallet that signs the transaction, one of its unspent outputs is paid back to it")
+	anchorCmd.Flags().Bool("hash", false, "Anchor the SHA256 hash of the data instead of the data itself")
+	for _, flag := range []string{"data", "from"} {
+		_ = anchorCmd.MarkFlagRequired(flag)
+	}
+
+	anchorCmd.AddCommand(anchorFindCmd)
+	rootCmd.AddCommand(anchorCmd)
+}
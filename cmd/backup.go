@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Write a snapshot of the chain, its indexes and its wallets",
+	Long: "Writes a consistent snapshot of the data directory to a file 💾\n" +
+		"A running node holds the data directory, use --node to download the snapshot from its admin API (block serve --admin-addr)",
+	Example: "block backup --out chain.bak\nblock backup --out chain.bak --node http://127.0.0.1:8081",
+	Args:    cobra.NoArgs,
+	// the chain is only opened when the snapshot is not taken by a running node
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if node, _ := cmd.Flags().GetString("node"); node == "" {
+			openChain(cmd, args)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("out")
+		node, _ := cmd.Flags().GetString("node")
+		backup(cmd, out, node)
+	},
+}
+
+func init() {
+	backupCmd.Flags().String("out", "", "File the snapshot is written to")
+	backupCmd.Flags().String("node", "", "Admin API of a running node to take the snapshot from")
+	_ = backupCmd.MarkFlagRequired("out")
+	rootCmd.AddCommand(backupCmd)
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var balanceCmd = &cobra.Command{
+	Use:     "balance",
+	Short:   "Show the balance of an address",
+	Long:    "Sums the unspent outputs an address can unlock 💰",
+	Example: "block balance <ADDRESS>",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// addresses are case sensitive, so unlike other commands the input is used as is
+		printBalance(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(balanceCmd)
+}
@@ -1,22 +1,178 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/spf13/cobra"
+	"github.com/tdadadavid/block/pkg/block"
 	"github.com/tdadadavid/block/pkg/chain"
+	"github.com/tdadadavid/block/pkg/config"
+	"github.com/tdadadavid/block/pkg/htlc"
+	"github.com/tdadadavid/block/pkg/notary"
+	"github.com/tdadadavid/block/pkg/params"
+	"github.com/tdadadavid/block/pkg/script"
+	"github.com/tdadadavid/block/pkg/store"
+	"github.com/tdadadavid/block/pkg/toolkit"
 	"github.com/tdadadavid/block/pkg/transactions"
+	"github.com/tdadadavid/block/pkg/wallet"
 )
 
 var blockChain chain.Chain
-var chainStorePath = "/data/blocks"
 
-func init() {
-	blockChain = chain.New(context.Background(), chainStorePath)
+// effective is the configuration once it is loaded, see settings
+var effective *config.Config
+
+// openChain opens the chain every command works on, it runs before any command and exits when there is no chain
+func openChain(cmd *cobra.Command, _ []string) {
+	var err error
+	path := chainStorePath(cmd)
+	if network(cmd) == params.Regtest && settings(cmd).Name == "" {
+		// regtest chains are throwaway, they start from the genesis block of the network the first time they are used
+		blockChain, err = chain.Open(context.Background(), path, chainOptions(cmd)...)
+	} else {
+		blockChain, err = chain.Load(context.Background(), path, chainOptions(cmd)...)
+	}
+
+	if errors.Is(err, chain.ErrNoChain) {
+		fmt.Printf("there is no chain in %s yet, create one with `block createchain --name <NAME> --address <ADDRESS>`\n", path)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("err opening chain in %s: %v\n", path, err)
+		os.Exit(1)
+	}
+}
+
+// settings returns the effective configuration, it exits when the configuration is not valid
+//
+// Process
+//   - Loads the defaults, the config file given with --config or BLOCK_CONFIG and the BLOCK_* environment variables
+//   - The flags set on the command line override all of them
+//   - Applies the log level
+//
+// NOTE
+//   - No config file is read unless one is given, local-config.yaml is only an example to pass with --config or
+//     BLOCK_CONFIG (.env.example sets it)
+func settings(cmd *cobra.Command) config.Config {
+	if effective != nil {
+		return *effective
+	}
+
+	flags := cmd.Flags()
+	path, _ := flags.GetString("config")
+	if !flags.Changed("config") {
+		path = os.Getenv(config.EnvPrefix + "CONFIG")
+	}
+	cfg, err := config.Load(path, os.LookupEnv)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if flags.Changed("datadir") {
+		cfg.DataDir, _ = flags.GetString("datadir")
+	}
+	if flags.Changed("network") {
+		cfg.Network, _ = flags.GetString("network")
+	}
+	if flags.Changed("name") {
+		cfg.Name, _ = flags.GetString("name")
+	}
+	if flags.Changed("log-level") {
+		cfg.LogLevel, _ = flags.GetString("log-level")
+	}
+	if flags.Changed("txindex") {
+		cfg.TxIndex, _ = flags.GetBool("txindex")
+	}
+	if flags.Changed("addrindex") {
+		cfg.AddrIndex, _ = flags.GetBool("addrindex")
+	}
+	if flags.Changed("prune") {
+		cfg.Prune, _ = flags.GetInt32("prune")
+	}
+	if flags.Changed("addr") {
+		cfg.RPC.Addr, _ = flags.GetString("addr")
+	}
+	if flags.Changed("admin-addr") {
+		cfg.RPC.AdminAddr, _ = flags.GetString("admin-addr")
+	}
+	if flags.Changed("peer") {
+		cfg.P2P.Peers, _ = flags.GetStringArray("peer")
+	}
+
+	level, err := cfg.Level()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	slog.SetLogLoggerLevel(level)
+	InitLogger(level)
+
+	effective = &cfg
+	return cfg
+}
+
+// network returns the parameters of the configured network, it exits on an unknown network
+func network(cmd *cobra.Command) *params.Params {
+	p, err := params.ByName(settings(cmd).Network)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return p
+}
+
+// chainStorePath returns where the selected chain of the network is stored
+//
+// NOTE
+//   - Mainnet keeps its chains at the root of the data directory, a named chain is kept in a directory of its name
+func chainStorePath(cmd *cobra.Command) string {
+	cfg := settings(cmd)
+	return filepath.Join(network(cmd).DataDir(cfg.DataDir), cfg.Name, "blocks")
+}
+
+// chainOptions returns the chain options selected by the configuration
+func chainOptions(cmd *cobra.Command) []chain.Option {
+	cfg := settings(cmd)
+	return []chain.Option{
+		chain.WithParams(network(cmd)), chain.WithTxIndex(cfg.TxIndex), chain.WithAddrIndex(cfg.AddrIndex), chain.WithPrune(cfg.Prune),
+	}
+}
+
+func showConfig(cmd *cobra.Command) {
+	cfg := settings(cmd)
+	if err := cfg.Write(os.Stdout); err != nil {
+		fmt.Printf("err writing configuration: %v\n", err)
+	}
 }
 
-func addBlock(data string) {
-	blockChain.AddBlock(transactions.Transaction{}) //TODO: fix me
+// addBlock mines a block whose transaction carries the data in a data output, an output of the wallet pays for it
+func addBlock(cmd *cobra.Command, data string) {
+	from, _ := cmd.Flags().GetString("from")
+	if len(data) > script.MaxDataSize {
+		fmt.Printf("%d bytes of data exceed the size of %d, anchor its hash with `block anchor --data <FILE> --hash`\n", len(data), script.MaxDataSize)
+		return
+	}
+	txn, b, err := submitAnchor(cmd, from, []byte(data))
+	if err != nil {
+		fmt.Printf("err adding %q: %v\n", data, err)
+		return
+	}
+	fmt.Printf("added %s in block %s at height %d\n", txn.GetId(), b.GetHash(), b.GetHeight())
 }
 
 func printBlock(hash string) {
@@ -31,3 +187,896 @@ func printLastBlockOnChain(_ string) {
 	b, _ := blockChain.FindLast()
 	fmt.Printf("Block {%v}\n", b)
 }
+
+func printBlockAtHeight(value string) {
+	height, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || height < 0 {
+		fmt.Printf("invalid height %q\n", value)
+		return
+	}
+
+	b, err := blockChain.GetBlockByHeight(context.Background(), int32(height))
+	if err != nil {
+		fmt.Printf("err finding block at height %d: %v\n", height, err)
+		return
+	}
+	fmt.Println(b)
+}
+
+func printTransaction(id string) {
+	lookup, err := blockChain.FindTransaction(context.Background(), id)
+	if err != nil {
+		fmt.Printf("err finding transaction %s: %v\n", id, err)
+		return
+	}
+	fmt.Printf("Transaction {%v} in block %s at height %d (position %d, %d confirmations)\n",
+		lookup.Txn, lookup.BlockHash, lookup.Height, lookup.Position, lookup.Confirmations)
+}
+
+func reindex() {
+	if err := blockChain.Reindex(context.Background()); err != nil {
+		fmt.Printf("err rebuilding indexes: %v\n", err)
+		return
+	}
+	fmt.Println("indexes rebuilt")
+}
+
+func printBalance(address string) {
+	balance, err := blockChain.GetBalance(context.Background(), address)
+	if err != nil {
+		fmt.Printf("err computing balance of %s: %v\n", address, err)
+		return
+	}
+	fmt.Printf("Balance of %s: %d\n", address, balance)
+}
+
+func createChain(cmd *cobra.Command) {
+	// the flags override the genesis file
+	var genesis params.Genesis
+	flags := cmd.Flags()
+	if path, _ := flags.GetString("genesis"); path != "" {
+		var err error
+		if genesis, err = params.LoadGenesis(path); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if flags.Changed("address") {
+		genesis.Address, _ = flags.GetString("address")
+	}
+	if flags.Changed("genesis-message") {
+		genesis.CoinbaseData, _ = flags.GetString("genesis-message")
+	}
+	if flags.Changed("timestamp") {
+		genesis.Timestamp, _ = flags.GetInt64("timestamp")
+	}
+	allocs, _ := flags.GetStringArray("alloc")
+	for _, alloc := range allocs {
+		address, value, _ := strings.Cut(alloc, "=")
+		amount, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			fmt.Printf("invalid allocation %q, expected <ADDRESS>=<AMOUNT>\n", alloc)
+			return
+		}
+		genesis.Allocations = append(genesis.Allocations, params.Allocation{Address: address, Amount: amount})
+	}
+
+	path := chainStorePath(cmd)
+	bc, err := chain.Create(context.Background(), path, genesis, chainOptions(cmd)...)
+	if errors.Is(err, params.ErrBadGenesis) || errors.Is(err, block.ErrProofOfWork) {
+		fmt.Printf("err in genesis definition: %v\n", err)
+		return
+	}
+	if errors.Is(err, wallet.ErrInvalidAddress) {
+		fmt.Printf("%v\nthe genesis subsidy must be paid to an address of %s\n", err, network(cmd).Name)
+		return
+	}
+	if errors.Is(err, chain.ErrChainExists) {
+		fmt.Printf("%s holds a chain already, pick another --name\n", path)
+		return
+	}
+	if err != nil {
+		fmt.Printf("err creating chain: %v\n", err)
+		return
+	}
+	defer bc.Close()
+
+	b, err := bc.FindLast()
+	if err != nil {
+		fmt.Printf("err reading genesis block: %v\n", err)
+		return
+	}
+	fmt.Printf("created chain in %s\ngenesis block %s (nonce %d)\n", path, b.GetHash(), b.GetNonce())
+}
+
+func generate(value string, to string) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Printf("invalid number of blocks %q\n", value)
+		return
+	}
+
+	blocks, err := blockChain.Generate(context.Background(), n, to)
+	for _, b := range blocks {
+		fmt.Println(b.GetHash())
+	}
+	if err != nil {
+		fmt.Printf("err generating blocks: %v\n", err)
+		return
+	}
+	fmt.Printf("generated %d blocks\n", len(blocks))
+}
+
+func verify() {
+	report, err := blockChain.Verify(context.Background())
+	if err != nil {
+		fmt.Printf("chain is inconsistent: %v\n", err)
+		return
+	}
+	fmt.Printf("verified %d headers and %d blocks up to height %d\n", report.Headers, report.Blocks, report.Height)
+	if report.Allocated > 0 {
+		fmt.Printf("the genesis block allocates %d\n", report.Allocated)
+	}
+	if report.PrunedBelow > 0 {
+		fmt.Printf("the chain is pruned below height %d, only the headers of those blocks were verified and the UTXO set was not replayed\n", report.PrunedBelow)
+		return
+	}
+	fmt.Printf("the UTXO set matches the chain (%d outputs)\n", report.UTXOs)
+}
+
+// backup writes a snapshot to out, taken by the node at the admin API when node is set, else by this process with
+// the wallets of the network
+func backup(cmd *cobra.Command, out string, node string) {
+	f, err := os.Create(out)
+	if err != nil {
+		fmt.Printf("err creating %s: %v\n", out, err)
+		return
+	}
+	defer f.Close()
+
+	if node != "" {
+		err = downloadBackup(node, f)
+	} else {
+		wallets := openWallets(cmd)
+		defer wallets.Close()
+
+		var header store.BackupHeader
+		if header, err = blockChain.Backup(context.Background(), f, wallets.Store()); err == nil {
+			fmt.Printf("backed up chain %s at height %d (tip %s)\n", header.ChainId, header.Height, header.TipHash)
+		}
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		fmt.Printf("err writing backup: %v\n", err)
+		_ = os.Remove(out)
+	}
+}
+
+// downloadBackup streams the snapshot of a running node into w
+func downloadBackup(node string, w io.Writer) error {
+	resp, err := http.Get(strings.TrimSuffix(node, "/") + "/backup")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("node answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if _, err = io.Copy(w, resp.Body); err != nil {
+		return err
+	}
+	fmt.Printf("downloaded backup from %s\n", node)
+	return nil
+}
+
+// restore replaces the chain at storePath with the snapshot in, its wallets are merged into the ones at walletsPath
+func restore(storePath string, walletsPath string, in string, force bool) {
+	f, err := os.Open(in)
+	if err != nil {
+		fmt.Printf("err opening %s: %v\n", in, err)
+		return
+	}
+	defer f.Close()
+
+	header, err := chain.Restore(bufio.NewReader(f), storePath, walletsPath, force)
+	if errors.Is(err, store.ErrNotEmpty) {
+		fmt.Printf("%s is not empty, use --force to replace it\n", storePath)
+		return
+	}
+	if err != nil {
+		fmt.Printf("err restoring %s: %v\n", in, err)
+		return
+	}
+	fmt.Printf("restored chain %s at height %d (tip %s)\n", header.ChainId, header.Height, header.TipHash)
+}
+
+func dumpUTXOs(out string) {
+	f, err := os.Create(out)
+	if err != nil {
+		fmt.Printf("err creating %s: %v\n", out, err)
+		return
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	header, err := blockChain.DumpUTXOs(context.Background(), w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		fmt.Printf("err writing UTXO snapshot: %v\n", err)
+		_ = os.Remove(out)
+		return
+	}
+	fmt.Printf("wrote %d outputs at height %d (block %s)\ncontent hash %s\n", header.Count, header.Height, header.BaseHash, header.Hash)
+}
+
+func loadUTXOs(cmd *cobra.Command, in string, hash string) {
+	f, err := os.Open(in)
+	if err != nil {
+		fmt.Printf("err opening %s: %v\n", in, err)
+		return
+	}
+	defer f.Close()
+
+	bc, header, err := chain.LoadUTXOSnapshot(context.Background(), chainStorePath(cmd), bufio.NewReader(f), hash, chainOptions(cmd)...)
+	if errors.Is(err, chain.ErrUnknownSnapshot) {
+		fmt.Printf("%v\ncheck the hash with a source you trust and pass it with --hash\n", err)
+		return
+	}
+	if err != nil {
+		fmt.Printf("err loading UTXO snapshot: %v\n", err)
+		return
+	}
+	defer bc.Close()
+	fmt.Printf("loaded %d outputs at height %d (block %s)\n", header.Count, header.Height, header.BaseHash)
+	fmt.Println("validate the history below it with `block serve --history <explorer url of a synced node>`")
+}
+
+// openWallets opens the wallets of the configured network, the caller closes them
+func openWallets(cmd *cobra.Command) wallet.Wallets {
+	return wallet.NewWallets(network(cmd), settings(cmd).DataDir)
+}
+
+func newWallet(cmd *cobra.Command) {
+	wallets := openWallets(cmd)
+	defer wallets.Close()
+
+	w, err := wallet.New()
+	if err == nil {
+		err = wallets.AddWallet(w)
+	}
+	if err != nil {
+		fmt.Printf("err creating wallet: %v\n", err)
+		return
+	}
+	address, _ := w.GenAddressFor(network(cmd).AddressVersion)
+	fmt.Printf("address    %s\npublic key %x\n", address, w.GetPublicKey())
+}
+
+func listWallets(cmd *cobra.Command) {
+	wallets := openWallets(cmd)
+	defer wallets.Close()
+
+	addresses, err := wallets.Addresses()
+	if err != nil {
+		fmt.Printf("err listing wallets: %v\n", err)
+		return
+	}
+	for _, address := range addresses {
+		w, _ := wallets.GetWallet(address)
+		fmt.Printf("%s %x\n", address, w.GetPublicKey())
+	}
+}
+
+func createMultisig(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	required, _ := flags.GetInt("required")
+	hexKeys, _ := flags.GetStringArray("pubkey")
+	addresses, _ := flags.GetStringArray("address")
+
+	var pubKeys [][]byte
+	if len(addresses) > 0 {
+		wallets := openWallets(cmd)
+		for _, address := range addresses {
+			w, err := wallets.GetWallet(address)
+			if err != nil {
+				fmt.Println(err)
+				_ = wallets.Close()
+				return
+			}
+			pubKeys = append(pubKeys, w.GetPublicKey())
+		}
+		_ = wallets.Close()
+	}
+	for _, hexKey := range hexKeys {
+		pubKey, err := hex.DecodeString(hexKey)
+		if err == nil {
+			_, err = toolkit.ParsePublicKey(pubKey)
+		}
+		if err != nil {
+			fmt.Printf("invalid public key %q: %v\n", hexKey, err)
+			return
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	s, err := script.MultiSig(required, pubKeys)
+	if err != nil {
+		fmt.Printf("err creating multisig: %v\n", err)
+		return
+	}
+	wallets := openWallets(cmd)
+	defer wallets.Close()
+	address, err := wallets.AddScript(s)
+	if err != nil {
+		fmt.Printf("err keeping the redeem script: %v\n", err)
+		return
+	}
+	fmt.Printf("%d of %d multisig\nscript  %s\naddress %s\n", required, len(pubKeys), s, address)
+	fmt.Printf("bare    %s\n", s.Hex())
+}
+
+func draftSpend(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	inputs, _ := flags.GetStringArray("input")
+	outputs, _ := flags.GetStringArray("to")
+	out, _ := flags.GetString("out")
+	lockTime, _ := flags.GetInt64("locktime")
+	ctx := context.Background()
+	if lockTime < 0 {
+		fmt.Printf("invalid lock time %d, expected a height or a unix time\n", lockTime)
+		return
+	}
+
+	txn := transactions.Transaction{LockTime: lockTime}
+	var spent []transactions.TxnOutput
+	for _, input := range inputs {
+		txnId, value, _ := strings.Cut(input, ":")
+		value, blocks, locked := strings.Cut(value, ":")
+		vout, err := strconv.ParseInt(value, 10, 32)
+		var sequence int64
+		if err == nil && locked {
+			sequence, err = strconv.ParseInt(blocks, 10, 32)
+		}
+		if err != nil || sequence < 0 {
+			fmt.Printf("invalid input %q, expected <TXID>:<VOUT>[:<BLOCKS>]\n", input)
+			return
+		}
+		utxo, err := blockChain.FindUTXO(ctx, txnId, int32(vout))
+		if err != nil {
+			fmt.Printf("err finding unspent output %s: %v\n", input, err)
+			return
+		}
+		txn.Inputs = append(txn.Inputs, transactions.TxnInput{TxnId: txnId, Output: int32(vout), Sequence: int32(sequence)})
+		spent = append(spent, utxo.TxnOutput)
+	}
+	for _, output := range outputs {
+		to, value, _ := strings.Cut(output, "=")
+		amount, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || amount <= 0 {
+			fmt.Printf("invalid output %q, expected <ADDRESS|SCRIPT>=<AMOUNT>\n", output)
+			return
+		}
+		txnOut := transactions.TxnOutput{Value: amount, ScriptPubKey: to}
+		if _, err = txnOut.LockingScript(network(cmd).Versions()); err != nil {
+			fmt.Printf("invalid output %q: %v\n", output, err)
+			return
+		}
+		txn.Outputs = append(txn.Outputs, txnOut)
+	}
+
+	partial, err := transactions.NewPartial(txn, spent)
+	if err == nil {
+		wallets := openWallets(cmd)
+		_, err = wallets.SetRedeemScripts(partial)
+		_ = wallets.Close()
+	}
+	if err == nil {
+		err = writePartial(out, partial)
+	}
+	if err != nil {
+		fmt.Printf("err drafting transaction: %v\n", err)
+		return
+	}
+	fmt.Printf("wrote the unsigned transaction to %s, every signer signs it with `block multisig sign %s --address <ADDRESS>`\n", out, out)
+}
+
+func signPartial(cmd *cobra.Command, path string, address string) {
+	partial, err := readPartial(path)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	wallets := openWallets(cmd)
+	defer wallets.Close()
+	w, err := wallets.GetWallet(address)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	revealed, err := wallets.SetRedeemScripts(partial)
+	if err != nil {
+		fmt.Printf("err revealing redeem scripts: %v\n", err)
+		return
+	}
+	signed, err := w.SignPartial(partial, network(cmd).Versions())
+	if err == nil && signed+revealed > 0 {
+		err = writePartial(path, partial)
+	}
+	if err != nil {
+		fmt.Printf("err signing %s: %v\n", path, err)
+		return
+	}
+	fmt.Printf("signed %d of %d inputs\n", signed, len(partial.Inputs))
+}
+
+func combinePartials(cmd *cobra.Command, paths []string, out string) {
+	combined, err := readPartial(paths[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, path := range paths[1:] {
+		other, err := readPartial(path)
+		if err == nil {
+			err = combined.Combine(*other, network(cmd).Versions())
+		}
+		if err != nil {
+			fmt.Printf("err combining %s: %v\n", path, err)
+			return
+		}
+	}
+	if err = writePartial(out, combined); err != nil {
+		fmt.Printf("err writing %s: %v\n", out, err)
+		return
+	}
+	fmt.Printf("wrote the combined transaction to %s\n", out)
+}
+
+func broadcastPartial(cmd *cobra.Command, path string) {
+	partial, err := readPartial(path)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	txn, err := partial.Finalize(network(cmd).Versions())
+	if err != nil {
+		fmt.Printf("err finalizing %s: %v\n", path, err)
+		return
+	}
+	b, err := blockChain.SubmitTransaction(context.Background(), txn)
+	if err != nil {
+		fmt.Printf("err broadcasting %s: %v\n", txn.GetId(), err)
+		return
+	}
+	fmt.Printf("transaction %s mined in block %s at height %d\n", txn.GetId(), b.GetHash(), b.GetHeight())
+}
+
+// readPartial reads a partially signed transaction written by writePartial
+func readPartial(path string) (*transactions.PartialTransaction, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("err reading %s: %w", path, err)
+	}
+	var partial transactions.PartialTransaction
+	if err = json.Unmarshal(data, &partial); err != nil {
+		return nil, fmt.Errorf("err parsing %s: %w", path, err)
+	}
+	return &partial, nil
+}
+
+// writePartial writes a partially signed transaction as JSON
+func writePartial(path string, partial *transactions.PartialTransaction) error {
+	return writeJSON(path, partial)
+}
+
+// writeJSON writes a value as indented JSON
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+func createContract(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	sender, _ := flags.GetString("sender")
+	receiver, _ := flags.GetString("receiver")
+	hexHash, _ := flags.GetString("hash")
+	timeout, _ := flags.GetInt64("timeout")
+	inputs, _ := flags.GetStringArray("input")
+	amount, _ := flags.GetInt64("amount")
+	out, _ := flags.GetString("out")
+	ctx := context.Background()
+
+	var secret, hash []byte
+	var err error
+	if hexHash == "" {
+		secret, hash, err = htlc.NewSecret()
+	} else {
+		hash, err = hex.DecodeString(hexHash)
+	}
+	if err != nil {
+		fmt.Printf("invalid hash %q: %v\n", hexHash, err)
+		return
+	}
+	contract, err := htlc.New(network(cmd), hash, receiver, sender, timeout)
+	if err != nil {
+		fmt.Printf("err creating contract: %v\n", err)
+		return
+	}
+
+	wallets := openWallets(cmd)
+	defer wallets.Close()
+	w, err := wallets.GetWallet(sender)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// the inputs of the sender pay the contract and the change back to the sender
+	var txn transactions.Transaction
+	var spent []transactions.TxnOutput
+	var value int64
+	for _, input := range inputs {
+		in, err := parseInput(input)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		utxo, err := blockChain.FindUTXO(ctx, in.TxnId, in.Output)
+		if err != nil {
+			fmt.Printf("err finding unspent output %s: %v\n", input, err)
+			return
+		}
+		txn.Inputs = append(txn.Inputs, in)
+		spent = append(spent, utxo.TxnOutput)
+		value += utxo.Value
+	}
+	if amount == 0 {
+		amount = value
+	}
+	if amount <= 0 || amount > value {
+		fmt.Printf("invalid amount %d, the inputs are worth %d\n", amount, value)
+		return
+	}
+	txn.Outputs = []transactions.TxnOutput{{Value: amount, ScriptPubKey: contract.Address}}
+	if amount < value {
+		txn.Outputs = append(txn.Outputs, transactions.TxnOutput{Value: value - amount, ScriptPubKey: sender})
+	}
+	for index := range txn.Inputs {
+		if err = w.SignInput(&txn, index, spent[index], network(cmd).Versions()); err != nil {
+			fmt.Printf("err signing input %d: %v\n", index, err)
+			return
+		}
+	}
+	txn.GenId()
+
+	redeem, _, err := contract.Terms()
+	if err == nil {
+		_, err = wallets.AddScript(redeem)
+	}
+	if err == nil {
+		err = writeJSON(out, contract)
+	}
+	if err != nil {
+		fmt.Printf("err writing contract: %v\n", err)
+		return
+	}
+	b, err := blockChain.SubmitTransaction(ctx, txn)
+	if err != nil {
+		fmt.Printf("err funding %s: %v\n", contract.Address, err)
+		return
+	}
+
+	fmt.Printf("contract %s funded with %d by %s in block %s at height %d\n", contract.Address, amount, txn.GetId(), b.GetHash(), b.GetHeight())
+	fmt.Printf("wrote the contract to %s, hash %s\n", out, contract.Hash)
+	if secret != nil {
+		fmt.Printf("secret %x, keep it until you claim the contract of your counterparty\n", secret)
+	}
+}
+
+func claimContract(cmd *cobra.Command, path string) {
+	flags := cmd.Flags()
+	hexSecret, _ := flags.GetString("secret")
+	from, _ := flags.GetString("from")
+	fromChain, _ := flags.GetString("from-chain")
+	contract, err := readContract(cmd, path)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	var secret []byte
+	if from != "" {
+		secret, err = revealedSecret(cmd, from, fromChain)
+	} else {
+		secret, err = hex.DecodeString(hexSecret)
+	}
+	if err != nil {
+		fmt.Printf("err finding the secret: %v\n", err)
+		return
+	}
+	spendContract(cmd, contract, contract.Receiver, func(utxos []transactions.UTXO, to string, w *wallet.Wallet) (transactions.Transaction, error) {
+		return contract.Claim(utxos, to, secret, w)
+	})
+}
+
+func refundContract(cmd *cobra.Command, path string) {
+	contract, err := readContract(cmd, path)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	spendContract(cmd, contract, contract.Sender, contract.Refund)
+}
+
+// spendContract spends every output paid to the contract with the wallet of the owner and mines the transaction
+func spendContract(
+	cmd *cobra.Command, contract htlc.Contract, owner string,
+	spend func(utxos []transactions.UTXO, to string, w *wallet.Wallet) (transactions.Transaction, error),
+) {
+	ctx := context.Background()
+	to, _ := cmd.Flags().GetString("to")
+	if to == "" {
+		to = owner
+	}
+
+	wallets := openWallets(cmd)
+	defer wallets.Close()
+	w, err := wallets.GetWallet(owner)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	utxos, err := blockChain.FindUTXOs(ctx, contract.Address)
+	if err != nil {
+		fmt.Printf("err finding the outputs of %s: %v\n", contract.Address, err)
+		return
+	}
+	txn, err := spend(utxos, to, w)
+	if err != nil {
+		fmt.Printf("err spending %s: %v\n", contract.Address, err)
+		return
+	}
+	b, err := blockChain.SubmitTransaction(ctx, txn)
+	if err != nil {
+		fmt.Printf("err broadcasting %s: %v\n", txn.GetId(), err)
+		return
+	}
+	fmt.Printf("transaction %s paid %d to %s in block %s at height %d\n", txn.GetId(), txn.GetOutputs()[0].Value, to, b.GetHash(), b.GetHeight())
+}
+
+// revealedSecret finds the secret revealed by the claim of a contract on another chain of the network
+func revealedSecret(cmd *cobra.Command, path, name string) ([]byte, error) {
+	contract, err := readContract(cmd, path)
+	if err != nil {
+		return nil, err
+	}
+	storePath := filepath.Join(network(cmd).DataDir(settings(cmd).DataDir), name, "blocks")
+	other, err := chain.Load(context.Background(), storePath, chain.WithParams(network(cmd)))
+	if err != nil {
+		return nil, fmt.Errorf("err opening chain in %s: %w", storePath, err)
+	}
+	defer other.Close()
+	return htlc.FindSecret(context.Background(), &other, contract)
+}
+
+// readContract reads a contract written by createContract, its terms are read again from its redeem script
+func readContract(cmd *cobra.Command, path string) (htlc.Contract, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return htlc.Contract{}, fmt.Errorf("err reading %s: %w", path, err)
+	}
+	var contract htlc.Contract
+	if err = json.Unmarshal(data, &contract); err != nil {
+		return htlc.Contract{}, fmt.Errorf("err parsing %s: %w", path, err)
+	}
+	redeem, err := script.ParseHex(contract.RedeemScript)
+	if err == nil {
+		contract, err = htlc.Parse(network(cmd), redeem)
+	}
+	if err != nil {
+		return htlc.Contract{}, fmt.Errorf("err parsing %s: %w", path, err)
+	}
+	return contract, nil
+}
+
+// parseInput parses an input given as <TXID>:<VOUT>
+func parseInput(input string) (transactions.TxnInput, error) {
+	txnId, value, _ := strings.Cut(input, ":")
+	vout, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return transactions.TxnInput{}, fmt.Errorf("invalid input %q, expected <TXID>:<VOUT>", input)
+	}
+	return transactions.TxnInput{TxnId: txnId, Output: int32(vout)}, nil
+}
+
+func anchor(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	value, _ := flags.GetString("data")
+	from, _ := flags.GetString("from")
+	hashed, _ := flags.GetBool("hash")
+
+	data, err := readData(value)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if hashed {
+		sum := sha256.Sum256(data)
+		data = sum[:]
+	}
+	if len(data) > script.MaxDataSize {
+		fmt.Printf("%d bytes of data exceed the size of %d, anchor its hash with --hash\n", len(data), script.MaxDataSize)
+		return
+	}
+
+	txn, b, err := submitAnchor(cmd, from, data)
+	if err != nil {
+		fmt.Printf("err anchoring data: %v\n", err)
+		return
+	}
+	fmt.Printf("anchored %x in %s:%d in block %s at height %d\n", data, txn.GetId(), len(txn.GetOutputs())-1, b.GetHash(), b.GetHeight())
+}
+
+// readData reads the file at the path, or decodes the value when it is not a file
+func readData(value string) ([]byte, error) {
+	if info, err := os.Stat(value); err == nil && !info.IsDir() {
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("err reading %s: %w", value, err)
+		}
+		return data, nil
+	}
+	data, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a file nor hexadecimal data", value)
+	}
+	return data, nil
+}
+
+// submitAnchor mines a transaction carrying the data in its last output
+//
+// Process
+//   - An unspent output of the wallet is spent back to it, so the anchor is signed by the wallet and its id is unique
+//   - The data output follows the change, it carries no value
+//
+// Returns
+//   - `transactions.Transaction`: The mined transaction
+//   - `block.Block`: The block it is mined in
+//   - `error`: When the wallet has nothing to spend, the data is too large or the chain refuses the transaction
+func submitAnchor(cmd *cobra.Command, from string, data []byte) (txn transactions.Transaction, b block.Block, err error) {
+	ctx := context.Background()
+	wallets := openWallets(cmd)
+	defer wallets.Close()
+	w, err := wallets.GetWallet(from)
+	if err != nil {
+		return txn, b, err
+	}
+	utxos, err := blockChain.FindUTXOs(ctx, from)
+	if err != nil {
+		return txn, b, fmt.Errorf("err finding the outputs of %s: %w", from, err)
+	}
+	if len(utxos) == 0 {
+		return txn, b, fmt.Errorf("%s has no unspent output to spend, generate blocks to it first", from)
+	}
+
+	out, err := transactions.NewDataOutput(data)
+	if err != nil {
+		return txn, b, err
+	}
+	utxo := utxos[0]
+	txn.Inputs = []transactions.TxnInput{{TxnId: utxo.TxnId, Output: utxo.Vout}}
+	txn.Outputs = []transactions.TxnOutput{{Value: utxo.Value, ScriptPubKey: from}, out}
+	if err = w.SignInput(&txn, 0, utxo.TxnOutput, network(cmd).Versions()); err != nil {
+		return txn, b, err
+	}
+	txn.GenId()
+
+	b, err = blockChain.SubmitTransaction(ctx, txn)
+	return txn, b, err
+}
+
+func findAnchors(prefix string) {
+	decoded, err := hex.DecodeString(prefix)
+	if err != nil {
+		fmt.Printf("invalid prefix %q: %v\n", prefix, err)
+		return
+	}
+	anchors, err := blockChain.FindAnchors(context.Background(), decoded)
+	for _, a := range anchors {
+		fmt.Printf("%s:%d at height %d in block %s: %s\n", a.TxnId, a.Vout, a.Height, a.BlockHash, a.Data)
+	}
+	if err != nil {
+		fmt.Printf("err finding anchors: %v\n", err)
+		return
+	}
+	fmt.Printf("found %d anchors\n", len(anchors))
+}
+
+func notarize(cmd *cobra.Command, files []string) {
+	from, _ := cmd.Flags().GetString("from")
+	out, _ := cmd.Flags().GetString("out")
+
+	documents := make([]notary.Document, len(files))
+	for i, file := range files {
+		hash, err := notary.HashFile(file)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		documents[i] = notary.Document{Name: filepath.Base(file), Hash: hash}
+	}
+	batch, err := notary.NewBatch(documents)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	txn, b, err := submitAnchor(cmd, from, batch.Data())
+	if err != nil {
+		fmt.Printf("err anchoring the root %x: %v\n", batch.Root(), err)
+		return
+	}
+	vout := len(txn.GetOutputs()) - 1
+	receipts, err := batch.Receipts(chain.Anchor{
+		TxnId: txn.GetId(), Vout: int32(vout), BlockHash: b.GetHash(), Height: b.GetHeight(), Data: hex.EncodeToString(batch.Data()),
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("anchored the root %x of %d files in %s:%d in block %s at height %d\n", batch.Root(), len(files), txn.GetId(), vout, b.GetHash(), b.GetHeight())
+
+	for i, file := range files {
+		path := file + ".receipt.json"
+		if out != "" {
+			path = filepath.Join(out, filepath.Base(file)+".receipt.json")
+		}
+		if err = writeJSON(path, receipts[i]); err != nil {
+			fmt.Printf("err writing the receipt of %s: %v\n", file, err)
+			return
+		}
+		fmt.Printf("%s %s\n", receipts[i].Hash, path)
+	}
+}
+
+func verifyReceipt(file, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("err reading %s: %v\n", path, err)
+		return
+	}
+	var receipt notary.Receipt
+	if err = json.Unmarshal(data, &receipt); err != nil {
+		fmt.Printf("err parsing %s: %v\n", path, err)
+		return
+	}
+	hash, err := notary.HashFile(file)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	b, err := notary.Verify(context.Background(), &blockChain, hash, receipt)
+	if err != nil {
+		fmt.Printf("receipt %s does not verify %s: %v\n", path, file, err)
+		return
+	}
+	confirmations := int32(1)
+	if tip, err := blockChain.FindLast(); err == nil {
+		confirmations = tip.GetHeight() - b.GetHeight() + 1
+	}
+	fmt.Printf("%s existed on %s, it is anchored in block %s at height %d with %d confirmations\n",
+		file, time.Unix(b.GetTimestamp(), 0).UTC().Format(time.RFC3339), b.GetHash(), b.GetHeight(), confirmations)
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+	Long:  "The configuration merges the defaults, the config file, BLOCK_* environment variables and flags, in that order ⚙️",
+	// the configuration is inspected without opening the chain
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:     "show",
+	Short:   "Print the effective configuration",
+	Long:    "Prints the effective configuration as YAML, the output can be used as a config file",
+	Example: "block config show\nBLOCK_NETWORK=regtest block config show --config block.yaml",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		showConfig(cmd)
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var createChainCmd = &cobra.Command{
+	Use:   "createchain",
+	Short: "Create a new chain",
+	Long:  "Creates a chain in its own directory whose genesis coinbase pays the subsidy to an address 🌱",
+	Example: "block createchain --name bitcoin --address <ADDRESS>\n" +
+		"block createchain --name bitcoin --address <ADDRESS> --genesis-message \"hello\" --timestamp 1700000000\n" +
+		"block createchain --name private --genesis genesis.yaml\n" +
+		"block createchain --name private --alloc <ADDRESS>=1000 --alloc <ADDRESS>=250 --timestamp 1700000000",
+	Args: cobra.NoArgs,
+	// the chain does not exist yet, it must not be opened first
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		createChain(cmd)
+	},
+}
+
+func init() {
+	createChainCmd.Flags().String("genesis", "", "JSON or YAML genesis file, every node creating the chain from it gets the same genesis block")
+	createChainCmd.Flags().String("address", "", "Address of the network the genesis subsidy is paid to")
+	createChainCmd.Flags().String("genesis-message", "", "Message of the genesis coinbase (defaults to the one of the network)")
+	createChainCmd.Flags().Int64("timestamp", 0, "Unix time of the genesis block (defaults to now)")
+	createChainCmd.Flags().StringArray("alloc", nil, "Amount the genesis pays to an address as <ADDRESS>=<AMOUNT>, repeat it to fund many addresses")
+	createChainCmd.MarkFlagsOneRequired("genesis", "address", "alloc")
+	rootCmd.AddCommand(createChainCmd)
+}
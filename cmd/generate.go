@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var generateCmd = &cobra.Command{
+	Use:     "generate",
+	Short:   "Mine blocks immediately",
+	Long:    "Mines N blocks on top of the tip and pays their subsidies to an address, meant for --network regtest ⛏",
+	Example: "block --network regtest generate 101 --to <ADDRESS>",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		to, _ := cmd.Flags().GetString("to")
+		generate(args[0], to)
+	},
+}
+
+func init() {
+	generateCmd.Flags().String("to", "", "Address of the network the subsidies are paid to")
+	_ = generateCmd.MarkFlagRequired("to")
+	rootCmd.AddCommand(generateCmd)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var htlcCmd = &cobra.Command{
+	Use:   "htlc",
+	Short: "Lock funds to a secret and a timeout, swap them across chains",
+	Long: "Hash time-locked contracts are claimed by the receiver with a secret or refunded to the sender after a timeout 🔐\n" +
+		"An atomic swap locks the coins of both parties with the same hash: the one who knows the secret claims first and reveals it,\n" +
+		"the other one claims with the revealed secret. The contract of the one who knows the secret must time out later",
+	PersistentPreRun: openChain,
+}
+
+var htlcCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a contract and fund it",
+	Long: "Writes the contract to a file and pays the inputs of the sender's wallet to it, a random secret is generated and printed\n" +
+		"when no hash is given. Give the contract file to the receiver, it checks the terms before locking its side of a swap",
+	Example: "block htlc create --sender <ADDRESS> --receiver <ADDRESS> --timeout 200 --input <TXID>:<VOUT> --out alice.json\n" +
+		"block --name other htlc create --sender <ADDRESS> --receiver <ADDRESS> --hash <HEX> --timeout 100 --input <TXID>:<VOUT> --out bob.json",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		createContract(cmd)
+	},
+}
+
+var htlcClaimCmd = &cobra.Command{
+	Use:   "claim <CONTRACT>",
+	Short: "Claim the outputs of a contract with its secret",
+	Long: "Spends every output paid to the contract with the receiver's wallet, this reveals the secret on the chain.\n" +
+		"Without --secret the secret is looked up on another chain, in the claim of the contract given with --from",
+	Example: "block --name other htlc claim bob.json --secret <HEX>\n" +
+		"block htlc claim alice.json --from bob.json --from-chain other",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		claimContract(cmd, args[0])
+	},
+}
+
+var htlcRefundCmd = &cobra.Command{
+	Use:     "refund <CONTRACT>",
+	Short:   "Take back the outputs of a contract after its timeout",
+	Long:    "Spends every output paid to the contract back with the sender's wallet, the chain refuses it before the timeout",
+	Example: "block htlc refund alice.json",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		refundContract(cmd, args[0])
+	},
+}
+
+func init() {
+	htlcCreateCmd.Flags().String("sender", "", "Address of the local wallet that funds the contract and refunds it after the timeout")
+	htlcCreateCmd.Flags().String("receiver", "", "Address that claims the contract with the secret")
+	htlcCreateCmd.Flags().String("hash", "", "Hexadecimal SHA256 hash of the secret, a secret is generated when it is not given")
+	htlcCreateCmd.Flags().Int64("timeout", 0, "Height, or unix time from 500000000, from which the sender can refund the contract")
+	htlcCreateCmd.Flags().StringArray("input", nil, "Unspent output of the sender to fund the contract with as <TXID>:<VOUT>, repeat it to spend many")
+	htlcCreateCmd.Flags().Int64("amount", 0, "Amount paid to the contract, the rest is paid back to the sender (defaults to the value of the inputs)")
+	htlcCreateCmd.Flags().String("out", "", "File the contract is written to")
+	for _, flag := range []string{"sender", "receiver", "timeout", "input", "out"} {
+		_ = htlcCreateCmd.MarkFlagRequired(flag)
+	}
+
+	htlcClaimCmd.Flags().String("secret", "", "Hexadecimal secret of the contract")
+	htlcClaimCmd.Flags().String("from", "", "Contract of the counterparty with the same hash, its claim revealed the secret")
+	htlcClaimCmd.Flags().String("from-chain", "", "Chain created with createchain the contract given with --from is on")
+	htlcClaimCmd.Flags().String("to", "", "Address the outputs are paid to (defaults to the receiver)")
+	htlcClaimCmd.MarkFlagsOneRequired("secret", "from")
+	htlcClaimCmd.MarkFlagsMutuallyExclusive("secret", "from")
+	htlcClaimCmd.MarkFlagsRequiredTogether("from", "from-chain")
+
+	htlcRefundCmd.Flags().String("to", "", "Address the outputs are paid to (defaults to the sender)")
+
+	htlcCmd.AddCommand(htlcCreateCmd, htlcClaimCmd, htlcRefundCmd)
+	rootCmd.AddCommand(htlcCmd)
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var multisigCmd = &cobra.Command{
+	Use:   "multisig",
+	Short: "Lock funds to M of N keys and spend them",
+	Long: "Multisig outputs are spent once M of their N keys signed, the signers pass a partially signed transaction around 🤝\n" +
+		"create the multisig, draft a spend, let every signer sign it, combine the signatures and broadcast it",
+	// only the commands reading the chain open it
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+}
+
+var multisigCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a multisig script address from N public keys",
+	Long: "Prints the script address of M of the public keys and keeps its redeem script in the local wallets so they can spend it,\n" +
+		"senders pay to the address with `block multisig spend --to <ADDRESS>=<AMOUNT>` without knowing the keys.\n" +
+		"The bare script is printed too, paying to it reveals the keys in the output",
+	Example: "block multisig create --required 2 --pubkey <HEX> --pubkey <HEX> --pubkey <HEX>\n" +
+		"block multisig create --required 2 --address <WALLET ADDRESS> --address <WALLET ADDRESS> --pubkey <HEX>",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		createMultisig(cmd)
+	},
+}
+
+var multisigSpendCmd = &cobra.Command{
+	Use:   "spend",
+	Short: "Draft a transaction for the signers",
+	Long:  "Writes a partially signed transaction spending unspent outputs of the chain, it carries the outputs it spends so signers don't need the chain",
+	Example: "block multisig spend --input <TXID>:<VOUT> --to <ADDRESS>=<AMOUNT> --out spend.json\n" +
+		"block multisig spend --input <TXID>:<VOUT> --to <SCRIPT>=<AMOUNT> --to <ADDRESS>=<CHANGE> --out fund.json\n" +
+		"block multisig spend --input <TXID>:<VOUT>:144 --to <ADDRESS>=<AMOUNT> --locktime 5000 --out vesting.json",
+	Args:             cobra.NoArgs,
+	PersistentPreRun: openChain,
+	Run: func(cmd *cobra.Command, args []string) {
+		draftSpend(cmd)
+	},
+}
+
+var multisigSignCmd = &cobra.Command{
+	Use:   "sign <FILE>",
+	Short: "Sign a partially signed transaction",
+	Long: "Adds the signature of a wallet to every input of the transaction it can sign, the file is updated in place.\n" +
+		"The redeem scripts of the script addresses the local wallets know are revealed first",
+	Example: "block multisig sign spend.json --address <WALLET ADDRESS>",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		address, _ := cmd.Flags().GetString("address")
+		signPartial(cmd, args[0], address)
+	},
+}
+
+var multisigCombineCmd = &cobra.Command{
+	Use:     "combine <FILE> <FILE>...",
+	Short:   "Merge the signatures of partially signed transactions",
+	Long:    "Merges the signatures signers collected on their own copies of the same transaction",
+	Example: "block multisig combine alice.json bob.json --out spend.json",
+	Args:    cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("out")
+		combinePartials(cmd, args, out)
+	},
+}
+
+var multisigBroadcastCmd = &cobra.Command{
+	Use:              "broadcast <FILE>",
+	Short:            "Finalize a signed transaction and mine it",
+	Long:             "Builds the signature scripts once every input has enough signatures and mines the transaction in a block",
+	Example:          "block multisig broadcast spend.json",
+	Args:             cobra.ExactArgs(1),
+	PersistentPreRun: openChain,
+	Run: func(cmd *cobra.Command, args []string) {
+		broadcastPartial(cmd, args[0])
+	},
+}
+
+func init() {
+	multisigCreateCmd.Flags().Int("required", 0, "Number of signatures (M) that spend the output")
+	multisigCreateCmd.Flags().StringArray("pubkey", nil, "Hexadecimal public key of a signer, repeat it for every signer")
+	multisigCreateCmd.Flags().StringArray("address", nil, "Address of a local wallet whose public key signs, repeat it for every signer")
+	_ = multisigCreateCmd.MarkFlagRequired("required")
+	multisigCreateCmd.MarkFlagsOneRequired("pubkey", "address")
+
+	multisigSpendCmd.Flags().StringArray("input", nil, "Unspent output to spend as <TXID>:<VOUT>[:<BLOCKS>], repeat it to spend many. "+
+		"BLOCKS is the number of blocks that must be mined on the output before it is spent")
+	multisigSpendCmd.Flags().StringArray("to", nil, "Output to create as <ADDRESS|SCRIPT>=<AMOUNT>, repeat it to pay many")
+	multisigSpendCmd.Flags().String("out", "", "File the partially signed transaction is written to")
+	multisigSpendCmd.Flags().Int64("locktime", 0, "Height, or unix time from 500000000, before which the transaction can't be mined")
+	_ = multisigSpendCmd.MarkFlagRequired("input")
+	_ = multisigSpendCmd.MarkFlagRequired("to")
+	_ = multisigSpendCmd.MarkFlagRequired("out")
+
+	multisigSignCmd.Flags().String("address", "", "Address of the local wallet that signs")
+	_ = multisigSignCmd.MarkFlagRequired("address")
+
+	multisigCombineCmd.Flags().String("out", "", "File the combined transaction is written to")
+	_ = multisigCombineCmd.MarkFlagRequired("out")
+
+	multisigCmd.AddCommand(multisigCreateCmd, multisigSpendCmd, multisigSignCmd, multisigCombineCmd, multisigBroadcastCmd)
+	rootCmd.AddCommand(multisigCmd)
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var notarizeCmd = &cobra.Command{
+	Use:   "notarize <FILE>...",
+	Short: "Prove files existed by anchoring their hashes on the chain",
+	Long: "Hashes the files, batches the hashes in a Merkle tree and anchors its root in a transaction signed by a wallet 📜\n" +
+		"a receipt is written for every file, it holds the path from the hash of the file to the root and the block anchoring it",
+	Example: "block notarize contract.pdf --from <WALLET ADDRESS>\n" +
+		"block notarize invoices/*.pdf --from <WALLET ADDRESS> --out receipts",
+	Args:             cobra.MinimumNArgs(1),
+	PersistentPreRun: openChain,
+	Run: func(cmd *cobra.Command, args []string) {
+		notarize(cmd, args)
+	},
+}
+
+var verifyReceiptCmd = &cobra.Command{
+	Use:              "verify-receipt <FILE> <RECEIPT>",
+	Short:            "Check a file against the receipt written when it was notarized",
+	Long:             "Checks the file hashes to the receipt, the receipt's path leads to its root and the root is anchored on the local chain",
+	Example:          "block verify-receipt contract.pdf contract.pdf.receipt.json",
+	Args:             cobra.ExactArgs(2),
+	PersistentPreRun: openChain,
+	Run: func(cmd *cobra.Command, args []string) {
+		verifyReceipt(args[0], args[1])
+	},
+}
+
+func init() {
+	notarizeCmd.Flags().String("from", "", "Address of the local wallet that signs the anchoring transaction")
+	notarizeCmd.Flags().String("out", "", "Directory the receipts are written to (defaults to next to every file as <FILE>.receipt.json)")
+	_ = notarizeCmd.MarkFlagRequired("from")
+
+	rootCmd.AddCommand(notarizeCmd, verifyReceiptCmd)
+}
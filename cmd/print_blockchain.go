@@ -13,7 +13,7 @@ var printCmd = &cobra.Command{
 	Use:     "print",
 	Short:   "View the chain",
 	Long:    "🥽 into the chain",
-	Example: "block print <chain|block>",
+	Example: "block print <b|bc|last|height|tx> [value]",
 	Args:    cobra.MaximumNArgs(3),
 	Run: func(cmd *cobra.Command, args []string) {
 		input := strings.ToLower(args[0])
@@ -42,5 +42,7 @@ func init() {
 	CommandToHandlers["b"] = printBlock
 	CommandToHandlers["bc"] = printChain
 	CommandToHandlers["last"] = printLastBlockOnChain
+	CommandToHandlers["height"] = printBlockAtHeight
+	CommandToHandlers["tx"] = printTransaction
 
 }
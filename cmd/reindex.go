@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var reindexCmd = &cobra.Command{
+	Use:     "reindex",
+	Short:   "Rebuild the transaction and address indexes",
+	Long:    "Drops the indexes and rebuilds them from every block on the chain 🗂",
+	Example: "block reindex",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		reindex()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reindexCmd)
+}
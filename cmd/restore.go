@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/tdadadavid/block/pkg/wallet"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a snapshot written by backup",
+	Long: "Restores a snapshot into the data directory after verifying it against its header ♻️\n" +
+		"The wallets of the snapshot are added to the ones of the network, none is removed",
+	Example: "block restore --in chain.bak\nblock restore --in chain.bak --force",
+	Args:    cobra.NoArgs,
+	// the data directory is written by the restore, it must not be opened first
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		in, _ := cmd.Flags().GetString("in")
+		force, _ := cmd.Flags().GetBool("force")
+		restore(chainStorePath(cmd), wallet.StorePath(network(cmd), settings(cmd).DataDir), in, force)
+	},
+}
+
+func init() {
+	restoreCmd.Flags().String("in", "", "File the snapshot is read from")
+	restoreCmd.Flags().Bool("force", false, "Replace the data directory when it is not empty")
+	_ = restoreCmd.MarkFlagRequired("in")
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/tdadadavid/block/pkg/config"
 )
 
 var CommandToHandlers = map[string]func(string){}
@@ -22,7 +23,8 @@ var rootCmd = &cobra.Command{
 		data := args[0]
 		fmt.Println(data)
 	},
-	Example: "block add b <DATA>",
+	PersistentPreRun: openChain,
+	Example:          "block add b <DATA>",
 }
 
 func Execute() {
@@ -34,11 +36,20 @@ func Execute() {
 
 func init() {
 	printCmd.PersistentFlags().String("chain", "", "Print the chain information")
+	defaults := config.Default()
+	rootCmd.PersistentFlags().String("config", "", "YAML config file (defaults to $BLOCK_CONFIG, none is read otherwise, not even ./local-config.yaml), BLOCK_* environment variables and flags override it")
+	rootCmd.PersistentFlags().String("network", defaults.Network, "Network the node runs on: mainnet, testnet or regtest")
+	rootCmd.PersistentFlags().String("name", defaults.Name, "Chain created with createchain to use (defaults to the chain of the network)")
+	rootCmd.PersistentFlags().String("datadir", defaults.DataDir, "Data directory, every network but mainnet keeps its data in a subdirectory")
+	rootCmd.PersistentFlags().String("log-level", defaults.LogLevel, "Lowest level that is logged: debug, info, warn or error")
+	rootCmd.PersistentFlags().Bool("txindex", false, "Maintain the transaction index (costs disk space)")
+	rootCmd.PersistentFlags().Bool("addrindex", false, "Maintain the address index (costs disk space)")
+	rootCmd.PersistentFlags().Int32("prune", 0, "Keep only the bodies of the last N blocks (0 keeps every block, minimum 288)")
 
 	// initialize logger for project
-	InitLogger()
+	InitLogger(slog.LevelInfo)
 }
 
-func InitLogger() {
-	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+func InitLogger(level slog.Level) {
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
 }
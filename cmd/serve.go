@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+	"github.com/tdadadavid/block/pkg/explorer"
+	"github.com/tdadadavid/block/pkg/wallet"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the block explorer API",
+	Long: "Read-only HTTP API for exploring the chain 🔭\n" +
+		"The node holds the data directory, other block commands can't write to it while it runs. Transactions are\n" +
+		"submitted and blocks mined through the admin API (--admin-addr), the /ws feed streams what they connect",
+	Example: "block serve --addr :8080 --admin-addr 127.0.0.1:8081\nblock serve --peer http://10.0.0.2:8080 --peer http://10.0.0.3:8080",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := settings(cmd)
+		addr, adminAddr := cfg.RPC.Addr, cfg.RPC.AdminAddr
+		if addr == "" {
+			addr = fmt.Sprintf(":%d", blockChain.Params().DefaultPort)
+		}
+		history, _ := cmd.Flags().GetString("history")
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		// nodes of another chain are refused, their blocks are never valid here
+		for _, peer := range cfg.P2P.Peers {
+			if _, err := explorer.ConnectPeer(ctx, &blockChain, peer); err != nil {
+				logger.Warn("peer refused", slog.String("peer", peer), slog.Any("error", err))
+				continue
+			}
+			logger.Info("peer follows the same chain", slog.String("peer", peer))
+		}
+		if history != "" {
+			go func() {
+				source, err := explorer.ConnectPeer(ctx, &blockChain, history)
+				if err == nil {
+					err = blockChain.ValidateSnapshot(ctx, source)
+				}
+				if err != nil {
+					logger.Error("history of the UTXO snapshot is invalid", slog.Any("error", err))
+				}
+			}()
+		}
+		if adminAddr != "" {
+			go func() {
+				if err := explorer.NewAdmin(&blockChain, wallet.StorePath(network(cmd), settings(cmd).DataDir)).ListenAndServe(ctx, adminAddr); err != nil {
+					logger.Error("admin stopped", slog.Any("error", err))
+				}
+			}()
+		}
+
+		if err := explorer.New(&blockChain).ListenAndServe(ctx, addr); err != nil {
+			logger.Error("explorer stopped", slog.Any("error", err))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	serveCmd.Flags().String("addr", "", "Address the explorer API listens on (defaults to the port of the network)")
+	serveCmd.Flags().String("history", "", "Explorer API of a synced node, the history below a loaded UTXO snapshot is validated against it")
+	serveCmd.Flags().String("admin-addr", "", "Address the admin API (backups, transactions, mining) listens on, keep it private (disabled when empty)")
+	serveCmd.Flags().StringArray("peer", nil, "Explorer API of a node to talk to, repeat it for more peers (replaces the peers of the config)")
+	rootCmd.AddCommand(serveCmd)
+}
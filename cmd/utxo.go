@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var utxoCmd = &cobra.Command{
+	Use:   "utxo",
+	Short: "Export and import the UTXO set",
+	Long:  "Snapshots of the UTXO set bootstrap a node without replaying every block 🚀",
+}
+
+var utxoDumpCmd = &cobra.Command{
+	Use:     "dump",
+	Short:   "Write the UTXO set at the tip and the header chain to a file",
+	Long:    "Writes the UTXO set at the tip and the header chain to a file and prints its content hash",
+	Example: "block utxo dump --out utxo.snap",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("out")
+		dumpUTXOs(out)
+	},
+}
+
+var utxoLoadCmd = &cobra.Command{
+	Use:   "load",
+	Short: "Initialize an empty node from a UTXO snapshot",
+	Long: "Initializes an empty node from a UTXO snapshot whose content hash is assumed by the chain or given with --hash\n" +
+		"The history below the snapshot is validated in the background by `block serve --history <explorer url>`",
+	Example: "block utxo load --in utxo.snap\nblock utxo load --in utxo.snap --hash <content hash>",
+	Args:    cobra.NoArgs,
+	// the chain is created from the snapshot, there is nothing to open yet
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		in, _ := cmd.Flags().GetString("in")
+		hash, _ := cmd.Flags().GetString("hash")
+		loadUTXOs(cmd, in, hash)
+	},
+}
+
+func init() {
+	utxoDumpCmd.Flags().String("out", "", "File the snapshot is written to")
+	_ = utxoDumpCmd.MarkFlagRequired("out")
+	utxoLoadCmd.Flags().String("in", "", "File the snapshot is read from")
+	utxoLoadCmd.Flags().String("hash", "", "Content hash the snapshot must have, overrides the hash assumed by the chain")
+	_ = utxoLoadCmd.MarkFlagRequired("in")
+
+	utxoCmd.AddCommand(utxoDumpCmd, utxoLoadCmd)
+	rootCmd.AddCommand(utxoCmd)
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:     "verify",
+	Short:   "Check the stored chain is consistent",
+	Long:    "Checks every header, block body and the UTXO set against each other 🔍",
+	Example: "block verify",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		verify()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var walletCmd = &cobra.Command{
+	Use:   "wallet",
+	Short: "Manage the keys of the network",
+	Long:  "Wallets hold the keys that sign transactions, every network keeps its own wallets 🔑",
+	// wallets don't need the chain
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+}
+
+var walletNewCmd = &cobra.Command{
+	Use:     "new",
+	Short:   "Create a wallet",
+	Long:    "Creates a wallet and prints its address and public key, the public key is what multisig addresses are made of",
+	Example: "block --network regtest wallet new",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		newWallet(cmd)
+	},
+}
+
+var walletListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List the wallets",
+	Long:    "Prints the address and public key of every wallet of the network",
+	Example: "block --network regtest wallet list",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		listWallets(cmd)
+	},
+}
+
+func init() {
+	walletCmd.AddCommand(walletNewCmd, walletListCmd)
+	rootCmd.AddCommand(walletCmd)
+}
@@ -10,15 +10,50 @@ import (
 	"io"
 	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/tdadadavid/block/pkg/toolkit"
 	"github.com/tdadadavid/block/pkg/transactions"
 )
 
-var (
-	HashDifficulty int32 = 4
-)
+// DefaultDifficulty is the difficulty New and NewGenesisBlock mine with, it is the one of mainnet
+//
+// NOTE
+//   - The difficulty is the number of leading zero hex digits a valid block hash has, every network defines its own
+//     in its parameters (see params.Params)
+const DefaultDifficulty int32 = 4
+
+// MaxDifficulty is the number of hex digits of a block hash, no block meets a higher difficulty
+const MaxDifficulty int32 = sha256.Size * 2
+
+// ErrProofOfWork is returned when the hash of a block does not meet the difficulty
+var ErrProofOfWork = errors.New("block hash does not meet the difficulty")
+
+// ErrBadHash is returned when the hash of a block is not the hash of its content
+var ErrBadHash = errors.New("block hash is not the hash of its content")
+
+// genesisSeed is the hash a genesis block starts mining from
+var genesisSeed = hex.EncodeToString(sha256.New().Sum([]byte("")))
+
+// Clock tells the time new blocks are stamped with, time.Now is the clock of a real node
+type Clock func() time.Time
+
+// StepClock returns a clock that reads start first and moves step forward every time it is read
+//
+// NOTE
+//   - Blocks mined with it get deterministic timestamps, tests use it to control the time of the chain
+func StepClock(start time.Time, step time.Duration) Clock {
+	var mu sync.Mutex
+	next := start
+	return func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		now := next
+		next = next.Add(step)
+		return now
+	}
+}
 
 // A grouping of transactions, marked with a timestamp, and a
 // fingerprint of the previous block. The block header is hashed to produce a proof of work,
@@ -52,26 +87,32 @@ type Block struct {
 //   - data(string): The transactional data on the chain
 //   - prevBlkHash(string): The hash of the previous block
 //   - height(int32): The height of the block
+//   - clock(Clock): Tells the time the block is stamped with, pass time.Now on a real node
 //
 // Process:
-//   - Creates the block with the given parameters and the current time in milliseconds
+//   - Creates the block with the given parameters and the time of the clock
 //   - It deserializes the transaction and hashes it, then converts to hexadecimal
 //   - It also runs the proofOfWork algorithm on the newly created block
 //
 // Returns:
 //   - block: The block that just got created
-func New(data transactions.Transaction, prevBlkHash string, height int32) (block Block) {
-	timestamp := time.Now()
+func New(data transactions.Transaction, prevBlkHash string, height int32, clock Clock) (block Block) {
+	return NewAt(data, prevBlkHash, height, clock().Unix(), DefaultDifficulty)
+}
 
-	bytez, err := data.Serialize()
+// NewAt creates a new block like New with the given timestamp and mines it with the given difficulty
+//
+// Parameters:
+//   - timestamp(int64): The unix time of the block
+//   - difficulty(int32): The number of leading zero hex digits the hash of the block must have
+func NewAt(data transactions.Transaction, prevBlkHash string, height int32, timestamp int64, difficulty int32) (block Block) {
+	hash, err := seedHash(data)
 	if err != nil {
 		panic(err)
 	}
-	val := sha256.Sum256(bytez)
-	hash := hex.EncodeToString(val[:])
 
 	block = Block{
-		Timestamp:     timestamp.Unix(),
+		Timestamp:     timestamp,
 		Transactions:  []transactions.Transaction{data},
 		PrevBlockHash: prevBlkHash,
 		Hash:          hash,
@@ -79,7 +120,7 @@ func New(data transactions.Transaction, prevBlkHash string, height int32) (block
 		Nonce:         0,
 		logger:        slog.Default(),
 	}
-	block.mine() // mine the block
+	block.mine(difficulty) // mine the block
 	return block
 }
 
@@ -88,21 +129,47 @@ func New(data transactions.Transaction, prevBlkHash string, height int32) (block
 // Note:
 //   - This method should be called once and that is during the BlockChain creation.
 //   - Coinbase is the first coin (base) for cryptocurrency like bitcoin, it has no inputs
+//   - The block is stamped with the time of the clock, pass time.Now on a real node
 //
 // Returns:
 //   - genesis: the genesis block on the chains
-func NewGenesisBlock(coinbase transactions.Transaction) (genesis Block) {
-	timestamp := time.Now()
-	genesis = Block{
-		Timestamp:     timestamp.Unix(),
+func NewGenesisBlock(coinbase transactions.Transaction, clock Clock) (genesis Block) {
+	return NewGenesisBlockAt(coinbase, clock().Unix(), DefaultDifficulty)
+}
+
+// NewGenesisBlockAt creates the genesis block like NewGenesisBlock with the given timestamp and difficulty
+//
+// NOTE
+//   - The same coinbase, timestamp and difficulty always give the same block, networks define their genesis this way
+func NewGenesisBlockAt(coinbase transactions.Transaction, timestamp int64, difficulty int32) (genesis Block) {
+	genesis = newGenesisBlock(coinbase, timestamp, 0)
+	genesis.mine(difficulty)
+	return genesis
+}
+
+// NewGenesisBlockWithNonce creates the genesis block like NewGenesisBlockAt with a known nonce instead of mining it
+//
+// Returns
+//   - `genesis Block`: The genesis block
+//   - `error`: ErrProofOfWork when the hash of the block does not meet the difficulty with the nonce
+func NewGenesisBlockWithNonce(coinbase transactions.Transaction, timestamp int64, nonce int32, difficulty int32) (genesis Block, err error) {
+	genesis = newGenesisBlock(coinbase, timestamp, nonce)
+	if !genesis.validate(difficulty) {
+		return genesis, fmt.Errorf("%w: nonce %d at difficulty %d", ErrProofOfWork, nonce, difficulty)
+	}
+	return genesis, nil
+}
+
+// newGenesisBlock creates the genesis block before it is mined
+func newGenesisBlock(coinbase transactions.Transaction, timestamp int64, nonce int32) Block {
+	return Block{
+		Timestamp:     timestamp,
 		Transactions:  []transactions.Transaction{coinbase},
 		PrevBlockHash: "",
-		Hash:          hex.EncodeToString(sha256.New().Sum([]byte(""))),
+		Hash:          genesisSeed,
 		Height:        0,
-		Nonce:         0,
+		Nonce:         nonce,
 	}
-	genesis.mine()
-	return genesis
 }
 
 // GetTransaction returns the transaction of the block
@@ -135,6 +202,20 @@ func (b *Block) GetTimestamp() int64 {
 	return b.Timestamp
 }
 
+// Header returns a copy of the block without its transactions
+//
+// NOTE
+//   - Headers are small, they are kept for every block even when the full block is not needed
+func (b *Block) Header() Block {
+	return Block{
+		Timestamp:     b.Timestamp,
+		PrevBlockHash: b.PrevBlockHash,
+		Hash:          b.Hash,
+		Height:        b.Height,
+		Nonce:         b.Nonce,
+	}
+}
+
 // String returns a string representation of a Block
 // This implements the Stringer interface to enable us printing like this fmt.Println(&block)
 func (b *Block) String() string {
@@ -307,14 +388,87 @@ func (b *Block) Deserialize(data []byte) (err error) {
 	return err
 }
 
+// ComputeHash recomputes the hash of the block from its content, the Hash field is ignored
+//
+// NOTE
+//   - A block is hashed with the hash it started mining from in its Hash field: the hash of its transaction, or
+//     genesisSeed for a genesis block (see NewAt and NewGenesisBlockAt), so the hash commits to the transactions
+//   - A header has no transactions, its hash can't be recomputed
+//
+// Returns
+//   - `string`: The hexadecimal hash
+//   - `error`: ErrBadHash when the block has no transactions
+func (b *Block) ComputeHash() (string, error) {
+	seeded := *b
+	if b.Height == 0 && b.PrevBlockHash == "" {
+		seeded.Hash = genesisSeed
+	} else {
+		if len(b.Transactions) != 1 {
+			return "", fmt.Errorf("%w: block %s has %d transactions, expected 1", ErrBadHash, b.Hash, len(b.Transactions))
+		}
+		seed, err := seedHash(b.Transactions[0])
+		if err != nil {
+			return "", err
+		}
+		seeded.Hash = seed
+	}
+	if len(seeded.Transactions) == 0 {
+		return "", fmt.Errorf("%w: block %s has no transactions", ErrBadHash, b.Hash)
+	}
+	data, err := seeded.Serialize()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// CheckProofOfWork checks the hash of the block is the hash of its content and meets the difficulty
+//
+// Returns
+//   - `error`: ErrBadHash when the block was changed after it was mined, ErrProofOfWork when its hash does not
+//     meet the difficulty
+func (b *Block) CheckProofOfWork(difficulty int32) error {
+	hash, err := b.ComputeHash()
+	if err != nil {
+		return err
+	}
+	if hash != b.Hash {
+		return fmt.Errorf("%w: block %s hashes to %s", ErrBadHash, b.Hash, hash)
+	}
+	if !MeetsDifficulty(hash, difficulty) {
+		return fmt.Errorf("%w: block %s at difficulty %d", ErrProofOfWork, hash, difficulty)
+	}
+	return nil
+}
+
+// MeetsDifficulty tells whether the hexadecimal hash starts with difficulty zeros, a difficulty out of the range of
+// the hash is never met
+func MeetsDifficulty(hash string, difficulty int32) bool {
+	if difficulty < 0 || int(difficulty) > len(hash) {
+		return false
+	}
+	return hash[:difficulty] == strings.Repeat("0", int(difficulty))
+}
+
+// seedHash returns the hash a block mining the transaction starts from
+func seedHash(txn transactions.Transaction) (string, error) {
+	bytez, err := txn.Serialize()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(bytez)
+	return hex.EncodeToString(hash[:]), nil
+}
+
 // mine validates and calculate the hash of the new block to be added
 //
 // Process:
 //   - Validate the block, if the block is not validated increase the block Nonce to increase Hash shuffling
 //   - calculateHash updates the hash of the current block
-func (b *Block) mine() {
+func (b *Block) mine(difficulty int32) {
 	// first validate the Hash if it is not correct increment the Nonce to affect the Hash shuffling
-	for !b.validate() {
+	for !b.validate(difficulty) {
 		b.Nonce += 1
 	}
 }
@@ -323,8 +477,8 @@ func (b *Block) mine() {
 //
 // Process:
 //   - Get the binary representation of the current block
-//   - Using SHA256 hash the bytes data, converts it to hexadecimal, then get the HashDifficulty prefix
-//   - Generate a zeroString HashDifficulty with length
+//   - Using SHA256 hash the bytes data, converts it to hexadecimal, then get the difficulty prefix
+//   - Generate a zeroString difficulty with length
 //   - compare hash and the zeroString for validity
 //
 // Note:
@@ -333,7 +487,7 @@ func (b *Block) mine() {
 //
 // Returns:
 //   - valid: true if the validation block passes else false.
-func (b *Block) validate() (valid bool) {
+func (b *Block) validate(difficulty int32) (valid bool) {
 	data, err := b.Serialize()
 	if err != nil {
 		return valid
@@ -344,14 +498,9 @@ func (b *Block) validate() (valid bool) {
 	hash := sha256.Sum256(data)
 	// get hexadecimal value of the hash
 	hexHash := hex.EncodeToString(hash[:])
-	// get the HASH_DIFFICULTY prefix from hash
-	hashPrefix := hexHash[:HashDifficulty]
-
-	// Compare with HASH_DIFFICULTY zeroes
-	zeroString := strings.Repeat("0", int(HashDifficulty))
 
-	// compare the values to see if its valid
-	valid = zeroString == hashPrefix
+	// compare the HASH_DIFFICULTY prefix of the hash with difficulty zeroes
+	valid = MeetsDifficulty(hexHash, difficulty)
 
 	// set the Hash of the block if it is valid
 	if valid {
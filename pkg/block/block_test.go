@@ -9,13 +9,14 @@ import (
 )
 
 func TestBlock_New(t *testing.T) {
-	b := New(transactions.Transaction{}, "", 4)
+	now := time.Unix(1700000000, 0)
+	b := New(transactions.Transaction{}, "", 4, func() time.Time { return now })
 
 	assert.NotNil(t, b)
 	assert.Equal(t, b.GetHeight(), int32(4))
 	assert.NotNil(t, b.GetTimestamp())
 	assert.NotNil(t, b.GetHash())
-	assert.Equal(t, b.GetTimestamp(), time.Now().Unix())
+	assert.Equal(t, now.Unix(), b.GetTimestamp())
 	assert.Empty(t, b.GetPrevBlockHash())
 	assert.NotNil(t, b.GetPrevBlockHash())
 	assert.NotNil(t, b.GetTransaction())
@@ -34,7 +35,7 @@ func TestBlock_Serialize_Deserialize(t *testing.T) {
 		},
 	}
 
-	b := New(txn, "", 4)
+	b := New(txn, "", 4, time.Now)
 
 	bytes, err := b.Serialize()
 	assert.Nil(t, err)
@@ -59,12 +60,56 @@ func TestBlock_NewGenesisBlock(t *testing.T) {
 		Inputs:  []transactions.TxnInput{},
 		Outputs: []transactions.TxnOutput{},
 	}
-	g := NewGenesisBlock(txn)
+	g := NewGenesisBlock(txn, StepClock(time.Unix(1700000000, 0), time.Minute))
 
 	assert.NotNil(t, g)
 	assert.Equal(t, g.GetHeight(), int32(0))
-	assert.NotNil(t, g.GetTimestamp())
+	assert.Equal(t, int64(1700000000), g.GetTimestamp())
 	assert.Empty(t, g.GetPrevBlockHash())
 	assert.NotNil(t, g.GetTransaction())
 	assert.Equal(t, len(g.GetTransaction()), 1)
 }
+
+func TestBlock_NewAtWithStepClock(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	clock := StepClock(start, 10*time.Minute)
+
+	first := NewAt(transactions.Transaction{Id: "tx"}, "", 1, clock().Unix(), 1)
+	second := NewAt(transactions.Transaction{Id: "tx"}, "", 1, clock().Unix(), 1)
+	again := NewAt(transactions.Transaction{Id: "tx"}, "", 1, start.Unix(), 1)
+
+	assert.Equal(t, start.Unix(), first.GetTimestamp())
+	assert.Equal(t, start.Add(10*time.Minute).Unix(), second.GetTimestamp())
+	// the same time gives the same block
+	assert.Equal(t, first.GetHash(), again.GetHash())
+	assert.NotEqual(t, first.GetHash(), second.GetHash())
+	assert.Equal(t, "0", first.GetHash()[:1])
+}
+
+func TestBlock_CheckProofOfWork(t *testing.T) {
+	clock := StepClock(time.Unix(1700000000, 0), time.Minute)
+	genesis := NewGenesisBlockAt(transactions.Transaction{Id: "cb", Outputs: []transactions.TxnOutput{{Value: 100}}}, clock().Unix(), 2)
+	b := NewAt(transactions.Transaction{Id: "tx", Outputs: []transactions.TxnOutput{{Value: 5, ScriptPubKey: "bob"}}}, genesis.GetHash(), 1, clock().Unix(), 2)
+	for _, mined := range []Block{genesis, b} {
+		hash, err := mined.ComputeHash()
+		assert.NoError(t, err)
+		assert.Equal(t, mined.GetHash(), hash)
+		assert.NoError(t, mined.CheckProofOfWork(2))
+		assert.ErrorIs(t, mined.CheckProofOfWork(12), ErrProofOfWork)
+		assert.ErrorIs(t, mined.CheckProofOfWork(65), ErrProofOfWork)
+	}
+
+	// the hash commits to the transactions, the header fields and the parent
+	swapped := b
+	swapped.Transactions = []transactions.Transaction{{Id: "tx", Outputs: []transactions.TxnOutput{{Value: 5, ScriptPubKey: "mallory"}}}}
+	assert.ErrorIs(t, swapped.CheckProofOfWork(2), ErrBadHash)
+	moved := b
+	moved.Timestamp++
+	assert.ErrorIs(t, moved.CheckProofOfWork(2), ErrBadHash)
+	header := b.Header()
+	assert.ErrorIs(t, header.CheckProofOfWork(2), ErrBadHash)
+
+	// a difficulty above the digits of a hash is never met
+	_, err := NewGenesisBlockWithNonce(genesis.Transactions[0], genesis.Timestamp, genesis.Nonce, MaxDifficulty+1)
+	assert.ErrorIs(t, err, ErrProofOfWork)
+}
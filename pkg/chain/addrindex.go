@@ -0,0 +1,82 @@
+package chain
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+// AddrIndexEnabled tells whether the chain maintains the address index
+func (c *Chain) AddrIndexEnabled() bool {
+	return c.addrIndex
+}
+
+// indexedUTXOs reads the unspent outputs of the address from the address index, newest first
+func (c *Chain) indexedUTXOs(ctx context.Context, address string) (utxos []transactions.UTXO, err error) {
+	outputs, err := c.store.FindAddressOutputs(ctx, address)
+	if err != nil {
+		return utxos, err
+	}
+
+	for _, out := range outputs {
+		if out.SpentBy != "" {
+			continue
+		}
+		utxos = append(utxos, transactions.UTXO{
+			TxnId:     out.TxnId,
+			Vout:      out.Vout,
+			Height:    out.Height,
+			TxnOutput: transactions.TxnOutput{Value: out.Value, ScriptPubKey: out.Script},
+		})
+	}
+
+	slices.SortStableFunc(utxos, func(a, b transactions.UTXO) int {
+		return cmp.Compare(b.Height, a.Height)
+	})
+	return utxos, err
+}
+
+// indexedHistory builds the history of the address from the address index, newest first
+func (c *Chain) indexedHistory(ctx context.Context, address string) (history []AddressTxn, err error) {
+	outputs, err := c.store.FindAddressOutputs(ctx, address)
+	if err != nil {
+		return history, err
+	}
+
+	entries := make(map[string]*AddressTxn)
+	entry := func(txnId string, height int32) *AddressTxn {
+		if e, ok := entries[txnId]; ok {
+			return e
+		}
+		entries[txnId] = &AddressTxn{TxnId: txnId, Height: height}
+		return entries[txnId]
+	}
+
+	for _, out := range outputs {
+		entry(out.TxnId, out.Height).Received += out.Value
+		if out.SpentBy != "" {
+			entry(out.SpentBy, out.SpentHeight).Sent += out.Value
+		}
+	}
+
+	// the index only knows heights, the height index gives the block hashes
+	hashes := make(map[int32]string)
+	for _, e := range entries {
+		if _, ok := hashes[e.Height]; !ok {
+			b, err := c.store.FindBlockByHeight(ctx, e.Height)
+			if err != nil {
+				return history, err
+			}
+			hashes[e.Height] = b.GetHash()
+		}
+		e.BlockHash = hashes[e.Height]
+		history = append(history, *e)
+	}
+
+	slices.SortFunc(history, func(a, b AddressTxn) int {
+		return cmp.Or(cmp.Compare(b.Height, a.Height), cmp.Compare(a.TxnId, b.TxnId))
+	})
+	return history, err
+}
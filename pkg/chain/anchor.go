@@ -0,0 +1,86 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+
+	"github.com/tdadadavid/block/pkg/block"
+)
+
+// Anchor is data a transaction of the chain carries in a data output (see transactions.NewDataOutput)
+type Anchor struct {
+	TxnId     string `json:"txid"`
+	Vout      int32  `json:"vout"`
+	BlockHash string `json:"block_hash"`
+	Height    int32  `json:"height"`
+
+	// Data is the hexadecimal data of the output
+	Data string `json:"data"`
+}
+
+// FindAnchors returns the data outputs of the chain whose data starts with the prefix
+//
+// Parameters
+//   - `prefix []byte`: The first bytes of the data, an empty prefix finds every anchor
+//
+// NOTE
+//   - Data outputs are never in the UTXO set, every block of the chain is read
+//   - A pruned node only finds the anchors of the blocks it kept, the error tells where it stopped
+//
+// Returns
+//   - `anchors []Anchor`: The anchors, newest first
+//   - `err error`: Any error that occurred while reading the store
+func (c *Chain) FindAnchors(ctx context.Context, prefix []byte) (anchors []Anchor, err error) {
+	iter := c.iter()
+	for iter.HasNext(ctx) {
+		anchors = append(anchors, blockAnchors(iter.Next(ctx), prefix)...)
+	}
+	if err = iter.Err(); err != nil {
+		return anchors, c.describePruned(ctx, err)
+	}
+	return anchors, nil
+}
+
+// GetAnchors returns the data outputs whose data starts with the prefix in a page of blocks walking backwards from
+// the given hash
+//
+// Parameters
+//   - `prefix []byte`: The first bytes of the data, an empty prefix finds every anchor
+//   - `from string`: The hash of the first block searched, the tip of the chain is used when it is empty
+//   - `limit int`: The maximum number of blocks searched
+//
+// NOTE
+//   - Unlike FindAnchors only the blocks of the page are read, a page can hold no anchor while older blocks do
+//
+// Returns
+//   - `anchors []Anchor`: The anchors of the page, newest first
+//   - `next string`: The hash to pass as `from` to search the next page, empty when the genesis block was searched
+//   - `err error`: Any error that occurred while reading the store
+func (c *Chain) GetAnchors(ctx context.Context, prefix []byte, from string, limit int) (anchors []Anchor, next string, err error) {
+	blocks, next, err := c.GetBlocks(ctx, from, limit)
+	for _, b := range blocks {
+		anchors = append(anchors, blockAnchors(b, prefix)...)
+	}
+	return anchors, next, err
+}
+
+// blockAnchors returns the data outputs of the block whose data starts with the prefix
+func blockAnchors(b *block.Block, prefix []byte) (anchors []Anchor) {
+	for _, txn := range b.GetTransaction() {
+		for vout, out := range txn.GetOutputs() {
+			data, ok := out.Data()
+			if !ok || !bytes.HasPrefix(data, prefix) {
+				continue
+			}
+			anchors = append(anchors, Anchor{
+				TxnId:     txn.GetId(),
+				Vout:      int32(vout),
+				BlockHash: b.GetHash(),
+				Height:    b.GetHeight(),
+				Data:      hex.EncodeToString(data),
+			})
+		}
+	}
+	return anchors
+}
@@ -0,0 +1,39 @@
+package chain
+
+import (
+	"context"
+	"io"
+
+	"github.com/tdadadavid/block/pkg/store"
+)
+
+// Backup writes a consistent snapshot of the chain, its indexes and its wallets to w while the chain keeps running
+//
+// Parameters
+//   - `wallets store.Storage`: The store the wallets are kept in (see wallet.Wallets.Store), nil leaves them out
+//
+// NOTE
+//   - New blocks wait until the snapshot is written, everything else carries on (see store.Store.Backup)
+//
+// Returns
+//   - `store.BackupHeader`: The chain id, tip hash and height the snapshot was taken at
+//   - `error`: Any error that occurred while writing the snapshot
+func (c *Chain) Backup(ctx context.Context, w io.Writer, wallets store.Storage) (store.BackupHeader, error) {
+	return c.store.Backup(ctx, w, wallets)
+}
+
+// Restore restores a snapshot written by Backup into the data directory of a chain
+//
+// Parameters
+//   - `r io.Reader`: The snapshot
+//   - `storagePath string`: The data directory, it must be empty unless force is set
+//   - `walletsPath string`: The wallet store the wallets of the snapshot are added to (see wallet.StorePath), empty
+//     leaves them out
+//   - `force bool`: Replaces whatever is in the data directory
+//
+// Returns
+//   - `store.BackupHeader`: The header of the restored snapshot
+//   - `error`: store.ErrNotEmpty, store.ErrBadBackup when the snapshot does not verify against its header
+func Restore(r io.Reader, storagePath string, walletsPath string, force bool) (store.BackupHeader, error) {
+	return store.Restore(r, storagePath, walletsPath, force)
+}
@@ -2,15 +2,30 @@ package chain
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/tdadadavid/block/pkg/store"
 	"log/slog"
+	"path/filepath"
+	"time"
 
 	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/events"
+	"github.com/tdadadavid/block/pkg/mempool"
+	"github.com/tdadadavid/block/pkg/params"
 	"github.com/tdadadavid/block/pkg/toolkit"
 	"github.com/tdadadavid/block/pkg/transactions"
 )
 
+var (
+	// ErrNoChain is returned when a chain is loaded from a store that holds none yet
+	ErrNoChain = errors.New("no chain exists yet")
+
+	// ErrChainExists is returned when a chain is created in a store that holds one already
+	ErrChainExists = errors.New("a chain exists already")
+)
+
 type Chain struct {
 	// store In memory database that stores the chain's data
 	store store.Storage
@@ -21,13 +36,38 @@ type Chain struct {
 	// chainCtx is the context for the chain, it is used to control the execution of the chain
 	chainCtx context.Context
 
+	// events publishes what happens on the chain to subscribers
+	events *events.Bus
+
+	// mempool holds the transactions waiting to be included in a block
+	mempool *mempool.Pool
+
+	// txIndex tells whether the transaction index is maintained
+	txIndex bool
+
+	// addrIndex tells whether the address index is maintained
+	addrIndex bool
+
+	// pruneDepth is the number of recent blocks whose bodies are kept, 0 keeps every block
+	pruneDepth int32
+
+	// params are the rules of the network the chain belongs to
+	params *params.Params
+
+	// clock stamps the blocks the chain mines
+	clock block.Clock
+
+	// openStore opens the store at the chain's storage path when no store was given with WithStore
+	openStore func(path string, opts ...store.Option) (store.Storage, error)
+
 	logger *slog.Logger
 }
 
 // New instantiates a new chain from the store
 //
 // Parameters:
-//   - `storagePath(string)`: The path to the in-memory storage
+//   - `storagePath(string)`: The path to the storage, unused when an option provides the store
+//   - `opts(...Option)`: The optional features of the chain
 //
 // Process:
 //   - Opens or creates the storage location
@@ -35,32 +75,146 @@ type Chain struct {
 //   - Assigns the currentHash of the chain to the LastHash on the block (in this case it will be the GenesisBlock)
 //
 // Notes:
-//   - If the store fails to open or create this function panics
+//   - If the store fails to open or create this function panics, Load returns the error instead
 //   - This is called for chains that already exists
 //
 // Returns:
 //   - `bc(Chain)`: The newly created chain
-func New(ctx context.Context, storagePath string) (bc Chain) {
-	s, err := store.Open(storagePath)
+func New(ctx context.Context, storagePath string, opts ...Option) (bc Chain) {
+	bc, err := Load(ctx, storagePath, opts...)
 	if err != nil {
 		panic(fmt.Errorf("failed to create chain %v", err))
 	}
+	return bc
+}
 
-	bc = Chain{
-		chainCtx: ctx,
-		store:    s,
-		logger:   slog.Default(),
+// Load opens the chain in the store like New and returns an error instead of panicking
+//
+// Returns
+//   - `bc Chain`: The chain, the caller closes it
+//   - `error`: ErrNoChain when the store holds no chain yet or any error that occurred while opening the store
+func Load(ctx context.Context, storagePath string, opts ...Option) (bc Chain, err error) {
+	if bc, err = newChain(ctx, storagePath, opts...); err != nil {
+		return bc, err
 	}
 
 	// get the last block's hash
-	hash, err := bc.getLastHash()
+	tip, err := bc.store.FindLastBlock(ctx)
+	if errors.Is(err, store.ErrNotFound) {
+		err = ErrNoChain
+	}
+	if err == nil {
+		bc.currentHash = tip.GetHash()
+		err = bc.syncIndexes(ctx)
+	}
 	if err != nil {
-		panic(fmt.Errorf("failed to created chain %s", err))
+		return bc, errors.Join(err, bc.Close())
 	}
+	return bc, nil
+}
 
-	bc.currentHash = hash
+// Open opens the chain in the store like New, a store without a chain starts from the genesis block of the network
+//
+// Parameters
+//   - `storagePath string`: The path to the storage, unused when an option provides the store
+//   - `opts ...Option`: The optional features of the chain, WithParams selects the network
+//
+// NOTE
+//   - The genesis block comes from the network parameters, every node of the network starts from the same block
+//
+// Returns
+//   - `bc Chain`: The chain, the caller closes it
+//   - `error`: Any error that occurred while opening the store or connecting the genesis block
+func Open(ctx context.Context, storagePath string, opts ...Option) (bc Chain, err error) {
+	if bc, err = newChain(ctx, storagePath, opts...); err != nil {
+		return bc, err
+	}
 
-	return bc
+	tip, err := bc.store.FindLastBlock(ctx)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		if tip, err = bc.params.GenesisBlock(); err == nil {
+			err = bc.connectGenesis(ctx, tip, bc.params.Genesis)
+		}
+	case err == nil:
+		bc.currentHash = tip.GetHash()
+		err = bc.syncIndexes(ctx)
+	}
+	if err != nil {
+		return bc, errors.Join(err, bc.Close())
+	}
+	return bc, nil
+}
+
+// Create creates a chain in an empty store from a genesis definition
+//
+// Parameters
+//   - `storagePath string`: The path to the storage, unused when an option provides the store
+//   - `genesis params.Genesis`: The addresses of the network that are paid, the coinbase message and the time of the
+//     genesis block. The message of the network and the time of the chain's clock are used when they are empty
+//   - `opts ...Option`: The optional features of the chain, WithParams selects the network
+//
+// NOTE
+//   - A definition with a timestamp always gives the same genesis block, so nodes that create a chain from the
+//     same definition (see params.LoadGenesis) can talk to each other
+//
+// Returns
+//   - `bc Chain`: The chain, the caller closes it
+//   - `error`: wallet.ErrInvalidAddress, params.ErrBadGenesis, ErrChainExists or any error that occurred while
+//     storing the genesis block
+func Create(ctx context.Context, storagePath string, genesis params.Genesis, opts ...Option) (bc Chain, err error) {
+	if bc, err = configure(ctx, opts...); err != nil {
+		return bc, err
+	}
+	if genesis.CoinbaseData == "" {
+		genesis.CoinbaseData = bc.params.Genesis.CoinbaseData
+	}
+	if genesis.Timestamp == 0 {
+		genesis.Timestamp = bc.clock().Unix()
+	}
+
+	// the genesis is checked and mined before anything is written
+	for _, address := range genesis.Addresses() {
+		if err = bc.checkAddress(address); err != nil {
+			return bc, fmt.Errorf("%s: %w", address, err)
+		}
+	}
+	b, err := genesis.Block(bc.params.BlockSubsidy(0), bc.params.Difficulty)
+	if err != nil {
+		return bc, err
+	}
+
+	if err = bc.open(storagePath); err != nil {
+		return bc, err
+	}
+	_, err = bc.store.FindLastBlock(ctx)
+	switch {
+	case err == nil:
+		err = ErrChainExists
+	case errors.Is(err, store.ErrNotFound):
+		err = bc.connectGenesis(ctx, b, genesis)
+	}
+	if err != nil {
+		return bc, errors.Join(err, bc.Close())
+	}
+	return bc, nil
+}
+
+// connectGenesis stores the genesis block and the definition it was built from and makes it the tip of the chain,
+// Verify rebuilds the genesis coinbase from the definition
+func (c *Chain) connectGenesis(ctx context.Context, genesis block.Block, definition params.Genesis) error {
+	data, err := json.Marshal(definition)
+	if err == nil {
+		err = c.store.SaveGenesis(ctx, data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store the genesis definition: %w", err)
+	}
+	if err = c.store.ConnectBlock(ctx, genesis, nil); err != nil {
+		return fmt.Errorf("failed to connect genesis block: %w", err)
+	}
+	c.currentHash = genesis.GetHash()
+	return c.syncIndexes(ctx)
 }
 
 // NewChain creates a new chain containing the coinbase transaction
@@ -69,49 +223,91 @@ func New(ctx context.Context, storagePath string) (bc Chain) {
 //   - `ctx context.Context`: The context that control execution
 //   - `name string`: The name of the blockchain. It is used when creating the store
 //   - `address string`: The address of the blockchain
+//   - `opts ...Option`: The optional features of the chain
 //
 // Process
 //   - The function tries to create a store if it fails then it panics
 //     if it doesn't then it creates a coinbase transaction using the address & the genesis block
-//     given and the coinbase data which is stored in the blockchain and in the 'LAST' position in the block
+//     given and the coinbase data which is connected as the tip of the chain
 //
 // Returns
 //   - `bc Chain`: The newly created chain
-func NewChain(ctx context.Context, name, address string) (bc Chain) {
-	s, err := store.Open(fmt.Sprintf("./data/%s/blocks", name))
+func NewChain(ctx context.Context, name, address string, opts ...Option) (bc Chain) {
+	// create the chain, every network keeps its chains in its own data directory
+	bc, err := configure(ctx, opts...)
+	if err == nil {
+		err = bc.open(filepath.Join(bc.params.DataDir("./data"), name, "blocks"))
+	}
 	if err != nil {
 		panic(fmt.Errorf("failed to create chain %v", err))
 	}
 
-	// create the chain
-	bc = Chain{
-		chainCtx: ctx,
-		store:    s,
-		logger:   slog.Default(),
+	// create coinbase transaction and genesis block
+	definition := params.Genesis{Timestamp: bc.clock().Unix(), CoinbaseData: bc.params.Genesis.CoinbaseData, Address: address}
+	genesis, err := definition.Block(bc.params.BlockSubsidy(0), bc.params.Difficulty)
+	if err != nil {
+		panic(fmt.Errorf("failed to create chain %v", err))
 	}
 
-	// create coinbase transaction and genesis block
-	cbtx := transactions.NewCoinbase(address, transactions.COINBASE_DATA)
-	genesis := block.NewGenesisBlock(*cbtx)
+	// store the genesis block and make it the tip of the chain
+	if err = bc.connectGenesis(ctx, genesis, definition); err != nil {
+		fmt.Printf("error while connecting genesis block %v", err)
+	}
+	return bc
+}
 
-	// store the genesis block in the store and in the 'LAST' position
-	err = bc.store.CreateBlock(ctx, genesis.GetHash(), genesis)
-	if err != nil {
-		fmt.Printf("error while creating new block %v", err)
-		return
+// newChain applies the options and opens the chain's store unless an option provided one
+func newChain(ctx context.Context, storagePath string, opts ...Option) (bc Chain, err error) {
+	if bc, err = configure(ctx, opts...); err != nil {
+		return bc, err
 	}
+	return bc, bc.open(storagePath)
+}
 
-	// update 'LAST' key in chain point to genesis block.
-	err = bc.store.UpdateLastBlock(bc.chainCtx, genesis)
-	if err != nil {
-		fmt.Println("error while updating last block")
-		return
+// configure creates a chain of mainnet and applies the options, the store is not opened yet
+func configure(ctx context.Context, opts ...Option) (bc Chain, err error) {
+	bus := events.NewBus()
+	bc = Chain{
+		chainCtx:  ctx,
+		events:    bus,
+		mempool:   mempool.New(bus),
+		params:    params.Mainnet,
+		clock:     time.Now,
+		openStore: store.Open,
+		logger:    slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(&bc)
+	}
+
+	if bc.pruneDepth != 0 && bc.pruneDepth < MinPruneDepth {
+		return bc, fmt.Errorf("prune depth %d is below the minimum of %d blocks", bc.pruneDepth, MinPruneDepth)
+	}
+	if bc.pruneDepth != 0 && (bc.txIndex || bc.addrIndex) {
+		return bc, ErrPrunedIndex
 	}
+	return bc, nil
+}
 
-	// update the chain with the last hash
-	bc.currentHash = genesis.GetHash()
+// open opens the chain's store at the storage path unless an option provided one
+func (c *Chain) open(storagePath string) (err error) {
+	if c.store == nil {
+		if c.store, err = c.openStore(storagePath); err != nil {
+			return err
+		}
+	}
+	c.store.SetIndexes(store.Indexes{Tx: c.txIndex, Addr: c.addrIndex})
+	return nil
+}
 
-	return bc
+// Params returns the parameters of the network the chain belongs to
+func (c *Chain) Params() *params.Params {
+	return c.params
+}
+
+// Close closes the chain's store, the chain can't be used afterwards
+func (c *Chain) Close() error {
+	return c.store.Close()
 }
 
 // FindUnspentTransactionsOutputs FindUnspentTransactions this get the total unspent transaction
@@ -120,54 +316,25 @@ func NewChain(ctx context.Context, name, address string) (bc Chain) {
 //   - `ctx context.Context`: the context that controls the execution
 //
 // Process
-//   - First it gets the unspent transactions for the user by going through every transaction (output) on each block
-//     checking if the user can unlock that transaction (spend it) its then stored in a map,
+//   - Reads every output of the UTXO set the store keeps in sync with the tip and groups them by transaction
 //
 // NOTE
 //   - unspent transactions are the outputs (vouts) while the inputs are the spent transactions
 //
 // Returns
+//   - `map[string]transactions.TxnOutputs`: The unspent outputs of every transaction, in output order
 func (c *Chain) FindUnspentTransactionsOutputs(ctx context.Context) map[string]transactions.TxnOutputs {
 	// tracks UTXO (unspent transaction outputs)
 	utxos := make(map[string]transactions.TxnOutputs)
 
-	// tracks the spent outputs for a transaction
-	spentUTXOs := make(map[string][]int)
-
-	iter := c.iter()
-
-	for iter.HasNext(ctx) {
-		curBlock := iter.Next(ctx)
-
-		// get transaction for block
-		for _, txn := range curBlock.GetTransaction() {
-
-		OutputLoop:
-			// get all outputs
-			for outIdx, out := range txn.GetOutputs() {
-				if spentUTXOs[txn.GetId()] != nil {
-					// check if this transaction is in the spent transaction outputs
-					for _, spentOutput := range spentUTXOs[txn.GetId()] {
-						// if the current output has been spent, goto the outer loop & skip this inner
-						if spentOutput == outIdx {
-							continue OutputLoop
-						}
-					}
-				}
-
-				// add the output to the map of unspent outputs
-				outs := utxos[txn.GetId()]
-				outs.Outputs = append(outs.Outputs, out)
-				utxos[txn.GetId()] = outs
-			}
-
-			if !txn.IsCoinbase() {
-				// get all inputs for this transaction and mark them spent
-				for _, in := range txn.GetInputs() {
-					spentUTXOs[in.TxnId] = append(spentUTXOs[in.TxnId], int(in.Output))
-				}
-			}
-		}
+	err := c.store.ForEachUTXO(ctx, func(utxo transactions.UTXO) error {
+		outs := utxos[utxo.TxnId]
+		outs.Outputs = append(outs.Outputs, utxo.TxnOutput)
+		utxos[utxo.TxnId] = outs
+		return nil
+	})
+	if err != nil {
+		c.logger.Error("failed to read the UTXO set", slog.Any("error", err))
 	}
 	return utxos
 }
@@ -178,35 +345,122 @@ func (c *Chain) FindUnspentTransactionsOutputs(ctx context.Context) map[string]t
 //   - data(string): The transactional data to be stored in the block
 //
 // Process:
-//   - finds the previous block (block in the "LAST" position)
+//   - finds the previous block (the tip of the chain)
+//   - Checks the inputs of the transaction unlock the outputs they spend, an invalid transaction is not mined
 //   - Creates new block with given data and previous block's hash
-//   - Updates the "LAST" key in the storage with the newly created block
+//   - Connects the block with the outputs it spends as undo data, the store writes the block,
+//     the tip and every index at once
 //   - Set the Chains hash to the new block's hash
+//   - Evicts the block's transactions from the mempool and publishes the block on the event bus
+//   - Prunes old block bodies when the chain runs in prune mode
+//
+// NOTE
+//   - The transaction is checked like SubmitTransaction does, a coinbase is refused
 func (c *Chain) AddBlock(data transactions.Transaction) {
+	if _, err := c.SubmitTransaction(c.chainCtx, data); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// mineBlock mines a block with the transaction on top of the tip and connects it (see AddBlock)
+//
+// NOTE
+//   - Only Generate mines coinbases, every other transaction must pass checkTransaction
+//   - A coinbase must pass checkCoinbase, the same check Verify runs, so it never pays more than the subsidy
+func (c *Chain) mineBlock(ctx context.Context, data transactions.Transaction) (newBlock block.Block, err error) {
 	// get previous block
-	prevBlock, err := c.store.FindLastBlock(c.chainCtx)
+	prevBlock, err := c.store.FindLastBlock(ctx)
 	if err != nil || toolkit.Ref(prevBlock) == nil {
-		fmt.Printf("error while finding previous block: %s\n", err)
-		return
+		return newBlock, fmt.Errorf("error while finding previous block: %w", err)
 	}
 
-	// creates new block with previous block hash
-	newBlock := block.New(data, prevBlock.GetHash(), block.HashDifficulty) // create new block
-	err = c.store.CreateBlock(c.chainCtx, newBlock.GetHash(), newBlock)
-	if err != nil {
-		fmt.Printf("error while creating new block %v", err)
-		return
+	// the transaction must unlock the outputs it spends before any work is spent mining it
+	height, timestamp := prevBlock.GetHeight()+1, c.clock().Unix()
+	if !data.IsCoinbase() {
+		if err = c.checkTransaction(ctx, data, height, timestamp); err != nil {
+			return newBlock, err
+		}
+	} else if err = data.CheckId(); err != nil {
+		return newBlock, fmt.Errorf("%w %s: %w", ErrInvalidTransaction, data.GetId(), err)
+	} else if err = c.checkCoinbase(data, height); err != nil {
+		return newBlock, fmt.Errorf("%w %s: %w", ErrInvalidTransaction, data.GetId(), err)
 	}
 
-	// update 'LAST' key in chain point to new block.
-	err = c.store.UpdateLastBlock(c.chainCtx, newBlock)
+	// creates new block with previous block hash, one level above the previous block
+	newBlock = block.NewAt(data, prevBlock.GetHash(), height, timestamp, c.params.Difficulty) // create new block
+
+	undo, err := c.undoData(ctx, newBlock)
 	if err != nil {
-		fmt.Println("error while updating last block")
-		return
+		return newBlock, fmt.Errorf("error while collecting undo data %w", err)
+	}
+	if err = c.store.ConnectBlock(ctx, newBlock, undo); err != nil {
+		return newBlock, fmt.Errorf("error while connecting new block %w", err)
 	}
 
 	// update the chain current-hash
 	c.currentHash = newBlock.GetHash()
+
+	c.blockConnected(&newBlock)
+	c.prune()
+	return newBlock, nil
+}
+
+// DisconnectTip removes the block at the tip of the chain
+//
+// Process:
+//   - Disconnects the block in the store, the tip moves back to the previous block, the UTXO set and
+//     every index are rolled back at once and the disconnected block stays in the storage
+//   - Returns the block's transactions (except the coinbase) to the mempool
+//   - Publishes the disconnected block on the event bus
+//
+// Returns:
+//   - `*block.Block`: The block that was disconnected
+//   - `error`: Any error that occurred, the genesis block can never be disconnected
+func (c *Chain) DisconnectTip() (*block.Block, error) {
+	tip, err := c.store.FindLastBlock(c.chainCtx)
+	if err != nil {
+		return nil, fmt.Errorf("error while finding tip: %w", err)
+	}
+	if tip.GetPrevBlockHash() == "" {
+		return nil, fmt.Errorf("cannot disconnect the genesis block")
+	}
+
+	if err = c.store.DisconnectBlock(c.chainCtx, tip); err != nil {
+		return nil, fmt.Errorf("error while disconnecting tip: %w", err)
+	}
+	c.currentHash = tip.GetPrevBlockHash()
+
+	c.blockDisconnected(&tip)
+
+	return &tip, nil
+}
+
+// undoData collects the outputs of the UTXO set the block spends
+//
+// NOTE
+//   - Outputs created by an earlier transaction of the same block are not in the set yet and are skipped,
+//     so are inputs that reference no known output
+func (c *Chain) undoData(ctx context.Context, b block.Block) (undo store.UndoData, err error) {
+	created := make(map[string]bool)
+	for _, txn := range b.GetTransaction() {
+		if !txn.IsCoinbase() {
+			for _, in := range txn.GetInputs() {
+				if created[in.TxnId] {
+					continue
+				}
+				utxo, err := c.store.FindUTXO(ctx, in.TxnId, in.Output)
+				if errors.Is(err, store.ErrNotFound) {
+					continue
+				}
+				if err != nil {
+					return undo, err
+				}
+				undo = append(undo, utxo)
+			}
+		}
+		created[txn.GetId()] = true
+	}
+	return undo, err
 }
 
 // GetAllBlocks retrieves all blocks from the chain store
@@ -218,7 +472,8 @@ func (c *Chain) AddBlock(data transactions.Transaction) {
 //
 // Returns:
 //   - `blocks []*block.Block`: a slice of blocks for this chain
-//   - `err error`: an error object
+//   - `err error`: an error object, it wraps store.ErrPruned when the walk reached pruned blocks,
+//     the blocks above the pruned ones are still returned
 func (c *Chain) GetAllBlocks() (blocks []*block.Block, err error) {
 	iter := c.iter()
 
@@ -230,6 +485,9 @@ func (c *Chain) GetAllBlocks() (blocks []*block.Block, err error) {
 		}
 		blocks = append(blocks, curBlock)
 	}
+	if err = iter.Err(); err != nil {
+		return blocks, c.describePruned(c.chainCtx, err)
+	}
 
 	// Reverse the blocks to get them in chronological order (oldest first)
 	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
@@ -253,18 +511,18 @@ func (c *Chain) iter() ChainIterator {
 	}
 }
 
-// getLastHash returns the hash of block as "LAST" position
+// getLastHash returns the hash of the block at the tip
 //
 // Process:
-//   - finds block at last position
+//   - finds block at the tip
 //
 // Returns:
-//   - The hash of the block at "LAST" position
+//   - The hash of the block at the tip
 func (c *Chain) getLastHash() (val string, err error) {
 	b, err := c.store.FindLastBlock(c.chainCtx)
 	if err != nil {
-		c.logger.Error("no block in LAST position", slog.Any("error", err))
-		err = fmt.Errorf("error retrieving LAST block %s", err)
+		c.logger.Error("no block at the tip", slog.Any("error", err))
+		err = fmt.Errorf("error retrieving tip block %s", err)
 		return val, err
 	}
 	val = b.GetHash()
@@ -1,39 +1,79 @@
 package chain
 
 import (
+	"bytes"
 	"context"
-	"os"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/events"
+	"github.com/tdadadavid/block/pkg/params"
+	"github.com/tdadadavid/block/pkg/script"
+	"github.com/tdadadavid/block/pkg/store"
 	"github.com/tdadadavid/block/pkg/transactions"
+	"github.com/tdadadavid/block/pkg/wallet"
 )
 
-func cleanUp(t *testing.T) {
+// newTestChain creates a chain in memory, it is closed when the test ends
+func newTestChain(t *testing.T, address string, opts ...Option) Chain {
+	t.Parallel()
+
+	bc := NewChain(context.Background(), "bitcoin", address, append(opts, WithInMemoryStore())...)
 	t.Cleanup(func() {
-		err := os.RemoveAll("./data")
-		if err != nil {
-			panic(err)
-		}
+		assert.NoError(t, bc.Close())
 	})
+	return bc
 }
 
-func TestBlockchain_NewChain(t *testing.T) {
-	defer cleanUp(t)
+// newWalletChain creates a chain in memory whose genesis pays a new wallet, see newTestChain
+func newWalletChain(t *testing.T, opts ...Option) (bc Chain, w *wallet.Wallet, address string) {
+	w, err := wallet.New()
+	assert.NoError(t, err)
+	encoded, err := w.GenAddress()
+	assert.NoError(t, err)
+	return newTestChain(t, string(encoded), opts...), w, string(encoded)
+}
+
+// signedSpend returns a transaction spending the first output of the transaction, signed by the wallet
+func signedSpend(t *testing.T, w *wallet.Wallet, from transactions.Transaction, outputs ...transactions.TxnOutput) transactions.Transaction {
+	txn := transactions.Transaction{
+		Inputs:  []transactions.TxnInput{{TxnId: from.GetId(), Output: 0}},
+		Outputs: outputs,
+	}
+	assert.NoError(t, w.SignInput(&txn, 0, from.GetOutputs()[0], params.Mainnet.Versions()))
+	txn.GenId()
+	return txn
+}
 
-	bc := NewChain(context.Background(), "bitcoin", "0x0000")
+func TestBlockchain_NewChain(t *testing.T) {
+	bc := newTestChain(t, "0x0000")
 	assert.NotNil(t, bc)
 }
 
 func TestBlockchain_AddBlock(t *testing.T) {
-	defer cleanUp(t)
-
 	// create blockchain with the coinbase (the initail coin release)
-	bc := NewChain(context.Background(), "bitcoin", "0x000")
+	bc, w, address := newWalletChain(t)
 	assert.NotNil(t, bc)
+	genesis, err := bc.FindLast()
+	assert.NoError(t, err)
 
-	// add block
+	// a transaction spending nothing is not mined
 	bc.AddBlock(transactions.Transaction{})
+	tip, err := bc.FindLast()
+	assert.NoError(t, err)
+	assert.Equal(t, genesis.GetHash(), tip.GetHash())
+
+	// add block
+	bc.AddBlock(signedSpend(t, w, genesis.GetTransaction()[0], transactions.TxnOutput{Value: 100, ScriptPubKey: address}))
+	tip, err = bc.FindLast()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), tip.GetHeight())
 
 	// get prevHash
 	prevHash, _ := bc.getLastHash()
@@ -49,3 +89,887 @@ func TestBlockchain_AddBlock(t *testing.T) {
 		assert.NotEmpty(t, it.GetTransaction())
 	}
 }
+
+func TestBlockchain_Events(t *testing.T) {
+	bc, w, _ := newWalletChain(t)
+	genesis, err := bc.FindLast()
+	assert.NoError(t, err)
+	sub := bc.Events().Subscribe(nil, nil, 0)
+	defer sub.Close()
+
+	txn := signedSpend(t, w, genesis.GetTransaction()[0], transactions.TxnOutput{Value: 10, ScriptPubKey: "bob"})
+	assert.NoError(t, bc.Mempool().Add(txn))
+	bc.AddBlock(txn)
+	assert.Equal(t, 0, bc.Mempool().Len())
+
+	disconnected, err := bc.DisconnectTip()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), disconnected.GetHeight())
+	assert.Equal(t, 1, bc.Mempool().Len())
+
+	_, err = bc.DisconnectTip()
+	assert.Error(t, err)
+
+	var topics []events.Topic
+	for len(sub.Events()) > 0 {
+		topics = append(topics, (<-sub.Events()).Topic)
+	}
+	assert.Equal(t, []events.Topic{
+		events.TxnAccepted, events.BlockConnected, events.AddressReceived,
+		events.TxnAccepted, events.BlockDisconnected,
+	}, topics)
+}
+
+func TestBlockchain_GetBlockByHeight(t *testing.T) {
+	bc, _, address := newWalletChain(t)
+	ctx := context.Background()
+	_, err := bc.Generate(ctx, 2, address)
+	assert.NoError(t, err)
+
+	for height := int32(0); height <= 2; height++ {
+		b, err := bc.GetBlockByHeight(ctx, height)
+		assert.NoError(t, err)
+		assert.Equal(t, height, b.GetHeight())
+	}
+
+	blocks, err := bc.GetBlockRange(ctx, 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, blocks, 2)
+	assert.Equal(t, blocks[0].GetHash(), blocks[1].GetPrevBlockHash())
+
+	_, err = bc.DisconnectTip()
+	assert.NoError(t, err)
+	_, err = bc.GetBlockByHeight(ctx, 2)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestBlockchain_FindTransaction(t *testing.T) {
+	ctx := context.Background()
+	bc, _, address := newWalletChain(t, WithTxIndex(true))
+	blocks, err := bc.Generate(ctx, 2, address)
+	assert.NoError(t, err)
+	tx1, tx2 := blocks[0].GetTransaction()[0].GetId(), blocks[1].GetTransaction()[0].GetId()
+
+	lookup, err := bc.FindTransaction(ctx, tx1)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), lookup.Height)
+	assert.Equal(t, int32(2), lookup.Confirmations)
+	assert.Equal(t, tx1, lookup.Txn.GetId())
+
+	_, err = bc.DisconnectTip()
+	assert.NoError(t, err)
+	_, err = bc.FindTransaction(ctx, tx2)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	// the scan without the index finds the same transaction
+	bc.txIndex = false
+	bc.store.SetIndexes(store.Indexes{})
+	scanned, err := bc.FindTransaction(ctx, tx1)
+	assert.NoError(t, err)
+	assert.Equal(t, lookup.BlockHash, scanned.BlockHash)
+	assert.Equal(t, int32(1), scanned.Confirmations)
+
+	// blocks added while the index is disabled are picked up by a reindex
+	blocks, err = bc.Generate(ctx, 1, address)
+	assert.NoError(t, err)
+	tx3 := blocks[0].GetTransaction()[0].GetId()
+	bc.txIndex = true
+	bc.store.SetIndexes(store.Indexes{Tx: true})
+	_, err = bc.FindTransaction(ctx, tx3)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	assert.NoError(t, bc.Reindex(ctx))
+	_, err = bc.FindTransaction(ctx, tx3)
+	assert.NoError(t, err)
+}
+
+func TestBlockchain_AddrIndex(t *testing.T) {
+	ctx := context.Background()
+	w, err := wallet.New()
+	assert.NoError(t, err)
+	address, err := w.GenAddress()
+	assert.NoError(t, err)
+
+	bc := newTestChain(t, string(address), WithAddrIndex(true))
+	genesis, err := bc.GetBlockByHeight(ctx, 0)
+	assert.NoError(t, err)
+	coinbase := genesis.GetTransaction()[0]
+
+	spend := transactions.Transaction{
+		Inputs:  []transactions.TxnInput{{TxnId: coinbase.GetId(), Output: 0}},
+		Outputs: []transactions.TxnOutput{{Value: 60, ScriptPubKey: "bob"}, {Value: 40, ScriptPubKey: string(address)}},
+	}
+	assert.NoError(t, w.SignInput(&spend, 0, coinbase.GetOutputs()[0], params.Mainnet.Versions()))
+	spend.GenId()
+	bc.AddBlock(spend)
+
+	// the index must agree with a walk of the chain
+	indexedHistory, err := bc.AddressHistory(ctx, string(address))
+	assert.NoError(t, err)
+	indexedUTXOs, err := bc.FindUTXOs(ctx, string(address))
+	assert.NoError(t, err)
+
+	bc.addrIndex = false
+	scannedHistory, err := bc.AddressHistory(ctx, string(address))
+	assert.NoError(t, err)
+	scannedUTXOs, err := bc.FindUTXOs(ctx, string(address))
+	assert.NoError(t, err)
+	bc.addrIndex = true
+
+	assert.Equal(t, scannedHistory, indexedHistory)
+	assert.Equal(t, scannedUTXOs, indexedUTXOs)
+	assert.Len(t, indexedHistory, 2)
+	assert.Equal(t, int64(100), indexedHistory[0].Sent)
+
+	balance, err := bc.GetBalance(ctx, string(address))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(40), balance)
+
+	// disconnecting the block gives the coinbase back
+	_, err = bc.DisconnectTip()
+	assert.NoError(t, err)
+	balance, err = bc.GetBalance(ctx, string(address))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), balance)
+	bobBalance, err := bc.GetBalance(ctx, "bob")
+	assert.NoError(t, err)
+	assert.Zero(t, bobBalance)
+}
+
+func TestBlockchain_Prune(t *testing.T) {
+	s, err := store.OpenInMemory(store.WithMaxBlockFileSize(300))
+	assert.NoError(t, err)
+	bc, _, address := newWalletChain(t, WithStore(s))
+	ctx := context.Background()
+	_, err = bc.Generate(ctx, 5, address)
+	assert.NoError(t, err)
+
+	report, err := bc.Verify(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, report.Blocks)
+	assert.Equal(t, 6, report.UTXOs)
+
+	// the chain option refuses depths a reorg could reach, the store is pruned directly to keep the test short
+	assert.Panics(t, func() { NewChain(ctx, "bitcoin", "alice", WithInMemoryStore(), WithPrune(2)) })
+	pruneHeight, err := bc.store.Prune(ctx, 2)
+	assert.NoError(t, err)
+	assert.Greater(t, pruneHeight, int32(0))
+
+	// walks over the chain report the pruned blocks instead of stopping silently
+	blocks, err := bc.GetAllBlocks()
+	assert.ErrorIs(t, err, store.ErrPruned)
+	assert.ErrorContains(t, err, fmt.Sprintf("below height %d", pruneHeight))
+	assert.Len(t, blocks, int(6-pruneHeight))
+
+	report, err = bc.Verify(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, pruneHeight, report.PrunedBelow)
+	assert.Equal(t, 6, report.Headers)
+	assert.Equal(t, int(6-pruneHeight), report.Blocks)
+	assert.Zero(t, report.UTXOs)
+
+	// balances come from the UTXO set and survive pruning
+	balance, err := bc.GetBalance(ctx, address)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(600), balance)
+
+	// the indexes are built from every body, they are refused instead of failing on the first pruned one
+	assert.ErrorIs(t, bc.Reindex(ctx), ErrPrunedIndex)
+	_, err = Open(ctx, "", WithInMemoryStore(), WithPrune(MinPruneDepth), WithTxIndex(true))
+	assert.ErrorIs(t, err, ErrPrunedIndex)
+}
+
+func TestBlockchain_VerifyRecomputesHashes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	w, err := wallet.New()
+	assert.NoError(t, err)
+	address, err := w.GenAddressFor(params.Regtest.AddressVersion)
+	assert.NoError(t, err)
+	bc := openRegtest(t)
+	blocks, err := bc.Generate(ctx, 3, string(address))
+	assert.NoError(t, err)
+	_, err = bc.Verify(ctx)
+	assert.NoError(t, err)
+
+	// a body rewritten under the hash of the block keeps its header valid, its hash no longer matches its content
+	forged := blocks[1]
+	coinbase := forged.GetTransaction()[0]
+	coinbase.Outputs = []transactions.TxnOutput{{Value: coinbase.GetOutputs()[0].Value, ScriptPubKey: "mallory"}}
+	forged.Transactions = []transactions.Transaction{coinbase}
+	assert.NoError(t, bc.store.CreateBlock(ctx, forged.GetHash(), forged))
+	_, err = bc.Verify(ctx)
+	assert.ErrorIs(t, err, block.ErrBadHash)
+}
+
+func TestBlockchain_UTXOSnapshot(t *testing.T) {
+	bc, _, address := newWalletChain(t)
+	ctx := context.Background()
+	_, err := bc.Generate(ctx, 5, address)
+	assert.NoError(t, err)
+
+	var snapshot bytes.Buffer
+	header, err := bc.DumpUTXOs(ctx, &snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5), header.Height)
+
+	// a snapshot nobody vouched for is refused
+	_, _, err = LoadUTXOSnapshot(ctx, "", bytes.NewReader(snapshot.Bytes()), "", WithInMemoryStore())
+	assert.ErrorIs(t, err, ErrUnknownSnapshot)
+
+	loaded, got, err := LoadUTXOSnapshot(ctx, "", bytes.NewReader(snapshot.Bytes()), header.Hash, WithInMemoryStore())
+	assert.NoError(t, err)
+	defer loaded.Close()
+	assert.Equal(t, header, got)
+
+	// the loaded chain works from the snapshot right away
+	balance, err := loaded.GetBalance(ctx, address)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(600), balance)
+	pending, err := loaded.SnapshotPending(ctx)
+	assert.NoError(t, err)
+	assert.True(t, pending)
+	_, err = loaded.GetBlockByHeight(ctx, 0)
+	assert.ErrorIs(t, err, store.ErrPruned)
+
+	// a source serving another chain is caught by the headers
+	other := NewChain(ctx, "bitcoin", "mallory", WithInMemoryStore())
+	defer other.Close()
+	assert.Error(t, loaded.ValidateSnapshot(ctx, other.GetBlockByHeight))
+	pending, err = loaded.SnapshotPending(ctx)
+	assert.NoError(t, err)
+	assert.True(t, pending)
+
+	// so is a source swapping the transactions of a block under its header, and nothing it served is stored
+	forging := func(ctx context.Context, height int32) (*block.Block, error) {
+		b, err := bc.GetBlockByHeight(ctx, height)
+		if err == nil && height == 3 {
+			forged := b.GetTransaction()[0]
+			forged.Outputs = []transactions.TxnOutput{{Value: forged.Outputs[0].Value, ScriptPubKey: "mallory"}}
+			b.Transactions = []transactions.Transaction{forged}
+		}
+		return b, err
+	}
+	assert.ErrorIs(t, loaded.ValidateSnapshot(ctx, forging), block.ErrBadHash)
+	pending, err = loaded.SnapshotPending(ctx)
+	assert.NoError(t, err)
+	assert.True(t, pending)
+	_, err = loaded.GetBlockByHeight(ctx, 0)
+	assert.ErrorIs(t, err, store.ErrPruned)
+
+	assert.NoError(t, loaded.ValidateSnapshot(ctx, bc.GetBlockByHeight))
+	pending, err = loaded.SnapshotPending(ctx)
+	assert.NoError(t, err)
+	assert.False(t, pending)
+	report, err := loaded.Verify(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, report.Blocks)
+	assert.Equal(t, 6, report.UTXOs)
+}
+
+func TestBlockchain_CreateAndLoad(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := t.TempDir()
+
+	_, err := Load(ctx, path)
+	assert.ErrorIs(t, err, ErrNoChain)
+
+	w, err := wallet.New()
+	assert.NoError(t, err)
+	address, err := w.GenAddress()
+	assert.NoError(t, err)
+
+	_, err = Create(ctx, path, params.Genesis{Address: "alice"})
+	assert.ErrorIs(t, err, wallet.ErrInvalidAddress)
+
+	genesis := params.Genesis{Address: string(address), CoinbaseData: "hello", Timestamp: 1700000000}
+	bc, err := Create(ctx, path, genesis)
+	assert.NoError(t, err)
+	created, err := bc.FindLast()
+	assert.NoError(t, err)
+	assert.Equal(t, genesis.Timestamp, created.GetTimestamp())
+	assert.Equal(t, "hello", created.GetTransaction()[0].Inputs[0].ScriptSignature)
+	assert.NoError(t, bc.Close())
+
+	// the same genesis gives the same block
+	again, err := genesis.Block(params.Mainnet.BlockSubsidy(0), params.Mainnet.Difficulty)
+	assert.NoError(t, err)
+	assert.Equal(t, again.GetHash(), created.GetHash())
+
+	_, err = Create(ctx, path, genesis)
+	assert.ErrorIs(t, err, ErrChainExists)
+
+	bc, err = Load(ctx, path)
+	assert.NoError(t, err)
+	defer bc.Close()
+	balance, err := bc.GetBalance(ctx, string(address))
+	assert.NoError(t, err)
+	assert.Equal(t, params.Mainnet.BlockSubsidy(0), balance)
+}
+
+func TestBlockchain_GenesisAllocations(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var genesis params.Genesis
+	genesis.Timestamp = params.Regtest.Genesis.Timestamp
+	for i := range 3 {
+		w, err := wallet.New()
+		assert.NoError(t, err)
+		address, err := w.GenAddressFor(params.Regtest.AddressVersion)
+		assert.NoError(t, err)
+		genesis.Allocations = append(genesis.Allocations, params.Allocation{Address: string(address), Amount: int64(1000 * (i + 1))})
+	}
+
+	bc, err := Create(ctx, "", genesis, WithParams(params.Regtest), WithInMemoryStore())
+	assert.NoError(t, err)
+	defer bc.Close()
+
+	// the allocations are spendable from height zero
+	coinbase := bc.FindUnspentTransactionsOutputs(ctx)
+	assert.Len(t, coinbase, 1)
+	for _, outs := range coinbase {
+		assert.Len(t, outs.Outputs, 3)
+	}
+	for _, allocation := range genesis.Allocations {
+		balance, err := bc.GetBalance(ctx, allocation.Address)
+		assert.NoError(t, err)
+		assert.Equal(t, allocation.Amount, balance)
+	}
+
+	_, err = bc.Generate(ctx, 2, genesis.Allocations[0].Address)
+	assert.NoError(t, err)
+	report, err := bc.Verify(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6000), report.Allocated)
+	assert.Equal(t, 5, report.UTXOs)
+
+	// only the genesis block allocates, a coinbase can't be submitted and one written to the store is caught
+	late := transactions.NewAllocation("late", []transactions.TxnOutput{{Value: 1, ScriptPubKey: "mallory"}, {Value: 1, ScriptPubKey: "eve"}})
+	late.GenId()
+	_, err = bc.SubmitTransaction(ctx, *late)
+	assert.ErrorIs(t, err, ErrCoinbase)
+	tip, err := bc.FindLast()
+	assert.NoError(t, err)
+
+	// mining checks coinbases like Verify does, neither an allocation nor more than the subsidy is connected
+	_, err = bc.mineBlock(ctx, *late)
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+	assert.ErrorContains(t, err, "pays more than the subsidy")
+	greedy := transactions.NewCoinbase(genesis.Allocations[0].Address, "greedy", params.Regtest.BlockSubsidy(tip.GetHeight()+1)+1)
+	_, err = bc.mineBlock(ctx, *greedy)
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+	after, err := bc.FindLast()
+	assert.NoError(t, err)
+	assert.Equal(t, tip.GetHash(), after.GetHash())
+
+	forged := block.NewAt(*late, tip.GetHash(), tip.GetHeight()+1, tip.GetTimestamp()+1, params.Regtest.Difficulty)
+	assert.NoError(t, bc.store.ConnectBlock(ctx, forged, nil))
+	_, err = bc.Verify(ctx)
+	assert.ErrorContains(t, err, "pays more than the subsidy")
+
+	// an allocation must pay something
+	genesis.Allocations = append(genesis.Allocations, params.Allocation{Address: genesis.Allocations[0].Address})
+	_, err = Create(ctx, "", genesis, WithParams(params.Regtest), WithInMemoryStore())
+	assert.ErrorIs(t, err, params.ErrBadGenesis)
+}
+
+func TestBlockchain_VerifyGenesisCoinbase(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	w, err := wallet.New()
+	assert.NoError(t, err)
+	address, err := w.GenAddressFor(params.Regtest.AddressVersion)
+	assert.NoError(t, err)
+	genesis := params.Genesis{Timestamp: 1, Allocations: []params.Allocation{{Address: string(address), Amount: 1000}}}
+
+	// the definition is stored with the chain, it is verified once the chain is opened again
+	path := filepath.Join(t.TempDir(), "blocks")
+	bc, err := Create(ctx, path, genesis, WithParams(params.Regtest))
+	assert.NoError(t, err)
+	assert.NoError(t, bc.Close())
+	bc, err = Open(ctx, path, WithParams(params.Regtest))
+	assert.NoError(t, err)
+	report, err := bc.Verify(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), report.Allocated)
+	assert.NoError(t, bc.Close())
+
+	// genesis blocks whose coinbase is not the one of the stored definition
+	forge := func(t *testing.T, outputs []transactions.TxnOutput, definition params.Genesis) error {
+		s, err := store.OpenInMemory()
+		assert.NoError(t, err)
+		coinbase := transactions.NewAllocation("block regtest genesis", outputs)
+		coinbase.GenId()
+		forged := block.NewGenesisBlockAt(*coinbase, definition.Timestamp, params.Regtest.Difficulty)
+		data, err := json.Marshal(definition)
+		assert.NoError(t, err)
+		assert.NoError(t, s.SaveGenesis(ctx, data))
+		assert.NoError(t, s.ConnectBlock(ctx, forged, nil))
+
+		bc, err := Open(ctx, "", WithParams(params.Regtest), WithStore(s))
+		assert.NoError(t, err)
+		defer bc.Close()
+		_, err = bc.Verify(ctx)
+		return err
+	}
+	definition := genesis
+	definition.CoinbaseData = "block regtest genesis"
+	err = forge(t, []transactions.TxnOutput{{Value: 5000, ScriptPubKey: string(address)}}, definition)
+	assert.ErrorContains(t, err, "its definition 1000")
+	err = forge(t, []transactions.TxnOutput{{Value: 1000, ScriptPubKey: string(address)}, {Value: 1, ScriptPubKey: string(address)}}, definition)
+	assert.ErrorContains(t, err, "has 2 outputs, its definition 1")
+	err = forge(t, []transactions.TxnOutput{{Value: 1000, ScriptPubKey: string(address)}}, definition)
+	assert.NoError(t, err)
+
+	// outputs must pay an address and must not overflow, whatever the definition
+	err = forge(t, []transactions.TxnOutput{{Value: 1000, ScriptPubKey: "mallory"}}, definition)
+	assert.ErrorIs(t, err, wallet.ErrInvalidAddress)
+	err = forge(t, []transactions.TxnOutput{{Value: math.MaxInt64, ScriptPubKey: string(address)}, {Value: 1, ScriptPubKey: string(address)}}, definition)
+	assert.ErrorIs(t, err, transactions.ErrInvalidValue)
+}
+
+func TestBlockchain_ScriptValidation(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	alice, err := wallet.New()
+	assert.NoError(t, err)
+	address, err := alice.GenAddressFor(params.Regtest.AddressVersion)
+	assert.NoError(t, err)
+	mallory, err := wallet.New()
+	assert.NoError(t, err)
+
+	bc := openRegtest(t)
+	blocks, err := bc.Generate(ctx, 1, string(address))
+	assert.NoError(t, err)
+	coinbase := blocks[0].GetTransaction()[0]
+	spent := coinbase.GetOutputs()[0]
+
+	newSpend := func() transactions.Transaction {
+		return transactions.Transaction{
+			Inputs:  []transactions.TxnInput{{TxnId: coinbase.GetId(), Output: 0}},
+			Outputs: []transactions.TxnOutput{{Value: spent.Value, ScriptPubKey: "bob"}},
+		}
+	}
+
+	// without a signature, with the wrong key or once the outputs changed the spend is rejected
+	unsigned := newSpend()
+	unsigned.GenId()
+	assert.ErrorIs(t, bc.AcceptTransaction(ctx, unsigned), ErrInvalidTransaction)
+	assert.ErrorIs(t, mallory.SignInput(&unsigned, 0, spent, params.Regtest.Versions()), wallet.ErrNotOwner)
+
+	tampered := newSpend()
+	assert.NoError(t, alice.SignInput(&tampered, 0, spent, params.Regtest.Versions()))
+	tampered.Outputs[0].ScriptPubKey = "mallory"
+	tampered.GenId()
+	assert.ErrorIs(t, bc.AcceptTransaction(ctx, tampered), ErrInvalidTransaction)
+	_, err = bc.mineBlock(ctx, tampered)
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+
+	signed := newSpend()
+	assert.NoError(t, alice.SignInput(&signed, 0, spent, params.Regtest.Versions()))
+	signed.GenId()
+	assert.NoError(t, bc.AcceptTransaction(ctx, signed))
+	_, err = bc.mineBlock(ctx, signed)
+	assert.NoError(t, err)
+
+	balance, err := bc.GetBalance(ctx, "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, spent.Value, balance)
+	assert.Equal(t, 0, bc.Mempool().Len())
+}
+
+func TestBlockchain_RejectedSpends(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	versions := params.Regtest.Versions()
+	alice, err := wallet.New()
+	assert.NoError(t, err)
+	address, err := alice.GenAddressFor(params.Regtest.AddressVersion)
+	assert.NoError(t, err)
+	bc := openRegtest(t)
+	blocks, err := bc.Generate(ctx, 2, string(address))
+	assert.NoError(t, err)
+	first, second := blocks[0].GetTransaction()[0], blocks[1].GetTransaction()[0]
+
+	// spend signs every input of a transaction spending the outputs of alice
+	spend := func(inputs []transactions.TxnInput, spent []transactions.TxnOutput, outputs ...transactions.TxnOutput) transactions.Transaction {
+		txn := transactions.Transaction{Inputs: inputs, Outputs: outputs}
+		for index := range inputs {
+			assert.NoError(t, alice.SignInput(&txn, index, spent[index], versions))
+		}
+		txn.GenId()
+		return txn
+	}
+	rejected := func(txn transactions.Transaction, reason error) {
+		t.Helper()
+		assert.ErrorIs(t, bc.AcceptTransaction(ctx, txn), reason)
+		_, err := bc.SubmitTransaction(ctx, txn)
+		assert.ErrorIs(t, err, ErrInvalidTransaction)
+		assert.ErrorIs(t, err, reason)
+	}
+	firstIn := []transactions.TxnInput{{TxnId: first.GetId(), Output: 0}}
+	firstOut := first.GetOutputs()
+
+	// the outputs pay at most what the inputs are worth, never a negative value
+	rejected(spend(firstIn, firstOut, transactions.TxnOutput{Value: 101, ScriptPubKey: "bob"}), transactions.ErrInvalidValue)
+	rejected(spend(firstIn, firstOut,
+		transactions.TxnOutput{Value: 200, ScriptPubKey: "bob"}, transactions.TxnOutput{Value: -100, ScriptPubKey: "bob"},
+	), transactions.ErrInvalidValue)
+
+	// an output is spent once, in a transaction and across transactions
+	twice := []transactions.TxnInput{firstIn[0], firstIn[0]}
+	rejected(spend(twice, []transactions.TxnOutput{firstOut[0], firstOut[0]}, transactions.TxnOutput{Value: 200, ScriptPubKey: "bob"}), transactions.ErrDuplicateInput)
+	paid := spend(firstIn, firstOut, transactions.TxnOutput{Value: 60, ScriptPubKey: "bob"})
+	_, err = bc.SubmitTransaction(ctx, paid)
+	assert.NoError(t, err)
+	rejected(paid, ErrMissingOutput)
+	again := transactions.Transaction{Inputs: firstIn, Outputs: []transactions.TxnOutput{{Value: 100, ScriptPubKey: "mallory"}}}
+	again.GenId()
+	rejected(again, ErrMissingOutput)
+
+	// outputs that never existed and transactions spending nothing create nothing
+	madeUp := transactions.Transaction{
+		Inputs:  []transactions.TxnInput{{TxnId: "nope", Output: 7}},
+		Outputs: []transactions.TxnOutput{{Value: 6_000_000, ScriptPubKey: "mallory"}},
+	}
+	madeUp.GenId()
+	rejected(madeUp, ErrMissingOutput)
+	fromNothing := transactions.Transaction{Outputs: []transactions.TxnOutput{{Value: 6_000_000, ScriptPubKey: "mallory"}}}
+	fromNothing.GenId()
+	rejected(fromNothing, transactions.ErrNoInputs)
+
+	// only Generate mines coinbases
+	coinbase := transactions.NewCoinbase("mallory", "free coins", 6_000_000)
+	coinbase.GenId()
+	rejected(*coinbase, ErrCoinbase)
+
+	balance, err := bc.GetBalance(ctx, "mallory")
+	assert.NoError(t, err)
+	assert.Zero(t, balance)
+	balance, err = bc.GetBalance(ctx, string(address))
+	assert.NoError(t, err)
+	assert.Equal(t, second.GetOutputs()[0].Value, balance)
+	_, err = bc.Verify(ctx)
+	assert.NoError(t, err)
+}
+
+func TestBlockchain_SpoofedId(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	versions := params.Regtest.Versions()
+	addressOf := func(w *wallet.Wallet) string {
+		address, err := w.GenAddressFor(params.Regtest.AddressVersion)
+		assert.NoError(t, err)
+		return string(address)
+	}
+	alice, err := wallet.New()
+	assert.NoError(t, err)
+	mallory, err := wallet.New()
+	assert.NoError(t, err)
+	bc := openRegtest(t)
+	victim, err := bc.Generate(ctx, 1, addressOf(alice))
+	assert.NoError(t, err)
+	own, err := bc.Generate(ctx, 1, addressOf(mallory))
+	assert.NoError(t, err)
+	stolen := victim[0].GetTransaction()[0]
+
+	// mallory signs a spend of her own output and claims the id of alice's coinbase, its outputs would replace alice's
+	coinbase := own[0].GetTransaction()[0]
+	spoofed := transactions.Transaction{
+		Inputs:  []transactions.TxnInput{{TxnId: coinbase.GetId(), Output: 0}},
+		Outputs: []transactions.TxnOutput{{Value: coinbase.GetOutputs()[0].Value, ScriptPubKey: addressOf(mallory)}},
+	}
+	assert.NoError(t, mallory.SignInput(&spoofed, 0, coinbase.GetOutputs()[0], versions))
+	spoofed.Id = stolen.GetId()
+	assert.ErrorIs(t, bc.AcceptTransaction(ctx, spoofed), transactions.ErrInvalidId)
+	_, err = bc.SubmitTransaction(ctx, spoofed)
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+	assert.ErrorIs(t, err, transactions.ErrInvalidId)
+	spoofed.Id = ""
+	_, err = bc.SubmitTransaction(ctx, spoofed)
+	assert.ErrorIs(t, err, transactions.ErrInvalidId)
+
+	utxo, err := bc.FindUTXO(ctx, stolen.GetId(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, stolen.GetOutputs()[0], utxo.TxnOutput)
+	_, err = bc.FindUTXO(ctx, coinbase.GetId(), 0)
+	assert.NoError(t, err)
+
+	// a coinbase claiming another id is not mined either
+	forged := transactions.NewCoinbase(addressOf(mallory), "forged", params.Regtest.BlockSubsidy(3))
+	forged.Id = stolen.GetId()
+	_, err = bc.mineBlock(ctx, *forged)
+	assert.ErrorIs(t, err, transactions.ErrInvalidId)
+}
+
+func TestBlockchain_Multisig(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	versions := params.Regtest.Versions()
+	var signers []*wallet.Wallet
+	var pubKeys [][]byte
+	for range 3 {
+		w, err := wallet.New()
+		assert.NoError(t, err)
+		signers = append(signers, w)
+		pubKeys = append(pubKeys, w.GetPublicKey())
+	}
+	multisig, err := script.MultiSig(2, pubKeys)
+	assert.NoError(t, err)
+
+	// a P2PKH output funds the multisig
+	owner, err := wallet.New()
+	assert.NoError(t, err)
+	address, err := owner.GenAddressFor(params.Regtest.AddressVersion)
+	assert.NoError(t, err)
+	bc := openRegtest(t)
+	blocks, err := bc.Generate(ctx, 1, string(address))
+	assert.NoError(t, err)
+	coinbase := blocks[0].GetTransaction()[0]
+
+	fund := transactions.Transaction{
+		Inputs:  []transactions.TxnInput{{TxnId: coinbase.GetId(), Output: 0}},
+		Outputs: []transactions.TxnOutput{{Value: 100, ScriptPubKey: multisig.Hex()}},
+	}
+	assert.NoError(t, owner.SignInput(&fund, 0, coinbase.GetOutputs()[0], versions))
+	fund.GenId()
+	_, err = bc.SubmitTransaction(ctx, fund)
+	assert.NoError(t, err)
+
+	// every signer signs its own copy, the copies are combined
+	spend := transactions.Transaction{
+		Inputs:  []transactions.TxnInput{{TxnId: fund.GetId(), Output: 0}},
+		Outputs: []transactions.TxnOutput{{Value: 100, ScriptPubKey: "treasury"}},
+	}
+	first, err := transactions.NewPartial(spend, fund.GetOutputs())
+	assert.NoError(t, err)
+	second, err := transactions.NewPartial(spend, fund.GetOutputs())
+	assert.NoError(t, err)
+
+	signed, err := signers[2].SignPartial(first, versions)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, signed)
+	signed, err = owner.SignPartial(second, versions)
+	assert.NoError(t, err)
+	assert.Zero(t, signed)
+
+	_, err = first.Finalize(versions)
+	assert.ErrorIs(t, err, transactions.ErrIncomplete)
+
+	_, err = signers[0].SignPartial(second, versions)
+	assert.NoError(t, err)
+	assert.NoError(t, first.Combine(*second, versions))
+	txn, err := first.Finalize(versions)
+	assert.NoError(t, err)
+
+	// the signatures don't cover another transaction
+	forged := txn
+	forged.Outputs = []transactions.TxnOutput{{Value: 100, ScriptPubKey: "mallory"}}
+	forged.GenId()
+	_, err = bc.SubmitTransaction(ctx, forged)
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+
+	_, err = bc.SubmitTransaction(ctx, txn)
+	assert.NoError(t, err)
+	balance, err := bc.GetBalance(ctx, "treasury")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), balance)
+}
+
+func TestBlockchain_ScriptHash(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	versions := params.Regtest.Versions()
+	var signers []*wallet.Wallet
+	var pubKeys [][]byte
+	for range 2 {
+		w, err := wallet.New()
+		assert.NoError(t, err)
+		signers = append(signers, w)
+		pubKeys = append(pubKeys, w.GetPublicKey())
+	}
+	redeem, err := script.MultiSig(2, pubKeys)
+	assert.NoError(t, err)
+
+	// the wallets keep the redeem script, the subsidy is paid to its script address
+	wallets := wallet.NewWallets(params.Regtest, t.TempDir())
+	defer wallets.Close()
+	address, err := wallets.AddScript(redeem)
+	assert.NoError(t, err)
+	bc := openRegtest(t)
+	blocks, err := bc.Generate(ctx, 1, address)
+	assert.NoError(t, err)
+	coinbase := blocks[0].GetTransaction()[0]
+
+	spend := transactions.Transaction{
+		Inputs:  []transactions.TxnInput{{TxnId: coinbase.GetId(), Output: 0}},
+		Outputs: []transactions.TxnOutput{{Value: 100, ScriptPubKey: "treasury"}},
+	}
+	partial, err := transactions.NewPartial(spend, coinbase.GetOutputs())
+	assert.NoError(t, err)
+
+	// nobody signs before the redeem script is revealed
+	_, err = signers[0].SignPartial(partial, versions)
+	assert.ErrorIs(t, err, transactions.ErrNonStandard)
+	assert.Error(t, partial.SetRedeemScript(0, script.Script{byte(script.OP_1)}, versions))
+	revealed, err := wallets.SetRedeemScripts(partial)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, revealed)
+
+	for _, signer := range signers {
+		signed, err := signer.SignPartial(partial, versions)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, signed)
+	}
+	txn, err := partial.Finalize(versions)
+	assert.NoError(t, err)
+
+	// the redeem script must run, a script that only matches the hash does not unlock the output
+	unsigned := txn
+	unsigned.Inputs = []transactions.TxnInput{{TxnId: coinbase.GetId(), Output: 0}}
+	sigScript, err := script.RedeemScript(nil, redeem)
+	assert.NoError(t, err)
+	unsigned.Inputs[0].ScriptSignature = sigScript.Hex()
+	unsigned.GenId()
+	_, err = bc.SubmitTransaction(ctx, unsigned)
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+
+	_, err = bc.SubmitTransaction(ctx, txn)
+	assert.NoError(t, err)
+	balance, err := bc.GetBalance(ctx, "treasury")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), balance)
+}
+
+func TestBlockchain_TimeLocks(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	versions := params.Regtest.Versions()
+	alice, err := wallet.New()
+	assert.NoError(t, err)
+	address, err := alice.GenAddressFor(params.Regtest.AddressVersion)
+	assert.NoError(t, err)
+	bc := openRegtest(t)
+
+	// spend signs a spend of the coinbase of the block, the mutation sets its locks
+	spend := func(b block.Block, lock func(txn *transactions.Transaction)) transactions.Transaction {
+		coinbase := b.GetTransaction()[0]
+		txn := transactions.Transaction{
+			Inputs:  []transactions.TxnInput{{TxnId: coinbase.GetId(), Output: 0}},
+			Outputs: []transactions.TxnOutput{{Value: coinbase.GetOutputs()[0].Value, ScriptPubKey: "bob"}},
+		}
+		lock(&txn)
+		assert.NoError(t, alice.SignInput(&txn, 0, coinbase.GetOutputs()[0], versions))
+		txn.GenId()
+		return txn
+	}
+	blocks, err := bc.Generate(ctx, 2, string(address))
+	assert.NoError(t, err)
+
+	// the lock time is a height: the transaction is mined from height 4 on
+	escrow := spend(blocks[0], func(txn *transactions.Transaction) { txn.LockTime = 4 })
+	assert.ErrorIs(t, bc.AcceptTransaction(ctx, escrow), transactions.ErrNotFinal)
+	_, err = bc.SubmitTransaction(ctx, escrow)
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+
+	// the signature covers the lock time
+	stripped := escrow
+	stripped.LockTime = 0
+	stripped.GenId()
+	assert.ErrorIs(t, bc.AcceptTransaction(ctx, stripped), ErrInvalidTransaction)
+
+	// a unix time far ahead of the chain's clock
+	later := spend(blocks[0], func(txn *transactions.Transaction) { txn.LockTime = params.Regtest.Genesis.Timestamp + 365*24*3600 })
+	assert.ErrorIs(t, bc.AcceptTransaction(ctx, later), transactions.ErrNotFinal)
+
+	_, err = bc.Generate(ctx, 1, string(address))
+	assert.NoError(t, err)
+	assert.NoError(t, bc.AcceptTransaction(ctx, escrow))
+	_, err = bc.SubmitTransaction(ctx, escrow)
+	assert.NoError(t, err)
+
+	// the output of height 2 can be spent 4 blocks later, from height 6 on
+	vesting := spend(blocks[1], func(txn *transactions.Transaction) { txn.Inputs[0].Sequence = 4 })
+	assert.ErrorIs(t, bc.AcceptTransaction(ctx, vesting), transactions.ErrSequenceLock)
+	_, err = bc.Generate(ctx, 1, string(address))
+	assert.NoError(t, err)
+	assert.NoError(t, bc.AcceptTransaction(ctx, vesting))
+	b, err := bc.SubmitTransaction(ctx, vesting)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(6), b.GetHeight())
+
+	// the locks are stored with the transaction
+	mined, err := bc.FindTransaction(ctx, vesting.GetId())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), mined.Txn.Inputs[0].Sequence)
+}
+
+func TestBlockchain_Anchors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	alice, err := wallet.New()
+	assert.NoError(t, err)
+	address, err := alice.GenAddressFor(params.Regtest.AddressVersion)
+	assert.NoError(t, err)
+	bc := openRegtest(t)
+	blocks, err := bc.Generate(ctx, 2, string(address))
+	assert.NoError(t, err)
+
+	// anchor spends a coinbase back to alice and carries the data in its second output
+	anchor := func(b block.Block, out transactions.TxnOutput) transactions.Transaction {
+		coinbase := b.GetTransaction()[0]
+		txn := transactions.Transaction{
+			Inputs:  []transactions.TxnInput{{TxnId: coinbase.GetId(), Output: 0}},
+			Outputs: []transactions.TxnOutput{coinbase.GetOutputs()[0], out},
+		}
+		assert.NoError(t, alice.SignInput(&txn, 0, coinbase.GetOutputs()[0], params.Regtest.Versions()))
+		txn.GenId()
+		return txn
+	}
+	data, err := transactions.NewDataOutput([]byte("receipt:1"))
+	assert.NoError(t, err)
+	first := anchor(blocks[0], data)
+	mined, err := bc.SubmitTransaction(ctx, first)
+	assert.NoError(t, err)
+	other, err := transactions.NewDataOutput([]byte("other"))
+	assert.NoError(t, err)
+	_, err = bc.SubmitTransaction(ctx, anchor(blocks[1], other))
+	assert.NoError(t, err)
+
+	anchors, err := bc.FindAnchors(ctx, []byte("receipt:"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Anchor{{TxnId: first.GetId(), Vout: 1, BlockHash: mined.GetHash(), Height: mined.GetHeight(), Data: "726563656970743a31"}}, anchors)
+	all, err := bc.FindAnchors(ctx, nil)
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+	assert.Equal(t, hex.EncodeToString([]byte("other")), all[0].Data)
+
+	// a page only searches its blocks
+	page, next, err := bc.GetAnchors(ctx, []byte("receipt:"), "", 1)
+	assert.NoError(t, err)
+	assert.Empty(t, page)
+	assert.Equal(t, mined.GetHash(), next)
+	page, next, err = bc.GetAnchors(ctx, []byte("receipt:"), next, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, anchors, page)
+	assert.Empty(t, next)
+
+	// the data output is not spendable, the change is
+	_, err = bc.FindUTXO(ctx, first.GetId(), 1)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	_, err = bc.FindUTXO(ctx, first.GetId(), 0)
+	assert.NoError(t, err)
+
+	// an unspendable output carrying more than the limit is refused
+	oversized, err := script.NewBuilder().AddOp(script.OP_RETURN).AddData(make([]byte, script.MaxDataSize+1)).Script()
+	assert.NoError(t, err)
+	blocks, err = bc.Generate(ctx, 1, string(address))
+	assert.NoError(t, err)
+	_, err = bc.SubmitTransaction(ctx, anchor(blocks[0], transactions.TxnOutput{ScriptPubKey: oversized.Hex()}))
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+	assert.ErrorIs(t, err, transactions.ErrDataTooLarge)
+
+	_, err = bc.Verify(ctx)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,70 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/transactions"
+	"github.com/tdadadavid/block/pkg/wallet"
+)
+
+// ErrInvalidCount is returned when a negative number of blocks is to be generated
+var ErrInvalidCount = errors.New("the number of blocks must not be negative")
+
+// Generate mines n blocks on top of the tip, the coinbase of every block pays its subsidy to the address
+//
+// Parameters
+//   - `n int`: The number of blocks to mine
+//   - `address string`: The wallet or script address of the network the subsidies are paid to
+//
+// Process
+//   - Every coinbase carries the height of its block, so two coinbases to the same address never share an id
+//   - Every block is mined with the difficulty of the network and stamped by the chain's clock (see WithClock)
+//
+// NOTE
+//   - It is meant for regtest, its difficulty is so low that hundreds of blocks are mined in milliseconds
+//
+// Returns
+//   - `[]block.Block`: The blocks that were mined, in chain order, also when an error stopped the generation
+//   - `error`: wallet.ErrInvalidAddress, ErrInvalidCount or any error that occurred while connecting a block
+func (c *Chain) Generate(ctx context.Context, n int, address string) (blocks []block.Block, err error) {
+	if n < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidCount, n)
+	}
+	if err = c.checkAddress(address); err != nil {
+		return nil, err
+	}
+
+	tip, err := c.store.FindLastBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for height := tip.GetHeight() + 1; len(blocks) < n; height++ {
+		if err = ctx.Err(); err != nil {
+			return blocks, err
+		}
+
+		coinbase := transactions.NewCoinbase(address, fmt.Sprintf("height %d", height), c.params.BlockSubsidy(height))
+		coinbase.GenId()
+		b, err := c.mineBlock(ctx, *coinbase)
+		if err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// checkAddress checks an address is a wallet address or a script address of the network
+//
+// Returns
+//   - `error`: wallet.ErrInvalidAddress when the address is neither
+func (c *Chain) checkAddress(address string) error {
+	if _, err := wallet.DecodeAddressFor(address, c.params.ScriptAddressVersion); err == nil {
+		return nil
+	}
+	_, err := wallet.DecodeAddressFor(address, c.params.AddressVersion)
+	return err
+}
@@ -0,0 +1,74 @@
+package chain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/params"
+	"github.com/tdadadavid/block/pkg/wallet"
+)
+
+// openRegtest opens a regtest chain in memory whose blocks are stamped ten minutes apart
+func openRegtest(t *testing.T, opts ...Option) Chain {
+	clock := block.StepClock(time.Unix(params.Regtest.Genesis.Timestamp, 0), 10*time.Minute)
+	bc, err := Open(context.Background(), "", append([]Option{WithParams(params.Regtest), WithClock(clock), WithInMemoryStore()}, opts...)...)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, bc.Close())
+	})
+	return bc
+}
+
+func TestBlockchain_Generate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	w, err := wallet.New()
+	assert.NoError(t, err)
+	address, err := w.GenAddressFor(params.Regtest.AddressVersion)
+	assert.NoError(t, err)
+
+	bc := openRegtest(t)
+	genesis, err := bc.FindLast()
+	assert.NoError(t, err)
+	assert.Equal(t, params.Regtest.GenesisHash, genesis.GetHash())
+
+	start := time.Now()
+	blocks, err := bc.Generate(ctx, 200, string(address))
+	assert.NoError(t, err)
+	assert.Len(t, blocks, 200)
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	tip, err := bc.FindLast()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(200), tip.GetHeight())
+	assert.Equal(t, blocks[199].GetHash(), tip.GetHash())
+	for i, b := range blocks {
+		assert.Equal(t, params.Regtest.Genesis.Timestamp+int64(i)*600, b.GetTimestamp())
+	}
+
+	// the subsidy halves at height 150
+	balance, err := bc.GetBalance(ctx, string(address))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(149*100+51*50), balance)
+
+	// the same clock mines the same chain
+	again := openRegtest(t)
+	replayed, err := again.Generate(ctx, 3, string(address))
+	assert.NoError(t, err)
+	for i, b := range replayed {
+		assert.Equal(t, blocks[i].GetHash(), b.GetHash())
+	}
+
+	_, err = bc.Generate(ctx, 1, "alice")
+	assert.ErrorIs(t, err, wallet.ErrInvalidAddress)
+	mainnetAddress, err := w.GenAddress()
+	assert.NoError(t, err)
+	_, err = bc.Generate(ctx, 1, string(mainnetAddress))
+	assert.ErrorIs(t, err, wallet.ErrInvalidAddress)
+	_, err = bc.Generate(ctx, -1, string(address))
+	assert.ErrorIs(t, err, ErrInvalidCount)
+}
@@ -0,0 +1,87 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// reindexBatch is the number of blocks read from the store at once while rebuilding the indexes
+const reindexBatch = 100
+
+// ErrPrunedIndex is returned when the indexes are used on a pruned chain, they are built from every block body
+var ErrPrunedIndex = errors.New("the indexes need every block, they can't be combined with pruning")
+
+// Reindex drops the transaction and address indexes and rebuilds them from every block on the chain
+//
+// Process
+//   - Walks the chain forwards through the height index in batches, so the chain is never loaded at once
+//   - The indexes are rebuilt even when they are disabled, so they are ready when they get enabled
+//
+// NOTE
+//   - A pruned chain, or one loaded from a UTXO snapshot whose history is not validated yet, is refused with
+//     ErrPrunedIndex before anything is dropped
+func (c *Chain) Reindex(ctx context.Context) error {
+	pruneHeight, err := c.store.FindPruneHeight(ctx)
+	if err != nil {
+		return err
+	}
+	if pruneHeight > 0 {
+		return fmt.Errorf("%w: the bodies below height %d are gone", ErrPrunedIndex, pruneHeight)
+	}
+
+	if err = c.store.DropTxIndex(ctx); err != nil {
+		return err
+	}
+	if err = c.store.DropAddrIndex(ctx); err != nil {
+		return err
+	}
+
+	for from := int32(0); ; from += reindexBatch {
+		blocks, err := c.store.FindBlockRange(ctx, from, reindexBatch)
+		if err != nil {
+			return fmt.Errorf("failed to read blocks from height %d: %w", from, err)
+		}
+		for _, b := range blocks {
+			if err = c.store.IndexTransactions(ctx, b); err != nil {
+				return fmt.Errorf("failed to index transactions of block %s: %w", b.GetHash(), err)
+			}
+			if err = c.store.IndexAddresses(ctx, b); err != nil {
+				return fmt.Errorf("failed to index addresses of block %s: %w", b.GetHash(), err)
+			}
+		}
+		if len(blocks) < reindexBatch {
+			return nil
+		}
+	}
+}
+
+// syncIndexes rebuilds the indexes when an enabled index is out of sync with the tip
+//
+// NOTE
+//   - This happens when an index is enabled on a chain that was running without it
+func (c *Chain) syncIndexes(ctx context.Context) error {
+	stale := false
+
+	if c.txIndex {
+		best, err := c.store.FindTxIndexBest(ctx)
+		if err != nil {
+			return err
+		}
+		stale = stale || best != c.currentHash
+	}
+	if c.addrIndex {
+		best, err := c.store.FindAddrIndexBest(ctx)
+		if err != nil {
+			return err
+		}
+		stale = stale || best != c.currentHash
+	}
+	if !stale {
+		return nil
+	}
+
+	c.logger.Info("indexes are out of sync, rebuilding", slog.String("tip", c.currentHash))
+	return c.Reindex(ctx)
+}
@@ -19,6 +19,9 @@ type ChainIterator struct {
 
 	// the blockchain holds a pointer to the Chain itself
 	blockchain *Chain
+
+	// err is the error that stopped the iteration before the genesis block was reached
+	err error
 }
 
 // HasNext control the iteration over the chain
@@ -39,6 +42,7 @@ func (it *ChainIterator) HasNext(ctx context.Context) bool {
 	// check if the block of the currentHash exists if it does the continued iteration else stop.
 	_, err := it.blockchain.store.FindBlockByHash(ctx, it.currentHash)
 	if err != nil {
+		it.err = err
 		return false
 	}
 
@@ -64,6 +68,7 @@ func (it *ChainIterator) Next(ctx context.Context) (curBlock *block.Block) {
 	// find the current block using the current hash
 	b, err := it.blockchain.store.FindBlockByHash(ctx, it.currentHash)
 	if err != nil {
+		it.err = err
 		it.currentHash = ""
 		return curBlock
 	}
@@ -74,3 +79,11 @@ func (it *ChainIterator) Next(ctx context.Context) (curBlock *block.Block) {
 
 	return curBlock
 }
+
+// Err returns the error that stopped the iteration, nil when it stopped after the genesis block
+//
+// NOTE
+//   - store.ErrPruned means the iteration reached blocks whose bodies were deleted on a pruned node
+func (it *ChainIterator) Err() error {
+	return it.err
+}
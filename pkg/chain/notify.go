@@ -0,0 +1,62 @@
+package chain
+
+import (
+	"log/slog"
+
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/events"
+	"github.com/tdadadavid/block/pkg/mempool"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+// Events returns the bus the chain publishes its events on
+func (c *Chain) Events() *events.Bus {
+	return c.events
+}
+
+// Mempool returns the pool of transactions waiting to be included in a block
+func (c *Chain) Mempool() *mempool.Pool {
+	return c.mempool
+}
+
+// blockConnected evicts the block's transactions from the mempool and publishes the block
+//
+// NOTE
+//   - An events.AddressReceived event is published for every output of the block
+func (c *Chain) blockConnected(b *block.Block) {
+	ids := make([]string, 0, len(b.GetTransaction()))
+	for _, txn := range b.GetTransaction() {
+		ids = append(ids, txn.GetId())
+	}
+	c.mempool.Remove(ids...)
+
+	c.events.Publish(events.Event{Topic: events.BlockConnected, Block: b})
+	for _, txn := range b.GetTransaction() {
+		for vout, out := range txn.GetOutputs() {
+			c.events.Publish(events.Event{
+				Topic:   events.AddressReceived,
+				Address: out.ScriptPubKey,
+				Output: &transactions.UTXO{
+					TxnId:     txn.GetId(),
+					Vout:      int32(vout),
+					Height:    b.GetHeight(),
+					TxnOutput: out,
+				},
+			})
+		}
+	}
+}
+
+// blockDisconnected returns the block's transactions to the mempool and publishes the block
+func (c *Chain) blockDisconnected(b *block.Block) {
+	for _, txn := range b.GetTransaction() {
+		if txn.IsCoinbase() {
+			continue
+		}
+		if err := c.mempool.Add(txn); err != nil {
+			c.logger.Debug("transaction not returned to mempool", slog.String("txid", txn.GetId()), slog.Any("error", err))
+		}
+	}
+
+	c.events.Publish(events.Event{Topic: events.BlockDisconnected, Block: b})
+}
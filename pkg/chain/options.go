@@ -0,0 +1,82 @@
+package chain
+
+import (
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/params"
+	"github.com/tdadadavid/block/pkg/store"
+)
+
+// Option configures the optional features of a chain
+type Option func(*Chain)
+
+// WithTxIndex enables or disables the transaction index
+//
+// NOTE
+//   - The index costs disk space, it maps the id of every transaction on the chain to the block that contains it
+func WithTxIndex(enabled bool) Option {
+	return func(c *Chain) {
+		c.txIndex = enabled
+	}
+}
+
+// WithAddrIndex enables or disables the address index
+//
+// NOTE
+//   - The index maps every address to the outputs ever paid to it and where they were spent,
+//     balance and history lookups use it instead of walking the chain
+func WithAddrIndex(enabled bool) Option {
+	return func(c *Chain) {
+		c.addrIndex = enabled
+	}
+}
+
+// WithPrune keeps only the bodies of the last depth blocks, older bodies are deleted as new blocks arrive
+//
+// NOTE
+//   - Headers, the height index and the UTXO set are kept, so the chain keeps validating and serving balances
+//   - A depth of 0 disables pruning, any other depth must be at least MinPruneDepth
+//   - The transaction and address indexes need every body, they can't be enabled with it (see ErrPrunedIndex)
+func WithPrune(depth int32) Option {
+	return func(c *Chain) {
+		c.pruneDepth = depth
+	}
+}
+
+// WithStore makes the chain use the given store instead of opening one at the storage path
+func WithStore(s store.Storage) Option {
+	return func(c *Chain) {
+		c.store = s
+	}
+}
+
+// WithInMemoryStore makes the chain keep its data in memory, nothing is written to the storage path
+//
+// NOTE
+//   - Every chain gets its own store, this is meant for tests and simulations that must not touch the disk
+func WithInMemoryStore() Option {
+	return func(c *Chain) {
+		c.openStore = func(_ string, opts ...store.Option) (store.Storage, error) {
+			return store.OpenInMemory(opts...)
+		}
+	}
+}
+
+// WithParams makes the chain follow the rules of the network, chains follow mainnet by default
+//
+// NOTE
+//   - The difficulty new blocks are mined and verified with and the genesis subsidy come from the parameters
+func WithParams(p *params.Params) Option {
+	return func(c *Chain) {
+		c.params = p
+	}
+}
+
+// WithClock makes the chain stamp the blocks it mines with the time of the clock instead of time.Now
+//
+// NOTE
+//   - Tests use block.StepClock to get the same timestamps, and so the same block hashes, on every run
+func WithClock(clock block.Clock) Option {
+	return func(c *Chain) {
+		c.clock = clock
+	}
+}
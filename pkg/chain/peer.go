@@ -0,0 +1,36 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrGenesisMismatch is returned when another node follows a chain that starts from a different genesis block
+var ErrGenesisMismatch = errors.New("the peer has a different genesis block")
+
+// GenesisHash returns the hash of the genesis block, it identifies the chain
+func (c *Chain) GenesisHash(ctx context.Context) (string, error) {
+	return c.store.FindHashByHeight(ctx, 0)
+}
+
+// CheckPeer refuses another node unless its chain starts from the same genesis block
+//
+// Parameters
+//   - `genesisHash string`: The hash of the genesis block the other node announced
+//
+// NOTE
+//   - Nodes of different chains can never sync, nothing they send each other is valid on the other chain
+//
+// Returns
+//   - `error`: ErrGenesisMismatch when the genesis blocks differ
+func (c *Chain) CheckPeer(ctx context.Context, genesisHash string) error {
+	ours, err := c.GenesisHash(ctx)
+	if err != nil {
+		return err
+	}
+	if genesisHash != ours {
+		return fmt.Errorf("%w: %s, ours is %s", ErrGenesisMismatch, genesisHash, ours)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/tdadadavid/block/pkg/store"
+)
+
+// MinPruneDepth is the smallest prune depth, the blocks within it can still be disconnected during a reorg
+const MinPruneDepth int32 = 288
+
+// Pruned tells whether the chain deleted old block bodies
+//
+// Returns
+//   - `int32`: The height below which block bodies are gone, 0 when the chain was never pruned
+//   - `error`: Any error that occurred while reading the store
+func (c *Chain) Pruned(ctx context.Context) (int32, error) {
+	return c.store.FindPruneHeight(ctx)
+}
+
+// prune deletes the block bodies deeper than the prune depth when the chain runs in prune mode
+func (c *Chain) prune() {
+	if c.pruneDepth == 0 {
+		return
+	}
+	if _, err := c.store.Prune(c.chainCtx, c.pruneDepth); err != nil {
+		c.logger.Error("failed to prune blocks", slog.Any("error", err))
+	}
+}
+
+// describePruned explains an error caused by a pruned block body, any other error is returned as is
+func (c *Chain) describePruned(ctx context.Context, err error) error {
+	if !errors.Is(err, store.ErrPruned) {
+		return err
+	}
+	pruneHeight, pruneErr := c.store.FindPruneHeight(ctx)
+	if pruneErr != nil {
+		return errors.Join(err, pruneErr)
+	}
+	return fmt.Errorf("the chain is pruned, only headers are kept below height %d: %w", pruneHeight, err)
+}
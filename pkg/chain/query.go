@@ -0,0 +1,207 @@
+package chain
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+// AddressTxn summarises how a transaction affected an address
+type AddressTxn struct {
+	TxnId     string `json:"txid"`
+	BlockHash string `json:"block_hash"`
+	Height    int32  `json:"height"`
+	Received  int64  `json:"received"`
+	Sent      int64  `json:"sent"`
+}
+
+// GetBlock finds a block on the chain by its hash
+//
+// Returns
+//   - `*block.Block`: The block found
+//   - `error`: store.ErrNotFound if the block does not exist
+func (c *Chain) GetBlock(ctx context.Context, hash string) (*block.Block, error) {
+	b, err := c.store.FindBlockByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// GetBlocks returns a page of blocks walking backwards from the given hash
+//
+// Parameters
+//   - `from string`: The hash of the first block in the page, the tip of the chain is used when it is empty
+//   - `limit int`: The maximum number of blocks in the page
+//
+// Process
+//   - Only the blocks in the page are read from the store, the rest of the chain is never loaded
+//
+// Returns
+//   - `blocks []*block.Block`: The blocks in the page, newest first
+//   - `next string`: The hash to pass as `from` to get the next page, empty when the genesis block was reached
+//   - `err error`: Any error that occurred while reading the store
+func (c *Chain) GetBlocks(ctx context.Context, from string, limit int) (blocks []*block.Block, next string, err error) {
+	next = from
+	if next == "" {
+		next = c.currentHash
+	}
+
+	for next != "" && len(blocks) < limit {
+		b, err := c.store.FindBlockByHash(ctx, next)
+		if err != nil {
+			return blocks, next, err
+		}
+		blocks = append(blocks, &b)
+		next = b.GetPrevBlockHash()
+	}
+
+	return blocks, next, err
+}
+
+// GetBlockByHeight finds the block at the given height
+//
+// Process
+//   - Looks the block up in the store's height index, the chain is never walked
+//
+// Returns
+//   - `*block.Block`: The block at the height
+//   - `error`: store.ErrNotFound if the chain is not that high
+func (c *Chain) GetBlockByHeight(ctx context.Context, height int32) (*block.Block, error) {
+	b, err := c.store.FindBlockByHeight(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// GetBlockRange returns consecutive blocks starting at the given height
+//
+// Parameters
+//   - `from int32`: The height of the first block
+//   - `limit int`: The maximum number of blocks returned
+//
+// Returns
+//   - `blocks []*block.Block`: The blocks in height order (oldest first)
+//   - `err error`: Any error that occurred while reading the store
+func (c *Chain) GetBlockRange(ctx context.Context, from int32, limit int) (blocks []*block.Block, err error) {
+	found, err := c.store.FindBlockRange(ctx, from, limit)
+	for i := range found {
+		blocks = append(blocks, &found[i])
+	}
+	return blocks, err
+}
+
+// FindUTXOs finds the unspent outputs that can be unlocked by the given address
+//
+// Process
+//   - Reads the address index when it is enabled, otherwise:
+//   - Scans the UTXO set, it is kept in sync with the tip and also works on a pruned node
+//
+// Returns
+//   - `utxos []transactions.UTXO`: The unspent outputs of the address, newest first
+//   - `err error`: Any error that occurred while reading the store
+func (c *Chain) FindUTXOs(ctx context.Context, address string) (utxos []transactions.UTXO, err error) {
+	if c.addrIndex {
+		return c.indexedUTXOs(ctx, address)
+	}
+
+	err = c.store.ForEachUTXO(ctx, func(utxo transactions.UTXO) error {
+		if utxo.CanUnlockWith(address) {
+			utxos = append(utxos, utxo)
+		}
+		return nil
+	})
+	slices.SortStableFunc(utxos, func(a, b transactions.UTXO) int {
+		return cmp.Compare(b.Height, a.Height)
+	})
+	return utxos, err
+}
+
+// FindUTXO finds an unspent output by the id of its transaction and its index
+//
+// Returns
+//   - `transactions.UTXO`: The unspent output
+//   - `error`: store.ErrNotFound when the output does not exist or is spent
+func (c *Chain) FindUTXO(ctx context.Context, txnId string, vout int32) (transactions.UTXO, error) {
+	return c.store.FindUTXO(ctx, txnId, vout)
+}
+
+// AddressHistory lists the transactions that paid to or spent from the given address
+//
+// Process
+//   - Reads the address index when it is enabled, otherwise:
+//   - Walks backwards from the tip remembering the outputs paid to the address and the inputs of every transaction
+//   - Once the walk is done every input can be matched against the outputs of the address to compute what was sent
+//
+// Returns
+//   - `history []AddressTxn`: The transactions of the address, newest first
+//   - `err error`: Any error that occurred while reading the store
+func (c *Chain) AddressHistory(ctx context.Context, address string) (history []AddressTxn, err error) {
+	if c.addrIndex {
+		return c.indexedHistory(ctx, address)
+	}
+
+	type candidate struct {
+		entry  AddressTxn
+		inputs []transactions.TxnInput
+	}
+
+	var candidates []candidate
+	owned := make(map[string]map[int32]int64)
+
+	iter := c.iter()
+	for iter.HasNext(ctx) {
+		curBlock := iter.Next(ctx)
+		txns := curBlock.GetTransaction()
+		for i := len(txns) - 1; i >= 0; i-- {
+			txn := txns[i]
+			cand := candidate{entry: AddressTxn{
+				TxnId:     txn.GetId(),
+				BlockHash: curBlock.GetHash(),
+				Height:    curBlock.GetHeight(),
+			}}
+
+			for vout, out := range txn.GetOutputs() {
+				if !out.CanUnlockWith(address) {
+					continue
+				}
+				if owned[txn.GetId()] == nil {
+					owned[txn.GetId()] = make(map[int32]int64)
+				}
+				owned[txn.GetId()][int32(vout)] = out.Value
+				cand.entry.Received += out.Value
+			}
+			if !txn.IsCoinbase() {
+				cand.inputs = txn.GetInputs()
+			}
+			candidates = append(candidates, cand)
+		}
+	}
+	if err = iter.Err(); err != nil {
+		return history, c.describePruned(ctx, err)
+	}
+
+	for _, cand := range candidates {
+		for _, in := range cand.inputs {
+			cand.entry.Sent += owned[in.TxnId][in.Output]
+		}
+		if cand.entry.Received > 0 || cand.entry.Sent > 0 {
+			history = append(history, cand.entry)
+		}
+	}
+
+	return history, err
+}
+
+// GetBalance returns the sum of the unspent outputs that can be unlocked by the given address
+func (c *Chain) GetBalance(ctx context.Context, address string) (balance int64, err error) {
+	utxos, err := c.FindUTXOs(ctx, address)
+	for _, utxo := range utxos {
+		balance += utxo.Value
+	}
+	return balance, err
+}
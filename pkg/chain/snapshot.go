@@ -0,0 +1,193 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/store"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+// ErrUnknownSnapshot is returned when a UTXO snapshot has no assumed hash and none was given
+var ErrUnknownSnapshot = errors.New("no assumed hash for the UTXO snapshot")
+
+// BlockSource fetches the block at a height of the main chain from somewhere else, usually another node
+type BlockSource func(ctx context.Context, height int32) (*block.Block, error)
+
+// DumpUTXOs writes the UTXO set at the tip together with the header chain to w (see store.Store.DumpUTXOs)
+//
+// Returns
+//   - `store.UTXOSnapshotHeader`: The base block and the content hash of the snapshot
+//   - `error`: Any error that occurred while writing the snapshot
+func (c *Chain) DumpUTXOs(ctx context.Context, w io.Writer) (store.UTXOSnapshotHeader, error) {
+	return c.store.DumpUTXOs(ctx, w)
+}
+
+// LoadUTXOSnapshot creates a chain from a UTXO snapshot instead of replaying every block
+//
+// Parameters
+//   - `storagePath string`: The path to the storage, it must not hold a chain yet
+//   - `r io.Reader`: The snapshot written by DumpUTXOs
+//   - `hash string`: The expected content hash, the AssumedUTXOs of the network are used when it is empty
+//   - `opts ...Option`: The optional features of the chain
+//
+// Process
+//   - Loads the header chain, the base block and the UTXO set, the snapshot is only committed when its content
+//     hash matches the expected one
+//   - The chain continues from the base block, the bodies below it are reported as pruned until
+//     ValidateSnapshot replayed the history
+//
+// Returns
+//   - `Chain`: The chain, the caller closes it
+//   - `store.UTXOSnapshotHeader`: The header of the loaded snapshot
+//   - `error`: ErrUnknownSnapshot, store.ErrBadSnapshot or any error that occurred while loading
+func LoadUTXOSnapshot(ctx context.Context, storagePath string, r io.Reader, hash string, opts ...Option) (bc Chain, header store.UTXOSnapshotHeader, err error) {
+	if bc, err = newChain(ctx, storagePath, opts...); err != nil {
+		return bc, header, err
+	}
+
+	header, err = bc.store.LoadUTXOs(ctx, r, func(h store.UTXOSnapshotHeader) error {
+		want := hash
+		if want == "" {
+			want = bc.params.AssumedUTXOs[h.Height]
+		}
+		if want == "" {
+			return fmt.Errorf("%w at height %d, its content hash is %s", ErrUnknownSnapshot, h.Height, h.Hash)
+		}
+		if want != h.Hash {
+			return fmt.Errorf("%w: content hash %s, expected %s", store.ErrBadSnapshot, h.Hash, want)
+		}
+		return nil
+	})
+	if err != nil {
+		return bc, header, errors.Join(err, bc.Close())
+	}
+
+	bc.currentHash = header.BaseHash
+	if err = bc.syncIndexes(ctx); err != nil {
+		// the indexes need the history, they are rebuilt once it is validated
+		bc.logger.Warn("indexes are not available before the history is validated", slog.Any("error", err))
+	}
+	return bc, header, nil
+}
+
+// ValidateSnapshot replays the history below the UTXO snapshot the chain was loaded from
+//
+// Parameters
+//   - `source BlockSource`: Where the bodies below the base block come from
+//
+// Process
+//   - Fetches every block from the genesis to the base, checks it against the header stored at its height and
+//     recomputes its hash from its body, a source can't swap the transactions of a block
+//   - Replays the blocks into a fresh UTXO set, its content hash must be the one of the snapshot
+//   - Stores the bodies, forgets the snapshot and rebuilds the enabled indexes, the chain is then like one that
+//     replayed every block
+//
+// NOTE
+//   - It does nothing when the chain was not loaded from a snapshot or its history was validated already
+//   - The bodies are held in memory until the whole history is valid, nothing is stored when it is not
+//   - It is meant to run in the background, the chain keeps working from the snapshot meanwhile
+//
+// Returns
+//   - `error`: The first block that does not match its header, a history that does not lead to the snapshot
+//     or any error of the source
+func (c *Chain) ValidateSnapshot(ctx context.Context, source BlockSource) error {
+	snapshot, err := c.store.FindSnapshot(ctx)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	base, err := c.store.FindBlockByHash(ctx, snapshot.BaseHash)
+	if err != nil {
+		return err
+	}
+	hashes, err := c.verifyHeaders(ctx, base)
+	if err != nil {
+		return err
+	}
+
+	c.logger.Info("validating the history of the UTXO snapshot", slog.Int64("height", int64(snapshot.Height)))
+	utxos := make(map[string]transactions.UTXO)
+	bodies := make([]*block.Block, 0, snapshot.Height)
+	for height := int32(0); height < snapshot.Height; height++ {
+		b, err := source(ctx, height)
+		if err != nil {
+			return fmt.Errorf("failed to fetch block at height %d: %w", height, err)
+		}
+		if err = c.checkHeader(ctx, *b, hashes[height]); err != nil {
+			return err
+		}
+		bodies = append(bodies, b)
+		replayUTXOs(utxos, *b)
+	}
+	replayUTXOs(utxos, base)
+
+	hash, err := store.UTXOSetHash(snapshot.BaseHash, snapshot.Height, slices.Collect(maps.Values(utxos)))
+	if err != nil {
+		return err
+	}
+	if hash != snapshot.Hash {
+		return fmt.Errorf("%w: the history leads to content hash %s, the snapshot has %s", store.ErrBadSnapshot, hash, snapshot.Hash)
+	}
+	for _, b := range bodies {
+		if err = c.store.CreateBlock(ctx, b.GetHash(), *b); err != nil {
+			return err
+		}
+	}
+	if err = c.store.CompleteSnapshot(ctx); err != nil {
+		return err
+	}
+	c.logger.Info("history of the UTXO snapshot is valid", slog.Int64("height", int64(snapshot.Height)))
+
+	if c.txIndex || c.addrIndex {
+		return c.Reindex(ctx)
+	}
+	return nil
+}
+
+// SnapshotPending tells whether the chain was loaded from a UTXO snapshot whose history is not validated yet
+func (c *Chain) SnapshotPending(ctx context.Context) (bool, error) {
+	_, err := c.store.FindSnapshot(ctx)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// checkHeader checks a fetched block is the one whose header the chain has at its height and its hash is the hash
+// of its body
+func (c *Chain) checkHeader(ctx context.Context, b block.Block, hash string) error {
+	if b.GetHash() != hash {
+		return fmt.Errorf("block %s at height %d is not on the chain, expected %s", b.GetHash(), b.GetHeight(), hash)
+	}
+	if err := b.CheckProofOfWork(c.params.Difficulty); err != nil {
+		return fmt.Errorf("block %s at height %d: %w", hash, b.GetHeight(), err)
+	}
+	header, err := c.store.FindHeaderByHash(ctx, hash)
+	if err != nil {
+		return err
+	}
+	fetched := b.Header()
+	want, err := header.Serialize()
+	if err != nil {
+		return err
+	}
+	got, err := fetched.Serialize()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(want, got) || len(b.GetTransaction()) == 0 {
+		return fmt.Errorf("block %s at height %d does not match its header", hash, b.GetHeight())
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tdadadavid/block/pkg/store"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+// TxnLookup is a transaction together with where it is on the chain
+type TxnLookup struct {
+	Txn           transactions.Transaction `json:"txn"`
+	BlockHash     string                   `json:"block_hash"`
+	Height        int32                    `json:"height"`
+	Position      int32                    `json:"position"`
+	Confirmations int32                    `json:"confirmations"`
+}
+
+// TxIndexEnabled tells whether the chain maintains the transaction index
+func (c *Chain) TxIndexEnabled() bool {
+	return c.txIndex
+}
+
+// FindTransaction finds a transaction on the chain by its id
+//
+// Process
+//   - Uses the transaction index when it is enabled
+//   - Otherwise scans every block from the tip
+//
+// Returns
+//   - `TxnLookup`: The transaction, its block and the number of confirmations
+//   - `error`: store.ErrNotFound if no block contains the transaction
+func (c *Chain) FindTransaction(ctx context.Context, id string) (lookup TxnLookup, err error) {
+	tip, err := c.store.FindLastBlock(ctx)
+	if err != nil {
+		return lookup, err
+	}
+
+	if c.txIndex {
+		lookup, err = c.findIndexedTransaction(ctx, id)
+	} else {
+		lookup, err = c.scanTransaction(ctx, id)
+	}
+	if err != nil {
+		return lookup, err
+	}
+
+	lookup.Confirmations = tip.GetHeight() - lookup.Height + 1
+	return lookup, err
+}
+
+func (c *Chain) findIndexedTransaction(ctx context.Context, id string) (lookup TxnLookup, err error) {
+	loc, err := c.store.FindTxLocation(ctx, id)
+	if err != nil {
+		return lookup, err
+	}
+
+	b, err := c.store.FindBlockByHash(ctx, loc.BlockHash)
+	if err != nil {
+		return lookup, err
+	}
+	if int(loc.Position) >= len(b.GetTransaction()) {
+		return lookup, fmt.Errorf("transaction index points past the end of block %s", b.GetHash())
+	}
+
+	lookup = TxnLookup{
+		Txn:       b.GetTransaction()[loc.Position],
+		BlockHash: b.GetHash(),
+		Height:    b.GetHeight(),
+		Position:  loc.Position,
+	}
+	return lookup, err
+}
+
+func (c *Chain) scanTransaction(ctx context.Context, id string) (lookup TxnLookup, err error) {
+	iter := c.iter()
+	for iter.HasNext(ctx) {
+		curBlock := iter.Next(ctx)
+		for pos, txn := range curBlock.GetTransaction() {
+			if txn.GetId() == id {
+				lookup = TxnLookup{
+					Txn:       txn,
+					BlockHash: curBlock.GetHash(),
+					Height:    curBlock.GetHeight(),
+					Position:  int32(pos),
+				}
+				return lookup, err
+			}
+		}
+	}
+	if err = iter.Err(); err != nil {
+		return lookup, c.describePruned(ctx, err)
+	}
+	return lookup, fmt.Errorf("transaction %s: %w", id, store.ErrNotFound)
+}
@@ -0,0 +1,134 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/store"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+var (
+	// ErrInvalidTransaction is returned when a transaction does not unlock the outputs it spends
+	ErrInvalidTransaction = errors.New("invalid transaction")
+
+	// ErrMissingOutput is returned when an input spends an output that is not in the UTXO set, it was already spent
+	// or never existed
+	ErrMissingOutput = errors.New("output is spent or unknown")
+
+	// ErrCoinbase is returned when a coinbase is submitted, only Generate mines coinbases
+	ErrCoinbase = errors.New("coinbases are only mined by Generate")
+)
+
+// AcceptTransaction admits a transaction into the mempool once it could be mined on top of the tip
+//
+// Process
+//   - Checks the transaction like a block at the next height, stamped by the chain's clock, would (see checkTransaction)
+//   - Adds it to the mempool which announces it on the event bus
+//
+// NOTE
+//   - The id must be the hash of the transaction before anything else is checked, otherwise its outputs would be
+//     stored under the id of another transaction, see transactions.Transaction.CheckId
+//   - A coinbase is refused with ErrCoinbase, it is never relayed
+//
+// Returns
+//   - `error`: ErrInvalidTransaction or the reason the mempool rejected the transaction
+func (c *Chain) AcceptTransaction(ctx context.Context, txn transactions.Transaction) error {
+	tip, err := c.store.FindLastBlock(ctx)
+	if err != nil {
+		return fmt.Errorf("error while finding tip: %w", err)
+	}
+	if err = c.checkTransaction(ctx, txn, tip.GetHeight()+1, c.clock().Unix()); err != nil {
+		return err
+	}
+	return c.mempool.Add(txn)
+}
+
+// SubmitTransaction mines a transaction in a block on top of the tip right away
+//
+// Process
+//   - Checks the transaction like AcceptTransaction, for the block it is mined in
+//   - Mines and connects the block (see AddBlock), a copy of the transaction waiting in the mempool is evicted
+//
+// NOTE
+//   - Every block holds a single transaction, there is no miner picking transactions from the mempool yet
+//   - A coinbase is refused with ErrCoinbase, only Generate mines them
+//
+// Returns
+//   - `block.Block`: The block the transaction was mined in
+//   - `error`: ErrInvalidTransaction or an error while connecting the block
+func (c *Chain) SubmitTransaction(ctx context.Context, txn transactions.Transaction) (block.Block, error) {
+	if txn.IsCoinbase() {
+		return block.Block{}, fmt.Errorf("%w %s: %w", ErrInvalidTransaction, txn.GetId(), ErrCoinbase)
+	}
+	return c.mineBlock(ctx, txn)
+}
+
+// checkTransaction checks the transaction can be mined in a block and every input unlocks the output it spends
+//
+// Parameters
+//   - `txn transactions.Transaction`: The transaction to check
+//   - `height int32`: The height of the block the transaction is mined in
+//   - `timestamp int64`: The time of the block the transaction is mined in
+//
+// NOTE
+//   - The id must be the hash of the transaction before anything else is checked, otherwise its outputs would be
+//     stored under the id of another transaction, see transactions.Transaction.CheckId
+//   - A coinbase is refused with ErrCoinbase, any other transaction spends at least one output and never one twice,
+//     see transactions.Transaction.CheckInputs
+//   - Every input spends an output of the UTXO set, ErrMissingOutput is returned for an output already spent or unknown
+//   - The outputs pay at most what the inputs are worth, see transactions.Transaction.OutputValue
+//   - Unspendable outputs must carry at most script.MaxDataSize bytes, see transactions.Transaction.CheckOutputs
+//   - The lock time of the transaction and the sequence of every input must be reached at the height and time of the
+//     block, see transactions.Transaction.CheckLockTime and transactions.TxnInput.CheckSequence
+//   - The scripts of the input and of the spent output are executed, see transactions.Transaction.VerifyInput
+//
+// Returns
+//   - `error`: ErrInvalidTransaction wrapping why the transaction can't be mined or an input can't spend its output
+func (c *Chain) checkTransaction(ctx context.Context, txn transactions.Transaction, height int32, timestamp int64) error {
+	invalid := func(err error) error {
+		return fmt.Errorf("%w %s: %w", ErrInvalidTransaction, txn.GetId(), err)
+	}
+	if err := txn.CheckId(); err != nil {
+		return invalid(err)
+	}
+	if txn.IsCoinbase() {
+		return invalid(ErrCoinbase)
+	}
+	outputs, err := txn.OutputValue()
+	if err != nil {
+		return invalid(err)
+	}
+	if err = errors.Join(txn.CheckInputs(), txn.CheckLockTime(height, timestamp), txn.CheckOutputs()); err != nil {
+		return invalid(err)
+	}
+
+	scriptCtx := transactions.ScriptContext{Versions: c.params.Versions(), Height: height, Time: timestamp}
+	var inputs int64
+	for index, in := range txn.GetInputs() {
+		utxo, err := c.store.FindUTXO(ctx, in.TxnId, in.Output)
+		if errors.Is(err, store.ErrNotFound) {
+			return invalid(fmt.Errorf("%w: input %d spends %s:%d", ErrMissingOutput, index, in.TxnId, in.Output))
+		}
+		if err != nil {
+			return err
+		}
+		if err = in.CheckSequence(utxo.Height, height); err != nil {
+			return invalid(err)
+		}
+		if err = txn.VerifyInput(index, utxo.TxnOutput, scriptCtx); err != nil {
+			return invalid(err)
+		}
+		if inputs > math.MaxInt64-utxo.Value {
+			return invalid(fmt.Errorf("%w: the inputs are worth more than %d", transactions.ErrInvalidValue, int64(math.MaxInt64)))
+		}
+		inputs += utxo.Value
+	}
+	if outputs > inputs {
+		return invalid(fmt.Errorf("%w: the outputs pay %d, the inputs are worth %d", transactions.ErrInvalidValue, outputs, inputs))
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/params"
+	"github.com/tdadadavid/block/pkg/store"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+// VerifyReport summarises what Verify checked
+type VerifyReport struct {
+	// Height is the height of the tip
+	Height int32 `json:"height"`
+
+	// Headers is the number of headers whose links, heights and hash prefix were checked, a header alone does not
+	// give back its hash so its proof of work is only checked with its body
+	Headers int `json:"headers"`
+
+	// Blocks is the number of block bodies that were read back, whose hash was recomputed to check their proof of
+	// work and that were checked against their headers
+	Blocks int `json:"blocks"`
+
+	// UTXOs is the number of outputs of the UTXO set checked against a replay of the chain
+	UTXOs int `json:"utxos"`
+
+	// PrunedBelow is the height below which only headers exist, their bodies and the UTXO set can't be checked
+	PrunedBelow int32 `json:"pruned_below"`
+
+	// Allocated is the value the genesis coinbase pays, the subsidy and the allocations of the genesis definition
+	Allocated int64 `json:"allocated"`
+}
+
+// Verify checks the chain stored on disk is consistent
+//
+// Process
+//   - Walks the headers from the tip to the genesis block checking every link, height and that every hash has
+//     the zeros the difficulty asks for
+//   - Reads every block body forwards through the height index, recomputes its hash to check its proof of work
+//     and checks it matches its header, this also verifies the checksum of every block record
+//   - Checks every coinbase: the genesis coinbase must be the one its definition builds (see params.Genesis), any
+//     later one pays a single output of at most the subsidy of its height
+//   - Replays the chain into a fresh UTXO set and compares it with the stored one
+//
+// NOTE
+//   - On a pruned node the bodies below the prune height are gone, only their headers are checked, so their
+//     proof of work is not recomputed, and the UTXO set can't be replayed, VerifyReport.PrunedBelow reports it
+//
+// Returns
+//   - `VerifyReport`: What was checked
+//   - `error`: The first inconsistency found
+func (c *Chain) Verify(ctx context.Context) (report VerifyReport, err error) {
+	tip, err := c.store.FindLastBlock(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to find the tip: %w", err)
+	}
+	report.Height = tip.GetHeight()
+	if report.PrunedBelow, err = c.store.FindPruneHeight(ctx); err != nil {
+		return report, err
+	}
+
+	hashes, err := c.verifyHeaders(ctx, tip)
+	if err != nil {
+		return report, err
+	}
+	report.Headers = len(hashes)
+	genesis, err := c.genesisDefinition(ctx, hashes[0])
+	if err != nil {
+		return report, err
+	}
+
+	utxos := make(map[string]transactions.UTXO)
+	for from := report.PrunedBelow; from <= tip.GetHeight(); from += reindexBatch {
+		blocks, err := c.store.FindBlockRange(ctx, from, reindexBatch)
+		if err != nil {
+			return report, c.describePruned(ctx, fmt.Errorf("failed to read blocks from height %d: %w", from, err))
+		}
+		for _, b := range blocks {
+			if b.GetHash() != hashes[b.GetHeight()] {
+				return report, fmt.Errorf("height index points at %s for height %d, the header chain at %s",
+					b.GetHash(), b.GetHeight(), hashes[b.GetHeight()])
+			}
+			if len(b.GetTransaction()) == 0 {
+				return report, fmt.Errorf("block %s at height %d has no transactions", b.GetHash(), b.GetHeight())
+			}
+			if err = b.CheckProofOfWork(c.params.Difficulty); err != nil {
+				return report, fmt.Errorf("block at height %d: %w", b.GetHeight(), err)
+			}
+			allocated, err := c.verifyCoinbases(b, genesis)
+			if err != nil {
+				return report, err
+			}
+			report.Allocated += allocated
+			report.Blocks++
+			replayUTXOs(utxos, b)
+		}
+		if len(blocks) < reindexBatch {
+			break
+		}
+	}
+	if report.Blocks != int(tip.GetHeight()-report.PrunedBelow)+1 {
+		return report, fmt.Errorf("found %d block bodies above height %d, the tip is at height %d",
+			report.Blocks, report.PrunedBelow, tip.GetHeight())
+	}
+
+	if report.PrunedBelow > 0 {
+		return report, nil
+	}
+	err = c.store.ForEachUTXO(ctx, func(utxo transactions.UTXO) error {
+		key := fmt.Sprintf("%s:%d", utxo.TxnId, utxo.Vout)
+		if replayed, ok := utxos[key]; !ok || replayed != utxo {
+			return fmt.Errorf("stored output %s does not match the chain", key)
+		}
+		delete(utxos, key)
+		report.UTXOs++
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	for key := range utxos {
+		return report, fmt.Errorf("output %s is missing from the stored UTXO set", key)
+	}
+	return report, nil
+}
+
+// verifyHeaders walks the headers back from the tip and returns the hash at every height
+func (c *Chain) verifyHeaders(ctx context.Context, tip block.Block) (hashes []string, err error) {
+	hashes = make([]string, tip.GetHeight()+1)
+
+	hash, height := tip.GetHash(), tip.GetHeight()
+	for ; hash != ""; height-- {
+		header, err := c.store.FindHeaderByHash(ctx, hash)
+		if err != nil {
+			return hashes, fmt.Errorf("failed to read header at height %d: %w", height, err)
+		}
+		if height < 0 || header.GetHeight() != height {
+			return hashes, fmt.Errorf("header %s has height %d, expected %d", hash, header.GetHeight(), height)
+		}
+		if header.GetHash() != hash || !block.MeetsDifficulty(hash, c.params.Difficulty) {
+			return hashes, fmt.Errorf("header %s at height %d has an invalid hash", hash, height)
+		}
+		hashes[height] = hash
+		hash = header.GetPrevBlockHash()
+	}
+	if height != -1 {
+		return hashes, fmt.Errorf("the header chain ends at height %d instead of the genesis block", height+1)
+	}
+	return hashes, nil
+}
+
+// verifyCoinbases checks the coinbases of a block and returns what the genesis coinbase pays
+func (c *Chain) verifyCoinbases(b block.Block, genesis *params.Genesis) (allocated int64, err error) {
+	for _, txn := range b.GetTransaction() {
+		if !txn.IsCoinbase() {
+			continue
+		}
+		if b.GetHeight() == 0 {
+			if allocated, err = c.checkGenesisCoinbase(txn, genesis); err != nil {
+				return 0, err
+			}
+		} else if err = c.checkCoinbase(txn, b.GetHeight()); err != nil {
+			return 0, err
+		}
+	}
+	return allocated, nil
+}
+
+// checkCoinbase checks a coinbase mined at the height pays a single output of at most the subsidy, mineBlock checks
+// coinbases with it before connecting them and Verify when it replays the chain
+func (c *Chain) checkCoinbase(txn transactions.Transaction, height int32) error {
+	// only the genesis block allocates, later blocks are paid their subsidy
+	subsidy := c.params.BlockSubsidy(height)
+	if outs := txn.GetOutputs(); len(outs) != 1 || outs[0].Value > subsidy {
+		return fmt.Errorf("coinbase %s at height %d pays more than the subsidy of %d", txn.GetId(), height, subsidy)
+	}
+	return nil
+}
+
+// checkGenesisCoinbase checks the genesis coinbase and returns what it allocates
+//
+// Process
+//   - Every output pays a positive value to an address of the network, the sum must not overflow
+//   - When the definition of the genesis is known, the coinbase must be the one it builds output by output and
+//     allocate what it does
+//
+// NOTE
+//   - The definition is unknown for a chain created before it was stored that is not the one of the network, only
+//     its outputs are checked then
+func (c *Chain) checkGenesisCoinbase(txn transactions.Transaction, genesis *params.Genesis) (allocated int64, err error) {
+	if allocated, err = txn.OutputValue(); err != nil {
+		return 0, fmt.Errorf("genesis coinbase %s: %w", txn.GetId(), err)
+	}
+	for vout, out := range txn.GetOutputs() {
+		if out.Value <= 0 {
+			return 0, fmt.Errorf("genesis allocation %s:%d of %d to %q is invalid", txn.GetId(), vout, out.Value, out.ScriptPubKey)
+		}
+		if err = c.checkAddress(out.ScriptPubKey); err != nil {
+			return 0, fmt.Errorf("genesis allocation %s:%d pays %q: %w", txn.GetId(), vout, out.ScriptPubKey, err)
+		}
+	}
+	if genesis == nil {
+		return allocated, nil
+	}
+
+	expected, err := genesis.Coinbase(c.params.BlockSubsidy(0))
+	if err != nil {
+		return 0, err
+	}
+	outs, want := txn.GetOutputs(), expected.GetOutputs()
+	if len(outs) != len(want) {
+		return 0, fmt.Errorf("genesis coinbase %s has %d outputs, its definition %d", txn.GetId(), len(outs), len(want))
+	}
+	for vout, out := range want {
+		if outs[vout] != out {
+			return 0, fmt.Errorf("genesis allocation %s:%d pays %d to %q, its definition %d to %q",
+				txn.GetId(), vout, outs[vout].Value, outs[vout].ScriptPubKey, out.Value, out.ScriptPubKey)
+		}
+	}
+	if txn.GetId() != expected.GetId() {
+		return 0, fmt.Errorf("genesis coinbase %s is not the %s built from its definition", txn.GetId(), expected.GetId())
+	}
+	value, err := expected.OutputValue()
+	if err != nil {
+		return 0, err
+	}
+	if value != allocated {
+		return 0, fmt.Errorf("genesis coinbase %s allocates %d, its definition %d", txn.GetId(), allocated, value)
+	}
+	return allocated, nil
+}
+
+// genesisDefinition returns the definition the genesis block was built from, nil when it is unknown
+//
+// NOTE
+//   - A chain stores its definition when it is created, one created before that or loaded from a UTXO snapshot
+//     follows the genesis of the network when its genesis hash is the one of the network
+func (c *Chain) genesisDefinition(ctx context.Context, genesisHash string) (*params.Genesis, error) {
+	data, err := c.store.FindGenesis(ctx)
+	if errors.Is(err, store.ErrNotFound) {
+		if genesisHash != c.params.GenesisHash {
+			return nil, nil
+		}
+		genesis := c.params.Genesis
+		return &genesis, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var genesis params.Genesis
+	if err = json.Unmarshal(data, &genesis); err != nil {
+		return nil, fmt.Errorf("malformed genesis definition: %w", err)
+	}
+	return &genesis, nil
+}
+
+// replayUTXOs applies a block to an in memory UTXO set the same way the store does
+func replayUTXOs(utxos map[string]transactions.UTXO, b block.Block) {
+	for _, txn := range b.GetTransaction() {
+		if !txn.IsCoinbase() {
+			for _, in := range txn.GetInputs() {
+				delete(utxos, fmt.Sprintf("%s:%d", in.TxnId, in.Output))
+			}
+		}
+		if txn.GetId() == "" {
+			continue
+		}
+		for vout, out := range txn.GetOutputs() {
+			if out.IsUnspendable() {
+				continue
+			}
+			utxos[fmt.Sprintf("%s:%d", txn.GetId(), vout)] = transactions.UTXO{
+				TxnId: txn.GetId(), Vout: int32(vout), Height: b.GetHeight(), TxnOutput: out,
+			}
+		}
+	}
+}
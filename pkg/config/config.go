@@ -0,0 +1,179 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the name of every environment variable the configuration is read from
+const EnvPrefix = "BLOCK_"
+
+// Config is the configuration of the CLI and the node
+type Config struct {
+	// DataDir is the directory every network keeps its data in
+	DataDir string `yaml:"datadir"`
+
+	// Network is the name of the network the node runs on
+	Network string `yaml:"network"`
+
+	// Name selects a chain created with createchain, the default chain of the network is used when it is empty
+	Name string `yaml:"name"`
+
+	// LogLevel is the lowest level that is logged: debug, info, warn or error
+	LogLevel string `yaml:"log_level"`
+
+	// TxIndex maintains the transaction index
+	TxIndex bool `yaml:"txindex"`
+
+	// AddrIndex maintains the address index
+	AddrIndex bool `yaml:"addrindex"`
+
+	// Prune keeps only the bodies of the last Prune blocks, 0 keeps every block
+	Prune int32 `yaml:"prune"`
+
+	// RPC configures the HTTP APIs of the node
+	RPC RPC `yaml:"rpc"`
+
+	// P2P configures how the node reaches other nodes
+	P2P P2P `yaml:"p2p"`
+}
+
+// RPC configures the HTTP APIs of the node
+type RPC struct {
+	// Addr is the address the explorer API listens on, the default port of the network is used when it is empty
+	Addr string `yaml:"addr"`
+
+	// AdminAddr is the address the admin API listens on, it is disabled when empty
+	AdminAddr string `yaml:"admin_addr"`
+}
+
+// P2P configures how the node reaches other nodes
+type P2P struct {
+	// Listen is the address the node accepts other nodes on
+	Listen string `yaml:"listen"`
+
+	// Peers are the explorer APIs of the nodes this node talks to
+	Peers []string `yaml:"peers"`
+}
+
+// Default returns the configuration used when nothing else is configured
+func Default() Config {
+	return Config{
+		DataDir:  "/data",
+		Network:  "mainnet",
+		LogLevel: "info",
+	}
+}
+
+// Load merges the defaults, the YAML file at path and the BLOCK_* environment variables, later layers win
+//
+// Parameters
+//   - `path string`: The YAML config file, no file is read when it is empty
+//   - `lookupEnv func(string) (string, bool)`: Looks up environment variables, usually os.LookupEnv
+//
+// NOTE
+//   - Only the keys present in the file override the defaults, unknown keys are an error so typos are not ignored
+//   - Command line flags are the last layer, the caller applies them on the returned configuration
+//
+// Returns
+//   - `Config`: The merged configuration
+//   - `error`: A file that can't be read or parsed, an environment variable or log level that is not valid
+func Load(path string, lookupEnv func(string) (string, bool)) (cfg Config, err error) {
+	cfg = Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if err = cfg.applyEnv(lookupEnv); err != nil {
+		return cfg, err
+	}
+	if _, err = cfg.Level(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the configuration with the BLOCK_* environment variables that are set
+func (c *Config) applyEnv(lookupEnv func(string) (string, bool)) error {
+	strs := map[string]*string{
+		"DATADIR":        &c.DataDir,
+		"NETWORK":        &c.Network,
+		"NAME":           &c.Name,
+		"LOG_LEVEL":      &c.LogLevel,
+		"RPC_ADDR":       &c.RPC.Addr,
+		"RPC_ADMIN_ADDR": &c.RPC.AdminAddr,
+		"P2P_LISTEN":     &c.P2P.Listen,
+	}
+	for name, field := range strs {
+		if value, ok := lookupEnv(EnvPrefix + name); ok {
+			*field = value
+		}
+	}
+
+	bools := map[string]*bool{
+		"TXINDEX":   &c.TxIndex,
+		"ADDRINDEX": &c.AddrIndex,
+	}
+	for name, field := range bools {
+		if value, ok := lookupEnv(EnvPrefix + name); ok {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s%s %q: %w", EnvPrefix, name, value, err)
+			}
+			*field = enabled
+		}
+	}
+
+	if value, ok := lookupEnv(EnvPrefix + "PRUNE"); ok {
+		prune, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %sPRUNE %q: %w", EnvPrefix, value, err)
+		}
+		c.Prune = int32(prune)
+	}
+
+	// peers are separated by commas
+	if value, ok := lookupEnv(EnvPrefix + "P2P_PEERS"); ok {
+		c.P2P.Peers = nil
+		for _, peer := range strings.Split(value, ",") {
+			if peer = strings.TrimSpace(peer); peer != "" {
+				c.P2P.Peers = append(c.P2P.Peers, peer)
+			}
+		}
+	}
+	return nil
+}
+
+// Level returns the slog level of LogLevel
+func (c *Config) Level() (level slog.Level, err error) {
+	if err = level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return level, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", c.LogLevel)
+	}
+	return level, nil
+}
+
+// Write writes the configuration as YAML, the output can be loaded as a config file
+func (c *Config) Write(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
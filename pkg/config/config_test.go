@@ -0,0 +1,84 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := Load("", env(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeConfig(t, `
+datadir: /srv/block
+network: testnet
+prune: 500
+rpc:
+  addr: ":9000"
+p2p:
+  peers: [http://a:8080]
+`)
+
+	cfg, err := Load(path, env(map[string]string{
+		"BLOCK_NETWORK":   "regtest",
+		"BLOCK_TXINDEX":   "true",
+		"BLOCK_P2P_PEERS": "http://b:8080, http://c:8080",
+	}))
+	assert.NoError(t, err)
+
+	// the file overrides the defaults, the environment overrides the file
+	assert.Equal(t, "/srv/block", cfg.DataDir)
+	assert.Equal(t, "regtest", cfg.Network)
+	assert.Equal(t, int32(500), cfg.Prune)
+	assert.True(t, cfg.TxIndex)
+	assert.Equal(t, ":9000", cfg.RPC.Addr)
+	assert.Equal(t, []string{"http://b:8080", "http://c:8080"}, cfg.P2P.Peers)
+	// keys missing from the file keep their default
+	assert.Equal(t, "info", cfg.LogLevel)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	_, err := Load(writeConfig(t, "netwrok: testnet\n"), env(nil))
+	assert.Error(t, err)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"), env(nil))
+	assert.Error(t, err)
+
+	_, err = Load("", env(map[string]string{"BLOCK_PRUNE": "many"}))
+	assert.Error(t, err)
+
+	_, err = Load("", env(map[string]string{"BLOCK_LOG_LEVEL": "loud"}))
+	assert.Error(t, err)
+}
+
+func TestConfig_WriteLoadsBack(t *testing.T) {
+	cfg := Default()
+	cfg.Network = "testnet"
+	cfg.P2P.Peers = []string{"http://a:8080"}
+
+	var out bytes.Buffer
+	assert.NoError(t, cfg.Write(&out))
+	loaded, err := Load(writeConfig(t, out.String()), env(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, cfg, loaded)
+}
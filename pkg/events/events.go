@@ -0,0 +1,198 @@
+package events
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+// Topic names a kind of event emitted by the chain
+type Topic string
+
+const (
+	// BlockConnected is emitted when a block becomes the new tip of the chain
+	BlockConnected Topic = "block.connected"
+	// BlockDisconnected is emitted when the tip of the chain is removed
+	BlockDisconnected Topic = "block.disconnected"
+	// TxnAccepted is emitted when a transaction enters the mempool
+	TxnAccepted Topic = "tx.mempool"
+	// AddressReceived is emitted for every output a connected block pays to an address
+	AddressReceived Topic = "address.received"
+)
+
+// DefaultBuffer is the number of events a subscription holds before it starts dropping them
+const DefaultBuffer = 64
+
+// Event is a single notification published on the bus
+type Event struct {
+	Topic   Topic                     `json:"topic"`
+	Block   *block.Block              `json:"block,omitempty"`
+	Txn     *transactions.Transaction `json:"txn,omitempty"`
+	Address string                    `json:"address,omitempty"`
+	Output  *transactions.UTXO        `json:"output,omitempty"`
+}
+
+// Addresses returns every address the event touches, it is used for address filtering
+func (e Event) Addresses() (addresses []string) {
+	if e.Address != "" {
+		addresses = append(addresses, e.Address)
+	}
+	if e.Txn != nil {
+		addresses = append(addresses, outputAddresses(*e.Txn)...)
+	}
+	if e.Block != nil {
+		for _, txn := range e.Block.GetTransaction() {
+			addresses = append(addresses, outputAddresses(txn)...)
+		}
+	}
+	return addresses
+}
+
+func outputAddresses(txn transactions.Transaction) (addresses []string) {
+	for _, out := range txn.GetOutputs() {
+		addresses = append(addresses, out.ScriptPubKey)
+	}
+	return addresses
+}
+
+// Bus fans events out to subscribers
+//
+// NOTE
+//   - Publishing never blocks, when a subscriber's buffer is full the event is dropped for that subscriber only,
+//     so a slow subscriber can never hold up the chain
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[uint64]*Subscription
+	nextID uint64
+	logger *slog.Logger
+}
+
+// NewBus creates an empty event bus
+func NewBus() *Bus {
+	return &Bus{
+		subs:   make(map[uint64]*Subscription),
+		logger: slog.Default(),
+	}
+}
+
+// Subscribe registers a new subscriber
+//
+// Parameters
+//   - `topics []Topic`: The topics to receive, every topic is received when it is empty
+//   - `addresses []string`: Only events touching one of these addresses are received, no filtering when it is empty
+//   - `buffer int`: The number of undelivered events held before events are dropped, DefaultBuffer when not positive
+//
+// Returns
+//   - `*Subscription`: The subscription, it must be closed when no longer needed
+func (b *Bus) Subscribe(topics []Topic, addresses []string, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	sub := &Subscription{
+		id:  b.nextID,
+		bus: b,
+		ch:  make(chan Event, buffer),
+	}
+	sub.SetFilter(topics, addresses)
+	b.subs[sub.id] = sub
+
+	return sub
+}
+
+// Publish delivers the event to every matching subscriber without blocking
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, sub := range b.subs {
+		if !sub.matches(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			if sub.dropped.Add(1) == 1 {
+				b.logger.Warn("subscriber is too slow, dropping events", slog.Uint64("subscription", sub.id))
+			}
+		}
+	}
+}
+
+func (b *Bus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub.id]; ok {
+		delete(b.subs, sub.id)
+		close(sub.ch)
+	}
+}
+
+// Subscription receives the events matching its filter
+type Subscription struct {
+	id  uint64
+	bus *Bus
+	ch  chan Event
+
+	mu        sync.RWMutex
+	topics    map[Topic]bool
+	addresses map[string]bool
+
+	dropped atomic.Uint64
+}
+
+// Events returns the channel events are delivered on, it is closed when the subscription is closed
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns the number of events dropped because the subscriber was too slow
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// SetFilter replaces the topics and addresses the subscription receives
+func (s *Subscription) SetFilter(topics []Topic, addresses []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.topics = make(map[Topic]bool, len(topics))
+	for _, topic := range topics {
+		s.topics[topic] = true
+	}
+	s.addresses = make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		s.addresses[address] = true
+	}
+}
+
+// Close removes the subscription from the bus and closes its channel
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+func (s *Subscription) matches(e Event) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.topics) > 0 && !s.topics[e.Topic] {
+		return false
+	}
+	if len(s.addresses) == 0 {
+		return true
+	}
+	for _, address := range e.Addresses() {
+		if s.addresses[address] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+func TestBus_Filter(t *testing.T) {
+	bus := NewBus()
+
+	all := bus.Subscribe(nil, nil, 0)
+	defer all.Close()
+	bob := bus.Subscribe([]Topic{AddressReceived}, []string{"bob"}, 0)
+	defer bob.Close()
+
+	bus.Publish(Event{Topic: BlockConnected})
+	bus.Publish(Event{Topic: AddressReceived, Address: "alice"})
+	bus.Publish(Event{Topic: AddressReceived, Address: "bob"})
+
+	assert.Len(t, all.Events(), 3)
+	assert.Len(t, bob.Events(), 1)
+	assert.Equal(t, "bob", (<-bob.Events()).Address)
+}
+
+func TestBus_TxnAddresses(t *testing.T) {
+	bus := NewBus()
+
+	sub := bus.Subscribe([]Topic{TxnAccepted}, []string{"carol"}, 0)
+	defer sub.Close()
+
+	txn := transactions.Transaction{Outputs: []transactions.TxnOutput{{Value: 1, ScriptPubKey: "carol"}}}
+	bus.Publish(Event{Topic: TxnAccepted, Txn: &txn})
+
+	assert.Len(t, sub.Events(), 1)
+}
+
+func TestBus_SlowSubscriberDoesNotBlock(t *testing.T) {
+	bus := NewBus()
+
+	slow := bus.Subscribe(nil, nil, 1)
+	defer slow.Close()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			bus.Publish(Event{Topic: BlockConnected})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a slow subscriber")
+	}
+	assert.Equal(t, uint64(9), slow.Dropped())
+}
+
+func TestSubscription_Close(t *testing.T) {
+	bus := NewBus()
+
+	sub := bus.Subscribe(nil, nil, 0)
+	sub.Close()
+	sub.Close()
+
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+	bus.Publish(Event{Topic: BlockConnected})
+}
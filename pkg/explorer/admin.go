@@ -0,0 +1,183 @@
+package explorer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/tdadadavid/block/pkg/chain"
+	"github.com/tdadadavid/block/pkg/store"
+	"github.com/tdadadavid/block/pkg/transactions"
+	"github.com/tdadadavid/block/pkg/wallet"
+)
+
+// maxRequestSize is the largest body the admin API reads from a request
+const maxRequestSize = 1 << 20
+
+// Admin is the HTTP API for operating a running node, unlike the explorer it must not be exposed publicly
+type Admin struct {
+	chain       *chain.Chain
+	walletsPath string
+	mux         *http.ServeMux
+	logger      *slog.Logger
+}
+
+// NewAdmin creates the admin server for the given chain
+//
+// Parameters
+//   - `walletsPath string`: The wallet store backed up with the chain (see wallet.StorePath), empty leaves it out
+//
+// Routes
+//   - `GET /backup`: A consistent snapshot of the chain and its wallets, see chain.Backup, it is restored with
+//     `block restore`
+//   - `POST /transactions`: Mines the signed transaction of the body in a block, see chain.SubmitTransaction
+//   - `POST /generate`: Mines blocks paying their subsidy to an address (see GenerateRequest and chain.Generate)
+//
+// NOTE
+//   - The node holds the chain, so the blocks of a running node are only mined through this API, the websocket
+//     feed of the explorer streams them
+//   - The node does not hold the wallet store, it is only opened while a backup is taken
+func NewAdmin(c *chain.Chain, walletsPath string) *Admin {
+	a := &Admin{
+		chain:       c,
+		walletsPath: walletsPath,
+		mux:         http.NewServeMux(),
+		logger:      slog.Default(),
+	}
+
+	a.mux.HandleFunc("GET /backup", a.handleBackup)
+	a.mux.HandleFunc("POST /transactions", a.handleSubmitTransaction)
+	a.mux.HandleFunc("POST /generate", a.handleGenerate)
+
+	return a
+}
+
+// ServeHTTP implements http.Handler
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the admin API on the given address until the context is cancelled
+func (a *Admin) ListenAndServe(ctx context.Context, addr string) error {
+	a.logger.Info("admin listening", slog.String("addr", addr))
+	return listenAndServe(ctx, addr, a)
+}
+
+func (a *Admin) handleBackup(w http.ResponseWriter, r *http.Request) {
+	wallets, err := a.openWallets()
+	if err != nil {
+		a.logger.Error("backup failed", slog.Any("error", err))
+		a.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if wallets != nil {
+		defer wallets.Close()
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	out := &countingWriter{w: w}
+	header, err := a.chain.Backup(r.Context(), out, wallets)
+	if err != nil {
+		a.logger.Error("backup failed", slog.Any("error", err))
+		if out.n == 0 {
+			a.writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		// the status is gone with the first byte of the snapshot, aborting tells the client it is incomplete
+		panic(http.ErrAbortHandler)
+	}
+	a.logger.Info("backup sent", slog.String("tip", header.TipHash), slog.Int64("height", int64(header.Height)))
+}
+
+func (a *Admin) handleSubmitTransaction(w http.ResponseWriter, r *http.Request) {
+	var txn transactions.Transaction
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&txn); err != nil {
+		a.writeError(w, http.StatusBadRequest, fmt.Errorf("malformed transaction: %w", err))
+		return
+	}
+
+	b, err := a.chain.SubmitTransaction(r.Context(), txn)
+	if errors.Is(err, chain.ErrInvalidTransaction) {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		a.logger.Error("transaction not mined", slog.String("txn", txn.GetId()), slog.Any("error", err))
+		a.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	a.writeJSON(w, http.StatusOK, b)
+}
+
+// GenerateRequest asks the node to mine blocks
+type GenerateRequest struct {
+	// Blocks is the number of blocks to mine
+	Blocks int `json:"blocks"`
+
+	// Address is paid the subsidy of every block
+	Address string `json:"address"`
+}
+
+func (a *Admin) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	var req GenerateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+		a.writeError(w, http.StatusBadRequest, fmt.Errorf("malformed request: %w", err))
+		return
+	}
+
+	blocks, err := a.chain.Generate(r.Context(), req.Blocks, req.Address)
+	if errors.Is(err, wallet.ErrInvalidAddress) || errors.Is(err, chain.ErrInvalidCount) {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		a.logger.Error("generate failed", slog.Int("mined", len(blocks)), slog.Any("error", err))
+		a.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	a.writeJSON(w, http.StatusOK, blocks)
+}
+
+func (a *Admin) writeError(w http.ResponseWriter, status int, err error) {
+	a.writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (a *Admin) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.logger.Error("failed to encode response", slog.Any("error", err))
+	}
+}
+
+// openWallets opens the wallet store for a backup, there is none when no wallet was ever created
+func (a *Admin) openWallets() (store.Storage, error) {
+	if a.walletsPath == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(a.walletsPath); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	wallets, err := store.Open(a.walletsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the wallets: %w", err)
+	}
+	return wallets, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,117 @@
+package explorer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/chain"
+	"github.com/tdadadavid/block/pkg/events"
+	"github.com/tdadadavid/block/pkg/params"
+	"github.com/tdadadavid/block/pkg/store"
+	"github.com/tdadadavid/block/pkg/transactions"
+	"golang.org/x/net/websocket"
+)
+
+func TestAdmin_Backup(t *testing.T) {
+	ctx := context.Background()
+	bc, _, address := servedChain(t)
+	generate(t, &bc, 1, address)
+	tip, err := bc.FindLast()
+	assert.NoError(t, err)
+
+	walletsPath := filepath.Join(t.TempDir(), "wallets")
+	wallets, err := store.Open(walletsPath)
+	assert.NoError(t, err)
+	assert.NoError(t, wallets.CreateWallet(ctx, address, []byte("wallet")))
+	assert.NoError(t, wallets.Close())
+
+	rec := httptest.NewRecorder()
+	NewAdmin(&bc, walletsPath).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/backup", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	restoredWallets := filepath.Join(t.TempDir(), "wallets")
+	header, err := chain.Restore(bytes.NewReader(rec.Body.Bytes()), filepath.Join(t.TempDir(), "blocks"), restoredWallets, false)
+	assert.NoError(t, err)
+	assert.Equal(t, tip.GetHash(), header.TipHash)
+	assert.Equal(t, int32(1), header.Height)
+
+	restored, err := store.Open(restoredWallets)
+	assert.NoError(t, err)
+	defer restored.Close()
+	found, err := restored.FindAllWallets(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("wallet")}, found)
+}
+
+func post(t *testing.T, admin *Admin, path string, body any) *httptest.ResponseRecorder {
+	data, err := json.Marshal(body)
+	assert.NoError(t, err)
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data)))
+	return rec
+}
+
+func TestAdmin_WritesReachSubscribers(t *testing.T) {
+	bc, w, address := servedChain(t)
+	_, bob := newWallet(t)
+	admin := NewAdmin(&bc, "")
+	ts := httptest.NewServer(New(&bc))
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?topics=block.connected,address.received&addresses=" + address + "," + bob
+	conn, err := websocket.Dial(url, "", ts.URL)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// the subscription is registered once the first mined block is streamed
+	var mined []block.Block
+	assert.Eventually(t, func() bool {
+		rec := post(t, admin, "/generate", GenerateRequest{Blocks: 1, Address: address})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&mined))
+		assert.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		var e events.Event
+		return websocket.JSON.Receive(conn, &e) == nil && e.Block != nil && e.Block.GetHash() == mined[0].GetHash()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a submitted transaction is mined and streamed to the subscribers of its addresses
+	coinbase := mined[0].GetTransaction()[0]
+	txn := transactions.Transaction{
+		Inputs:  []transactions.TxnInput{{TxnId: coinbase.GetId(), Output: 0}},
+		Outputs: []transactions.TxnOutput{{Value: coinbase.GetOutputs()[0].Value, ScriptPubKey: bob}},
+	}
+	assert.NoError(t, w.SignInput(&txn, 0, coinbase.GetOutputs()[0], params.Mainnet.Versions()))
+	txn.GenId()
+	rec := post(t, admin, "/transactions", txn)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var b block.Block
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&b))
+	// blocks mined while the subscription was registered may still be queued before them
+	var connected, received bool
+	for !connected || !received {
+		var e events.Event
+		assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		if !assert.NoError(t, websocket.JSON.Receive(conn, &e)) {
+			return
+		}
+		connected = connected || e.Topic == events.BlockConnected && e.Block.GetHash() == b.GetHash()
+		received = received || e.Topic == events.AddressReceived && e.Output.TxnId == txn.GetId() && e.Address == bob
+	}
+
+	// invalid writes are refused without touching the chain
+	assert.Equal(t, http.StatusBadRequest, post(t, admin, "/transactions", txn).Code)
+	assert.Equal(t, http.StatusBadRequest, post(t, admin, "/generate", GenerateRequest{Blocks: 1, Address: "mallory"}).Code)
+	assert.Equal(t, http.StatusBadRequest, post(t, admin, "/generate", "not a request").Code)
+	tip, err := bc.FindLast()
+	assert.NoError(t, err)
+	assert.Equal(t, b.GetHash(), tip.GetHash())
+}
@@ -0,0 +1,81 @@
+package explorer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/chain"
+)
+
+// client talks to the explorer API of other nodes
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// BlockSource fetches blocks from the explorer API of another node
+//
+// NOTE
+//   - A node loaded from a UTXO snapshot uses it to replay the history below the snapshot (see chain.ValidateSnapshot)
+//   - It does not check the node follows the same chain, ConnectPeer does
+func BlockSource(baseURL string) chain.BlockSource {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	return func(ctx context.Context, height int32) (*block.Block, error) {
+		var b block.Block
+		if err := getJSON(ctx, baseURL, fmt.Sprintf("/blocks/height/%d", height), &b); err != nil {
+			return nil, err
+		}
+		return &b, nil
+	}
+}
+
+// FetchInfo asks the explorer API of another node which chain it follows (see NodeInfo)
+func FetchInfo(ctx context.Context, baseURL string) (info NodeInfo, err error) {
+	err = getJSON(ctx, strings.TrimSuffix(baseURL, "/"), "/info", &info)
+	return info, err
+}
+
+// ConnectPeer checks another node follows the same chain and returns a source of its blocks
+//
+// Process
+//   - Fetches the info of the node and refuses it unless its genesis hash is the one of the chain
+//
+// Returns
+//   - `chain.BlockSource`: The blocks of the node
+//   - `error`: chain.ErrGenesisMismatch when the node follows another chain or any error reaching it
+func ConnectPeer(ctx context.Context, c *chain.Chain, baseURL string) (chain.BlockSource, error) {
+	info, err := FetchInfo(ctx, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.CheckPeer(ctx, info.GenesisHash); err != nil {
+		return nil, fmt.Errorf("refusing %s (%s): %w", baseURL, info.Network, err)
+	}
+	return BlockSource(baseURL), nil
+}
+
+// getJSON decodes the answer of another node's explorer API to a GET of the path
+func getJSON(ctx context.Context, baseURL, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s answered %s: %s", baseURL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("malformed answer from %s%s: %w", baseURL, path, err)
+	}
+	return nil
+}
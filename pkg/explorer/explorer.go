@@ -0,0 +1,284 @@
+package explorer
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/chain"
+	"github.com/tdadadavid/block/pkg/store"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+const (
+	// DefaultPageLimit is the number of blocks returned when no limit is given
+	DefaultPageLimit = 20
+	// MaxPageLimit is the maximum number of blocks returned in a single page
+	MaxPageLimit = 100
+	// MaxAnchorPageLimit is the maximum number of blocks searched for anchors in a single page, and the default
+	MaxAnchorPageLimit = 1000
+)
+
+// Server is a read-only HTTP API over the chain, it also streams chain events over websockets
+type Server struct {
+	chain  *chain.Chain
+	mux    *http.ServeMux
+	logger *slog.Logger
+}
+
+// BlocksPage is a page of blocks, newest first
+type BlocksPage struct {
+	Blocks []*block.Block `json:"blocks"`
+	Next   string         `json:"next,omitempty"`
+}
+
+// AnchorsPage holds the anchors found in a page of blocks, newest first
+type AnchorsPage struct {
+	Anchors []chain.Anchor `json:"anchors"`
+	Next    string         `json:"next,omitempty"`
+}
+
+// NodeInfo tells other nodes which chain the node follows and how far it is
+type NodeInfo struct {
+	Network     string `json:"network"`
+	GenesisHash string `json:"genesis_hash"`
+	TipHash     string `json:"tip_hash"`
+	Height      int32  `json:"height"`
+}
+
+// New creates the explorer server for the given chain
+//
+// Routes
+//   - `GET /info`: The network, genesis hash and tip of the node (see NodeInfo)
+//   - `GET /blocks?from=<hash>&limit=<n>`: A page of blocks walking backwards from `from` (defaults to the tip)
+//   - `GET /blocks/{hash}`: The block with the hash
+//   - `GET /blocks/height/{height}`: The block at the height
+//   - `GET /tx/{id}`: The transaction with the id
+//   - `GET /address/{addr}/utxos`: The unspent outputs of the address
+//   - `GET /address/{addr}/history`: The transactions that paid to or spent from the address
+//   - `GET /address/{addr}/balance`: The sum of the unspent outputs of the address
+//   - `GET /anchors?prefix=<hex>&from=<hash>&limit=<n>`: The data outputs whose data starts with the prefix in a page
+//     of `limit` blocks walking backwards from `from` (defaults to the tip)
+//   - `GET /ws?topics=<a,b>&addresses=<a,b>`: A websocket streaming chain events
+func New(c *chain.Chain) *Server {
+	s := &Server{
+		chain:  c,
+		mux:    http.NewServeMux(),
+		logger: slog.Default(),
+	}
+
+	s.mux.HandleFunc("GET /info", s.handleInfo)
+	s.mux.HandleFunc("GET /blocks", s.handleBlocks)
+	s.mux.HandleFunc("GET /blocks/{hash}", s.handleBlock)
+	s.mux.HandleFunc("GET /blocks/height/{height}", s.handleBlockByHeight)
+	s.mux.HandleFunc("GET /tx/{id}", s.handleTxn)
+	s.mux.HandleFunc("GET /address/{addr}/utxos", s.handleAddressUTXOs)
+	s.mux.HandleFunc("GET /address/{addr}/history", s.handleAddressHistory)
+	s.mux.HandleFunc("GET /address/{addr}/balance", s.handleAddressBalance)
+	s.mux.HandleFunc("GET /anchors", s.handleAnchors)
+	s.mux.HandleFunc("GET /ws", s.handleSubscribe)
+
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the API on the given address until the context is cancelled
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	s.logger.Info("explorer listening", slog.String("addr", addr))
+	return listenAndServe(ctx, addr, s)
+}
+
+// listenAndServe serves the handler on the given address until the context is cancelled
+func listenAndServe(ctx context.Context, addr string, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	err := srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) handleBlocks(w http.ResponseWriter, r *http.Request) {
+	limit := DefaultPageLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			s.writeError(w, http.StatusBadRequest, errors.New("limit must be a positive number"))
+			return
+		}
+		limit = min(n, MaxPageLimit)
+	}
+
+	blocks, next, err := s.chain.GetBlocks(r.Context(), r.URL.Query().Get("from"), limit)
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	if blocks == nil {
+		blocks = []*block.Block{}
+	}
+
+	s.writeJSON(w, http.StatusOK, BlocksPage{Blocks: blocks, Next: next})
+}
+
+func (s *Server) handleBlock(w http.ResponseWriter, r *http.Request) {
+	b, err := s.chain.GetBlock(r.Context(), r.PathValue("hash"))
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, b)
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	genesisHash, err := s.chain.GenesisHash(r.Context())
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	tip, err := s.chain.FindLast()
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, NodeInfo{
+		Network:     s.chain.Params().Name,
+		GenesisHash: genesisHash,
+		TipHash:     tip.GetHash(),
+		Height:      tip.GetHeight(),
+	})
+}
+
+func (s *Server) handleBlockByHeight(w http.ResponseWriter, r *http.Request) {
+	height, err := strconv.ParseInt(r.PathValue("height"), 10, 32)
+	if err != nil || height < 0 {
+		s.writeError(w, http.StatusBadRequest, errors.New("height must be a non-negative number"))
+		return
+	}
+
+	b, err := s.chain.GetBlockByHeight(r.Context(), int32(height))
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, b)
+}
+
+func (s *Server) handleTxn(w http.ResponseWriter, r *http.Request) {
+	lookup, err := s.chain.FindTransaction(r.Context(), r.PathValue("id"))
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, lookup)
+}
+
+func (s *Server) handleAddressUTXOs(w http.ResponseWriter, r *http.Request) {
+	utxos, err := s.chain.FindUTXOs(r.Context(), r.PathValue("addr"))
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	if utxos == nil {
+		utxos = []transactions.UTXO{}
+	}
+	s.writeJSON(w, http.StatusOK, utxos)
+}
+
+func (s *Server) handleAddressHistory(w http.ResponseWriter, r *http.Request) {
+	history, err := s.chain.AddressHistory(r.Context(), r.PathValue("addr"))
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	if history == nil {
+		history = []chain.AddressTxn{}
+	}
+	s.writeJSON(w, http.StatusOK, history)
+}
+
+func (s *Server) handleAddressBalance(w http.ResponseWriter, r *http.Request) {
+	balance, err := s.chain.GetBalance(r.Context(), r.PathValue("addr"))
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]int64{"balance": balance})
+}
+
+// handleAnchors searches a page of blocks for data outputs, a page never reads more than MaxAnchorPageLimit blocks
+func (s *Server) handleAnchors(w http.ResponseWriter, r *http.Request) {
+	prefix, err := hex.DecodeString(r.URL.Query().Get("prefix"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, errors.New("prefix must be hexadecimal"))
+		return
+	}
+	limit := MaxAnchorPageLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			s.writeError(w, http.StatusBadRequest, errors.New("limit must be a positive number"))
+			return
+		}
+		limit = min(n, MaxAnchorPageLimit)
+	}
+
+	anchors, next, err := s.chain.GetAnchors(r.Context(), prefix, r.URL.Query().Get("from"), limit)
+	if err != nil {
+		s.writeStoreError(w, err)
+		return
+	}
+	if anchors == nil {
+		anchors = []chain.Anchor{}
+	}
+	s.writeJSON(w, http.StatusOK, AnchorsPage{Anchors: anchors, Next: next})
+}
+
+// writeStoreError maps errors from the chain to HTTP status codes
+func (s *Server) writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		s.writeError(w, http.StatusNotFound, err)
+		return
+	}
+	// a pruned node does not serve the bodies it deleted
+	if errors.Is(err, store.ErrPruned) {
+		s.writeError(w, http.StatusGone, err)
+		return
+	}
+	s.logger.Error("explorer request failed", slog.Any("error", err))
+	s.writeError(w, http.StatusInternalServerError, err)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	s.writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Error("failed to encode response", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,235 @@
+package explorer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/chain"
+	"github.com/tdadadavid/block/pkg/events"
+	"github.com/tdadadavid/block/pkg/params"
+	"github.com/tdadadavid/block/pkg/store"
+	"github.com/tdadadavid/block/pkg/transactions"
+	"github.com/tdadadavid/block/pkg/wallet"
+	"golang.org/x/net/websocket"
+)
+
+// servedChain creates a chain in memory for the server to serve, its genesis pays a new wallet
+func servedChain(t *testing.T, opts ...chain.Option) (bc chain.Chain, w *wallet.Wallet, address string) {
+	t.Parallel()
+	w, address = newWallet(t)
+	bc, err := chain.Create(context.Background(), "", params.Genesis{Address: address}, append(opts, chain.WithInMemoryStore())...)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, bc.Close())
+	})
+	return bc, w, address
+}
+
+func newWallet(t *testing.T) (*wallet.Wallet, string) {
+	w, err := wallet.New()
+	assert.NoError(t, err)
+	address, err := w.GenAddress()
+	assert.NoError(t, err)
+	return w, string(address)
+}
+
+// generate mines blocks paying their subsidy to the address
+func generate(t *testing.T, bc *chain.Chain, n int, address string) []block.Block {
+	blocks, err := bc.Generate(context.Background(), n, address)
+	assert.NoError(t, err)
+	return blocks
+}
+
+func get(t *testing.T, srv *Server, path string, v any) int {
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if v != nil && rec.Code == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(v))
+	}
+	return rec.Code
+}
+
+func TestExplorer_Blocks(t *testing.T) {
+	bc, _, address := servedChain(t)
+	generate(t, &bc, 2, address)
+	srv := New(&bc)
+
+	var page BlocksPage
+	assert.Equal(t, http.StatusOK, get(t, srv, "/blocks?limit=2", &page))
+	assert.Len(t, page.Blocks, 2)
+	assert.Equal(t, int32(2), page.Blocks[0].GetHeight())
+	assert.Equal(t, page.Blocks[1].GetPrevBlockHash(), page.Next)
+
+	var rest BlocksPage
+	assert.Equal(t, http.StatusOK, get(t, srv, "/blocks?limit=2&from="+page.Next, &rest))
+	assert.Len(t, rest.Blocks, 1)
+	assert.Empty(t, rest.Next)
+
+	var byHeight struct {
+		Hash string `json:"hash"`
+	}
+	assert.Equal(t, http.StatusOK, get(t, srv, "/blocks/height/1", &byHeight))
+	assert.Equal(t, page.Blocks[1].GetHash(), byHeight.Hash)
+
+	assert.Equal(t, http.StatusNotFound, get(t, srv, "/blocks/height/9", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, srv, "/blocks?limit=-1", nil))
+}
+
+func TestExplorer_PrunedBlocks(t *testing.T) {
+	s, err := store.OpenInMemory(store.WithMaxBlockFileSize(300))
+	assert.NoError(t, err)
+	bc, _, address := servedChain(t, chain.WithStore(s))
+	generate(t, &bc, 4, address)
+	_, err = s.Prune(context.Background(), 2)
+	assert.NoError(t, err)
+	srv := New(&bc)
+
+	// old bodies are gone for good, recent ones are still served
+	assert.Equal(t, http.StatusGone, get(t, srv, "/blocks/height/0", nil))
+	assert.Equal(t, http.StatusOK, get(t, srv, "/blocks/height/4", nil))
+}
+
+func TestExplorer_TxnAndAddress(t *testing.T) {
+	bc, _, _ := servedChain(t)
+	_, bob := newWallet(t)
+	tx1 := generate(t, &bc, 1, bob)[0].GetTransaction()[0].GetId()
+	srv := New(&bc)
+
+	var txn chain.TxnLookup
+	assert.Equal(t, http.StatusOK, get(t, srv, "/tx/"+tx1, &txn))
+	assert.Equal(t, int32(1), txn.Height)
+	assert.Equal(t, int32(1), txn.Confirmations)
+	assert.Equal(t, tx1, txn.Txn.GetId())
+
+	var utxos []transactions.UTXO
+	assert.Equal(t, http.StatusOK, get(t, srv, "/address/"+bob+"/utxos", &utxos))
+	assert.Len(t, utxos, 1)
+	assert.Equal(t, int64(100), utxos[0].Value)
+
+	var history []chain.AddressTxn
+	assert.Equal(t, http.StatusOK, get(t, srv, "/address/"+bob+"/history", &history))
+	assert.Len(t, history, 1)
+	assert.Equal(t, tx1, history[0].TxnId)
+
+	assert.Equal(t, http.StatusNotFound, get(t, srv, "/tx/missing", nil))
+}
+
+func TestExplorer_Anchors(t *testing.T) {
+	bc, w, address := servedChain(t)
+	data, err := transactions.NewDataOutput([]byte("hello"))
+	assert.NoError(t, err)
+	genesis, err := bc.FindLast()
+	assert.NoError(t, err)
+	coinbase := genesis.GetTransaction()[0]
+	txn := transactions.Transaction{
+		Inputs:  []transactions.TxnInput{{TxnId: coinbase.GetId(), Output: 0}},
+		Outputs: []transactions.TxnOutput{{Value: 100, ScriptPubKey: address}, data},
+	}
+	assert.NoError(t, w.SignInput(&txn, 0, coinbase.GetOutputs()[0], params.Mainnet.Versions()))
+	txn.GenId()
+	_, err = bc.SubmitTransaction(context.Background(), txn)
+	assert.NoError(t, err)
+	srv := New(&bc)
+
+	var page AnchorsPage
+	assert.Equal(t, http.StatusOK, get(t, srv, "/anchors?prefix=6865", &page))
+	assert.Len(t, page.Anchors, 1)
+	assert.Equal(t, txn.GetId(), page.Anchors[0].TxnId)
+	assert.Equal(t, "68656c6c6f", page.Anchors[0].Data)
+	assert.Empty(t, page.Next)
+
+	// a page searches limit blocks and points at the next one
+	page = AnchorsPage{}
+	assert.Equal(t, http.StatusOK, get(t, srv, "/anchors?prefix=6865&limit=1&from="+genesis.GetHash(), &page))
+	assert.Empty(t, page.Anchors)
+	assert.Empty(t, page.Next)
+	page = AnchorsPage{}
+	assert.Equal(t, http.StatusOK, get(t, srv, "/anchors?limit=1", &page))
+	assert.Len(t, page.Anchors, 1)
+	assert.Equal(t, genesis.GetHash(), page.Next)
+
+	assert.Equal(t, http.StatusOK, get(t, srv, "/anchors?prefix=ff", &page))
+	assert.Empty(t, page.Anchors)
+	assert.Equal(t, http.StatusBadRequest, get(t, srv, "/anchors?prefix=zz", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, srv, "/anchors?limit=0", nil))
+}
+
+func TestExplorer_Subscribe(t *testing.T) {
+	bc, _, _ := servedChain(t)
+	_, bob := newWallet(t)
+	ts := httptest.NewServer(New(&bc))
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?topics=address.received&addresses=" + bob
+	conn, err := websocket.Dial(url, "", ts.URL)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// wait for the server to register the subscription
+	assert.Eventually(t, func() bool {
+		generate(t, &bc, 1, bob)
+		assert.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		var e events.Event
+		return websocket.JSON.Receive(conn, &e) == nil && e.Address == bob
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// switching the filter to blocks only
+	assert.NoError(t, websocket.JSON.Send(conn, SubscribeRequest{Topics: []events.Topic{events.BlockConnected}}))
+	assert.Eventually(t, func() bool {
+		generate(t, &bc, 1, bob)
+		assert.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		var e events.Event
+		return websocket.JSON.Receive(conn, &e) == nil && e.Topic == events.BlockConnected
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestExplorer_BlockSource(t *testing.T) {
+	bc, _, address := servedChain(t)
+	generate(t, &bc, 1, address)
+	srv := httptest.NewServer(New(&bc))
+	defer srv.Close()
+
+	want, err := bc.GetBlockByHeight(context.Background(), 1)
+	assert.NoError(t, err)
+	got, err := BlockSource(srv.URL)(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, want.GetHash(), got.GetHash())
+	assert.Equal(t, want.GetTransaction(), got.GetTransaction())
+
+	_, err = BlockSource(srv.URL)(context.Background(), 5)
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestExplorer_ConnectPeer(t *testing.T) {
+	bc, _, address := servedChain(t)
+	generate(t, &bc, 1, address)
+	srv := httptest.NewServer(New(&bc))
+	defer srv.Close()
+
+	info, err := FetchInfo(context.Background(), srv.URL)
+	assert.NoError(t, err)
+	genesis, err := bc.GetBlockByHeight(context.Background(), 0)
+	assert.NoError(t, err)
+	tip, err := bc.FindLast()
+	assert.NoError(t, err)
+	assert.Equal(t, NodeInfo{Network: "mainnet", GenesisHash: genesis.GetHash(), TipHash: tip.GetHash(), Height: 1}, info)
+
+	source, err := ConnectPeer(context.Background(), &bc, srv.URL)
+	assert.NoError(t, err)
+	b, err := source(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, tip.GetHash(), b.GetHash())
+
+	// a chain with another genesis block is refused
+	other := chain.NewChain(context.Background(), "other", "mallory", chain.WithInMemoryStore())
+	defer other.Close()
+	_, err = ConnectPeer(context.Background(), &other, srv.URL)
+	assert.ErrorIs(t, err, chain.ErrGenesisMismatch)
+}
@@ -0,0 +1,85 @@
+package explorer
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tdadadavid/block/pkg/events"
+	"golang.org/x/net/websocket"
+)
+
+// writeTimeout bounds how long a single event may take to reach a websocket client
+const writeTimeout = 10 * time.Second
+
+// SubscribeRequest is the message a websocket client sends to choose what it receives
+//
+// NOTE
+//   - Every message replaces the previous filter of the connection
+//   - Empty topics means every topic and empty addresses means no address filtering
+type SubscribeRequest struct {
+	Topics    []events.Topic `json:"topics"`
+	Addresses []string       `json:"addresses"`
+}
+
+// handleSubscribe upgrades the request to a websocket streaming chain events
+//
+// Process
+//   - The initial filter is read from the `topics` and `addresses` query parameters (comma separated)
+//   - The client can change the filter at any time by sending a SubscribeRequest
+//   - Events are buffered per connection, a client that can't keep up loses events instead of slowing down the chain
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	var topics []events.Topic
+	for _, topic := range splitList(r.URL.Query().Get("topics")) {
+		topics = append(topics, events.Topic(topic))
+	}
+	addresses := splitList(r.URL.Query().Get("addresses"))
+
+	wsServer := websocket.Server{
+		// the API is read-only, so any origin may subscribe
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			defer conn.Close()
+
+			sub := s.chain.Events().Subscribe(topics, addresses, events.DefaultBuffer)
+			defer sub.Close()
+
+			go s.readSubscriptions(conn, sub)
+
+			for e := range sub.Events() {
+				if err := conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+					return
+				}
+				if err := websocket.JSON.Send(conn, e); err != nil {
+					s.logger.Debug("websocket client gone", slog.Any("error", err))
+					return
+				}
+			}
+		},
+	}
+	wsServer.ServeHTTP(w, r)
+}
+
+// readSubscriptions applies the filters sent by the client until the connection is closed
+func (s *Server) readSubscriptions(conn *websocket.Conn, sub *events.Subscription) {
+	// closing the subscription ends the write loop once the client goes away
+	defer sub.Close()
+
+	for {
+		var req SubscribeRequest
+		if err := websocket.JSON.Receive(conn, &req); err != nil {
+			return
+		}
+		sub.SetFilter(req.Topics, req.Addresses)
+	}
+}
+
+func splitList(v string) (items []string) {
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,297 @@
+package htlc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/tdadadavid/block/pkg/chain"
+	"github.com/tdadadavid/block/pkg/params"
+	"github.com/tdadadavid/block/pkg/script"
+	"github.com/tdadadavid/block/pkg/toolkit"
+	"github.com/tdadadavid/block/pkg/transactions"
+	"github.com/tdadadavid/block/pkg/wallet"
+)
+
+var (
+	// ErrNotContract is returned when a script is not the script of a hash time-locked contract
+	ErrNotContract = errors.New("not a hash time-locked contract")
+
+	// ErrNoSecret is returned when the secret of a contract was not revealed on a chain yet
+	ErrNoSecret = errors.New("secret not revealed")
+
+	// ErrNothingToSpend is returned when a contract is claimed or refunded without outputs paid to it
+	ErrNothingToSpend = errors.New("no output is paid to the contract")
+)
+
+// Contract is a hash time-locked contract: outputs paid to its script address are claimed by the receiver with
+// the secret of the hash, or refunded to the sender once the timeout is reached
+//
+// NOTE
+//   - An atomic swap locks the coins of both parties on their chains with contracts of the same hash. The one who
+//     knows the secret claims first, which reveals the secret to the other one (see FindSecret). The contract of the
+//     one who knows the secret times out later, so the other one always has time to claim after the secret is revealed
+type Contract struct {
+	// RedeemScript is the hexadecimal script of the contract, every other field is derived from it
+	RedeemScript string `json:"redeem_script"`
+
+	// Address is the script address of the network outputs are paid to
+	Address string `json:"address"`
+
+	// Hash is the hexadecimal SHA256 hash of the secret
+	Hash string `json:"hash"`
+
+	// Receiver is the address that claims the outputs with the secret
+	Receiver string `json:"receiver"`
+
+	// Sender is the address that refunds the outputs after the timeout
+	Sender string `json:"sender"`
+
+	// Timeout is the height, or unix time, from which the sender can refund the outputs
+	Timeout int64 `json:"timeout"`
+}
+
+// NewSecret returns a random secret and its hash, the hash is shared and the secret kept until it is claimed
+func NewSecret() (secret, hash []byte, err error) {
+	secret = make([]byte, script.SecretSize)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, nil, fmt.Errorf("err generating secret: %w", err)
+	}
+	sum := sha256.Sum256(secret)
+	return secret, sum[:], nil
+}
+
+// New writes the contract of the terms
+//
+// Parameters
+//   - `p *params.Params`: The network of the addresses
+//   - `hash []byte`: The SHA256 hash of the secret
+//   - `receiver string`: The wallet address that claims the outputs with the secret
+//   - `sender string`: The wallet address that refunds the outputs after the timeout
+//   - `timeout int64`: The height, below transactions.LockTimeThreshold, or the unix time the refund is possible from
+//
+// Returns
+//   - `Contract`: The contract
+//   - `error`: wallet.ErrInvalidAddress or terms a script can't hold
+func New(p *params.Params, hash []byte, receiver, sender string, timeout int64) (Contract, error) {
+	receiverHash, err := wallet.DecodeAddressFor(receiver, p.AddressVersion)
+	if err != nil {
+		return Contract{}, fmt.Errorf("receiver: %w", err)
+	}
+	senderHash, err := wallet.DecodeAddressFor(sender, p.AddressVersion)
+	if err != nil {
+		return Contract{}, fmt.Errorf("sender: %w", err)
+	}
+
+	redeem, err := script.HashTimeLock{Hash: hash, Receiver: receiverHash, Sender: senderHash, Timeout: timeout}.Script()
+	if err != nil {
+		return Contract{}, err
+	}
+	return Parse(p, redeem)
+}
+
+// Parse reads the contract of a redeem script, the counterparty of a swap checks the terms it is given this way
+//
+// Returns
+//   - `Contract`: The contract
+//   - `error`: ErrNotContract when the script is not the script of a contract
+func Parse(p *params.Params, redeem script.Script) (Contract, error) {
+	terms, ok := redeem.HashTimeLock()
+	if !ok {
+		return Contract{}, fmt.Errorf("%w: %s", ErrNotContract, redeem)
+	}
+	address, err := wallet.ScriptAddressFor(redeem, p.ScriptAddressVersion)
+	if err != nil {
+		return Contract{}, err
+	}
+
+	return Contract{
+		RedeemScript: redeem.Hex(),
+		Address:      string(address),
+		Hash:         hex.EncodeToString(terms.Hash),
+		Receiver:     string(wallet.EncodeAddress(terms.Receiver, p.AddressVersion)),
+		Sender:       string(wallet.EncodeAddress(terms.Sender, p.AddressVersion)),
+		Timeout:      terms.Timeout,
+	}, nil
+}
+
+// Terms returns the redeem script of the contract and the terms it holds
+func (c Contract) Terms() (redeem script.Script, terms script.HashTimeLock, err error) {
+	if redeem, err = script.ParseHex(c.RedeemScript); err != nil {
+		return nil, terms, err
+	}
+	terms, ok := redeem.HashTimeLock()
+	if !ok {
+		return nil, terms, fmt.Errorf("%w: %s", ErrNotContract, redeem)
+	}
+	return redeem, terms, nil
+}
+
+// Claim spends the outputs paid to the contract with the secret, it reveals the secret on the chain
+//
+// Parameters
+//   - `utxos []transactions.UTXO`: The outputs paid to the contract, see chain.Chain.FindUTXOs
+//   - `to string`: Where their value is paid
+//   - `secret []byte`: The secret of the hash
+//   - `w *wallet.Wallet`: The wallet of the receiver
+//
+// Returns
+//   - `transactions.Transaction`: The signed transaction, ready to be submitted
+//   - `error`: ErrNothingToSpend, wallet.ErrNotOwner, a secret that does not match the hash or an error while signing
+func (c Contract) Claim(utxos []transactions.UTXO, to string, secret []byte, w *wallet.Wallet) (transactions.Transaction, error) {
+	_, terms, err := c.Terms()
+	if err != nil {
+		return transactions.Transaction{}, err
+	}
+	if hash := sha256.Sum256(secret); len(secret) != script.SecretSize || !bytes.Equal(hash[:], terms.Hash) {
+		return transactions.Transaction{}, fmt.Errorf("the secret does not match the hash %s", c.Hash)
+	}
+
+	return c.spend(utxos, to, terms.Receiver, 0, w, func(sig []byte) (script.Script, error) {
+		return script.ClaimScript(sig, w.GetPublicKey(), secret)
+	})
+}
+
+// Refund spends the outputs paid to the contract back to the sender once the timeout is reached
+//
+// Parameters
+//   - `utxos []transactions.UTXO`: The outputs paid to the contract, see chain.Chain.FindUTXOs
+//   - `to string`: Where their value is paid
+//   - `w *wallet.Wallet`: The wallet of the sender
+//
+// NOTE
+//   - The lock time of the transaction is the timeout, the chain refuses it until the timeout is reached
+//
+// Returns
+//   - `transactions.Transaction`: The signed transaction, ready to be submitted
+//   - `error`: ErrNothingToSpend, wallet.ErrNotOwner or an error while signing
+func (c Contract) Refund(utxos []transactions.UTXO, to string, w *wallet.Wallet) (transactions.Transaction, error) {
+	_, terms, err := c.Terms()
+	if err != nil {
+		return transactions.Transaction{}, err
+	}
+
+	return c.spend(utxos, to, terms.Sender, terms.Timeout, w, func(sig []byte) (script.Script, error) {
+		return script.RefundScript(sig, w.GetPublicKey())
+	})
+}
+
+// spend pays the value of the outputs of the contract to an address, every input is unlocked by the script of
+// the wallet's signature followed by the redeem script
+func (c Contract) spend(
+	utxos []transactions.UTXO, to string, owner []byte, lockTime int64, w *wallet.Wallet,
+	unlock func(sig []byte) (script.Script, error),
+) (transactions.Transaction, error) {
+	txn := transactions.Transaction{LockTime: lockTime}
+	if len(utxos) == 0 {
+		return txn, ErrNothingToSpend
+	}
+	pubKeyHash, err := toolkit.PublicKeyHash(w.GetPublicKey())
+	if err != nil {
+		return txn, err
+	}
+	if !bytes.Equal(pubKeyHash, owner) {
+		return txn, fmt.Errorf("%w: the wallet can't spend %s this way", wallet.ErrNotOwner, c.Address)
+	}
+
+	var value int64
+	for _, utxo := range utxos {
+		if utxo.ScriptPubKey != c.Address {
+			return txn, fmt.Errorf("%s:%d is not paid to the contract %s", utxo.TxnId, utxo.Vout, c.Address)
+		}
+		txn.Inputs = append(txn.Inputs, transactions.TxnInput{TxnId: utxo.TxnId, Output: utxo.Vout})
+		value += utxo.Value
+	}
+	txn.Outputs = []transactions.TxnOutput{{Value: value, ScriptPubKey: to}}
+
+	redeem, _, err := c.Terms()
+	if err != nil {
+		return txn, err
+	}
+	for index := range txn.Inputs {
+		hash, err := txn.SignatureHash(index, redeem)
+		if err != nil {
+			return txn, err
+		}
+		sig, err := w.Sign(hash)
+		if err != nil {
+			return txn, err
+		}
+		sigScript, err := unlock(sig)
+		if err == nil {
+			sigScript, err = script.RedeemScript(sigScript, redeem)
+		}
+		if err != nil {
+			return txn, err
+		}
+		txn.Inputs[index].ScriptSignature = sigScript.Hex()
+	}
+	txn.GenId()
+	return txn, nil
+}
+
+// ExtractSecret returns the secret a transaction revealed when it claimed an output locked to the hash
+//
+// Returns
+//   - `[]byte`: The secret
+//   - `bool`: false when no input of the transaction pushes the secret
+func ExtractSecret(txn transactions.Transaction, hash []byte) ([]byte, bool) {
+	for _, in := range txn.GetInputs() {
+		sigScript, err := script.ParseHex(in.ScriptSignature)
+		if err != nil {
+			continue
+		}
+		instructions, err := sigScript.Instructions()
+		if err != nil {
+			continue
+		}
+		for _, instruction := range instructions {
+			if sum := sha256.Sum256(instruction.Data); len(instruction.Data) == script.SecretSize && bytes.Equal(sum[:], hash) {
+				return instruction.Data, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// FindSecret finds the secret revealed by the claim of a contract on a chain
+//
+// Process
+//   - Looks for the transactions that spent outputs paid to the contract (see chain.Chain.AddressHistory)
+//   - Extracts the secret from their signature scripts
+//
+// NOTE
+//   - In a swap, the party that does not know the secret looks for it on the chain of the contract it wrote,
+//     the other party revealed it there when it claimed the contract
+//
+// Returns
+//   - `[]byte`: The secret
+//   - `error`: ErrNoSecret when the contract was not claimed, or an error while reading the chain
+func FindSecret(ctx context.Context, bc *chain.Chain, c Contract) ([]byte, error) {
+	hash, err := hex.DecodeString(c.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hash %q: %w", c.Hash, err)
+	}
+	history, err := bc.AddressHistory(ctx, c.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range history {
+		if entry.Sent == 0 {
+			continue
+		}
+		lookup, err := bc.FindTransaction(ctx, entry.TxnId)
+		if err != nil {
+			return nil, err
+		}
+		if secret, ok := ExtractSecret(lookup.Txn, hash); ok {
+			return secret, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoSecret, c.Address)
+}
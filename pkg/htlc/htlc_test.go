@@ -0,0 +1,203 @@
+package htlc
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/chain"
+	"github.com/tdadadavid/block/pkg/params"
+	"github.com/tdadadavid/block/pkg/script"
+	"github.com/tdadadavid/block/pkg/transactions"
+	"github.com/tdadadavid/block/pkg/wallet"
+)
+
+// party is someone trading on the regtest chains
+type party struct {
+	wallet  *wallet.Wallet
+	address string
+}
+
+func newParty(t *testing.T) party {
+	w, err := wallet.New()
+	assert.NoError(t, err)
+	address, err := w.GenAddressFor(params.Regtest.AddressVersion)
+	assert.NoError(t, err)
+	return party{wallet: w, address: string(address)}
+}
+
+// openChain creates a regtest chain in memory whose genesis pays the party, the message tells the chains apart
+func openChain(t *testing.T, message string, funded party) *chain.Chain {
+	clock := block.StepClock(time.Unix(params.Regtest.Genesis.Timestamp, 0), 10*time.Minute)
+	genesis := params.Genesis{Timestamp: params.Regtest.Genesis.Timestamp, CoinbaseData: message, Address: funded.address}
+	bc, err := chain.Create(context.Background(), "", genesis, chain.WithParams(params.Regtest), chain.WithClock(clock), chain.WithInMemoryStore())
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, bc.Close())
+	})
+	return &bc
+}
+
+// fund pays every output of the party on the chain to the contract
+func fund(t *testing.T, bc *chain.Chain, from party, c Contract) {
+	ctx := context.Background()
+	utxos, err := bc.FindUTXOs(ctx, from.address)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, utxos)
+
+	var txn transactions.Transaction
+	var value int64
+	for _, utxo := range utxos {
+		txn.Inputs = append(txn.Inputs, transactions.TxnInput{TxnId: utxo.TxnId, Output: utxo.Vout})
+		value += utxo.Value
+	}
+	txn.Outputs = []transactions.TxnOutput{{Value: value, ScriptPubKey: c.Address}}
+	for index, utxo := range utxos {
+		assert.NoError(t, from.wallet.SignInput(&txn, index, utxo.TxnOutput, params.Regtest.Versions()))
+	}
+	txn.GenId()
+	_, err = bc.SubmitTransaction(ctx, txn)
+	assert.NoError(t, err)
+}
+
+func balance(t *testing.T, bc *chain.Chain, address string) int64 {
+	b, err := bc.GetBalance(context.Background(), address)
+	assert.NoError(t, err)
+	return b
+}
+
+func TestContract_New(t *testing.T) {
+	alice, bob := newParty(t), newParty(t)
+	_, hash, err := NewSecret()
+	assert.NoError(t, err)
+
+	c, err := New(params.Regtest, hash, bob.address, alice.address, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, bob.address, c.Receiver)
+	assert.Equal(t, alice.address, c.Sender)
+	assert.Equal(t, hex.EncodeToString(hash), c.Hash)
+
+	// the counterparty reads the same contract from the script alone
+	redeem, _, err := c.Terms()
+	assert.NoError(t, err)
+	parsed, err := Parse(params.Regtest, redeem)
+	assert.NoError(t, err)
+	assert.Equal(t, c, parsed)
+
+	_, err = Parse(params.Regtest, script.Script{byte(script.OP_1)})
+	assert.ErrorIs(t, err, ErrNotContract)
+	_, err = New(params.Regtest, hash, "bob", alice.address, 10)
+	assert.ErrorIs(t, err, wallet.ErrInvalidAddress)
+	_, err = New(params.Regtest, hash[1:], bob.address, alice.address, 10)
+	assert.Error(t, err)
+}
+
+func TestContract_Swap(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := newParty(t), newParty(t)
+	chainA := openChain(t, "chain a", alice)
+	chainB := openChain(t, "chain b", bob)
+	amountA, amountB := balance(t, chainA, alice.address), balance(t, chainB, bob.address)
+
+	// alice knows the secret, she locks her coins on chain A to bob with the longer timeout
+	secret, hash, err := NewSecret()
+	assert.NoError(t, err)
+	contractA, err := New(params.Regtest, hash, bob.address, alice.address, 20)
+	assert.NoError(t, err)
+	fund(t, chainA, alice, contractA)
+
+	// bob checks the terms alice gave him and locks his coins on chain B to her with the same hash
+	redeemA, termsA, err := contractA.Terms()
+	assert.NoError(t, err)
+	checked, err := Parse(params.Regtest, redeemA)
+	assert.NoError(t, err)
+	assert.Equal(t, bob.address, checked.Receiver)
+	contractB, err := New(params.Regtest, termsA.Hash, alice.address, bob.address, 10)
+	assert.NoError(t, err)
+	fund(t, chainB, bob, contractB)
+	_, err = FindSecret(ctx, chainB, contractB)
+	assert.ErrorIs(t, err, ErrNoSecret)
+
+	// alice claims on chain B, bob can't claim in her place and she can't refund it
+	utxosB, err := chainB.FindUTXOs(ctx, contractB.Address)
+	assert.NoError(t, err)
+	_, err = contractB.Claim(utxosB, bob.address, secret, bob.wallet)
+	assert.ErrorIs(t, err, wallet.ErrNotOwner)
+	_, err = contractB.Refund(utxosB, alice.address, alice.wallet)
+	assert.ErrorIs(t, err, wallet.ErrNotOwner)
+	claimB, err := contractB.Claim(utxosB, alice.address, secret, alice.wallet)
+	assert.NoError(t, err)
+	_, err = chainB.SubmitTransaction(ctx, claimB)
+	assert.NoError(t, err)
+
+	// which reveals the secret bob claims chain A with
+	revealed, err := FindSecret(ctx, chainB, contractB)
+	assert.NoError(t, err)
+	assert.Equal(t, secret, revealed)
+	utxosA, err := chainA.FindUTXOs(ctx, contractA.Address)
+	assert.NoError(t, err)
+	claimA, err := contractA.Claim(utxosA, bob.address, revealed, bob.wallet)
+	assert.NoError(t, err)
+	_, err = chainA.SubmitTransaction(ctx, claimA)
+	assert.NoError(t, err)
+
+	// the contract is spent, bob can't claim it twice and alice can't refund it once the timeout passed
+	carol := newParty(t)
+	again, err := contractA.Claim(utxosA, carol.address, revealed, bob.wallet)
+	assert.NoError(t, err)
+	_, err = chainA.SubmitTransaction(ctx, again)
+	assert.ErrorIs(t, err, chain.ErrMissingOutput)
+	_, err = chainA.Generate(ctx, 20, carol.address)
+	assert.NoError(t, err)
+	refundA, err := contractA.Refund(utxosA, alice.address, alice.wallet)
+	assert.NoError(t, err)
+	_, err = chainA.SubmitTransaction(ctx, refundA)
+	assert.ErrorIs(t, err, chain.ErrMissingOutput)
+
+	assert.Equal(t, amountA, balance(t, chainA, bob.address))
+	assert.Equal(t, amountB, balance(t, chainB, alice.address))
+	assert.Zero(t, balance(t, chainA, contractA.Address))
+	assert.Zero(t, balance(t, chainB, contractB.Address))
+}
+
+func TestContract_Refund(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := newParty(t), newParty(t)
+	bc := openChain(t, "refund", alice)
+	amount := balance(t, bc, alice.address)
+
+	secret, hash, err := NewSecret()
+	assert.NoError(t, err)
+	c, err := New(params.Regtest, hash, bob.address, alice.address, 5)
+	assert.NoError(t, err)
+	fund(t, bc, alice, c)
+
+	utxos, err := bc.FindUTXOs(ctx, c.Address)
+	assert.NoError(t, err)
+	_, err = c.Claim(utxos, bob.address, make([]byte, script.SecretSize), bob.wallet)
+	assert.Error(t, err)
+
+	// the refund is only mined from the timeout on
+	refund, err := c.Refund(utxos, alice.address, alice.wallet)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), refund.LockTime)
+	_, err = bc.SubmitTransaction(ctx, refund)
+	assert.ErrorIs(t, err, transactions.ErrNotFinal)
+	_, err = bc.Generate(ctx, 3, bob.address)
+	assert.NoError(t, err)
+	_, err = bc.SubmitTransaction(ctx, refund)
+	assert.NoError(t, err)
+	assert.Equal(t, amount, balance(t, bc, alice.address))
+
+	// the refunded contract can't be claimed with the secret nor refunded twice
+	claim, err := c.Claim(utxos, bob.address, secret, bob.wallet)
+	assert.NoError(t, err)
+	_, err = bc.SubmitTransaction(ctx, claim)
+	assert.ErrorIs(t, err, chain.ErrMissingOutput)
+	_, err = bc.SubmitTransaction(ctx, refund)
+	assert.ErrorIs(t, err, chain.ErrMissingOutput)
+	assert.Zero(t, balance(t, bc, c.Address))
+}
@@ -0,0 +1,108 @@
+package mempool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/tdadadavid/block/pkg/events"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+var (
+	// ErrMissingId is returned when a transaction without an id is added to the pool
+	ErrMissingId = errors.New("transaction has no id")
+	// ErrDuplicate is returned when the transaction is already in the pool
+	ErrDuplicate = errors.New("transaction already in mempool")
+)
+
+// Pool holds the transactions waiting to be included in a block
+type Pool struct {
+	mu    sync.RWMutex
+	txns  map[string]transactions.Transaction
+	order []string
+	bus   *events.Bus
+}
+
+// New creates an empty pool that announces accepted transactions on the given bus
+func New(bus *events.Bus) *Pool {
+	return &Pool{
+		txns: make(map[string]transactions.Transaction),
+		bus:  bus,
+	}
+}
+
+// Add admits a transaction into the pool
+//
+// Process
+//   - Rejects transactions without an id and transactions already in the pool
+//   - Publishes an events.TxnAccepted event once the transaction is admitted
+//
+// Returns
+//   - `error`: The reason the transaction was rejected
+func (p *Pool) Add(txn transactions.Transaction) error {
+	if txn.GetId() == "" {
+		return ErrMissingId
+	}
+
+	p.mu.Lock()
+	if _, ok := p.txns[txn.GetId()]; ok {
+		p.mu.Unlock()
+		return fmt.Errorf("%s: %w", txn.GetId(), ErrDuplicate)
+	}
+	p.txns[txn.GetId()] = txn
+	p.order = append(p.order, txn.GetId())
+	p.mu.Unlock()
+
+	if p.bus != nil {
+		p.bus.Publish(events.Event{Topic: events.TxnAccepted, Txn: &txn})
+	}
+	return nil
+}
+
+// Get returns the transaction with the given id if it is in the pool
+func (p *Pool) Get(id string) (transactions.Transaction, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	txn, ok := p.txns[id]
+	return txn, ok
+}
+
+// Transactions returns the transactions in the pool in the order they were admitted
+func (p *Pool) Transactions() []transactions.Transaction {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	txns := make([]transactions.Transaction, 0, len(p.order))
+	for _, id := range p.order {
+		txns = append(txns, p.txns[id])
+	}
+	return txns
+}
+
+// Remove evicts the transactions with the given ids, usually because they were included in a block
+func (p *Pool) Remove(ids ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, id := range ids {
+		delete(p.txns, id)
+	}
+
+	order := p.order[:0]
+	for _, id := range p.order {
+		if _, ok := p.txns[id]; ok {
+			order = append(order, id)
+		}
+	}
+	p.order = order
+}
+
+// Len returns the number of transactions in the pool
+func (p *Pool) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return len(p.txns)
+}
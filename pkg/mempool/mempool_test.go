@@ -0,0 +1,39 @@
+package mempool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/events"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+func TestPool_Add(t *testing.T) {
+	bus := events.NewBus()
+	sub := bus.Subscribe([]events.Topic{events.TxnAccepted}, nil, 0)
+	defer sub.Close()
+
+	pool := New(bus)
+	assert.NoError(t, pool.Add(transactions.Transaction{Id: "tx1"}))
+	assert.ErrorIs(t, pool.Add(transactions.Transaction{Id: "tx1"}), ErrDuplicate)
+	assert.ErrorIs(t, pool.Add(transactions.Transaction{}), ErrMissingId)
+
+	assert.Equal(t, 1, pool.Len())
+	assert.Len(t, sub.Events(), 1)
+}
+
+func TestPool_Remove(t *testing.T) {
+	pool := New(nil)
+	for _, id := range []string{"tx1", "tx2", "tx3"} {
+		assert.NoError(t, pool.Add(transactions.Transaction{Id: id}))
+	}
+
+	pool.Remove("tx2")
+
+	txns := pool.Transactions()
+	assert.Len(t, txns, 2)
+	assert.Equal(t, "tx1", txns[0].GetId())
+	assert.Equal(t, "tx3", txns[1].GetId())
+	_, ok := pool.Get("tx2")
+	assert.False(t, ok)
+}
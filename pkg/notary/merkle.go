@@ -0,0 +1,118 @@
+package notary
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// leafPrefix and nodePrefix are hashed in front of the leaves and of the inner nodes, so a leaf can never be
+// passed off as an inner node of another tree
+const (
+	leafPrefix byte = 0x00
+	nodePrefix byte = 0x01
+)
+
+// Step is a sibling on the path from a leaf to the root of a Tree
+type Step struct {
+	// Hash is the hexadecimal hash of the sibling
+	Hash string `json:"hash"`
+
+	// Left tells whether the sibling is on the left, it is hashed before the node then
+	Left bool `json:"left,omitempty"`
+}
+
+// Tree is a Merkle tree of SHA256 hashes, its root commits to every leaf and a short path proves a leaf is in it
+//
+// NOTE
+//   - A node without a sibling moves up a level as it is instead of being paired with itself, so no two lists of
+//     leaves share a root
+type Tree struct {
+	// levels holds the hashes of every level, the leaves first and the root last
+	levels [][][]byte
+}
+
+// NewTree builds the tree of the leaves
+//
+// Parameters
+//   - `leaves [][]byte`: The hashes committed to, in order
+//
+// Returns
+//   - `*Tree`: The tree
+//   - `error`: When there is no leaf
+func NewTree(leaves [][]byte) (*Tree, error) {
+	if len(leaves) == 0 {
+		return nil, errors.New("a tree needs at least one leaf")
+	}
+
+	level := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = hashLeaf(leaf)
+	}
+	t := &Tree{levels: [][][]byte{level}}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, hashNode(level[i], level[i+1]))
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+	return t, nil
+}
+
+// Root returns the hash every leaf of the tree leads to
+func (t *Tree) Root() []byte {
+	return t.levels[len(t.levels)-1][0]
+}
+
+// Path returns the siblings from the leaf at the index up to the root, see RootOf
+func (t *Tree) Path(index int) ([]Step, error) {
+	if index < 0 || index >= len(t.levels[0]) {
+		return nil, fmt.Errorf("leaf %d of %d is out of range", index, len(t.levels[0]))
+	}
+
+	var path []Step
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			path = append(path, Step{Hash: hex.EncodeToString(level[sibling]), Left: sibling < index})
+		}
+		index /= 2
+	}
+	return path, nil
+}
+
+// RootOf returns the root a leaf leads to following its path, the leaf is in a tree when it is the tree's root
+func RootOf(leaf []byte, path []Step) ([]byte, error) {
+	hash := hashLeaf(leaf)
+	for i, step := range path {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash of step %d: %w", i, err)
+		}
+		if step.Left {
+			hash = hashNode(sibling, hash)
+		} else {
+			hash = hashNode(hash, sibling)
+		}
+	}
+	return hash, nil
+}
+
+func hashLeaf(leaf []byte) []byte {
+	sum := sha256.Sum256(append([]byte{leafPrefix}, leaf...))
+	return sum[:]
+}
+
+func hashNode(left, right []byte) []byte {
+	data := make([]byte, 0, 1+len(left)+len(right))
+	data = append(append(append(data, nodePrefix), left...), right...)
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
@@ -0,0 +1,196 @@
+package notary
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/chain"
+	"github.com/tdadadavid/block/pkg/store"
+)
+
+var (
+	// ErrHashMismatch is returned when a document is not the one a receipt was written for
+	ErrHashMismatch = errors.New("the document does not match the receipt")
+
+	// ErrInvalidReceipt is returned when the path of a receipt does not lead from its hash to its root
+	ErrInvalidReceipt = errors.New("invalid receipt")
+
+	// ErrNotAnchored is returned when the root of a receipt is not anchored where the receipt says on the chain
+	ErrNotAnchored = errors.New("the receipt is not anchored on the chain")
+)
+
+// Tag starts the data anchoring the root of a batch, chain.Chain.FindAnchors finds every batch with it
+var Tag = []byte("notary:")
+
+// Document is a file whose hash is notarized
+type Document struct {
+	// Name is the name of the file, it is only kept in the receipt for the reader
+	Name string
+
+	// Hash is the SHA256 hash of the file
+	Hash []byte
+}
+
+// Receipt proves a document existed when the block anchoring its batch was mined
+//
+// NOTE
+//   - The receipt holds everything needed to check it but the chain: the path leads from the hash of the document to
+//     the root of its batch, the root is anchored in the data output TxnId:Vout of the block
+type Receipt struct {
+	// Name is the name of the document when it was notarized
+	Name string `json:"name"`
+
+	// Hash is the hexadecimal SHA256 hash of the document
+	Hash string `json:"hash"`
+
+	// Path is the path from the hash to the root of the batch
+	Path []Step `json:"path"`
+
+	// Root is the hexadecimal root of the batch
+	Root string `json:"root"`
+
+	TxnId     string `json:"txid"`
+	Vout      int32  `json:"vout"`
+	BlockHash string `json:"block_hash"`
+	Height    int32  `json:"height"`
+}
+
+// Batch commits to the hashes of many documents with a single anchor
+type Batch struct {
+	Documents []Document
+	tree      *Tree
+}
+
+// HashFile returns the SHA256 hash of the file at the path
+func HashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("err hashing %s: %w", path, err)
+	}
+	return h.Sum(nil), nil
+}
+
+// NewBatch builds the Merkle tree of the hashes of the documents
+//
+// Returns
+//   - `*Batch`: The batch, anchor Batch.Data and write the Batch.Receipts of the anchor
+//   - `error`: When there is no document or a hash is not a SHA256 hash
+func NewBatch(documents []Document) (*Batch, error) {
+	leaves := make([][]byte, len(documents))
+	for i, doc := range documents {
+		if len(doc.Hash) != sha256.Size {
+			return nil, fmt.Errorf("the hash of %s is %d bytes long, expected %d", doc.Name, len(doc.Hash), sha256.Size)
+		}
+		leaves[i] = doc.Hash
+	}
+	tree, err := NewTree(leaves)
+	if err != nil {
+		return nil, err
+	}
+	return &Batch{Documents: documents, tree: tree}, nil
+}
+
+// Root returns the root of the batch
+func (b *Batch) Root() []byte {
+	return b.tree.Root()
+}
+
+// Data returns the data anchored on the chain for the batch: Tag followed by the root
+func (b *Batch) Data() []byte {
+	return append(bytes.Clone(Tag), b.tree.Root()...)
+}
+
+// Receipts returns the receipt of every document, in the order of the documents
+//
+// Parameters
+//   - `anchor chain.Anchor`: The data output of the chain that carries Batch.Data
+//
+// Returns
+//   - `[]Receipt`: The receipts
+//   - `error`: When the anchor does not carry the data of the batch
+func (b *Batch) Receipts(anchor chain.Anchor) ([]Receipt, error) {
+	if anchor.Data != hex.EncodeToString(b.Data()) {
+		return nil, fmt.Errorf("%w: %s:%d does not carry the root of the batch", ErrNotAnchored, anchor.TxnId, anchor.Vout)
+	}
+
+	receipts := make([]Receipt, len(b.Documents))
+	for i, doc := range b.Documents {
+		path, err := b.tree.Path(i)
+		if err != nil {
+			return nil, err
+		}
+		receipts[i] = Receipt{
+			Name:      doc.Name,
+			Hash:      hex.EncodeToString(doc.Hash),
+			Path:      path,
+			Root:      hex.EncodeToString(b.tree.Root()),
+			TxnId:     anchor.TxnId,
+			Vout:      anchor.Vout,
+			BlockHash: anchor.BlockHash,
+			Height:    anchor.Height,
+		}
+	}
+	return receipts, nil
+}
+
+// Verify checks a receipt against a document and the chain
+//
+// Process
+//   - The hash of the document must be the hash of the receipt
+//   - The path of the receipt must lead from the hash to its root
+//   - The block of the receipt must be on the main chain at its height, its transaction must anchor the root
+//
+// Parameters
+//   - `bc *chain.Chain`: The chain the batch was anchored on
+//   - `hash []byte`: The SHA256 hash of the document, see HashFile
+//   - `r Receipt`: The receipt of the document
+//
+// Returns
+//   - `*block.Block`: The block anchoring the document, its timestamp is when the document was notarized
+//   - `error`: ErrHashMismatch, ErrInvalidReceipt, ErrNotAnchored or an error while reading the chain
+func Verify(ctx context.Context, bc *chain.Chain, hash []byte, r Receipt) (*block.Block, error) {
+	if r.Hash != hex.EncodeToString(hash) {
+		return nil, fmt.Errorf("%w: the document hashes to %x, the receipt is for %s", ErrHashMismatch, hash, r.Hash)
+	}
+	root, err := RootOf(hash, r.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidReceipt, err)
+	}
+	if hex.EncodeToString(root) != r.Root {
+		return nil, fmt.Errorf("%w: the path leads to %x, not to the root %s", ErrInvalidReceipt, root, r.Root)
+	}
+
+	b, err := bc.GetBlockByHeight(ctx, r.Height)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("%w: the chain has no block at height %d", ErrNotAnchored, r.Height)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if b.GetHash() != r.BlockHash {
+		return nil, fmt.Errorf("%w: block %s is not on the main chain at height %d", ErrNotAnchored, r.BlockHash, r.Height)
+	}
+	data := append(bytes.Clone(Tag), root...)
+	for _, txn := range b.GetTransaction() {
+		if txn.GetId() != r.TxnId || r.Vout < 0 || int(r.Vout) >= len(txn.GetOutputs()) {
+			continue
+		}
+		if anchored, ok := txn.GetOutputs()[r.Vout].Data(); ok && bytes.Equal(anchored, data) {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s:%d of block %s does not carry the root %s", ErrNotAnchored, r.TxnId, r.Vout, r.BlockHash, r.Root)
+}
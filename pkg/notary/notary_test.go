@@ -0,0 +1,137 @@
+package notary
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/chain"
+	"github.com/tdadadavid/block/pkg/params"
+	"github.com/tdadadavid/block/pkg/transactions"
+	"github.com/tdadadavid/block/pkg/wallet"
+)
+
+func leaves(n int) [][]byte {
+	hashes := make([][]byte, n)
+	for i := range hashes {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("document %d", i)))
+		hashes[i] = sum[:]
+	}
+	return hashes
+}
+
+func TestTree_Path(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		tree, err := NewTree(leaves(n))
+		assert.NoError(t, err)
+		for i, leaf := range leaves(n) {
+			path, err := tree.Path(i)
+			assert.NoError(t, err)
+			root, err := RootOf(leaf, path)
+			assert.NoError(t, err)
+			assert.Equal(t, tree.Root(), root, "leaf %d of %d", i, n)
+		}
+		_, err = tree.Path(n)
+		assert.Error(t, err)
+	}
+
+	// the path of a leaf does not lead another leaf to the root
+	tree, err := NewTree(leaves(4))
+	assert.NoError(t, err)
+	path, err := tree.Path(0)
+	assert.NoError(t, err)
+	root, err := RootOf(leaves(4)[1], path)
+	assert.NoError(t, err)
+	assert.NotEqual(t, tree.Root(), root)
+
+	// an odd leaf is not paired with itself, so repeating it changes the root
+	odd, err := NewTree(leaves(3))
+	assert.NoError(t, err)
+	repeated, err := NewTree(append(leaves(3), leaves(3)[2]))
+	assert.NoError(t, err)
+	assert.NotEqual(t, odd.Root(), repeated.Root())
+
+	_, err = NewTree(nil)
+	assert.Error(t, err)
+}
+
+func TestBatch_Verify(t *testing.T) {
+	ctx := context.Background()
+	w, err := wallet.New()
+	assert.NoError(t, err)
+	address, err := w.GenAddressFor(params.Regtest.AddressVersion)
+	assert.NoError(t, err)
+	clock := block.StepClock(time.Unix(params.Regtest.Genesis.Timestamp, 0), 10*time.Minute)
+	bc, err := chain.Open(ctx, "", chain.WithParams(params.Regtest), chain.WithClock(clock), chain.WithInMemoryStore())
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, bc.Close())
+	})
+	blocks, err := bc.Generate(ctx, 1, string(address))
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	var documents []Document
+	for i := range 3 {
+		path := filepath.Join(dir, fmt.Sprintf("doc%d.txt", i))
+		assert.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf("document %d", i)), 0o644))
+		hash, err := HashFile(path)
+		assert.NoError(t, err)
+		documents = append(documents, Document{Name: path, Hash: hash})
+	}
+	batch, err := NewBatch(documents)
+	assert.NoError(t, err)
+
+	// the root is anchored by a transaction paying the coinbase back to the wallet
+	out, err := transactions.NewDataOutput(batch.Data())
+	assert.NoError(t, err)
+	coinbase := blocks[0].GetTransaction()[0]
+	txn := transactions.Transaction{
+		Inputs:  []transactions.TxnInput{{TxnId: coinbase.GetId(), Output: 0}},
+		Outputs: []transactions.TxnOutput{coinbase.GetOutputs()[0], out},
+	}
+	assert.NoError(t, w.SignInput(&txn, 0, coinbase.GetOutputs()[0], params.Regtest.Versions()))
+	txn.GenId()
+	mined, err := bc.SubmitTransaction(ctx, txn)
+	assert.NoError(t, err)
+
+	anchors, err := bc.FindAnchors(ctx, Tag)
+	assert.NoError(t, err)
+	assert.Len(t, anchors, 1)
+	receipts, err := batch.Receipts(anchors[0])
+	assert.NoError(t, err)
+	assert.Len(t, receipts, 3)
+	for i, r := range receipts {
+		b, err := Verify(ctx, &bc, documents[i].Hash, r)
+		assert.NoError(t, err)
+		assert.Equal(t, mined.GetHash(), b.GetHash())
+	}
+
+	// another document, a tampered path or a receipt of another block don't verify
+	_, err = Verify(ctx, &bc, documents[1].Hash, receipts[0])
+	assert.ErrorIs(t, err, ErrHashMismatch)
+	tampered := receipts[0]
+	tampered.Path = append([]Step{}, tampered.Path...)
+	tampered.Path[0].Hash = hex.EncodeToString(documents[2].Hash)
+	_, err = Verify(ctx, &bc, documents[0].Hash, tampered)
+	assert.ErrorIs(t, err, ErrInvalidReceipt)
+	moved := receipts[0]
+	moved.BlockHash, moved.Height = blocks[0].GetHash(), blocks[0].GetHeight()
+	_, err = Verify(ctx, &bc, documents[0].Hash, moved)
+	assert.ErrorIs(t, err, ErrNotAnchored)
+	_, err = batch.Receipts(chain.Anchor{TxnId: "other", Data: "00"})
+	assert.ErrorIs(t, err, ErrNotAnchored)
+
+	// the receipt is worthless once its block leaves the main chain
+	_, err = bc.DisconnectTip()
+	assert.NoError(t, err)
+	_, err = Verify(ctx, &bc, documents[0].Hash, receipts[0])
+	assert.ErrorIs(t, err, ErrNotAnchored)
+}
@@ -0,0 +1,139 @@
+package params
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/transactions"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrBadGenesis is returned when a genesis definition can't be turned into a genesis block
+var ErrBadGenesis = errors.New("invalid genesis")
+
+// Genesis is what the genesis block of a chain is built from, the same definition always gives the same block
+type Genesis struct {
+	// Timestamp is the unix time of the genesis block
+	Timestamp int64 `json:"timestamp" yaml:"timestamp"`
+
+	// CoinbaseData is the message in the signature script of the genesis coinbase
+	CoinbaseData string `json:"message" yaml:"message"`
+
+	// Address is paid the subsidy of the genesis block
+	Address string `json:"address,omitempty" yaml:"address,omitempty"`
+
+	// Allocations are paid by the genesis coinbase on top of the subsidy
+	Allocations []Allocation `json:"allocations,omitempty" yaml:"allocations,omitempty"`
+
+	// Difficulty the genesis block is mined with, 0 uses the difficulty of the network
+	Difficulty int32 `json:"difficulty,omitempty" yaml:"difficulty,omitempty"`
+
+	// Nonce pins the nonce of the genesis block instead of mining it, the block must meet the difficulty with it
+	Nonce *int32 `json:"nonce,omitempty" yaml:"nonce,omitempty"`
+}
+
+// Allocation is an amount the genesis coinbase pays to an address
+type Allocation struct {
+	Address string `json:"address" yaml:"address"`
+	Amount  int64  `json:"amount" yaml:"amount"`
+}
+
+// LoadGenesis reads a genesis definition from a JSON or YAML file
+//
+// NOTE
+//   - The file must set the timestamp, a genesis stamped with the time it is built at would differ on every node
+//   - Unknown keys are an error so a typo does not silently change the genesis block
+//
+// Returns
+//   - `Genesis`: The genesis definition
+//   - `error`: A file that can't be read or parsed, ErrBadGenesis when the definition is not complete
+func LoadGenesis(path string) (g Genesis, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return g, fmt.Errorf("failed to read genesis file: %w", err)
+	}
+
+	// JSON is valid YAML, one decoder reads both
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&g); err != nil {
+		return g, fmt.Errorf("failed to parse genesis file %s: %w", path, err)
+	}
+	if g.Timestamp <= 0 {
+		return g, fmt.Errorf("%w: %s has no timestamp", ErrBadGenesis, path)
+	}
+	return g, nil
+}
+
+// Block builds the genesis block whose coinbase pays value to the address and every allocation
+//
+// Parameters
+//   - `value int64`: The subsidy paid to Address, it is not paid when Address is empty
+//   - `difficulty int32`: The difficulty of the network, the genesis may only be harder
+//
+// Returns
+//   - `block.Block`: The genesis block, mined unless the nonce is pinned
+//   - `error`: ErrBadGenesis when nobody is paid, an amount is not positive or the difficulty is too low or above
+//     block.MaxDifficulty, block.ErrProofOfWork when the pinned nonce does not meet the difficulty
+func (g Genesis) Block(value int64, difficulty int32) (b block.Block, err error) {
+	coinbase, err := g.Coinbase(value)
+	if err != nil {
+		return b, err
+	}
+
+	if g.Difficulty != 0 {
+		if g.Difficulty < difficulty {
+			return b, fmt.Errorf("%w: difficulty %d is below the %d of the network", ErrBadGenesis, g.Difficulty, difficulty)
+		}
+		if g.Difficulty > block.MaxDifficulty {
+			return b, fmt.Errorf("%w: difficulty %d is above the %d digits of a hash", ErrBadGenesis, g.Difficulty, block.MaxDifficulty)
+		}
+		difficulty = g.Difficulty
+	}
+	if g.Nonce != nil {
+		return block.NewGenesisBlockWithNonce(*coinbase, g.Timestamp, *g.Nonce, difficulty)
+	}
+	return block.NewGenesisBlockAt(*coinbase, g.Timestamp, difficulty), nil
+}
+
+// Coinbase builds the genesis coinbase, it pays value to the address followed by every allocation
+func (g Genesis) Coinbase(value int64) (*transactions.Transaction, error) {
+	var outputs []transactions.TxnOutput
+	if g.Address != "" {
+		outputs = append(outputs, transactions.TxnOutput{Value: value, ScriptPubKey: g.Address})
+	}
+	for _, allocation := range g.Allocations {
+		if allocation.Address == "" || allocation.Amount <= 0 {
+			return nil, fmt.Errorf("%w: allocation of %d to %q", ErrBadGenesis, allocation.Amount, allocation.Address)
+		}
+		outputs = append(outputs, transactions.TxnOutput{Value: allocation.Amount, ScriptPubKey: allocation.Address})
+	}
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("%w: it pays neither an address nor allocations", ErrBadGenesis)
+	}
+
+	// a genesis paying only the subsidy is an ordinary coinbase
+	coinbase := transactions.NewAllocation(g.CoinbaseData, outputs)
+	if len(g.Allocations) == 0 {
+		coinbase = transactions.NewCoinbase(g.Address, g.CoinbaseData, value)
+	}
+	if _, err := coinbase.OutputValue(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadGenesis, err)
+	}
+	coinbase.GenId()
+	return coinbase, nil
+}
+
+// Addresses returns every address the genesis pays
+func (g Genesis) Addresses() (addresses []string) {
+	if g.Address != "" {
+		addresses = append(addresses, g.Address)
+	}
+	for _, allocation := range g.Allocations {
+		addresses = append(addresses, allocation.Address)
+	}
+	return addresses
+}
@@ -0,0 +1,91 @@
+package params
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/block"
+)
+
+func writeGenesis(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadGenesis_Reproducible(t *testing.T) {
+	fromYAML, err := LoadGenesis(writeGenesis(t, "genesis.yaml", `
+timestamp: 1700000000
+message: private network
+difficulty: 2
+allocations:
+  - address: alice
+    amount: 1000
+  - address: bob
+    amount: 250
+`))
+	assert.NoError(t, err)
+	fromJSON, err := LoadGenesis(writeGenesis(t, "genesis.json", `{
+  "timestamp": 1700000000,
+  "message": "private network",
+  "difficulty": 2,
+  "allocations": [{"address": "alice", "amount": 1000}, {"address": "bob", "amount": 250}]
+}`))
+	assert.NoError(t, err)
+	assert.Equal(t, fromYAML, fromJSON)
+
+	first, err := fromYAML.Block(100, 1)
+	assert.NoError(t, err)
+	second, err := fromJSON.Block(100, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, first.GetHash(), second.GetHash())
+	assert.Equal(t, "00", first.GetHash()[:2])
+
+	outputs := first.GetTransaction()[0].GetOutputs()
+	assert.Len(t, outputs, 2)
+	assert.Equal(t, int64(1000), outputs[0].Value)
+	assert.Equal(t, "bob", outputs[1].ScriptPubKey)
+	assert.True(t, first.GetTransaction()[0].IsCoinbase())
+
+	// the nonce of the mined block can be pinned, it is then not mined again
+	nonce := first.GetNonce()
+	fromYAML.Nonce = &nonce
+	pinned, err := fromYAML.Block(100, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, first.GetHash(), pinned.GetHash())
+
+	wrong := nonce + 1
+	fromYAML.Nonce = &wrong
+	_, err = fromYAML.Block(100, 1)
+	assert.ErrorIs(t, err, block.ErrProofOfWork)
+}
+
+func TestLoadGenesis_Invalid(t *testing.T) {
+	_, err := LoadGenesis(writeGenesis(t, "genesis.yaml", "message: no time\naddress: alice\n"))
+	assert.ErrorIs(t, err, ErrBadGenesis)
+
+	_, err = LoadGenesis(writeGenesis(t, "genesis.yaml", "timestamp: 1\nmesage: typo\n"))
+	assert.Error(t, err)
+
+	_, err = Genesis{Timestamp: 1}.Block(100, 1)
+	assert.ErrorIs(t, err, ErrBadGenesis)
+
+	_, err = Genesis{Timestamp: 1, Allocations: []Allocation{{Address: "alice", Amount: 0}}}.Block(100, 1)
+	assert.ErrorIs(t, err, ErrBadGenesis)
+
+	_, err = Genesis{Timestamp: 1, Address: "alice", Allocations: []Allocation{{Address: "bob", Amount: math.MaxInt64}}}.Block(100, 1)
+	assert.ErrorIs(t, err, ErrBadGenesis)
+
+	_, err = Genesis{Timestamp: 1, Address: "alice", Difficulty: 1}.Block(100, 2)
+	assert.ErrorIs(t, err, ErrBadGenesis)
+
+	// no hash has more leading zeros than digits, mining it would never end
+	_, err = Genesis{Timestamp: 1, Address: "alice", Difficulty: block.MaxDifficulty + 1}.Block(100, 1)
+	assert.ErrorIs(t, err, ErrBadGenesis)
+	nonce := int32(0)
+	_, err = Genesis{Timestamp: 1, Address: "alice", Difficulty: block.MaxDifficulty + 1, Nonce: &nonce}.Block(100, 1)
+	assert.ErrorIs(t, err, ErrBadGenesis)
+}
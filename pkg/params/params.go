@@ -0,0 +1,167 @@
+package params
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+// Params are the rules and constants a network is defined by, nodes of different networks never share a chain
+type Params struct {
+	// Name selects the network, e.g. with --network
+	Name string `json:"name"`
+
+	// Magic identifies the network in data exchanged between nodes
+	Magic uint32 `json:"magic"`
+
+	// DefaultPort is the port the node's API listens on unless another one is configured
+	DefaultPort int `json:"default_port"`
+
+	// AddressVersion is the version byte in front of the public key hash of a wallet address
+	AddressVersion byte `json:"address_version"`
+
+	// ScriptAddressVersion is the version byte in front of the script hash of a script address
+	ScriptAddressVersion byte `json:"script_address_version"`
+
+	// Difficulty is the number of leading zero hex digits the hash of a valid block has
+	Difficulty int32 `json:"difficulty"`
+
+	// InitialSubsidy is the value of the coinbase of the first blocks
+	InitialSubsidy int64 `json:"initial_subsidy"`
+
+	// HalvingInterval is the number of blocks after which the subsidy halves, 0 never halves it
+	HalvingInterval int32 `json:"halving_interval"`
+
+	// Genesis is what the genesis block is mined from
+	Genesis Genesis `json:"genesis"`
+
+	// GenesisHash is the hash of the genesis block, the chain id of the network
+	GenesisHash string `json:"genesis_hash"`
+
+	// AssumedUTXOs pins the content hash of the UTXO snapshots a node may be loaded from by the height of their base block
+	AssumedUTXOs map[int32]string `json:"assumed_utxos,omitempty"`
+
+	// DataSubdir is the directory of the network inside the data directory, mainnet uses the data directory itself
+	DataSubdir string `json:"data_subdir"`
+}
+
+// Mainnet is the main network, its coins are meant to have value
+var Mainnet = &Params{
+	Name:                 "mainnet",
+	Magic:                0xB10CB10C,
+	DefaultPort:          8080,
+	AddressVersion:       0x00,
+	ScriptAddressVersion: 0x05,
+	Difficulty:           block.DefaultDifficulty,
+	InitialSubsidy:       100,
+	HalvingInterval:      210_000,
+	Genesis: Genesis{
+		Timestamp:    1735689600,
+		CoinbaseData: "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks",
+		// the public key hash of zero, nobody can spend the genesis coins
+		Address: "1111111111111111111114oLvT2",
+	},
+	GenesisHash:  "0000518d2f62ebe653ff21dcbcafe2df92c0e924c5eced661f8b6b728a4967c0",
+	AssumedUTXOs: map[int32]string{},
+}
+
+// Testnet is the public test network, its coins have no value
+var Testnet = &Params{
+	Name:                 "testnet",
+	Magic:                0x7E57B10C,
+	DefaultPort:          18080,
+	AddressVersion:       0x6F,
+	ScriptAddressVersion: 0xC4,
+	Difficulty:           3,
+	InitialSubsidy:       100,
+	HalvingInterval:      210_000,
+	Genesis: Genesis{
+		Timestamp:    1735776000,
+		CoinbaseData: "block testnet genesis",
+		Address:      "mfWxJ45yp2SFn7UciZyNpvDKrzbhyfKrY8",
+	},
+	GenesisHash:  "000bbe02692e31d57ffc4626e36e5ed7d8513731ff65ec73a3e305ee5d641d22",
+	AssumedUTXOs: map[int32]string{},
+	DataSubdir:   "testnet",
+}
+
+// Regtest is a private network for tests, blocks are mined instantly and the subsidy halves quickly
+var Regtest = &Params{
+	Name:                 "regtest",
+	Magic:                0xFAB10C5E,
+	DefaultPort:          28080,
+	AddressVersion:       0x6F,
+	ScriptAddressVersion: 0xC4,
+	Difficulty:           1,
+	InitialSubsidy:       100,
+	HalvingInterval:      150,
+	Genesis: Genesis{
+		Timestamp:    1296688602,
+		CoinbaseData: "block regtest genesis",
+		Address:      "mfWxJ45yp2SFn7UciZyNpvDKrzbhyfKrY8",
+	},
+	GenesisHash:  "08db11c9a8b13d6b629c358ee1e90f324fe6584ad7f809a3c521bb4257a8f7b2",
+	AssumedUTXOs: map[int32]string{},
+	DataSubdir:   "regtest",
+}
+
+// Networks are every known network by name
+var Networks = map[string]*Params{
+	Mainnet.Name: Mainnet,
+	Testnet.Name: Testnet,
+	Regtest.Name: Regtest,
+}
+
+// ByName returns the parameters of the network with the name
+//
+// Returns
+//   - `*Params`: The parameters of the network
+//   - `error`: When no network has the name
+func ByName(name string) (*Params, error) {
+	if p, ok := Networks[strings.ToLower(name)]; ok {
+		return p, nil
+	}
+	names := make([]string, 0, len(Networks))
+	for name := range Networks {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return nil, fmt.Errorf("unknown network %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// Versions returns the address versions of the network, the scripts of outputs paying an address depend on them
+func (p *Params) Versions() transactions.AddressVersions {
+	return transactions.AddressVersions{PubKeyHash: p.AddressVersion, ScriptHash: p.ScriptAddressVersion}
+}
+
+// BlockSubsidy returns the value of the coinbase of the block at the height
+//
+// NOTE
+//   - The subsidy halves every HalvingInterval blocks until it reaches 0
+func (p *Params) BlockSubsidy(height int32) int64 {
+	if p.HalvingInterval <= 0 {
+		return p.InitialSubsidy
+	}
+	halvings := height / p.HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+	return p.InitialSubsidy >> halvings
+}
+
+// GenesisBlock mines the genesis block of the network
+//
+// NOTE
+//   - Its hash is GenesisHash, every node of the network mines the same block
+func (p *Params) GenesisBlock() (block.Block, error) {
+	return p.Genesis.Block(p.BlockSubsidy(0), p.Difficulty)
+}
+
+// DataDir returns the directory the network keeps its data in below the data directory
+func (p *Params) DataDir(root string) string {
+	return filepath.Join(root, p.DataSubdir)
+}
@@ -0,0 +1,55 @@
+package params
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/toolkit"
+)
+
+func TestParams_GenesisBlock(t *testing.T) {
+	for name, p := range Networks {
+		t.Run(name, func(t *testing.T) {
+			genesis, err := p.GenesisBlock()
+			assert.NoError(t, err)
+			assert.Equal(t, p.GenesisHash, genesis.GetHash())
+			assert.Equal(t, p.BlockSubsidy(0), genesis.GetTransaction()[0].GetOutputs()[0].Value)
+
+			// the genesis coins are paid to the public key hash of zero
+			version, pubKeyHash, err := toolkit.Base58CheckDecode(p.Genesis.Address, 4)
+			assert.NoError(t, err)
+			assert.Equal(t, p.AddressVersion, version)
+			assert.Equal(t, make([]byte, 20), pubKeyHash)
+
+			// a script address is never mistaken for a wallet address
+			assert.NotEqual(t, p.AddressVersion, p.ScriptAddressVersion)
+		})
+	}
+}
+
+func TestParams_BlockSubsidy(t *testing.T) {
+	assert.Equal(t, int64(100), Regtest.BlockSubsidy(0))
+	assert.Equal(t, int64(100), Regtest.BlockSubsidy(149))
+	assert.Equal(t, int64(50), Regtest.BlockSubsidy(150))
+	assert.Equal(t, int64(25), Regtest.BlockSubsidy(300))
+	assert.Zero(t, Regtest.BlockSubsidy(150*63))
+
+	never := &Params{InitialSubsidy: 7}
+	assert.Equal(t, int64(7), never.BlockSubsidy(1_000_000))
+}
+
+func TestParams_ByName(t *testing.T) {
+	p, err := ByName("Regtest")
+	assert.NoError(t, err)
+	assert.Same(t, Regtest, p)
+
+	_, err = ByName("moon")
+	assert.ErrorContains(t, err, "mainnet, regtest, testnet")
+}
+
+func TestParams_DataDir(t *testing.T) {
+	assert.Equal(t, "/data", Mainnet.DataDir("/data"))
+	assert.Equal(t, filepath.Join("/data", "regtest"), Regtest.DataDir("/data"))
+	assert.NotEqual(t, Testnet.DataDir("/data"), Regtest.DataDir("/data"))
+}
@@ -0,0 +1,382 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/tdadadavid/block/pkg/toolkit"
+)
+
+var (
+	// ErrFailed is returned when a script runs to the end and leaves an empty or false item on top of the stack
+	ErrFailed = errors.New("script evaluated to false")
+
+	// ErrVerify is returned when OP_VERIFY or an opcode ending in VERIFY finds a false item
+	ErrVerify = errors.New("script verification failed")
+
+	// ErrReturn is returned when OP_RETURN is executed
+	ErrReturn = errors.New("script executed OP_RETURN")
+
+	// ErrLockTime is returned when OP_CHECKLOCKTIMEVERIFY finds a lock time that is not reached yet
+	ErrLockTime = errors.New("lock time not reached")
+
+	// ErrLimit is returned when a script exceeds one of the resource limits
+	ErrLimit = errors.New("script exceeds a resource limit")
+
+	// ErrInvalid is returned for everything else a script can do wrong: unknown opcodes, missing items,
+	// unbalanced conditionals or a signature script that does more than pushing items
+	ErrInvalid = errors.New("invalid script")
+)
+
+// SigHashAll ends every signature, the signature commits to all the inputs and outputs of the transaction
+const SigHashAll byte = 0x01
+
+// Checker checks what a script can't check by itself because it depends on the spending transaction
+type Checker interface {
+	// CheckSig tells whether sig is a signature by pubKey of the spending transaction, subScript is the script
+	// being executed that the signature commits to
+	CheckSig(sig, pubKey []byte, subScript Script) bool
+
+	// CheckLockTime tells whether the lock time, a height or a unix time, is reached
+	CheckLockTime(lockTime int64) bool
+}
+
+// Execute runs the signature script of an input and the script of the output it spends
+//
+// Process
+//   - The signature script may only push items, it is executed first
+//   - The pubkey script is executed on the stack the signature script left
+//   - The output is unlocked when the pubkey script ends with a true item on top of the stack
+//   - A PayToScriptHash pubkey script only checks the last push of the signature script is the redeem script,
+//     the redeem script is then executed on the other pushes and must end with a true item too
+//
+// Parameters
+//   - `sigScript Script`: The script of the input, it provides the signatures and data
+//   - `pubKeyScript Script`: The script locking the output
+//   - `checker Checker`: Checks signatures and lock times against the spending transaction
+//
+// Returns
+//   - `error`: nil when the output is unlocked, otherwise why it is not
+func Execute(sigScript, pubKeyScript Script, checker Checker) error {
+	if !sigScript.IsPushOnly() {
+		return fmt.Errorf("%w: the signature script does more than pushing items", ErrInvalid)
+	}
+
+	e := engine{checker: checker}
+	if err := e.run(sigScript); err != nil {
+		return fmt.Errorf("signature script: %w", err)
+	}
+	pushed := slices.Clone(e.stack)
+	if err := e.run(pubKeyScript); err != nil {
+		return fmt.Errorf("pubkey script: %w", err)
+	}
+	if err := e.succeeded(); err != nil {
+		return err
+	}
+
+	// the redeem script of a PayToScriptHash output runs on the items pushed before it
+	if _, ok := pubKeyScript.ScriptHash(); !ok {
+		return nil
+	}
+	redeem := Script(pushed[len(pushed)-1])
+	e.stack = pushed[:len(pushed)-1]
+	if err := e.run(redeem); err != nil {
+		return fmt.Errorf("redeem script: %w", err)
+	}
+	return e.succeeded()
+}
+
+// succeeded tells whether a script left a true item on top of the stack
+func (e *engine) succeeded() error {
+	if len(e.stack) == 0 || !asBool(e.stack[len(e.stack)-1]) {
+		return ErrFailed
+	}
+	return nil
+}
+
+// engine holds the state of an execution, the stack is shared by the scripts of an input
+type engine struct {
+	stack   [][]byte
+	checker Checker
+}
+
+// run executes a single script on the stack
+func (e *engine) run(s Script) error {
+	if len(s) > MaxScriptSize {
+		return fmt.Errorf("%w: script of %d bytes", ErrLimit, len(s))
+	}
+	instructions, err := s.Instructions()
+	if err != nil {
+		return err
+	}
+
+	// conditions holds whether every OP_IF branch the execution is in is taken
+	var conditions []bool
+	ops := 0
+	for _, in := range instructions {
+		if len(in.Data) > MaxElementSize {
+			return fmt.Errorf("%w: push of %d bytes", ErrLimit, len(in.Data))
+		}
+		if !in.Op.IsPush() {
+			if ops++; ops > MaxOps {
+				return fmt.Errorf("%w: more than %d opcodes", ErrLimit, MaxOps)
+			}
+		}
+
+		executing := true
+		for _, taken := range conditions {
+			executing = executing && taken
+		}
+		// the conditionals are followed in skipped branches too, so their nesting stays known
+		switch in.Op {
+		case OP_IF, OP_NOTIF:
+			taken := false
+			if executing {
+				item, err := e.pop()
+				if err != nil {
+					return err
+				}
+				taken = asBool(item) == (in.Op == OP_IF)
+			}
+			conditions = append(conditions, taken)
+			continue
+		case OP_ELSE:
+			if len(conditions) == 0 {
+				return fmt.Errorf("%w: OP_ELSE without OP_IF", ErrInvalid)
+			}
+			conditions[len(conditions)-1] = !conditions[len(conditions)-1]
+			continue
+		case OP_ENDIF:
+			if len(conditions) == 0 {
+				return fmt.Errorf("%w: OP_ENDIF without OP_IF", ErrInvalid)
+			}
+			conditions = conditions[:len(conditions)-1]
+			continue
+		}
+		if !executing {
+			continue
+		}
+
+		if err = e.step(in, s, &ops); err != nil {
+			return err
+		}
+		if len(e.stack) > MaxStackSize {
+			return fmt.Errorf("%w: more than %d items on the stack", ErrLimit, MaxStackSize)
+		}
+	}
+	if len(conditions) != 0 {
+		return fmt.Errorf("%w: OP_IF without OP_ENDIF", ErrInvalid)
+	}
+	return nil
+}
+
+// step executes an instruction that is not a conditional
+func (e *engine) step(in Instruction, s Script, ops *int) error {
+	switch op := in.Op; {
+	case op == OP_0 || op <= OP_PUSHDATA4:
+		e.push(in.Data)
+		return nil
+	case op == OP_1NEGATE:
+		e.push(encodeNum(-1))
+		return nil
+	case op >= OP_1 && op <= OP_16:
+		e.push(encodeNum(int64(op - OP_1 + 1)))
+		return nil
+	}
+
+	switch in.Op {
+	case OP_NOP:
+	case OP_VERIFY:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if !asBool(item) {
+			return ErrVerify
+		}
+	case OP_RETURN:
+		return ErrReturn
+	case OP_DROP:
+		if _, err := e.pop(); err != nil {
+			return err
+		}
+	case OP_DUP:
+		item, err := e.peek()
+		if err != nil {
+			return err
+		}
+		e.push(bytes.Clone(item))
+	case OP_SIZE:
+		item, err := e.peek()
+		if err != nil {
+			return err
+		}
+		e.push(encodeNum(int64(len(item))))
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		return e.result(in.Op == OP_EQUALVERIFY, bytes.Equal(a, b))
+	case OP_SHA256:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(item)
+		e.push(hash[:])
+	case OP_HASH160:
+		item, err := e.pop()
+		if err != nil {
+			return err
+		}
+		hash, err := toolkit.PublicKeyHash(item)
+		if err != nil {
+			return err
+		}
+		e.push(hash)
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		pubKey, err := e.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := e.pop()
+		if err != nil {
+			return err
+		}
+		return e.result(in.Op == OP_CHECKSIGVERIFY, len(sig) > 0 && e.checker.CheckSig(sig, pubKey, s))
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		ok, err := e.checkMultisig(s, ops)
+		if err != nil {
+			return err
+		}
+		return e.result(in.Op == OP_CHECKMULTISIGVERIFY, ok)
+	case OP_CHECKLOCKTIMEVERIFY:
+		item, err := e.peek()
+		if err != nil {
+			return err
+		}
+		// lock times are 5 bytes long so they reach past 2^31
+		lockTime, err := decodeNum(item, 5)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if lockTime < 0 {
+			return fmt.Errorf("%w: negative lock time %d", ErrInvalid, lockTime)
+		}
+		if !e.checker.CheckLockTime(lockTime) {
+			return fmt.Errorf("%w: %d", ErrLockTime, lockTime)
+		}
+	default:
+		return fmt.Errorf("%w: unknown opcode %s", ErrInvalid, in.Op)
+	}
+	return nil
+}
+
+// checkMultisig executes OP_CHECKMULTISIG: <sig 1> ... <sig m> <m> <pubkey 1> ... <pubkey n> <n>
+//
+// NOTE
+//   - The signatures must be in the order of the public keys they belong to
+//   - Unlike Bitcoin no extra item is popped, so signature scripts don't start with OP_0
+func (e *engine) checkMultisig(s Script, ops *int) (bool, error) {
+	n, err := e.popInt()
+	if err != nil {
+		return false, err
+	}
+	if n < 0 || n > MaxPubKeysPerMultisig {
+		return false, fmt.Errorf("%w: %d public keys", ErrInvalid, n)
+	}
+	if *ops += int(n); *ops > MaxOps {
+		return false, fmt.Errorf("%w: more than %d opcodes", ErrLimit, MaxOps)
+	}
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubKeys[i], err = e.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	m, err := e.popInt()
+	if err != nil {
+		return false, err
+	}
+	if m < 0 || m > n {
+		return false, fmt.Errorf("%w: %d signatures of %d public keys", ErrInvalid, m, n)
+	}
+	sigs := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if sigs[i], err = e.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	// every signature is matched with the next public key it is valid for
+	key := 0
+	for _, sig := range sigs {
+		for ; key < len(pubKeys); key++ {
+			if len(sig) > 0 && e.checker.CheckSig(sig, pubKeys[key], s) {
+				break
+			}
+		}
+		if key == len(pubKeys) {
+			return false, nil
+		}
+		key++
+	}
+	return true, nil
+}
+
+// result pushes the result of a check, or fails the script for the VERIFY variants
+func (e *engine) result(verify, ok bool) error {
+	if verify {
+		if !ok {
+			return ErrVerify
+		}
+		return nil
+	}
+	if ok {
+		e.push(encodeNum(1))
+	} else {
+		e.push(nil)
+	}
+	return nil
+}
+
+func (e *engine) push(item []byte) {
+	e.stack = append(e.stack, item)
+}
+
+func (e *engine) peek() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, fmt.Errorf("%w: the stack is empty", ErrInvalid)
+	}
+	return e.stack[len(e.stack)-1], nil
+}
+
+func (e *engine) pop() ([]byte, error) {
+	item, err := e.peek()
+	if err == nil {
+		e.stack = e.stack[:len(e.stack)-1]
+	}
+	return item, err
+}
+
+// popInt pops a number, numbers used by opcodes are at most 4 bytes long
+func (e *engine) popInt() (int64, error) {
+	item, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+	n, err := decodeNum(item, 4)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return n, nil
+}
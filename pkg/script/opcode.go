@@ -0,0 +1,102 @@
+package script
+
+import "fmt"
+
+// Opcode is a single instruction of a script, the values are the ones of Bitcoin script
+type Opcode byte
+
+// The opcodes understood by the interpreter, any other byte fails the script when it is executed
+const (
+	// OP_0 pushes an empty item, which is false
+	OP_0 Opcode = 0x00
+
+	// OP_DATA_1 to OP_DATA_75 push the next 1 to 75 bytes
+	OP_DATA_1  Opcode = 0x01
+	OP_DATA_75 Opcode = 0x4b
+
+	// OP_PUSHDATA1, OP_PUSHDATA2 and OP_PUSHDATA4 push the number of bytes given by the next 1, 2 or 4 little endian bytes
+	OP_PUSHDATA1 Opcode = 0x4c
+	OP_PUSHDATA2 Opcode = 0x4d
+	OP_PUSHDATA4 Opcode = 0x4e
+
+	// OP_1NEGATE pushes the number -1
+	OP_1NEGATE Opcode = 0x4f
+
+	// OP_1 to OP_16 push the numbers 1 to 16
+	OP_1  Opcode = 0x51
+	OP_16 Opcode = 0x60
+
+	OP_NOP    Opcode = 0x61
+	OP_IF     Opcode = 0x63
+	OP_NOTIF  Opcode = 0x64
+	OP_ELSE   Opcode = 0x67
+	OP_ENDIF  Opcode = 0x68
+	OP_VERIFY Opcode = 0x69
+
+	// OP_RETURN fails the script, outputs locked by it can never be spent
+	OP_RETURN Opcode = 0x6a
+
+	OP_DROP        Opcode = 0x75
+	OP_DUP         Opcode = 0x76
+	OP_SIZE        Opcode = 0x82
+	OP_EQUAL       Opcode = 0x87
+	OP_EQUALVERIFY Opcode = 0x88
+	OP_SHA256      Opcode = 0xa8
+
+	// OP_HASH160 replaces the top item by its RIPEMD160(SHA256) hash, the hash addresses are made of
+	OP_HASH160 Opcode = 0xa9
+
+	OP_CHECKSIG            Opcode = 0xac
+	OP_CHECKSIGVERIFY      Opcode = 0xad
+	OP_CHECKMULTISIG       Opcode = 0xae
+	OP_CHECKMULTISIGVERIFY Opcode = 0xaf
+
+	// OP_CHECKLOCKTIMEVERIFY fails the script until the lock time on top of the stack is reached, the item stays on the stack
+	OP_CHECKLOCKTIMEVERIFY Opcode = 0xb1
+)
+
+var opcodeNames = map[Opcode]string{
+	OP_0:                   "OP_0",
+	OP_PUSHDATA1:           "OP_PUSHDATA1",
+	OP_PUSHDATA2:           "OP_PUSHDATA2",
+	OP_PUSHDATA4:           "OP_PUSHDATA4",
+	OP_1NEGATE:             "OP_1NEGATE",
+	OP_NOP:                 "OP_NOP",
+	OP_IF:                  "OP_IF",
+	OP_NOTIF:               "OP_NOTIF",
+	OP_ELSE:                "OP_ELSE",
+	OP_ENDIF:               "OP_ENDIF",
+	OP_VERIFY:              "OP_VERIFY",
+	OP_RETURN:              "OP_RETURN",
+	OP_DROP:                "OP_DROP",
+	OP_DUP:                 "OP_DUP",
+	OP_SIZE:                "OP_SIZE",
+	OP_EQUAL:               "OP_EQUAL",
+	OP_EQUALVERIFY:         "OP_EQUALVERIFY",
+	OP_SHA256:              "OP_SHA256",
+	OP_HASH160:             "OP_HASH160",
+	OP_CHECKSIG:            "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY:      "OP_CHECKSIGVERIFY",
+	OP_CHECKMULTISIG:       "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+	OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY",
+}
+
+// String returns the name of the opcode, OP_UNKNOWN followed by its value for bytes that are no opcode
+func (op Opcode) String() string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+	if op >= OP_1 && op <= OP_16 {
+		return fmt.Sprintf("OP_%d", op-OP_1+1)
+	}
+	if op >= OP_DATA_1 && op <= OP_DATA_75 {
+		return fmt.Sprintf("OP_DATA_%d", op)
+	}
+	return fmt.Sprintf("OP_UNKNOWN_0x%02x", byte(op))
+}
+
+// IsPush tells whether the opcode only pushes an item, signature scripts are made of pushes only
+func (op Opcode) IsPush() bool {
+	return op <= OP_16 && op != 0x50
+}
@@ -0,0 +1,249 @@
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxScriptSize is the largest script in bytes that is executed
+	MaxScriptSize = 10_000
+
+	// MaxElementSize is the largest item in bytes that can be pushed on the stack
+	MaxElementSize = 520
+
+	// MaxStackSize is the most items the stack holds at once
+	MaxStackSize = 1_000
+
+	// MaxOps is the most opcodes other than pushes a script may execute, every public key of a multisig counts as one
+	MaxOps = 201
+
+	// MaxPubKeysPerMultisig is the most public keys OP_CHECKMULTISIG checks signatures against
+	MaxPubKeysPerMultisig = 20
+)
+
+// ErrMalformed is returned when a push runs past the end of the script
+var ErrMalformed = errors.New("malformed script")
+
+// Script is the binary encoding of a script, a sequence of opcodes where pushes are followed by their data
+type Script []byte
+
+// Instruction is an opcode of a script with the data it pushes
+type Instruction struct {
+	Op   Opcode
+	Data []byte
+}
+
+// ParseHex decodes a script from its hexadecimal encoding (see Script.Hex)
+func ParseHex(s string) (Script, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return data, nil
+}
+
+// Hex returns the hexadecimal encoding of the script, it is how scripts are kept in the string fields of transactions
+func (s Script) Hex() string {
+	return hex.EncodeToString(s)
+}
+
+// Instructions decodes the script into its instructions
+//
+// Returns
+//   - `[]Instruction`: The instructions in script order
+//   - `error`: ErrMalformed when a push is longer than what is left of the script
+func (s Script) Instructions() (instructions []Instruction, err error) {
+	for pc := 0; pc < len(s); {
+		op := Opcode(s[pc])
+		pc++
+
+		var size int
+		switch {
+		case op >= OP_DATA_1 && op <= OP_DATA_75:
+			size = int(op)
+		case op == OP_PUSHDATA1 || op == OP_PUSHDATA2 || op == OP_PUSHDATA4:
+			width := map[Opcode]int{OP_PUSHDATA1: 1, OP_PUSHDATA2: 2, OP_PUSHDATA4: 4}[op]
+			if pc+width > len(s) {
+				return instructions, fmt.Errorf("%w: %s at %d has no length", ErrMalformed, op, pc-1)
+			}
+			length := make([]byte, 4)
+			copy(length, s[pc:pc+width])
+			size = int(binary.LittleEndian.Uint32(length))
+			pc += width
+		default:
+			instructions = append(instructions, Instruction{Op: op})
+			continue
+		}
+
+		if size < 0 || size > len(s)-pc {
+			return instructions, fmt.Errorf("%w: push of %d bytes at %d runs past the end", ErrMalformed, size, pc)
+		}
+		instructions = append(instructions, Instruction{Op: op, Data: s[pc : pc+size]})
+		pc += size
+	}
+	return instructions, nil
+}
+
+// IsPushOnly tells whether the script is well formed and only pushes items
+func (s Script) IsPushOnly() bool {
+	instructions, err := s.Instructions()
+	if err != nil {
+		return false
+	}
+	for _, in := range instructions {
+		if !in.Op.IsPush() {
+			return false
+		}
+	}
+	return true
+}
+
+// String disassembles the script, pushed data is written in hexadecimal
+func (s Script) String() string {
+	instructions, err := s.Instructions()
+	parts := make([]string, 0, len(instructions)+1)
+	for _, in := range instructions {
+		switch {
+		case in.Data != nil:
+			parts = append(parts, hex.EncodeToString(in.Data))
+		default:
+			parts = append(parts, in.Op.String())
+		}
+	}
+	if err != nil {
+		parts = append(parts, "[error]")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Builder builds a script one instruction at a time, the first error stops the build
+type Builder struct {
+	script Script
+	err    error
+}
+
+// NewBuilder returns a builder of an empty script
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// AddOp appends an opcode
+func (b *Builder) AddOp(op Opcode) *Builder {
+	b.script = append(b.script, byte(op))
+	return b
+}
+
+// AddData appends the smallest push of the data
+func (b *Builder) AddData(data []byte) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if len(data) > MaxElementSize {
+		b.err = fmt.Errorf("push of %d bytes exceeds the element size of %d", len(data), MaxElementSize)
+		return b
+	}
+
+	switch size := len(data); {
+	case size == 0:
+		b.script = append(b.script, byte(OP_0))
+	case size <= int(OP_DATA_75):
+		b.script = append(b.script, byte(size))
+	case size <= 0xff:
+		b.script = append(b.script, byte(OP_PUSHDATA1), byte(size))
+	default:
+		b.script = binary.LittleEndian.AppendUint16(append(b.script, byte(OP_PUSHDATA2)), uint16(size))
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+// AddInt appends the push of a number, 0 to 16 and -1 have their own opcode
+func (b *Builder) AddInt(n int64) *Builder {
+	switch {
+	case n == 0:
+		return b.AddOp(OP_0)
+	case n == -1:
+		return b.AddOp(OP_1NEGATE)
+	case n >= 1 && n <= 16:
+		return b.AddOp(OP_1 + Opcode(n-1))
+	}
+	return b.AddData(encodeNum(n))
+}
+
+// Script returns the built script
+//
+// Returns
+//   - `Script`: The script
+//   - `error`: A push larger than MaxElementSize or a script larger than MaxScriptSize
+func (b *Builder) Script() (Script, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.script) > MaxScriptSize {
+		return nil, fmt.Errorf("script of %d bytes exceeds the size of %d", len(b.script), MaxScriptSize)
+	}
+	return b.script, nil
+}
+
+// encodeNum encodes a number the way scripts do: little endian, the highest bit of the last byte is the sign
+func encodeNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+
+	negative := n < 0
+	abs := uint64(n)
+	if negative {
+		abs = uint64(-n)
+	}
+	var data []byte
+	for ; abs > 0; abs >>= 8 {
+		data = append(data, byte(abs))
+	}
+	// a highest byte with its top bit set needs another byte for the sign
+	switch last := len(data) - 1; {
+	case data[last]&0x80 != 0 && negative:
+		data = append(data, 0x80)
+	case data[last]&0x80 != 0:
+		data = append(data, 0x00)
+	case negative:
+		data[last] |= 0x80
+	}
+	return data
+}
+
+// decodeNum decodes a number encoded by encodeNum of at most maxSize bytes
+func decodeNum(data []byte, maxSize int) (int64, error) {
+	if len(data) > maxSize {
+		return 0, fmt.Errorf("number of %d bytes is longer than %d bytes", len(data), maxSize)
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << (8 * i)
+	}
+	// the sign is the top bit of the last byte
+	if last := data[len(data)-1]; last&0x80 != 0 {
+		n &^= int64(0x80) << (8 * (len(data) - 1))
+		n = -n
+	}
+	return n, nil
+}
+
+// asBool tells whether an item is true, any item but zero and negative zero is
+func asBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			// negative zero
+			return !(i == len(data)-1 && b == 0x80)
+		}
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/toolkit"
+)
+
+// fakeChecker accepts the signature "sig" by every key in keys and lock times up to height
+type fakeChecker struct {
+	keys   [][]byte
+	height int64
+}
+
+func (c fakeChecker) CheckSig(sig, pubKey []byte, _ Script) bool {
+	if !bytes.Equal(sig, []byte("sig")) {
+		return false
+	}
+	for _, key := range c.keys {
+		if bytes.Equal(key, pubKey) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c fakeChecker) CheckLockTime(lockTime int64) bool {
+	return lockTime <= c.height
+}
+
+func build(t *testing.T, b *Builder) Script {
+	s, err := b.Script()
+	assert.NoError(t, err)
+	return s
+}
+
+func TestScript_PayToPubKeyHash(t *testing.T) {
+	pubKey := []byte("alice's key")
+	hash, err := toolkit.PublicKeyHash(pubKey)
+	assert.NoError(t, err)
+
+	pubKeyScript, err := PayToPubKeyHash(hash)
+	assert.NoError(t, err)
+	extracted, ok := pubKeyScript.PubKeyHash()
+	assert.True(t, ok)
+	assert.Equal(t, hash, extracted)
+	assert.Equal(t, "OP_DUP OP_HASH160 "+Script(hash).Hex()+" OP_EQUALVERIFY OP_CHECKSIG", pubKeyScript.String())
+
+	sigScript, err := SignatureScript([]byte("sig"), pubKey)
+	assert.NoError(t, err)
+	checker := fakeChecker{keys: [][]byte{pubKey}}
+	assert.NoError(t, Execute(sigScript, pubKeyScript, checker))
+
+	// another key does not hash to the address, a bad signature fails CHECKSIG
+	other, _ := SignatureScript([]byte("sig"), []byte("mallory's key"))
+	assert.ErrorIs(t, Execute(other, pubKeyScript, fakeChecker{keys: [][]byte{[]byte("mallory's key")}}), ErrVerify)
+	forged, _ := SignatureScript([]byte("forged"), pubKey)
+	assert.ErrorIs(t, Execute(forged, pubKeyScript, checker), ErrFailed)
+
+	// the signature script may only push
+	assert.ErrorIs(t, Execute(append(sigScript, byte(OP_DUP)), pubKeyScript, checker), ErrInvalid)
+}
+
+func TestScript_Conditionals(t *testing.T) {
+	// OP_IF <2> OP_ELSE OP_IF <3> OP_ENDIF OP_ENDIF <3> OP_EQUAL
+	pubKeyScript := build(t, NewBuilder().AddOp(OP_IF).AddInt(2).AddOp(OP_ELSE).
+		AddOp(OP_IF).AddInt(3).AddOp(OP_ENDIF).AddOp(OP_ENDIF).AddInt(3).AddOp(OP_EQUAL))
+
+	tests := map[string]struct {
+		sigScript Script
+		err       error
+	}{
+		"else branch":     {sigScript: build(t, NewBuilder().AddInt(1).AddInt(0)), err: nil},
+		"if branch":       {sigScript: build(t, NewBuilder().AddInt(1)), err: ErrFailed},
+		"nested skipped":  {sigScript: build(t, NewBuilder().AddInt(0).AddInt(0)), err: ErrInvalid},
+		"missing operand": {sigScript: nil, err: ErrInvalid},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := Execute(tc.sigScript, pubKeyScript, fakeChecker{})
+			if tc.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.err)
+			}
+		})
+	}
+
+	unbalanced := build(t, NewBuilder().AddInt(1).AddOp(OP_IF).AddInt(1))
+	assert.ErrorIs(t, Execute(nil, unbalanced, fakeChecker{}), ErrInvalid)
+}
+
+func TestScript_Multisig(t *testing.T) {
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	pubKeyScript := build(t, NewBuilder().AddInt(2).AddData(keys[0]).AddData(keys[1]).AddData(keys[2]).
+		AddInt(3).AddOp(OP_CHECKMULTISIG))
+	sigs := build(t, NewBuilder().AddData([]byte("sig")).AddData([]byte("sig")))
+
+	assert.NoError(t, Execute(sigs, pubKeyScript, fakeChecker{keys: keys[1:]}))
+	assert.ErrorIs(t, Execute(sigs, pubKeyScript, fakeChecker{keys: keys[2:]}), ErrFailed)
+}
+
+func TestScript_PayToScriptHash(t *testing.T) {
+	keys := [][]byte{[]byte("a"), []byte("b")}
+	redeem, err := MultiSig(1, keys)
+	assert.NoError(t, err)
+	hash, err := redeem.Hash160()
+	assert.NoError(t, err)
+	pubKeyScript, err := PayToScriptHash(hash)
+	assert.NoError(t, err)
+	extracted, ok := pubKeyScript.ScriptHash()
+	assert.True(t, ok)
+	assert.Equal(t, hash, extracted)
+
+	sigs := build(t, NewBuilder().AddData([]byte("sig")))
+	sigScript, err := RedeemScript(sigs, redeem)
+	assert.NoError(t, err)
+	assert.NoError(t, Execute(sigScript, pubKeyScript, fakeChecker{keys: keys[1:]}))
+
+	// the redeem script runs after it matched the hash, another script does not match
+	assert.ErrorIs(t, Execute(sigScript, pubKeyScript, fakeChecker{}), ErrFailed)
+	other, err := RedeemScript(sigs, build(t, NewBuilder().AddInt(1)))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, Execute(other, pubKeyScript, fakeChecker{keys: keys}), ErrFailed)
+	assert.ErrorIs(t, Execute(nil, pubKeyScript, fakeChecker{}), ErrInvalid)
+}
+
+func TestScript_HashTimeLock(t *testing.T) {
+	secret := bytes.Repeat([]byte{7}, SecretSize)
+	hash := sha256.Sum256(secret)
+	receiver, _ := toolkit.PublicKeyHash([]byte("receiver"))
+	sender, _ := toolkit.PublicKeyHash([]byte("sender"))
+	h := HashTimeLock{Hash: hash[:], Receiver: receiver, Sender: sender, Timeout: 100}
+	pubKeyScript, err := h.Script()
+	assert.NoError(t, err)
+	parsed, ok := pubKeyScript.HashTimeLock()
+	assert.True(t, ok)
+	assert.Equal(t, h, parsed)
+	_, ok = build(t, NewBuilder().AddInt(1)).HashTimeLock()
+	assert.False(t, ok)
+
+	claim := func(secret []byte) Script {
+		s, err := ClaimScript([]byte("sig"), []byte("receiver"), secret)
+		assert.NoError(t, err)
+		return s
+	}
+	refund, err := RefundScript([]byte("sig"), []byte("sender"))
+	assert.NoError(t, err)
+	receiverKey := fakeChecker{keys: [][]byte{[]byte("receiver")}}
+	senderKey := fakeChecker{keys: [][]byte{[]byte("sender")}, height: 99}
+
+	// the receiver claims with the secret at any time, the sender refunds from the timeout on
+	assert.NoError(t, Execute(claim(secret), pubKeyScript, receiverKey))
+	assert.ErrorIs(t, Execute(claim(bytes.Repeat([]byte{8}, SecretSize)), pubKeyScript, receiverKey), ErrVerify)
+	assert.ErrorIs(t, Execute(claim(secret[1:]), pubKeyScript, receiverKey), ErrVerify)
+	assert.ErrorIs(t, Execute(refund, pubKeyScript, senderKey), ErrLockTime)
+	senderKey.height = 100
+	assert.NoError(t, Execute(refund, pubKeyScript, senderKey))
+	assert.ErrorIs(t, Execute(claim(secret), pubKeyScript, senderKey), ErrFailed)
+}
+
+func TestScript_LockTimeAndReturn(t *testing.T) {
+	locked := build(t, NewBuilder().AddInt(100).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).AddInt(1))
+	assert.ErrorIs(t, Execute(nil, locked, fakeChecker{height: 99}), ErrLockTime)
+	assert.NoError(t, Execute(nil, locked, fakeChecker{height: 100}))
+
+	data := build(t, NewBuilder().AddOp(OP_RETURN).AddData([]byte("hello")))
+	assert.ErrorIs(t, Execute(nil, data, fakeChecker{}), ErrReturn)
+}
+
+func TestScript_Limits(t *testing.T) {
+	_, err := NewBuilder().AddData(make([]byte, MaxElementSize+1)).Script()
+	assert.Error(t, err)
+
+	b := NewBuilder().AddInt(1)
+	for range MaxOps {
+		b.AddOp(OP_DUP).AddOp(OP_DROP)
+	}
+	assert.ErrorIs(t, Execute(nil, build(t, b), fakeChecker{}), ErrLimit)
+
+	b = NewBuilder()
+	for range MaxStackSize {
+		b.AddInt(1)
+	}
+	assert.ErrorIs(t, Execute(nil, build(t, b.AddOp(OP_DUP)), fakeChecker{}), ErrLimit)
+
+	_, err = Script{byte(OP_PUSHDATA1), 10, 1}.Instructions()
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestScript_Numbers(t *testing.T) {
+	for _, n := range []int64{0, 1, -1, 127, 128, -128, 255, 1 << 20, -(1 << 31), 1 << 33} {
+		decoded, err := decodeNum(encodeNum(n), 5)
+		assert.NoError(t, err)
+		assert.Equal(t, n, decoded)
+	}
+	assert.False(t, asBool([]byte{0, 0x80}))
+	assert.True(t, asBool([]byte{0, 1}))
+}
+
+func TestScript_NullData(t *testing.T) {
+	s, err := NullData([]byte("hello"))
+	assert.NoError(t, err)
+	assert.True(t, s.IsUnspendable())
+	data, ok := s.NullData()
+	assert.True(t, ok)
+	assert.Equal(t, []byte("hello"), data)
+	assert.ErrorIs(t, Execute(nil, s, fakeChecker{}), ErrReturn)
+
+	full, err := NullData(make([]byte, MaxDataSize))
+	assert.NoError(t, err)
+	data, ok = full.NullData()
+	assert.True(t, ok)
+	assert.Len(t, data, MaxDataSize)
+	_, err = NullData(make([]byte, MaxDataSize+1))
+	assert.Error(t, err)
+
+	// a bare OP_RETURN carries nothing, anything more than a single push is not a data script
+	data, ok = Script{byte(OP_RETURN)}.NullData()
+	assert.True(t, ok)
+	assert.Empty(t, data)
+	oversized := build(t, NewBuilder().AddOp(OP_RETURN).AddData(make([]byte, MaxDataSize+1)))
+	_, ok = oversized.NullData()
+	assert.False(t, ok)
+	_, ok = build(t, NewBuilder().AddOp(OP_RETURN).AddData([]byte("a")).AddData([]byte("b"))).NullData()
+	assert.False(t, ok)
+	_, ok = build(t, NewBuilder().AddData([]byte("hello"))).NullData()
+	assert.False(t, ok)
+}
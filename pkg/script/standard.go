@@ -0,0 +1,258 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/tdadadavid/block/pkg/toolkit"
+)
+
+// PayToPubKeyHash returns the standard script locking an output to the owner of an address:
+// OP_DUP OP_HASH160 <pubkey hash> OP_EQUALVERIFY OP_CHECKSIG
+func PayToPubKeyHash(pubKeyHash []byte) (Script, error) {
+	return NewBuilder().AddOp(OP_DUP).AddOp(OP_HASH160).AddData(pubKeyHash).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).Script()
+}
+
+// PubKeyHash returns the public key hash a PayToPubKeyHash script locks to
+//
+// Returns
+//   - `[]byte`: The HASH160 of the public key
+//   - `bool`: false when the script is not a PayToPubKeyHash script
+func (s Script) PubKeyHash() ([]byte, bool) {
+	if len(s) != 25 || !bytes.Equal(s[:3], []byte{byte(OP_DUP), byte(OP_HASH160), 20}) ||
+		!bytes.Equal(s[23:], []byte{byte(OP_EQUALVERIFY), byte(OP_CHECKSIG)}) {
+		return nil, false
+	}
+	return s[3:23], true
+}
+
+// PayToScriptHash returns the script locking an output to a redeem script by its hash: OP_HASH160 <script hash> OP_EQUAL
+//
+// NOTE
+//   - The input reveals the redeem script as its last push, it must hash to the script hash and is then executed
+//     on what the input pushed before it (see Execute)
+func PayToScriptHash(scriptHash []byte) (Script, error) {
+	return NewBuilder().AddOp(OP_HASH160).AddData(scriptHash).AddOp(OP_EQUAL).Script()
+}
+
+// ScriptHash returns the hash of the redeem script a PayToScriptHash script locks to
+//
+// Returns
+//   - `[]byte`: The HASH160 of the redeem script
+//   - `bool`: false when the script is not a PayToScriptHash script
+func (s Script) ScriptHash() ([]byte, bool) {
+	if len(s) != 23 || s[0] != byte(OP_HASH160) || s[1] != 20 || s[22] != byte(OP_EQUAL) {
+		return nil, false
+	}
+	return s[2:22], true
+}
+
+// Hash160 returns the hash of the script a PayToScriptHash script commits to
+func (s Script) Hash160() ([]byte, error) {
+	return toolkit.PublicKeyHash(s)
+}
+
+// SignatureScript returns the script of an input spending a PayToPubKeyHash output: <signature> <pubkey>
+func SignatureScript(sig, pubKey []byte) (Script, error) {
+	return NewBuilder().AddData(sig).AddData(pubKey).Script()
+}
+
+// MultiSig returns the script locking an output to m of the public keys:
+// <m> <pubkey 1> ... <pubkey n> <n> OP_CHECKMULTISIG
+//
+// Returns
+//   - `Script`: The locking script, its signature script pushes m signatures in the order of the public keys
+//   - `error`: m is not between 1 and the number of keys, or there are more than MaxPubKeysPerMultisig keys
+func MultiSig(m int, pubKeys [][]byte) (Script, error) {
+	if len(pubKeys) == 0 || len(pubKeys) > MaxPubKeysPerMultisig {
+		return nil, fmt.Errorf("a multisig has 1 to %d public keys, not %d", MaxPubKeysPerMultisig, len(pubKeys))
+	}
+	if m < 1 || m > len(pubKeys) {
+		return nil, fmt.Errorf("a multisig of %d public keys requires 1 to %d signatures, not %d", len(pubKeys), len(pubKeys), m)
+	}
+
+	b := NewBuilder().AddInt(int64(m))
+	for _, pubKey := range pubKeys {
+		b.AddData(pubKey)
+	}
+	return b.AddInt(int64(len(pubKeys))).AddOp(OP_CHECKMULTISIG).Script()
+}
+
+// MultiSigKeys returns the number of signatures and the public keys of a MultiSig script
+//
+// Returns
+//   - `m int`: The number of signatures the script requires
+//   - `pubKeys [][]byte`: The public keys in script order
+//   - `ok bool`: false when the script is not a MultiSig script
+func (s Script) MultiSigKeys() (m int, pubKeys [][]byte, ok bool) {
+	instructions, err := s.Instructions()
+	if err != nil || len(instructions) < 4 || instructions[len(instructions)-1].Op != OP_CHECKMULTISIG {
+		return 0, nil, false
+	}
+
+	required, errM := decodeNum(smallInt(instructions[0]), 4)
+	n, errN := decodeNum(smallInt(instructions[len(instructions)-2]), 4)
+	keys := instructions[1 : len(instructions)-2]
+	if errM != nil || errN != nil || int(n) != len(keys) || required < 1 || required > n {
+		return 0, nil, false
+	}
+	for _, key := range keys {
+		if len(key.Data) == 0 {
+			return 0, nil, false
+		}
+		pubKeys = append(pubKeys, key.Data)
+	}
+	return int(required), pubKeys, true
+}
+
+// MultiSigScript returns the script of an input spending a MultiSig output, the signatures are in the order of the
+// public keys they belong to
+func MultiSigScript(sigs [][]byte) (Script, error) {
+	b := NewBuilder()
+	for _, sig := range sigs {
+		b.AddData(sig)
+	}
+	return b.Script()
+}
+
+// RedeemScript appends the push of the redeem script to the script of an input spending a PayToScriptHash output
+func RedeemScript(sigScript Script, redeem Script) (Script, error) {
+	return (&Builder{script: bytes.Clone(sigScript)}).AddData(redeem).Script()
+}
+
+// SecretSize is the size of the secret whose SHA256 hash a HashTimeLock script locks to
+const SecretSize = 32
+
+// HashTimeLock are the terms of a hash time-locked contract: the receiver spends the output with the secret
+// of the hash, the sender takes it back once the timeout is reached
+type HashTimeLock struct {
+	// Hash is the SHA256 hash of the secret
+	Hash []byte
+
+	// Receiver is the public key hash of the key that claims the output with the secret
+	Receiver []byte
+
+	// Sender is the public key hash of the key that refunds the output after the timeout
+	Sender []byte
+
+	// Timeout is the height, or unix time, from which the sender can refund the output (see OP_CHECKLOCKTIMEVERIFY)
+	Timeout int64
+}
+
+// Script returns the script of the contract:
+//
+//	OP_IF
+//	  OP_SIZE <32> OP_EQUALVERIFY OP_SHA256 <hash> OP_EQUALVERIFY OP_DUP OP_HASH160 <receiver>
+//	OP_ELSE
+//	  <timeout> OP_CHECKLOCKTIMEVERIFY OP_DROP OP_DUP OP_HASH160 <sender>
+//	OP_ENDIF
+//	OP_EQUALVERIFY OP_CHECKSIG
+//
+// NOTE
+//   - The secret must be SecretSize bytes long, so a secret one chain accepts is accepted by every other chain
+//
+// Returns
+//   - `Script`: The script, it is usually paid to through its script address (see PayToScriptHash)
+//   - `error`: A hash, a public key hash or a timeout of the wrong size
+func (h HashTimeLock) Script() (Script, error) {
+	if len(h.Hash) != 32 || len(h.Receiver) != 20 || len(h.Sender) != 20 {
+		return nil, fmt.Errorf("a hash time lock has a 32 byte hash and 20 byte public key hashes")
+	}
+	if h.Timeout <= 0 || len(encodeNum(h.Timeout)) > 5 {
+		return nil, fmt.Errorf("invalid timeout %d", h.Timeout)
+	}
+	return NewBuilder().
+		AddOp(OP_IF).
+		AddOp(OP_SIZE).AddInt(SecretSize).AddOp(OP_EQUALVERIFY).AddOp(OP_SHA256).AddData(h.Hash).AddOp(OP_EQUALVERIFY).
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(h.Receiver).
+		AddOp(OP_ELSE).
+		AddInt(h.Timeout).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(h.Sender).
+		AddOp(OP_ENDIF).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).Script()
+}
+
+// HashTimeLock returns the terms of a HashTimeLock script
+//
+// Returns
+//   - `HashTimeLock`: The terms of the contract
+//   - `bool`: false when the script is not a HashTimeLock script
+func (s Script) HashTimeLock() (HashTimeLock, bool) {
+	instructions, err := s.Instructions()
+	if err != nil || len(instructions) != 20 {
+		return HashTimeLock{}, false
+	}
+	timeout, err := decodeNum(smallInt(instructions[11]), 5)
+	if err != nil {
+		return HashTimeLock{}, false
+	}
+
+	h := HashTimeLock{Hash: instructions[5].Data, Receiver: instructions[9].Data, Sender: instructions[16].Data, Timeout: timeout}
+	expected, err := h.Script()
+	if err != nil || !bytes.Equal(expected, s) {
+		return HashTimeLock{}, false
+	}
+	return h, true
+}
+
+// ClaimScript returns the script of an input claiming a HashTimeLock output with the secret:
+// <signature> <pubkey> <secret> OP_1
+func ClaimScript(sig, pubKey, secret []byte) (Script, error) {
+	return NewBuilder().AddData(sig).AddData(pubKey).AddData(secret).AddInt(1).Script()
+}
+
+// RefundScript returns the script of an input refunding a HashTimeLock output after its timeout:
+// <signature> <pubkey> OP_0
+func RefundScript(sig, pubKey []byte) (Script, error) {
+	return NewBuilder().AddData(sig).AddData(pubKey).AddInt(0).Script()
+}
+
+// MaxDataSize is the largest payload a NullData script carries
+const MaxDataSize = 80
+
+// NullData returns the script of a provably unspendable output carrying data: OP_RETURN <data>
+//
+// Returns
+//   - `Script`: The script, it fails as soon as it is executed so the output can never be spent
+//   - `error`: The data is larger than MaxDataSize
+func NullData(data []byte) (Script, error) {
+	if len(data) > MaxDataSize {
+		return nil, fmt.Errorf("%d bytes of data exceed the size of %d", len(data), MaxDataSize)
+	}
+	return NewBuilder().AddOp(OP_RETURN).AddData(data).Script()
+}
+
+// IsUnspendable tells whether the script starts with OP_RETURN, nothing can unlock it
+func (s Script) IsUnspendable() bool {
+	return len(s) > 0 && s[0] == byte(OP_RETURN)
+}
+
+// NullData returns the data a NullData script carries
+//
+// Returns
+//   - `[]byte`: The data, empty when the script is a bare OP_RETURN
+//   - `bool`: false when the script is not a NullData script or carries more than MaxDataSize bytes
+func (s Script) NullData() ([]byte, bool) {
+	if !s.IsUnspendable() {
+		return nil, false
+	}
+	instructions, err := s.Instructions()
+	switch {
+	case err != nil || len(instructions) > 2:
+		return nil, false
+	case len(instructions) == 1:
+		return []byte{}, true
+	case instructions[1].Op > OP_PUSHDATA4 || len(instructions[1].Data) > MaxDataSize:
+		return nil, false
+	}
+	return instructions[1].Data, true
+}
+
+// smallInt returns the number an instruction pushes encoded like encodeNum
+func smallInt(in Instruction) []byte {
+	if in.Op >= OP_1 && in.Op <= OP_16 {
+		return encodeNum(int64(in.Op - OP_1 + 1))
+	}
+	return in.Data
+}
@@ -0,0 +1,306 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/toolkit"
+)
+
+// AddrIndexBestKey stores the hash of the last block the address index is in sync with
+var AddrIndexBestKey = NamespaceMeta.Key([]byte("addrindex_best"))
+
+// AddressOutput is an output paid to an address together with where it was spent
+type AddressOutput struct {
+	// Key identifies the address the output was paid to, usually its public key hash
+	Key []byte
+
+	TxnId  string
+	Vout   int32
+	Height int32
+	Value  int64
+
+	// Script is the locking script of the output
+	Script string
+
+	// SpentBy is the id of the transaction that spent the output, empty while it is unspent
+	SpentBy string
+
+	// SpentHeight is the height of the block that spent the output
+	SpentHeight int32
+}
+
+// addressSpend marks the output (txnId, vout) as spent by the transaction spentBy
+type addressSpend struct {
+	txnId       string
+	vout        int32
+	spentBy     string
+	spentHeight int32
+}
+
+const (
+	// pubKeyHashKey marks address keys built from the public key hash of a wallet address
+	pubKeyHashKey byte = 0x00
+	// rawScriptKey marks address keys built from a locking script that is not a wallet address
+	rawScriptKey byte = 0x01
+
+	// addressCheckSumLength is the length of the checksum at the end of a wallet address
+	addressCheckSumLength = 4
+)
+
+// AddressKey returns the address index key of a locking script
+//
+// Process
+//   - Scripts holding a wallet address (Base58(VERSION + HASH160 + CHECKSUM)) are keyed by the address's public key hash
+//   - Any other script is keyed by the script itself
+func AddressKey(script string) []byte {
+	if _, pubKeyHash, err := toolkit.Base58CheckDecode(script, addressCheckSumLength); err == nil && len(pubKeyHash) == 20 {
+		return append([]byte{pubKeyHashKey}, pubKeyHash...)
+	}
+	return append([]byte{rawScriptKey}, script...)
+}
+
+// addressEntries lists the outputs a block creates and the outputs it spends
+func addressEntries(b block.Block) (outputs []AddressOutput, spends []addressSpend) {
+	for _, tx := range b.GetTransaction() {
+		for vout, out := range tx.GetOutputs() {
+			outputs = append(outputs, AddressOutput{
+				Key:    AddressKey(out.ScriptPubKey),
+				TxnId:  tx.GetId(),
+				Vout:   int32(vout),
+				Height: b.GetHeight(),
+				Value:  out.Value,
+				Script: out.ScriptPubKey,
+			})
+		}
+
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.GetInputs() {
+			spends = append(spends, addressSpend{
+				txnId:       in.TxnId,
+				vout:        in.Output,
+				spentBy:     tx.GetId(),
+				spentHeight: b.GetHeight(),
+			})
+		}
+	}
+	return outputs, spends
+}
+
+// Serialize converts the output into bytes, the key fields (address key, txid, vout) live in the storage key instead
+func (o *AddressOutput) Serialize() (val []byte, err error) {
+	var buf bytes.Buffer
+	if err = toolkit.SerializeString(&buf, o.Script); err != nil {
+		return val, err
+	}
+	if err = binary.Write(&buf, binary.LittleEndian, o.Height); err != nil {
+		return val, err
+	}
+	if err = binary.Write(&buf, binary.LittleEndian, o.Value); err != nil {
+		return val, err
+	}
+	if err = toolkit.SerializeString(&buf, o.SpentBy); err != nil {
+		return val, err
+	}
+	if err = binary.Write(&buf, binary.LittleEndian, o.SpentHeight); err != nil {
+		return val, err
+	}
+	return buf.Bytes(), err
+}
+
+// Deserialize converts bytes written by Serialize back into the output
+func (o *AddressOutput) Deserialize(data []byte) (err error) {
+	buf := bytes.NewReader(data)
+	if o.Script, err = toolkit.DeserializeString(buf); err != nil {
+		return err
+	}
+	if err = binary.Read(buf, binary.LittleEndian, &o.Height); err != nil {
+		return err
+	}
+	if err = binary.Read(buf, binary.LittleEndian, &o.Value); err != nil {
+		return err
+	}
+	if o.SpentBy, err = toolkit.DeserializeString(buf); err != nil {
+		return err
+	}
+	return binary.Read(buf, binary.LittleEndian, &o.SpentHeight)
+}
+
+// addrPrefix is the prefix shared by every entry of an address, it is length prefixed so keys never overlap
+func addrPrefix(key []byte) []byte {
+	return NamespaceAddrIndex.Key(binary.BigEndian.AppendUint16(nil, uint16(len(key))), key)
+}
+
+func addrKey(key []byte, txnId string, vout int32) []byte {
+	k := addrPrefix(key)
+	k = binary.BigEndian.AppendUint16(k, uint16(len(txnId)))
+	k = append(k, txnId...)
+	return binary.BigEndian.AppendUint32(k, uint32(vout))
+}
+
+func addrOutKey(txnId string, vout int32) []byte {
+	return NamespaceAddrOut.Key([]byte(txnId), binary.BigEndian.AppendUint32(nil, uint32(vout)))
+}
+
+// IndexAddresses adds the outputs and spends of a connected block to the address index
+//
+// Process:
+//   - Every output of the block is stored under the key of its locking script
+//   - Every output spent by the block is marked with the spending transaction
+//   - Moves the index's best block to the block
+//
+// NOTE
+//   - Spends of outputs that were never indexed are ignored
+func (s *Store) IndexAddresses(_ context.Context, b block.Block) error {
+	return s.store.Update(func(txn *badger.Txn) error {
+		return indexAddresses(txn, b)
+	})
+}
+
+// UnindexAddresses rolls back IndexAddresses for a disconnected block
+//
+// Process:
+//   - The outputs spent by the block become unspent again
+//   - The outputs created by the block are removed
+//   - Moves the index's best block back to the block's parent
+func (s *Store) UnindexAddresses(_ context.Context, b block.Block) error {
+	return s.store.Update(func(txn *badger.Txn) error {
+		return unindexAddresses(txn, b)
+	})
+}
+
+func indexAddresses(txn *badger.Txn, b block.Block) error {
+	outputs, spends := addressEntries(b)
+	for _, out := range outputs {
+		if err := setAddressOutput(txn, out); err != nil {
+			return err
+		}
+		if err := txn.Set(addrOutKey(out.TxnId, out.Vout), out.Key); err != nil {
+			return err
+		}
+	}
+	for _, spend := range spends {
+		if err := markAddressSpend(txn, spend.txnId, spend.vout, spend.spentBy, spend.spentHeight); err != nil {
+			return err
+		}
+	}
+	return txn.Set(AddrIndexBestKey, []byte(b.GetHash()))
+}
+
+func unindexAddresses(txn *badger.Txn, b block.Block) error {
+	outputs, spends := addressEntries(b)
+	for _, spend := range spends {
+		if err := markAddressSpend(txn, spend.txnId, spend.vout, "", 0); err != nil {
+			return err
+		}
+	}
+	for _, out := range outputs {
+		if err := txn.Delete(addrKey(out.Key, out.TxnId, out.Vout)); err != nil {
+			return err
+		}
+		if err := txn.Delete(addrOutKey(out.TxnId, out.Vout)); err != nil {
+			return err
+		}
+	}
+	return txn.Set(AddrIndexBestKey, []byte(b.GetPrevBlockHash()))
+}
+
+// FindAddressOutputs returns every output ever paid to the address
+//
+// Returns
+//   - outputs([]AddressOutput): The outputs, spent ones included
+//   - err(error): Returns the error during the search
+func (s *Store) FindAddressOutputs(_ context.Context, address string) (outputs []AddressOutput, err error) {
+	key := AddressKey(address)
+	err = s.store.View(func(txn *badger.Txn) error {
+		prefix := addrPrefix(key)
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix, PrefetchValues: true, PrefetchSize: 100})
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			out := AddressOutput{Key: key}
+
+			// the rest of the key is (txid length, txid, vout)
+			rest := it.Item().Key()[len(prefix):]
+			idLen := int(binary.BigEndian.Uint16(rest))
+			out.TxnId = string(rest[2 : 2+idLen])
+			out.Vout = int32(binary.BigEndian.Uint32(rest[2+idLen:]))
+
+			if err := it.Item().Value(out.Deserialize); err != nil {
+				return err
+			}
+			outputs = append(outputs, out)
+		}
+		return nil
+	})
+	return outputs, err
+}
+
+// FindAddrIndexBest returns the hash of the last block the address index is in sync with
+func (s *Store) FindAddrIndexBest(_ context.Context) (hash string, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(AddrIndexBestKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		val, err := item.ValueCopy(nil)
+		hash = string(val)
+		return err
+	})
+	return hash, err
+}
+
+// DropAddrIndex deletes the whole address index
+func (s *Store) DropAddrIndex(_ context.Context) error {
+	if err := s.store.DropPrefix(NamespaceAddrIndex.Prefix(), NamespaceAddrOut.Prefix()); err != nil {
+		return fmt.Errorf("failed to drop address index: %w", err)
+	}
+	return s.store.Update(func(txn *badger.Txn) error {
+		return txn.Delete(AddrIndexBestKey)
+	})
+}
+
+func setAddressOutput(txn *badger.Txn, out AddressOutput) error {
+	data, err := out.Serialize()
+	if err != nil {
+		return err
+	}
+	return txn.Set(addrKey(out.Key, out.TxnId, out.Vout), data)
+}
+
+// markAddressSpend updates the spender of an indexed output, an empty spentBy marks it unspent
+func markAddressSpend(txn *badger.Txn, txnId string, vout int32, spentBy string, spentHeight int32) error {
+	item, err := txn.Get(addrOutKey(txnId, vout))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	key, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+
+	item, err = txn.Get(addrKey(key, txnId, vout))
+	if err != nil {
+		return err
+	}
+	out := AddressOutput{Key: key, TxnId: txnId, Vout: vout}
+	if err = item.Value(out.Deserialize); err != nil {
+		return err
+	}
+	out.SpentBy = spentBy
+	out.SpentHeight = spentHeight
+	return setAddressOutput(txn, out)
+}
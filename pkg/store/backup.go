@@ -0,0 +1,559 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/tdadadavid/block/pkg/toolkit"
+)
+
+const (
+	// BackupMagic starts every snapshot written by Backup
+	BackupMagic uint32 = 0xB10CBAC0
+
+	// BackupVersion is the version of the snapshot format, version 1 snapshots have no wallets section and are still
+	// restored
+	BackupVersion uint32 = 2
+
+	// backupChunkSize is the largest chunk a section is split into
+	backupChunkSize = 1 << 20
+
+	// maxBackupHeaderSize and maxBackupNameSize bound the lengths read from a snapshot before allocating them
+	maxBackupHeaderSize = 4 << 10
+	maxBackupNameSize   = 255
+)
+
+// kinds of the sections of a snapshot
+const (
+	backupSectionEnd       byte = 0
+	backupSectionDatabase  byte = 'D'
+	backupSectionBlockFile byte = 'F'
+	backupSectionWallets   byte = 'W'
+)
+
+// ErrBadBackup is returned when a snapshot is malformed or does not match its header
+var ErrBadBackup = errors.New("bad backup")
+
+// ErrNotEmpty is returned when a snapshot would be restored over existing data
+var ErrNotEmpty = errors.New("data directory is not empty")
+
+// BackupHeader describes the chain a snapshot was taken of
+type BackupHeader struct {
+	// ChainId is the hash of the genesis block
+	ChainId string `json:"chain_id"`
+
+	// TipHash is the hash of the tip when the snapshot was taken
+	TipHash string `json:"tip_hash"`
+
+	// Height is the height of the tip
+	Height int32 `json:"height"`
+
+	// Created is the unix time the snapshot was taken at
+	Created int64 `json:"created"`
+}
+
+// Serialize serializes the header
+func (h BackupHeader) Serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := toolkit.SerializeString(&buf, h.ChainId); err != nil {
+		return nil, err
+	}
+	if err := toolkit.SerializeString(&buf, h.TipHash); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, binary.BigEndian, h.Height); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, binary.BigEndian, h.Created); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Deserialize deserializes the header
+func (h *BackupHeader) Deserialize(data []byte) (err error) {
+	buf := bytes.NewReader(data)
+	if h.ChainId, err = toolkit.DeserializeString(buf); err != nil {
+		return err
+	}
+	if h.TipHash, err = toolkit.DeserializeString(buf); err != nil {
+		return err
+	}
+	if err = binary.Read(buf, binary.BigEndian, &h.Height); err != nil {
+		return err
+	}
+	return binary.Read(buf, binary.BigEndian, &h.Created)
+}
+
+// Backup writes a consistent snapshot of the store to w while the store stays open
+//
+// Parameters:
+//   - w(io.Writer): Where the snapshot is written
+//   - wallets(Storage): The store the wallets are kept in, nil leaves the wallets out of the snapshot
+//
+// Process:
+//   - Writes MAGIC + VERSION + the length prefixed BackupHeader
+//   - Streams every key of badger, then every block file that was not pruned up to its committed end, then the
+//     wallets and redeem scripts of the wallet store, each as a section of chunks ending with an empty chunk
+//   - Ends with an end marker followed by the SHA256 of everything written before it
+//
+// NOTE
+//   - Blocks can't be connected or disconnected while the snapshot is taken, readers and other writers carry on
+//   - Badger is streamed from a single read transaction, so the keys written during the backup are not part of it
+//
+// Returns
+//   - header(BackupHeader): The header written to the snapshot
+//   - err(error): Returns the error during the backup, the snapshot is unusable in that case
+func (s *Store) Backup(ctx context.Context, w io.Writer, wallets Storage) (header BackupHeader, err error) {
+	var walletStore *Store
+	if wallets != nil {
+		var ok bool
+		if walletStore, ok = wallets.(*Store); !ok {
+			return header, fmt.Errorf("wallets kept in %T can't be backed up", wallets)
+		}
+	}
+
+	s.files.mu.Lock()
+	defer s.files.mu.Unlock()
+
+	err = s.store.View(func(txn *badger.Txn) error {
+		tip, err := getTipHash(txn)
+		if err != nil {
+			return fmt.Errorf("an empty store can't be backed up: %w", err)
+		}
+		b, err := getHeader(txn, tip)
+		if err != nil {
+			return err
+		}
+		header.TipHash, header.Height = tip, b.GetHeight()
+		header.ChainId, err = getHeightHash(txn, 0)
+		return err
+	})
+	if err != nil {
+		return header, err
+	}
+	header.Created = time.Now().Unix()
+
+	hash := sha256.New()
+	out := io.MultiWriter(w, hash)
+
+	headerData, err := header.Serialize()
+	if err != nil {
+		return header, err
+	}
+	prefix := binary.BigEndian.AppendUint32(nil, BackupMagic)
+	prefix = binary.BigEndian.AppendUint32(prefix, BackupVersion)
+	prefix = binary.BigEndian.AppendUint32(prefix, uint32(len(headerData)))
+	if _, err = out.Write(append(prefix, headerData...)); err != nil {
+		return header, err
+	}
+
+	if err = writeBackupSection(out, backupSectionDatabase, "", streamDatabase(s.store, nil)); err != nil {
+		return header, fmt.Errorf("failed to back up the database: %w", err)
+	}
+
+	for n := s.files.prunedBelow; n <= s.files.committed.File; n++ {
+		if err = ctx.Err(); err != nil {
+			return header, err
+		}
+		file, _, err := s.files.file(n)
+		if err != nil {
+			return header, err
+		}
+		// only the committed records of the current file are part of the snapshot
+		size := int64(1<<63 - 1)
+		if n == s.files.committed.File {
+			size = int64(s.files.committed.Offset)
+		}
+		if err = writeBackupSection(out, backupSectionBlockFile, BlockFileName(n), func(w io.Writer) error {
+			_, err := io.Copy(w, io.NewSectionReader(file, 0, size))
+			return err
+		}); err != nil {
+			return header, fmt.Errorf("failed to back up block file %s: %w", BlockFileName(n), err)
+		}
+	}
+
+	if walletStore != nil {
+		keys := []Namespace{NamespaceWallets, NamespaceScripts}
+		if err = writeBackupSection(out, backupSectionWallets, "", streamDatabase(walletStore.store, keys)); err != nil {
+			return header, fmt.Errorf("failed to back up the wallets: %w", err)
+		}
+	}
+
+	if _, err = out.Write([]byte{backupSectionEnd}); err != nil {
+		return header, err
+	}
+	_, err = w.Write(hash.Sum(nil))
+	return header, err
+}
+
+// Restore restores a snapshot written by Backup into a new store at path
+//
+// Parameters:
+//   - r(io.Reader): The snapshot
+//   - path(string): The data directory of the store
+//   - walletsPath(string): The wallet store the wallets of the snapshot are added to, empty leaves them out
+//   - force(bool): Replaces whatever is in path, otherwise a non-empty path is refused with ErrNotEmpty
+//
+// Process:
+//   - Loads the database and writes the block files into a new directory next to path while hashing the snapshot
+//   - Checks the SHA256 at the end of the snapshot
+//   - Opens the restored store, which checks the block files against the index, and compares its genesis,
+//     tip and height with the header
+//   - Moves the existing data directory aside, moves the restored one into its place and deletes the old one
+//   - Adds the wallets and redeem scripts of the snapshot to the wallet store, it is created when it does not exist
+//
+// NOTE
+//   - path is only touched once the snapshot is verified, a failed restore leaves it as it was
+//   - The wallets are merged, force or not, a wallet of the wallet store that is not in the snapshot is never lost
+//
+// Returns
+//   - header(BackupHeader): The header of the snapshot
+//   - err(error): ErrBadBackup when the snapshot is malformed or does not match its header
+func Restore(r io.Reader, path string, walletsPath string, force bool) (header BackupHeader, err error) {
+	path = filepath.Clean(path)
+	entries, err := os.ReadDir(path)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return header, err
+	}
+	if len(entries) > 0 && !force {
+		return header, fmt.Errorf("%w: %s", ErrNotEmpty, path)
+	}
+
+	parent := filepath.Dir(path)
+	if err = os.MkdirAll(parent, 0o755); err != nil {
+		return header, err
+	}
+	restored, err := os.MkdirTemp(parent, "."+filepath.Base(path)+".restore-")
+	if err != nil {
+		return header, err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(restored)
+		}
+	}()
+
+	header, wallets, err := restoreSnapshot(r, restored)
+	if wallets != nil {
+		defer wallets.Close()
+	}
+	if err != nil {
+		return header, err
+	}
+	if err = verifyRestore(restored, header); err != nil {
+		return header, err
+	}
+
+	if !exists {
+		err = os.Rename(restored, path)
+	} else {
+		old := restored + ".old"
+		if err = os.Rename(path, old); err != nil {
+			return header, err
+		}
+		if err = os.Rename(restored, path); err != nil {
+			return header, errors.Join(err, os.Rename(old, path))
+		}
+		err = os.RemoveAll(old)
+	}
+	if err != nil || wallets == nil || walletsPath == "" {
+		return header, err
+	}
+	if err = mergeWallets(wallets, walletsPath); err != nil {
+		return header, fmt.Errorf("the chain is restored but the wallets are not: %w", err)
+	}
+	return header, nil
+}
+
+// mergeWallets copies the wallets and redeem scripts of the restored wallets database into the wallet store at path
+func mergeWallets(from *badger.DB, path string) (err error) {
+	opened, err := Open(path)
+	if err != nil {
+		return err
+	}
+	to := opened.(*Store)
+	defer func() {
+		err = errors.Join(err, to.Close())
+	}()
+
+	batch := to.store.NewWriteBatch()
+	defer batch.Cancel()
+	err = from.View(func(txn *badger.Txn) error {
+		for _, ns := range []Namespace{NamespaceWallets, NamespaceScripts} {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = ns.Prefix()
+			it := txn.NewIterator(opts)
+			for it.Rewind(); it.Valid(); it.Next() {
+				val, err := it.Item().ValueCopy(nil)
+				if err == nil {
+					err = batch.Set(it.Item().KeyCopy(nil), val)
+				}
+				if err != nil {
+					it.Close()
+					return err
+				}
+			}
+			it.Close()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return batch.Flush()
+}
+
+// verifyRestore opens the store restored at path and checks its genesis, tip and height match the header
+func verifyRestore(path string, header BackupHeader) (err error) {
+	s, err := Open(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadBackup, err)
+	}
+	defer func() {
+		err = errors.Join(err, s.Close())
+	}()
+
+	tip, err := s.FindLastBlock(context.Background())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadBackup, err)
+	}
+	genesis, err := s.FindBlockByHeight(context.Background(), 0)
+	if errors.Is(err, ErrPruned) {
+		genesis, err = s.FindHeaderByHash(context.Background(), header.ChainId)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadBackup, err)
+	}
+	if genesis.GetHeight() != 0 || genesis.GetPrevBlockHash() != "" {
+		return fmt.Errorf("%w: block %s is not a genesis block", ErrBadBackup, genesis.GetHash())
+	}
+	if tip.GetHash() != header.TipHash || tip.GetHeight() != header.Height || genesis.GetHash() != header.ChainId {
+		return fmt.Errorf("%w: restored tip %s at height %d of chain %s, the header expects %s at height %d of chain %s",
+			ErrBadBackup, tip.GetHash(), tip.GetHeight(), genesis.GetHash(), header.TipHash, header.Height, header.ChainId)
+	}
+	return nil
+}
+
+// restoreSnapshot writes the sections of the snapshot into path and checks its checksum, the wallets section is
+// loaded into a database in memory that the caller closes
+func restoreSnapshot(r io.Reader, path string) (header BackupHeader, wallets *badger.DB, err error) {
+	hash := sha256.New()
+	in := io.TeeReader(r, hash)
+
+	prefix := make([]byte, 12)
+	if _, err = io.ReadFull(in, prefix); err != nil {
+		return header, wallets, fmt.Errorf("%w: %v", ErrBadBackup, err)
+	}
+	if magic := binary.BigEndian.Uint32(prefix); magic != BackupMagic {
+		return header, wallets, fmt.Errorf("%w: bad magic %x", ErrBadBackup, magic)
+	}
+	if version := binary.BigEndian.Uint32(prefix[4:]); version == 0 || version > BackupVersion {
+		return header, wallets, fmt.Errorf("%w: unsupported version %d", ErrBadBackup, version)
+	}
+	size := binary.BigEndian.Uint32(prefix[8:])
+	if size > maxBackupHeaderSize {
+		return header, wallets, fmt.Errorf("%w: header of %d bytes exceeds the size of %d", ErrBadBackup, size, maxBackupHeaderSize)
+	}
+	headerData := make([]byte, size)
+	if _, err = io.ReadFull(in, headerData); err != nil {
+		return header, wallets, fmt.Errorf("%w: %v", ErrBadBackup, err)
+	}
+	if err = header.Deserialize(headerData); err != nil {
+		return header, wallets, fmt.Errorf("%w: malformed header: %v", ErrBadBackup, err)
+	}
+
+	db, err := badger.Open(badger.DefaultOptions(path).WithLogger(nil))
+	if err != nil {
+		return header, wallets, err
+	}
+	defer func() {
+		err = errors.Join(err, db.Close())
+	}()
+
+	for done := false; !done; {
+		kind := make([]byte, 1)
+		if _, err = io.ReadFull(in, kind); err != nil {
+			return header, wallets, fmt.Errorf("%w: %v", ErrBadBackup, err)
+		}
+
+		switch kind[0] {
+		case backupSectionEnd:
+			done = true
+		case backupSectionDatabase:
+			if _, err = readBackupName(in); err != nil {
+				return header, wallets, err
+			}
+			if err = db.Load(&backupChunkReader{r: in}, 256); err != nil {
+				return header, wallets, fmt.Errorf("%w: failed to load the database: %v", ErrBadBackup, err)
+			}
+		case backupSectionWallets:
+			if _, err = readBackupName(in); err != nil {
+				return header, wallets, err
+			}
+			if wallets == nil {
+				if wallets, err = badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)); err != nil {
+					return header, wallets, err
+				}
+			}
+			if err = wallets.Load(&backupChunkReader{r: in}, 256); err != nil {
+				return header, wallets, fmt.Errorf("%w: failed to load the wallets: %v", ErrBadBackup, err)
+			}
+		case backupSectionBlockFile:
+			name, err := readBackupName(in)
+			if err != nil {
+				return header, wallets, err
+			}
+			if name != filepath.Base(name) {
+				return header, wallets, fmt.Errorf("%w: bad block file name %q", ErrBadBackup, name)
+			}
+			if err = restoreFile(filepath.Join(path, name), &backupChunkReader{r: in}); err != nil {
+				return header, wallets, err
+			}
+		default:
+			return header, wallets, fmt.Errorf("%w: unknown section %q", ErrBadBackup, kind[0])
+		}
+	}
+
+	sum := make([]byte, sha256.Size)
+	if _, err = io.ReadFull(r, sum); err != nil {
+		return header, wallets, fmt.Errorf("%w: missing checksum: %v", ErrBadBackup, err)
+	}
+	if !bytes.Equal(sum, hash.Sum(nil)) {
+		return header, wallets, fmt.Errorf("%w: checksum mismatch", ErrBadBackup)
+	}
+	return header, wallets, nil
+}
+
+func restoreFile(name string, r io.Reader) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("%w: %v", ErrBadBackup, err)
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// streamDatabase returns a function writing the keys of the namespaces (every key when there is none) in badger's
+// backup format, a single producer reads them through one transaction
+func streamDatabase(db *badger.DB, namespaces []Namespace) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		stream := db.NewStream()
+		stream.LogPrefix = "Store.Backup"
+		stream.NumGo = 1
+		if len(namespaces) > 0 {
+			stream.ChooseKey = func(item *badger.Item) bool {
+				return slices.ContainsFunc(namespaces, func(ns Namespace) bool {
+					return bytes.HasPrefix(item.Key(), ns.Prefix())
+				})
+			}
+		}
+		_, err := stream.Backup(w, 0)
+		return err
+	}
+}
+
+// writeBackupSection writes KIND + the length prefixed name, then whatever fn writes as chunks of
+// LENGTH + DATA ending with an empty chunk
+func writeBackupSection(w io.Writer, kind byte, name string, fn func(w io.Writer) error) error {
+	prefix := binary.BigEndian.AppendUint32([]byte{kind}, uint32(len(name)))
+	if _, err := w.Write(append(prefix, name...)); err != nil {
+		return err
+	}
+	chunks := &backupChunkWriter{w: w}
+	if err := fn(chunks); err != nil {
+		return err
+	}
+	return chunks.Close()
+}
+
+func readBackupName(r io.Reader) (string, error) {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(r, length); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBadBackup, err)
+	}
+	size := binary.BigEndian.Uint32(length)
+	if size > maxBackupNameSize {
+		return "", fmt.Errorf("%w: name of %d bytes exceeds the size of %d", ErrBadBackup, size, maxBackupNameSize)
+	}
+	name := make([]byte, size)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBadBackup, err)
+	}
+	return string(name), nil
+}
+
+// backupChunkWriter splits a section into chunks so its length does not need to be known upfront
+type backupChunkWriter struct {
+	w io.Writer
+}
+
+func (c *backupChunkWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := p[:min(len(p), backupChunkSize)]
+		if _, err = c.w.Write(binary.BigEndian.AppendUint32(nil, uint32(len(chunk)))); err != nil {
+			return n, err
+		}
+		if _, err = c.w.Write(chunk); err != nil {
+			return n, err
+		}
+		n, p = n+len(chunk), p[len(chunk):]
+	}
+	return n, nil
+}
+
+// Close writes the empty chunk that ends the section
+func (c *backupChunkWriter) Close() error {
+	_, err := c.w.Write(make([]byte, 4))
+	return err
+}
+
+// backupChunkReader reads the chunks of a section, it returns io.EOF at the empty chunk that ends it
+type backupChunkReader struct {
+	r         io.Reader
+	remaining uint32
+	done      bool
+}
+
+func (c *backupChunkReader) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, io.EOF
+	}
+	if c.remaining == 0 {
+		length := make([]byte, 4)
+		if _, err := io.ReadFull(c.r, length); err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if c.remaining = binary.BigEndian.Uint32(length); c.remaining == 0 {
+			c.done = true
+			return 0, io.EOF
+		}
+	}
+	if uint32(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= uint32(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
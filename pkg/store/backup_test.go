@@ -0,0 +1,183 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorage_BackupRestore(t *testing.T) {
+	conformance(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		blocks := connectBlocks(t, s, 5)
+		assert.NoError(t, s.CreateWallet(ctx, "addr", []byte("wallet")))
+
+		var snapshot bytes.Buffer
+		header, err := s.Backup(ctx, &snapshot, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, blocks[0].GetHash(), header.ChainId)
+		assert.Equal(t, blocks[5].GetHash(), header.TipHash)
+		assert.Equal(t, int32(5), header.Height)
+
+		path := t.TempDir()
+		restored, err := Restore(bytes.NewReader(snapshot.Bytes()), path, "", false)
+		assert.NoError(t, err)
+		assert.Equal(t, header, restored)
+
+		r, err := Open(path)
+		assert.NoError(t, err)
+		defer r.Close()
+		for _, b := range blocks {
+			found, err := r.FindBlockByHash(ctx, b.GetHash())
+			assert.NoError(t, err)
+			assert.Equal(t, b.GetHash(), found.GetHash())
+		}
+		_, err = r.FindUTXO(ctx, "cb", 0)
+		assert.NoError(t, err)
+		wallets, err := r.FindAllWallets(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("wallet")}, wallets)
+	}, WithMaxBlockFileSize(300))
+}
+
+func TestStore_BackupRestoreWallets(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenInMemory()
+	assert.NoError(t, err)
+	defer s.Close()
+	connectBlocks(t, s, 2)
+	wallets, err := OpenInMemory()
+	assert.NoError(t, err)
+	defer wallets.Close()
+	assert.NoError(t, wallets.CreateWallet(ctx, "alice", []byte("alice")))
+	assert.NoError(t, wallets.CreateScript(ctx, "multisig", []byte("redeem")))
+
+	var snapshot bytes.Buffer
+	_, err = s.Backup(ctx, &snapshot, wallets)
+	assert.NoError(t, err)
+
+	// the wallets of the snapshot are added to the ones already there
+	walletsPath := filepath.Join(t.TempDir(), "wallets")
+	existing, err := Open(walletsPath)
+	assert.NoError(t, err)
+	assert.NoError(t, existing.CreateWallet(ctx, "bob", []byte("bob")))
+	assert.NoError(t, existing.Close())
+
+	path := filepath.Join(t.TempDir(), "data")
+	_, err = Restore(bytes.NewReader(snapshot.Bytes()), path, walletsPath, false)
+	assert.NoError(t, err)
+
+	merged, err := Open(walletsPath)
+	assert.NoError(t, err)
+	defer merged.Close()
+	found, err := merged.FindAllWallets(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, [][]byte{[]byte("alice"), []byte("bob")}, found)
+	scripts, err := merged.FindAllScripts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"multisig": []byte("redeem")}, scripts)
+
+	// the chain does not get the wallets
+	r, err := Open(path)
+	assert.NoError(t, err)
+	defer r.Close()
+	found, err = r.FindAllWallets(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func TestStore_RestoreRefusesNonEmptyDirectory(t *testing.T) {
+	s, err := OpenInMemory()
+	assert.NoError(t, err)
+	defer s.Close()
+	connectBlocks(t, s, 1)
+
+	var snapshot bytes.Buffer
+	_, err = s.Backup(context.Background(), &snapshot, nil)
+	assert.NoError(t, err)
+
+	path := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(path, "keep"), []byte("data"), 0o644))
+	_, err = Restore(bytes.NewReader(snapshot.Bytes()), path, "", false)
+	assert.ErrorIs(t, err, ErrNotEmpty)
+	assert.FileExists(t, filepath.Join(path, "keep"))
+
+	_, err = Restore(bytes.NewReader(snapshot.Bytes()), path, "", true)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(path, "keep"))
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "the restore leaves nothing next to the data directory")
+}
+
+func TestStore_RestoreKeepsDataWhenSnapshotIsBad(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenInMemory()
+	assert.NoError(t, err)
+	defer s.Close()
+	blocks := connectBlocks(t, s, 3)
+
+	var snapshot bytes.Buffer
+	_, err = s.Backup(ctx, &snapshot, nil)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "data")
+	_, err = Restore(bytes.NewReader(snapshot.Bytes()), path, "", false)
+	assert.NoError(t, err)
+
+	// forcing a truncated snapshot over the store fails and leaves the store as it was
+	_, err = Restore(bytes.NewReader(snapshot.Bytes()[:snapshot.Len()/2]), path, "", true)
+	assert.ErrorIs(t, err, ErrBadBackup)
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	r, err := Open(path)
+	assert.NoError(t, err)
+	defer r.Close()
+	tip, err := r.FindLastBlock(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, blocks[3].GetHash(), tip.GetHash())
+}
+
+func TestStore_RestoreRejectsTamperedSnapshot(t *testing.T) {
+	s, err := OpenInMemory()
+	assert.NoError(t, err)
+	defer s.Close()
+	connectBlocks(t, s, 3)
+
+	var snapshot bytes.Buffer
+	_, err = s.Backup(context.Background(), &snapshot, nil)
+	assert.NoError(t, err)
+
+	// a flipped byte in the last block file
+	tampered := bytes.Clone(snapshot.Bytes())
+	tampered[len(tampered)-64] ^= 0xff
+	path := filepath.Join(t.TempDir(), "data")
+	_, err = Restore(bytes.NewReader(tampered), path, "", false)
+	assert.ErrorIs(t, err, ErrBadBackup)
+	assert.NoDirExists(t, path)
+
+	// a truncated snapshot
+	_, err = Restore(bytes.NewReader(snapshot.Bytes()[:snapshot.Len()/2]), path, "", false)
+	assert.ErrorIs(t, err, ErrBadBackup)
+	assert.NoDirExists(t, path)
+
+	// lengths too large to allocate in the header and in the name of the first section
+	huge := bytes.Clone(snapshot.Bytes())
+	binary.BigEndian.PutUint32(huge[8:], 1<<31)
+	_, err = Restore(bytes.NewReader(huge), path, "", false)
+	assert.ErrorIs(t, err, ErrBadBackup)
+	assert.ErrorContains(t, err, "header of")
+	huge = bytes.Clone(snapshot.Bytes())
+	name := 12 + int(binary.BigEndian.Uint32(huge[8:])) + 1
+	binary.BigEndian.PutUint32(huge[name:], 1<<31)
+	_, err = Restore(bytes.NewReader(huge), path, "", false)
+	assert.ErrorIs(t, err, ErrBadBackup)
+	assert.ErrorContains(t, err, "name of")
+	assert.NoDirExists(t, path)
+}
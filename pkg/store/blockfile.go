@@ -0,0 +1,551 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/tdadadavid/block/pkg/block"
+)
+
+const (
+	// BlockFileMagic starts every record of a block file
+	BlockFileMagic uint32 = 0xB10CF11E
+
+	// DefaultMaxBlockFileSize is the size after which a new block file is started
+	DefaultMaxBlockFileSize = 128 << 20
+
+	// blockRecordHeaderSize is the size of magic, length and CRC32 in front of every block
+	blockRecordHeaderSize = 12
+
+	// blockLocationSize is the size of a serialized BlockLocation
+	blockLocationSize = 12
+)
+
+// ErrCorruptBlockFile is returned when a block file record fails its magic, length or checksum check
+var ErrCorruptBlockFile = errors.New("corrupt block file")
+
+var (
+	// BlockFileEndKey stores the end of the last block file record that was committed to the index
+	BlockFileEndKey = NamespaceMeta.Key([]byte("blockfile_end"))
+
+	// BlockFilePrunedKey stores the number of the first block file Prune did not delete
+	BlockFilePrunedKey = NamespaceMeta.Key([]byte("blockfile_pruned"))
+)
+
+// blockFileKey maps a block file to the highest block written to it
+func blockFileKey(n uint32) []byte {
+	return NamespaceBlockFiles.Key(binary.BigEndian.AppendUint32(nil, n))
+}
+
+// BlockLocation is where a block's record lives in the block files
+type BlockLocation struct {
+	// File is the number of the block file, blk00000.dat is file 0
+	File uint32
+
+	// Offset is the position of the record (not the block) in the file
+	Offset uint32
+
+	// Length is the length of the serialized block
+	Length uint32
+}
+
+// Serialize converts the location into bytes (file, offset, length)
+func (l BlockLocation) Serialize() []byte {
+	val := binary.BigEndian.AppendUint32(nil, l.File)
+	val = binary.BigEndian.AppendUint32(val, l.Offset)
+	return binary.BigEndian.AppendUint32(val, l.Length)
+}
+
+// Deserialize converts bytes written by Serialize back into the location
+func (l *BlockLocation) Deserialize(data []byte) error {
+	if len(data) != blockLocationSize {
+		return fmt.Errorf("malformed block location %x", data)
+	}
+	l.File = binary.BigEndian.Uint32(data)
+	l.Offset = binary.BigEndian.Uint32(data[4:])
+	l.Length = binary.BigEndian.Uint32(data[8:])
+	return nil
+}
+
+// end is the position right after the record
+func (l BlockLocation) end() BlockLocation {
+	return BlockLocation{File: l.File, Offset: l.Offset + blockRecordHeaderSize + l.Length}
+}
+
+// BlockFileName returns the name of block file n
+func BlockFileName(n uint32) string {
+	return fmt.Sprintf("blk%05d.dat", n)
+}
+
+// blockFile is a block file on disk or in memory
+type blockFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// blockFiles appends blocks to rotating block files, badger only stores the BlockLocation of every block
+//
+// Process
+//   - Every record is MAGIC + LENGTH + CRC32(BLOCK) + BLOCK, the integers are big endian
+//   - Records are written at the committed end, the end only moves once the badger transaction that indexes
+//     the record committed, so a failed or interrupted write is overwritten by the next one
+//
+// NOTE
+//   - Writers are serialized with mu, readers only need the files map
+type blockFiles struct {
+	mu      sync.Mutex
+	maxSize uint32
+
+	// committed is the end of the last indexed record, pending is the end after the records of the running write
+	committed BlockLocation
+	pending   BlockLocation
+
+	// prunedBelow is the number of the first block file that was not deleted by Prune
+	prunedBelow uint32
+
+	// open opens block file n, creating it when it does not exist, and returns its size
+	open func(n uint32) (blockFile, int64, error)
+	// remove deletes block file n, it succeeds when the file does not exist
+	remove  func(n uint32) error
+	filesMu sync.Mutex
+	files   map[uint32]blockFile
+
+	logger *slog.Logger
+}
+
+// newDiskBlockFiles keeps the block files in dir
+func newDiskBlockFiles(dir string, logger *slog.Logger) *blockFiles {
+	return &blockFiles{
+		maxSize: DefaultMaxBlockFileSize,
+		files:   make(map[uint32]blockFile),
+		logger:  logger,
+		open: func(n uint32) (blockFile, int64, error) {
+			f, err := os.OpenFile(filepath.Join(dir, BlockFileName(n)), os.O_RDWR|os.O_CREATE, 0o644)
+			if err != nil {
+				return nil, 0, err
+			}
+			info, err := f.Stat()
+			if err != nil {
+				_ = f.Close()
+				return nil, 0, err
+			}
+			return f, info.Size(), nil
+		},
+		remove: func(n uint32) error {
+			err := os.Remove(filepath.Join(dir, BlockFileName(n)))
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		},
+	}
+}
+
+// newMemoryBlockFiles keeps the block files in memory
+func newMemoryBlockFiles(logger *slog.Logger) *blockFiles {
+	return &blockFiles{
+		maxSize: DefaultMaxBlockFileSize,
+		files:   make(map[uint32]blockFile),
+		logger:  logger,
+		open: func(uint32) (blockFile, int64, error) {
+			return &memoryFile{}, 0, nil
+		},
+		remove: func(uint32) error {
+			return nil
+		},
+	}
+}
+
+func (f *blockFiles) file(n uint32) (file blockFile, size int64, err error) {
+	f.filesMu.Lock()
+	defer f.filesMu.Unlock()
+
+	if file, ok := f.files[n]; ok {
+		return file, -1, nil
+	}
+	if file, size, err = f.open(n); err != nil {
+		return nil, 0, fmt.Errorf("failed to open block file %s: %w", BlockFileName(n), err)
+	}
+	f.files[n] = file
+	return file, size, nil
+}
+
+// append writes the serialized block at the pending end and returns its location
+func (f *blockFiles) append(data []byte) (loc BlockLocation, err error) {
+	loc = BlockLocation{File: f.pending.File, Offset: f.pending.Offset, Length: uint32(len(data))}
+	if loc.Offset > 0 && uint64(loc.Offset)+blockRecordHeaderSize+uint64(loc.Length) > uint64(f.maxSize) {
+		loc.File, loc.Offset = loc.File+1, 0
+	}
+
+	file, _, err := f.file(loc.File)
+	if err != nil {
+		return loc, err
+	}
+
+	record := binary.BigEndian.AppendUint32(nil, BlockFileMagic)
+	record = binary.BigEndian.AppendUint32(record, loc.Length)
+	record = binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(data))
+	record = append(record, data...)
+	if _, err = file.WriteAt(record, int64(loc.Offset)); err != nil {
+		return loc, fmt.Errorf("failed to write block file %s: %w", BlockFileName(loc.File), err)
+	}
+	// the record must be on disk before the index pointing at it is committed
+	if err = file.Sync(); err != nil {
+		return loc, err
+	}
+
+	f.pending = loc.end()
+	return loc, nil
+}
+
+// read reads and verifies the record at the location
+func (f *blockFiles) read(loc BlockLocation) ([]byte, error) {
+	file, _, err := f.file(loc.File)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, blockRecordHeaderSize+int(loc.Length))
+	if _, err = file.ReadAt(record, int64(loc.Offset)); err != nil {
+		return nil, fmt.Errorf("%w: %s:%d: %v", ErrCorruptBlockFile, BlockFileName(loc.File), loc.Offset, err)
+	}
+	if err = checkRecord(record[:blockRecordHeaderSize], record[blockRecordHeaderSize:]); err != nil {
+		return nil, fmt.Errorf("%w: %s:%d: %v", ErrCorruptBlockFile, BlockFileName(loc.File), loc.Offset, err)
+	}
+	return record[blockRecordHeaderSize:], nil
+}
+
+// checkRecord verifies the header of a record against its block
+func checkRecord(header, data []byte) error {
+	if magic := binary.BigEndian.Uint32(header); magic != BlockFileMagic {
+		return fmt.Errorf("bad magic %x", magic)
+	}
+	if length := binary.BigEndian.Uint32(header[4:]); length != uint32(len(data)) {
+		return fmt.Errorf("length %d does not match %d", length, len(data))
+	}
+	if sum := binary.BigEndian.Uint32(header[8:]); sum != crc32.ChecksumIEEE(data) {
+		return fmt.Errorf("checksum mismatch")
+	}
+	return nil
+}
+
+// commit moves the committed end to the pending end once the index of the written records is committed
+func (f *blockFiles) commit() {
+	f.committed = f.pending
+}
+
+// rollback forgets the records written since the last commit, the next write overwrites them
+func (f *blockFiles) rollback() {
+	f.pending = f.committed
+}
+
+// load checks the tail of the block file the committed end is in
+//
+// Process
+//   - Walks the records of the file up to the committed end and verifies the checksum of the last one
+//   - Bytes after the committed end were written by a write that never got indexed (a crash or a failed
+//     transaction), they are reported and truncated
+//
+// Returns
+//   - err(error): ErrCorruptBlockFile when a committed record is truncated or corrupted
+func (f *blockFiles) load(end BlockLocation) error {
+	f.committed, f.pending = end, end
+
+	file, size, err := f.file(end.File)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && size < int64(end.Offset) {
+		return fmt.Errorf("%w: %s is truncated to %d bytes, the index expects %d",
+			ErrCorruptBlockFile, BlockFileName(end.File), size, end.Offset)
+	}
+
+	var last []byte
+	for offset := int64(0); offset < int64(end.Offset); {
+		header := make([]byte, blockRecordHeaderSize)
+		if _, err = file.ReadAt(header, offset); err != nil {
+			return fmt.Errorf("%w: %s:%d: %v", ErrCorruptBlockFile, BlockFileName(end.File), offset, err)
+		}
+		if magic := binary.BigEndian.Uint32(header); magic != BlockFileMagic {
+			return fmt.Errorf("%w: %s:%d: bad magic %x", ErrCorruptBlockFile, BlockFileName(end.File), offset, magic)
+		}
+		length := int64(binary.BigEndian.Uint32(header[4:]))
+		if offset+blockRecordHeaderSize+length > int64(end.Offset) {
+			return fmt.Errorf("%w: %s:%d: record runs past the committed end", ErrCorruptBlockFile, BlockFileName(end.File), offset)
+		}
+		last = header
+		if offset+blockRecordHeaderSize+length == int64(end.Offset) {
+			data := make([]byte, length)
+			if _, err = file.ReadAt(data, offset+blockRecordHeaderSize); err != nil {
+				return fmt.Errorf("%w: %s:%d: %v", ErrCorruptBlockFile, BlockFileName(end.File), offset, err)
+			}
+			if err = checkRecord(last, data); err != nil {
+				return fmt.Errorf("%w: %s:%d: %v", ErrCorruptBlockFile, BlockFileName(end.File), offset, err)
+			}
+		}
+		offset += blockRecordHeaderSize + length
+	}
+
+	if size > int64(end.Offset) {
+		f.logger.Warn("discarding uncommitted tail of block file",
+			slog.String("file", BlockFileName(end.File)), slog.Int64("offset", int64(end.Offset)), slog.Int64("size", size))
+		return file.Truncate(int64(end.Offset))
+	}
+	return nil
+}
+
+// prune deletes the block files below n
+//
+// NOTE
+//   - Files Prune marked as pruned before a crash are deleted again, so none of them is left behind
+func (f *blockFiles) prune(n uint32) error {
+	f.filesMu.Lock()
+	defer f.filesMu.Unlock()
+
+	for i := uint32(0); i < n; i++ {
+		if file, ok := f.files[i]; ok {
+			_ = file.Close()
+			delete(f.files, i)
+		}
+		if err := f.remove(i); err != nil {
+			return fmt.Errorf("failed to delete block file %s: %w", BlockFileName(i), err)
+		}
+	}
+	f.prunedBelow = n
+	return nil
+}
+
+// close closes every open block file
+func (f *blockFiles) close() (err error) {
+	f.filesMu.Lock()
+	defer f.filesMu.Unlock()
+	for n, file := range f.files {
+		err = errors.Join(err, file.Close())
+		delete(f.files, n)
+	}
+	return err
+}
+
+// memoryFile is a block file held in memory
+type memoryFile struct {
+	mu   sync.RWMutex
+	data []byte
+}
+
+func (m *memoryFile) ReadAt(p []byte, off int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *memoryFile) WriteAt(p []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if end := off + int64(len(p)); end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	return copy(m.data[off:], p), nil
+}
+
+func (m *memoryFile) Truncate(size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if size < int64(len(m.data)) {
+		m.data = m.data[:size]
+	}
+	return nil
+}
+
+func (m *memoryFile) Sync() error  { return nil }
+func (m *memoryFile) Close() error { return nil }
+
+// loadBlockFiles reads the committed end from the index and checks the block files against it
+func (s *Store) loadBlockFiles() error {
+	var end BlockLocation
+	var prunedBelow uint32
+	err := s.store.View(func(txn *badger.Txn) error {
+		val, err := getMeta(txn, BlockFileEndKey, 8)
+		if err != nil || val == nil {
+			return err
+		}
+		end.File, end.Offset = binary.BigEndian.Uint32(val), binary.BigEndian.Uint32(val[4:])
+
+		if val, err = getMeta(txn, BlockFilePrunedKey, 4); err != nil || val == nil {
+			return err
+		}
+		prunedBelow = binary.BigEndian.Uint32(val)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = s.files.load(end); err != nil {
+		return err
+	}
+	return s.files.prune(prunedBelow)
+}
+
+// getMeta reads a fixed size record, it returns nil when the key does not exist
+func getMeta(txn *badger.Txn, key []byte, size int) ([]byte, error) {
+	item, err := txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(val) != size {
+		return nil, fmt.Errorf("malformed %s %x", key, val)
+	}
+	return val, nil
+}
+
+// update runs fn in a badger transaction that may write blocks with putBlock
+//
+// NOTE
+//   - The block files only commit the records written by fn when the transaction commits
+func (s *Store) update(fn func(txn *badger.Txn) error) error {
+	s.files.mu.Lock()
+	defer s.files.mu.Unlock()
+
+	if err := s.store.Update(fn); err != nil {
+		s.files.rollback()
+		return err
+	}
+	s.files.commit()
+	return nil
+}
+
+// putBlockData appends the serialized block to the block files and indexes its location under the hash
+//
+// Process
+//   - Records the highest block of every file, Prune deletes a file once that block is deep enough
+//
+// NOTE
+//   - Must run inside update
+func (s *Store) putBlockData(txn *badger.Txn, hash string, height int32, data []byte) error {
+	loc, err := s.files.append(data)
+	if err != nil {
+		return err
+	}
+	if err = txn.Set(NamespaceBlocks.Key([]byte(hash)), loc.Serialize()); err != nil {
+		return err
+	}
+
+	maxHeight, err := getMeta(txn, blockFileKey(loc.File), 4)
+	if err != nil {
+		return err
+	}
+	if maxHeight == nil || int32(binary.BigEndian.Uint32(maxHeight)) < height {
+		if err = txn.Set(blockFileKey(loc.File), binary.BigEndian.AppendUint32(nil, uint32(height))); err != nil {
+			return err
+		}
+	}
+
+	end := binary.BigEndian.AppendUint32(nil, s.files.pending.File)
+	return txn.Set(BlockFileEndKey, binary.BigEndian.AppendUint32(end, s.files.pending.Offset))
+}
+
+// getBlockData reads the serialized block stored under the hash from the block files
+//
+// Returns
+//   - err(error): ErrNotFound when the block is unknown, ErrPruned when its block file was deleted by Prune
+func (s *Store) getBlockData(txn *badger.Txn, hash string) ([]byte, error) {
+	item, err := txn.Get(NamespaceBlocks.Key([]byte(hash)))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		// a store loaded from a UTXO snapshot has the headers but not the bodies below the prune height
+		if header, headerErr := getHeader(txn, hash); headerErr == nil {
+			if pruneHeight, _ := getPruneHeight(txn); header.GetHeight() < pruneHeight {
+				return nil, fmt.Errorf("block %s: %w", hash, ErrPruned)
+			}
+		}
+		return nil, fmt.Errorf("block %s: %w", hash, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var loc BlockLocation
+	if err = item.Value(loc.Deserialize); err != nil {
+		return nil, err
+	}
+	if loc.File < s.files.prunedBelow {
+		return nil, fmt.Errorf("block %s: %w", hash, ErrPruned)
+	}
+	data, err := s.files.read(loc)
+	if err != nil {
+		return nil, fmt.Errorf("block %s: %w", hash, err)
+	}
+	return data, nil
+}
+
+// migrateBlockFiles moves the blocks stored in badger into the block files
+//
+// NOTE
+//   - A value that is a BlockLocation was moved already, this makes the migration safe to run again after a crash
+//   - Blocks are moved in batches so a long chain never exceeds badger's transaction size
+func migrateBlockFiles(s *Store) error {
+	const batch = 100
+	for {
+		var keys, blocks [][]byte
+		err := s.store.View(func(txn *badger.Txn) error {
+			it := txn.NewIterator(badger.IteratorOptions{Prefix: NamespaceBlocks.Prefix(), PrefetchValues: true})
+			defer it.Close()
+			for it.Rewind(); it.Valid() && len(keys) < batch; it.Next() {
+				if it.Item().ValueSize() == blockLocationSize {
+					continue
+				}
+				val, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				keys = append(keys, it.Item().KeyCopy(nil))
+				blocks = append(blocks, val)
+			}
+			return nil
+		})
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+
+		err = s.update(func(txn *badger.Txn) error {
+			for i, key := range keys {
+				var b block.Block
+				if err := b.Deserialize(blocks[i]); err != nil {
+					return err
+				}
+				hash := string(bytes.TrimPrefix(key, NamespaceBlocks.Prefix()))
+				if err := s.putBlockData(txn, hash, b.GetHeight(), blocks[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
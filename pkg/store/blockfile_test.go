@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+// connectBlocks connects a genesis and n blocks on top of it
+func connectBlocks(t *testing.T, s Storage, n int) (blocks []block.Block) {
+	ctx := context.Background()
+	b := block.NewGenesisBlock(transactions.Transaction{Id: "cb", Outputs: []transactions.TxnOutput{{Value: 100}}}, testClock)
+	for i := 0; ; i++ {
+		assert.NoError(t, s.ConnectBlock(ctx, b, nil))
+		blocks = append(blocks, b)
+		if i == n {
+			return blocks
+		}
+		b = block.New(transactions.Transaction{Id: fmt.Sprintf("tx%d", i)}, b.GetHash(), b.GetHeight()+1, testClock)
+	}
+}
+
+func TestBlockFiles_Rotate(t *testing.T) {
+	path := t.TempDir()
+	s, err := Open(path)
+	assert.NoError(t, err)
+	s.(*Store).files.maxSize = 300
+
+	blocks := connectBlocks(t, s, 5)
+	assert.NoError(t, s.Close())
+
+	// every block is still readable from its file after a restart
+	s, err = Open(path)
+	assert.NoError(t, err)
+	defer s.Close()
+	for _, b := range blocks {
+		found, err := s.FindBlockByHash(context.Background(), b.GetHash())
+		assert.NoError(t, err)
+		assert.Equal(t, b.GetHash(), found.GetHash())
+	}
+	assert.FileExists(t, filepath.Join(path, BlockFileName(0)))
+	assert.FileExists(t, filepath.Join(path, BlockFileName(1)))
+}
+
+func TestBlockFiles_DiscardUncommittedTail(t *testing.T) {
+	path := t.TempDir()
+	s, err := Open(path)
+	assert.NoError(t, err)
+	connectBlocks(t, s, 1)
+	assert.NoError(t, s.Close())
+
+	// a crash in the middle of an append leaves a torn record after the committed end
+	name := filepath.Join(path, BlockFileName(0))
+	info, err := os.Stat(name)
+	assert.NoError(t, err)
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte{0xB1, 0x0C, 0xF1})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	s, err = Open(path)
+	assert.NoError(t, err)
+	defer s.Close()
+	truncated, err := os.Stat(name)
+	assert.NoError(t, err)
+	assert.Equal(t, info.Size(), truncated.Size())
+
+	// the next block is written where the torn record was
+	tip, err := s.FindLastBlock(context.Background())
+	assert.NoError(t, err)
+	next := block.New(transactions.Transaction{Id: "next"}, tip.GetHash(), tip.GetHeight()+1, testClock)
+	assert.NoError(t, s.ConnectBlock(context.Background(), next, nil))
+	_, err = s.FindBlockByHash(context.Background(), next.GetHash())
+	assert.NoError(t, err)
+}
+
+func TestBlockFiles_CorruptCommittedRecord(t *testing.T) {
+	tests := map[string]func(t *testing.T, name string){
+		"flipped byte": func(t *testing.T, name string) {
+			data, err := os.ReadFile(name)
+			assert.NoError(t, err)
+			data[len(data)-1] ^= 0xFF
+			assert.NoError(t, os.WriteFile(name, data, 0o644))
+		},
+		"truncated": func(t *testing.T, name string) {
+			info, err := os.Stat(name)
+			assert.NoError(t, err)
+			assert.NoError(t, os.Truncate(name, info.Size()-1))
+		},
+	}
+
+	for desc, corrupt := range tests {
+		t.Run(desc, func(t *testing.T) {
+			path := t.TempDir()
+			s, err := Open(path)
+			assert.NoError(t, err)
+			connectBlocks(t, s, 1)
+			assert.NoError(t, s.Close())
+
+			corrupt(t, filepath.Join(path, BlockFileName(0)))
+
+			_, err = Open(path)
+			assert.ErrorIs(t, err, ErrCorruptBlockFile)
+		})
+	}
+}
+
+func TestBlockFiles_ReadVerifiesChecksum(t *testing.T) {
+	s, err := OpenInMemory()
+	assert.NoError(t, err)
+	defer s.Close()
+	blocks := connectBlocks(t, s, 1)
+
+	// corrupt the first record, which the startup check does not read
+	file, _, err := s.(*Store).files.file(0)
+	assert.NoError(t, err)
+	_, err = file.WriteAt([]byte{0xFF}, blockRecordHeaderSize)
+	assert.NoError(t, err)
+
+	_, err = s.FindBlockByHash(context.Background(), blocks[0].GetHash())
+	assert.ErrorIs(t, err, ErrCorruptBlockFile)
+	_, err = s.FindBlockByHash(context.Background(), blocks[1].GetHash())
+	assert.NoError(t, err)
+}
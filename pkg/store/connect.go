@@ -0,0 +1,432 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/tdadadavid/block/pkg/block"
+)
+
+// TipKey stores the hash of the block at the tip of the main chain
+var TipKey = NamespaceMeta.Key([]byte("tip"))
+
+// ErrNotOnTip is returned when a block connected to the chain is not a child of its tip
+var ErrNotOnTip = errors.New("block does not extend the tip")
+
+// Indexes tells the store which optional indexes ConnectBlock and DisconnectBlock maintain
+type Indexes struct {
+	Tx   bool
+	Addr bool
+}
+
+// SetIndexes selects the optional indexes maintained while blocks are connected and disconnected
+func (s *Store) SetIndexes(indexes Indexes) {
+	s.indexes = indexes
+}
+
+// ConnectBlock makes the block the new tip of the chain
+//
+// Parameters:
+//   - b(Block): The block to connect, its parent must be the current tip
+//   - undo(UndoData): The outputs of the UTXO set the block spends
+//
+// Process:
+//   - Checks the parent of the block is the tip, a store without a tip only takes a genesis block
+//   - Writes the block, its header and its undo data
+//   - Moves the UTXO set, the height index and the enabled indexes forward over the block
+//   - Points the tip at the block's hash
+//
+// NOTE
+//   - Everything is written in one badger transaction, a crash leaves the store either before or after the block
+//
+// Returns
+//   - error: ErrNotOnTip or the error during the connect, nothing is written in that case
+func (s *Store) ConnectBlock(_ context.Context, b block.Block, undo UndoData) error {
+	return s.update(func(txn *badger.Txn) error {
+		if err := checkParent(txn, b); err != nil {
+			return err
+		}
+		return s.connectBlock(txn, b, undo)
+	})
+}
+
+// checkParent checks the block extends the tip, its parent is the tip and it sits one height above it
+func checkParent(txn *badger.Txn, b block.Block) error {
+	tip, err := getTipHash(txn)
+	if errors.Is(err, ErrNotFound) {
+		if b.GetPrevBlockHash() != "" || b.GetHeight() != 0 {
+			return fmt.Errorf("%w: block %s at height %d on a store without a chain", ErrNotOnTip, b.GetHash(), b.GetHeight())
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if b.GetPrevBlockHash() != tip {
+		return fmt.Errorf("%w: the parent of block %s is %q, the tip is %s", ErrNotOnTip, b.GetHash(), b.GetPrevBlockHash(), tip)
+	}
+	parent, err := getHeader(txn, tip)
+	if err != nil {
+		return err
+	}
+	if b.GetHeight() != parent.GetHeight()+1 {
+		return fmt.Errorf("%w: block %s has height %d, the tip is at height %d", ErrNotOnTip, b.GetHash(), b.GetHeight(), parent.GetHeight())
+	}
+	return nil
+}
+
+// DisconnectBlock removes the block at the tip of the chain, its parent becomes the tip
+//
+// Process:
+//   - Removes the block's outputs from the UTXO set and restores the outputs it spent from its undo data
+//   - Rolls the height index and the enabled indexes back, points the tip at the block's parent
+//
+// NOTE
+//   - The block itself stays in the store, only the main chain forgets it
+//   - Everything is written in one badger transaction, it runs inside update so the tip never moves during a Backup
+//
+// Returns
+//   - error: Returns the error during the disconnect, nothing is written in that case
+func (s *Store) DisconnectBlock(_ context.Context, b block.Block) error {
+	return s.update(func(txn *badger.Txn) error {
+		tip, err := getTipHash(txn)
+		if err != nil {
+			return err
+		}
+		if tip != b.GetHash() {
+			return fmt.Errorf("block %s is not the tip %s", b.GetHash(), tip)
+		}
+
+		var undo UndoData
+		item, err := txn.Get(undoKey(b.GetHash()))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return fmt.Errorf("undo data of block %s: %w", b.GetHash(), ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		if err = item.Value(undo.Deserialize); err != nil {
+			return err
+		}
+
+		if err = revertUTXOs(txn, b, undo); err != nil {
+			return err
+		}
+		if err = txn.Delete(undoKey(b.GetHash())); err != nil {
+			return err
+		}
+		if err = txn.Set(UTXOBestKey, []byte(b.GetPrevBlockHash())); err != nil {
+			return err
+		}
+		if err = deleteHeightsAbove(txn, b.GetHeight()-1); err != nil {
+			return err
+		}
+		if s.indexes.Tx {
+			if err = unindexTransactions(txn, b); err != nil {
+				return err
+			}
+		}
+		if s.indexes.Addr {
+			if err = unindexAddresses(txn, b); err != nil {
+				return err
+			}
+		}
+		return txn.Set(TipKey, []byte(b.GetPrevBlockHash()))
+	})
+}
+
+func (s *Store) connectBlock(txn *badger.Txn, b block.Block, undo UndoData) error {
+	if err := s.putBlock(txn, b); err != nil {
+		return err
+	}
+
+	undoData, err := undo.Serialize()
+	if err != nil {
+		return err
+	}
+	if err = txn.Set(undoKey(b.GetHash()), undoData); err != nil {
+		return err
+	}
+	if err = applyUTXOs(txn, b); err != nil {
+		return err
+	}
+	if err = txn.Set(UTXOBestKey, []byte(b.GetHash())); err != nil {
+		return err
+	}
+
+	if err = txn.Set(heightKey(b.GetHeight()), []byte(b.GetHash())); err != nil {
+		return err
+	}
+	if err = deleteHeightsAbove(txn, b.GetHeight()); err != nil {
+		return err
+	}
+
+	if s.indexes.Tx {
+		if err = indexTransactions(txn, b); err != nil {
+			return err
+		}
+	}
+	if s.indexes.Addr {
+		if err = indexAddresses(txn, b); err != nil {
+			return err
+		}
+	}
+	return txn.Set(TipKey, []byte(b.GetHash()))
+}
+
+// putBlock writes the block to the block files and its header to the headers namespace, it must run inside update
+func (s *Store) putBlock(txn *badger.Txn, b block.Block) error {
+	data, err := b.Serialize()
+	if err != nil {
+		return err
+	}
+	if err = s.putBlockData(txn, b.GetHash(), b.GetHeight(), data); err != nil {
+		return err
+	}
+
+	header := b.Header()
+	headerData, err := header.Serialize()
+	if err != nil {
+		return err
+	}
+	return txn.Set(NamespaceHeaders.Key([]byte(b.GetHash())), headerData)
+}
+
+func getTipHash(txn *badger.Txn) (string, error) {
+	item, err := txn.Get(TipKey)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	hash, err := item.ValueCopy(nil)
+	return string(hash), err
+}
+
+// recover repairs state left behind by a crash or by code that wrote the chain in several transactions
+//
+// Process
+//   - A tip pointing at a missing block falls back to the highest block of the height index that exists
+//   - A height index that does not lead to the tip is rewritten by walking from the tip back to the genesis,
+//     heights above the tip are dropped
+//   - A UTXO set that is not in sync with the tip is rebuilt from the main chain together with the undo data
+//
+// NOTE
+//   - The transaction and address indexes are checked by the chain, which knows whether they are enabled
+func (s *Store) recover() error {
+	tip, err := s.recoverTip()
+	if err != nil || tip == "" {
+		return err
+	}
+	if err = s.recoverHeights(tip); err != nil {
+		return err
+	}
+
+	var best string
+	err = s.store.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(UTXOBestKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		val, err := item.ValueCopy(nil)
+		best = string(val)
+		return err
+	})
+	if err != nil || best == tip {
+		return err
+	}
+
+	pruneHeight, err := s.FindPruneHeight(context.Background())
+	if err != nil {
+		return err
+	}
+	if pruneHeight == 0 {
+		s.logger.Info("UTXO set is out of sync with the tip, rebuilding", slog.String("tip", tip))
+		return s.rebuildUTXOs()
+	}
+
+	// the bodies below the prune height are gone, the set can only catch up from a block of the main chain above it
+	from, err := s.utxoCatchUpHeight(best, pruneHeight)
+	if err != nil {
+		return fmt.Errorf("UTXO set at %q is out of sync with the tip %s: %w", best, tip, err)
+	}
+	s.logger.Info("UTXO set is behind the tip, catching up", slog.String("tip", tip), slog.Int64("from", int64(from)))
+	return s.replayUTXOs(from)
+}
+
+// utxoCatchUpHeight returns the height the UTXO set of a pruned store is replayed from
+//
+// Returns
+//   - from(int32): The height after the block the set is in sync with
+//   - err(error): ErrPruned when the set is not in sync with a block of the main chain whose children still have
+//     their bodies, only a backup or a UTXO snapshot can restore the set then
+func (s *Store) utxoCatchUpHeight(best string, pruneHeight int32) (from int32, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		header, err := getHeader(txn, best)
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("the bodies below height %d are pruned: %w", pruneHeight, ErrPruned)
+		}
+		if err != nil {
+			return err
+		}
+		from = header.GetHeight() + 1
+		if hash, err := getHeightHash(txn, header.GetHeight()); err != nil || hash != best || from < pruneHeight {
+			return fmt.Errorf("the bodies below height %d are pruned: %w", pruneHeight, ErrPruned)
+		}
+		return nil
+	})
+	return from, err
+}
+
+// recoverTip returns the hash of the tip, repairing the pointer when its block is missing
+func (s *Store) recoverTip() (tip string, err error) {
+	err = s.store.Update(func(txn *badger.Txn) error {
+		tip, err = getTipHash(txn)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if tip != "" {
+			if _, err = s.getBlock(txn, tip); err == nil {
+				return nil
+			} else if !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+
+		// walk the height index down to the highest block that exists
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: NamespaceHeight.Prefix(), Reverse: true})
+		defer it.Close()
+
+		found := ""
+		for it.Seek(heightKey(-1)); it.Valid(); it.Next() {
+			hash, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if _, err = s.getBlock(txn, string(hash)); err == nil {
+				found = string(hash)
+				break
+			}
+		}
+		if found == "" {
+			if tip != "" {
+				return fmt.Errorf("tip block %s is missing and no block of the height index exists", tip)
+			}
+			return nil
+		}
+
+		s.logger.Warn("tip block is missing, falling back to the height index", slog.String("tip", tip), slog.String("recovered", found))
+		tip = found
+		return txn.Set(TipKey, []byte(tip))
+	})
+	return tip, err
+}
+
+// recoverHeights points the height index at the blocks between the genesis and the tip
+//
+// NOTE
+//   - The index is only walked when it is not already one entry per height up to the tip with the tip on top
+//   - The walk follows the headers, they are kept when the bodies are pruned
+func (s *Store) recoverHeights(tip string) error {
+	return s.store.Update(func(txn *badger.Txn) error {
+		b, err := getHeader(txn, tip)
+		if err != nil {
+			return err
+		}
+
+		hash, err := getHeightHash(txn, b.GetHeight())
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if hash == tip && countKeys(txn, NamespaceHeight) == int(b.GetHeight())+1 {
+			return nil
+		}
+
+		s.logger.Warn("height index is out of sync with the tip, repairing", slog.String("tip", tip))
+		if err = deleteHeightsAbove(txn, b.GetHeight()); err != nil {
+			return err
+		}
+		for {
+			if err = txn.Set(heightKey(b.GetHeight()), []byte(b.GetHash())); err != nil {
+				return err
+			}
+			if b.GetPrevBlockHash() == "" {
+				return nil
+			}
+			if b, err = getHeader(txn, b.GetPrevBlockHash()); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// countKeys counts the keys of the namespace without reading their values
+func countKeys(txn *badger.Txn, ns Namespace) (count int) {
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: ns.Prefix()})
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		count++
+	}
+	return count
+}
+
+// rebuildUTXOs drops the UTXO set and the undo data and replays the main chain from the genesis
+func (s *Store) rebuildUTXOs() error {
+	if err := s.store.DropPrefix(NamespaceUTXO.Prefix(), NamespaceUndo.Prefix()); err != nil {
+		return fmt.Errorf("failed to drop UTXO set: %w", err)
+	}
+	return s.replayUTXOs(0)
+}
+
+// replayUTXOs applies the blocks of the main chain from the height up to the tip to the UTXO set
+//
+// NOTE
+//   - Every block is replayed in its own transaction so a long chain never exceeds badger's transaction size
+func (s *Store) replayUTXOs(from int32) error {
+	for height := from; ; height++ {
+		done := false
+		err := s.store.Update(func(txn *badger.Txn) error {
+			hash, err := getHeightHash(txn, height)
+			if errors.Is(err, ErrNotFound) {
+				done = true
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			b, err := s.getBlock(txn, hash)
+			if err != nil {
+				return err
+			}
+
+			undo, err := undoDataFor(txn, b)
+			if err != nil {
+				return err
+			}
+			undoData, err := undo.Serialize()
+			if err != nil {
+				return err
+			}
+			if err = txn.Set(undoKey(hash), undoData); err != nil {
+				return err
+			}
+			if err = applyUTXOs(txn, b); err != nil {
+				return err
+			}
+			return txn.Set(UTXOBestKey, []byte(hash))
+		})
+		if err != nil {
+			return fmt.Errorf("failed to rebuild UTXO set at height %d: %w", height, err)
+		}
+		if done {
+			return nil
+		}
+	}
+}
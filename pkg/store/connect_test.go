@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+func TestStore_RecoverHalfWrittenState(t *testing.T) {
+	path := t.TempDir()
+	ctx := context.Background()
+
+	s, err := Open(path)
+	assert.NoError(t, err)
+	genesis := block.NewGenesisBlock(transactions.Transaction{Id: "cb", Outputs: []transactions.TxnOutput{{Value: 100}}}, testClock)
+	assert.NoError(t, s.ConnectBlock(ctx, genesis, nil))
+	next := block.New(transactions.Transaction{Id: "tx1", Outputs: []transactions.TxnOutput{{Value: 5}}}, genesis.GetHash(), 1, testClock)
+	assert.NoError(t, s.ConnectBlock(ctx, next, nil))
+
+	// simulate writes of older code that crashed half way: the tip points at a block that was never written,
+	// the height index is missing the tip and the UTXO set lags behind
+	db := s.(*Store).store
+	assert.NoError(t, db.Update(func(txn *badger.Txn) error {
+		assert.NoError(t, txn.Set(TipKey, []byte("missing")))
+		assert.NoError(t, txn.Delete(heightKey(0)))
+		assert.NoError(t, txn.Delete(utxoKey("tx1", 0)))
+		return txn.Set(UTXOBestKey, []byte(genesis.GetHash()))
+	}))
+	assert.NoError(t, db.Close())
+
+	s, err = Open(path)
+	assert.NoError(t, err)
+
+	tip, err := s.FindLastBlock(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, next.GetHash(), tip.GetHash())
+	b, err := s.FindBlockByHeight(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, genesis.GetHash(), b.GetHash())
+	_, err = s.FindUTXO(ctx, "tx1", 0)
+	assert.NoError(t, err)
+}
+
+func TestStore_RecoverPrunedUTXOs(t *testing.T) {
+	path := t.TempDir()
+	ctx := context.Background()
+
+	s, err := Open(path, WithMaxBlockFileSize(300))
+	assert.NoError(t, err)
+	blocks := connectBlocks(t, s, 6)
+	pruneHeight, err := s.Prune(ctx, 2)
+	assert.NoError(t, err)
+	assert.Greater(t, pruneHeight, int32(1))
+	tip := block.New(transactions.Transaction{Id: "tx7", Outputs: []transactions.TxnOutput{{Value: 5}}}, blocks[6].GetHash(), 7, testClock)
+	assert.NoError(t, s.ConnectBlock(ctx, tip, nil))
+
+	// the UTXO set lags one block behind the tip, the bodies to replay it from the genesis are gone
+	db := s.(*Store).store
+	assert.NoError(t, db.Update(func(txn *badger.Txn) error {
+		assert.NoError(t, txn.Delete(utxoKey("tx7", 0)))
+		return txn.Set(UTXOBestKey, []byte(blocks[6].GetHash()))
+	}))
+	assert.NoError(t, s.Close())
+
+	s, err = Open(path, WithMaxBlockFileSize(300))
+	assert.NoError(t, err)
+	_, err = s.FindUTXO(ctx, "tx7", 0)
+	assert.NoError(t, err)
+	_, err = s.FindUTXO(ctx, "cb", 0)
+	assert.NoError(t, err)
+
+	// a set behind the pruned bodies can't catch up
+	db = s.(*Store).store
+	assert.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Set(UTXOBestKey, []byte(blocks[0].GetHash()))
+	}))
+	assert.NoError(t, s.Close())
+	_, err = Open(path, WithMaxBlockFileSize(300))
+	assert.ErrorIs(t, err, ErrPruned)
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// GenesisKey stores the definition the genesis block of the chain was built from (see params.Genesis)
+var GenesisKey = NamespaceMeta.Key([]byte("genesis"))
+
+// SaveGenesis stores the definition the genesis block of the chain was built from
+//
+// NOTE
+//   - The store does not read the definition, the chain rebuilds the genesis coinbase from it to verify the block
+func (s *Store) SaveGenesis(_ context.Context, definition []byte) error {
+	return s.store.Update(func(txn *badger.Txn) error {
+		return txn.Set(GenesisKey, definition)
+	})
+}
+
+// FindGenesis returns the definition stored by SaveGenesis
+//
+// Returns
+//   - definition([]byte): The definition
+//   - err(error): ErrNotFound when the chain was created before its definition was stored or loaded from a snapshot
+func (s *Store) FindGenesis(_ context.Context) (definition []byte, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(GenesisKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		definition, err = item.ValueCopy(nil)
+		return err
+	})
+	return definition, err
+}
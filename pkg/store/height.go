@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/tdadadavid/block/pkg/block"
+)
+
+// heightKey builds the height index key for a height
+//
+// NOTE
+//   - The height is big endian encoded so the keys sort in height order and range scans walk the chain forwards
+func heightKey(height int32) []byte {
+	return NamespaceHeight.Key(binary.BigEndian.AppendUint32(nil, uint32(height)))
+}
+
+// FindBlockByHeight finds the block at the given height on the main chain
+//
+// Process:
+//   - Looks up the hash at the height in the height index
+//   - Retrieves the block with that hash
+//
+// Returns
+//   - b(block): Returns the block at the height
+//   - err(error): ErrNotFound when no block is at the height
+func (s *Store) FindBlockByHeight(_ context.Context, height int32) (b block.Block, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		hash, err := getHeightHash(txn, height)
+		if err != nil {
+			return err
+		}
+		b, err = s.getBlock(txn, hash)
+		return err
+	})
+	return b, err
+}
+
+// FindHashByHeight finds the hash of the block at the given height on the main chain
+//
+// NOTE
+//   - Only the height index is read, it also works for blocks whose body was pruned
+//
+// Returns
+//   - hash(string): The hash of the block at the height
+//   - err(error): ErrNotFound when no block is at the height
+func (s *Store) FindHashByHeight(_ context.Context, height int32) (hash string, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		hash, err = getHeightHash(txn, height)
+		return err
+	})
+	return hash, err
+}
+
+// FindBlockRange finds consecutive blocks on the main chain starting at the given height
+//
+// Parameters:
+//   - from(int32): The height of the first block
+//   - limit(int): The maximum number of blocks returned
+//
+// Returns
+//   - blocks([]block.Block): The blocks in height order, fewer than limit when the tip is reached
+//   - err(error): Returns the error during the search
+func (s *Store) FindBlockRange(_ context.Context, from int32, limit int) (blocks []block.Block, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: NamespaceHeight.Prefix()})
+		defer it.Close()
+
+		var hashes []string
+		for it.Seek(heightKey(from)); it.Valid() && len(hashes) < limit; it.Next() {
+			hash, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			hashes = append(hashes, string(hash))
+		}
+
+		for _, hash := range hashes {
+			b, err := s.getBlock(txn, hash)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, b)
+		}
+		return nil
+	})
+	return blocks, err
+}
+
+// getHeightHash reads the hash of the block at the height from the index
+func getHeightHash(txn *badger.Txn, height int32) (string, error) {
+	item, err := txn.Get(heightKey(height))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return "", fmt.Errorf("block at height %d: %w", height, ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	hash, err := item.ValueCopy(nil)
+	return string(hash), err
+}
+
+// getBlock reads and deserializes the block stored under the hash
+func (s *Store) getBlock(txn *badger.Txn, hash string) (b block.Block, err error) {
+	data, err := s.getBlockData(txn, hash)
+	if err != nil {
+		return b, err
+	}
+	err = b.Deserialize(data)
+	return b, err
+}
+
+// deleteHeightsAbove drops every height index entry above the given height
+func deleteHeightsAbove(txn *badger.Txn, height int32) error {
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: NamespaceHeight.Prefix()})
+
+	var keys [][]byte
+	for it.Seek(heightKey(height + 1)); it.Valid(); it.Next() {
+		keys = append(keys, it.Item().KeyCopy(nil))
+	}
+	it.Close()
+
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
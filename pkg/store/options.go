@@ -0,0 +1,14 @@
+package store
+
+// Option configures a store when it is opened
+type Option func(*Store)
+
+// WithMaxBlockFileSize sets the size after which a new block file is started
+//
+// NOTE
+//   - Prune deletes whole block files, smaller files let a pruned node free disk space sooner
+func WithMaxBlockFileSize(size uint32) Option {
+	return func(s *Store) {
+		s.files.maxSize = size
+	}
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// PruneHeightKey stores the height below which block bodies may have been deleted, it marks the node as pruned
+var PruneHeightKey = NamespaceMeta.Key([]byte("prune_height"))
+
+// Prune deletes the bodies of the blocks that are more than depth blocks below the tip
+//
+// Parameters:
+//   - depth(int32): The number of blocks at the tip whose bodies are always kept
+//
+// Process:
+//   - Refuses to prune while the UTXO set is not in sync with the tip, the set is what replaces the old bodies
+//   - Deletes whole block files, oldest first, as long as the highest block in the file is deep enough,
+//     the file being written to is never deleted
+//   - Drops the undo data of the pruned blocks, they are too deep to be disconnected anyway
+//   - Headers and the height index are kept
+//
+// NOTE
+//   - The marker is committed before the files are deleted, a crash in between leaves files that are deleted
+//     the next time the store is opened
+//
+// Returns
+//   - pruneHeight(int32): The height below which block bodies are gone, 0 when nothing was ever pruned
+//   - err(error): Returns the error during the pruning
+func (s *Store) Prune(_ context.Context, depth int32) (pruneHeight int32, err error) {
+	if depth < 1 {
+		return 0, fmt.Errorf("prune depth must be at least 1, got %d", depth)
+	}
+
+	s.files.mu.Lock()
+	defer s.files.mu.Unlock()
+
+	var pruneFiles uint32
+	err = s.store.Update(func(txn *badger.Txn) error {
+		if pruneHeight, err = getPruneHeight(txn); err != nil {
+			return err
+		}
+		prunedHeight := pruneHeight
+
+		tipHash, err := getTipHash(txn)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		best, err := txn.Get(UTXOBestKey)
+		if err != nil {
+			return fmt.Errorf("UTXO set is not persisted: %w", err)
+		}
+		if bestHash, err := best.ValueCopy(nil); err != nil || string(bestHash) != tipHash {
+			return fmt.Errorf("UTXO set is not in sync with the tip %s", tipHash)
+		}
+		tip, err := getHeader(txn, tipHash)
+		if err != nil {
+			return err
+		}
+
+		// bodies below keepFrom may go
+		keepFrom := tip.GetHeight() - depth + 1
+		for pruneFiles = s.files.prunedBelow; pruneFiles < s.files.committed.File; pruneFiles++ {
+			maxHeight, err := getMeta(txn, blockFileKey(pruneFiles), 4)
+			if err != nil {
+				return err
+			}
+			if maxHeight == nil {
+				// the file never got a committed block
+				continue
+			}
+			height := int32(binary.BigEndian.Uint32(maxHeight))
+			if height >= keepFrom {
+				break
+			}
+			pruneHeight = max(pruneHeight, height+1)
+		}
+		if pruneFiles == s.files.prunedBelow {
+			return nil
+		}
+
+		for n := s.files.prunedBelow; n < pruneFiles; n++ {
+			if err = txn.Delete(blockFileKey(n)); err != nil {
+				return err
+			}
+		}
+		for height := prunedHeight; height < pruneHeight; height++ {
+			hash, err := getHeightHash(txn, height)
+			if err != nil {
+				return err
+			}
+			if err = txn.Delete(undoKey(hash)); err != nil {
+				return err
+			}
+		}
+		if err = txn.Set(BlockFilePrunedKey, binary.BigEndian.AppendUint32(nil, pruneFiles)); err != nil {
+			return err
+		}
+		return txn.Set(PruneHeightKey, binary.BigEndian.AppendUint32(nil, uint32(pruneHeight)))
+	})
+	if err != nil || pruneFiles <= s.files.prunedBelow {
+		return pruneHeight, err
+	}
+
+	s.logger.Info("pruned block files", slog.Uint64("files", uint64(pruneFiles-s.files.prunedBelow)),
+		slog.Int64("prune_height", int64(pruneHeight)))
+	return pruneHeight, s.files.prune(pruneFiles)
+}
+
+// FindPruneHeight returns the height below which block bodies may have been deleted, 0 for a node that never pruned
+func (s *Store) FindPruneHeight(_ context.Context) (pruneHeight int32, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		pruneHeight, err = getPruneHeight(txn)
+		return err
+	})
+	return pruneHeight, err
+}
+
+func getPruneHeight(txn *badger.Txn) (int32, error) {
+	val, err := getMeta(txn, PruneHeightKey, 4)
+	if err != nil || val == nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(val)), nil
+}
@@ -0,0 +1,321 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/tdadadavid/block/pkg/block"
+)
+
+// Namespace is the key prefix shared by every record of one kind
+//
+// NOTE
+//   - No namespace is a prefix of another, so a prefix scan of one namespace never reads another's keys
+type Namespace string
+
+const (
+	// NamespaceMeta holds single records describing the store itself (schema version, tip, index markers)
+	NamespaceMeta Namespace = "meta/"
+	// NamespaceBlocks maps a block hash to the BlockLocation of the block in the block files
+	NamespaceBlocks Namespace = "block/"
+	// NamespaceBlockFiles maps the number of a block file to the height of the highest block in it
+	NamespaceBlockFiles Namespace = "blockfile/"
+	// NamespaceHeaders maps a block hash to the block without its transactions
+	NamespaceHeaders Namespace = "header/"
+	// NamespaceHeight maps a height on the main chain to the hash of the block at that height
+	NamespaceHeight Namespace = "height/"
+	// NamespaceUTXO holds the set of unspent transaction outputs
+	NamespaceUTXO Namespace = "utxo/"
+	// NamespaceUndo maps a block hash to the UndoData needed to disconnect the block
+	NamespaceUndo Namespace = "undo/"
+	// NamespaceWallets maps a wallet key to the serialized wallet
+	NamespaceWallets Namespace = "wallet/"
+	// NamespaceScripts maps a script address to the redeem script the wallets spend it with
+	NamespaceScripts Namespace = "script/"
+	// NamespaceTxIndex maps a transaction id to its TxLocation
+	NamespaceTxIndex Namespace = "txindex/"
+	// NamespaceAddrIndex maps (address key, txid, vout) to an AddressOutput
+	NamespaceAddrIndex Namespace = "addr/"
+	// NamespaceAddrOut maps (txid, vout) back to the address key of the output
+	NamespaceAddrOut Namespace = "addrout/"
+)
+
+// namespaces lists every namespace, it is used to tell namespaced keys from legacy ones
+var namespaces = []Namespace{
+	NamespaceMeta, NamespaceBlocks, NamespaceBlockFiles, NamespaceHeaders, NamespaceHeight, NamespaceUTXO, NamespaceUndo,
+	NamespaceWallets, NamespaceScripts, NamespaceTxIndex, NamespaceAddrIndex, NamespaceAddrOut,
+}
+
+// Prefix returns the prefix of every key in the namespace
+func (ns Namespace) Prefix() []byte {
+	return []byte(ns)
+}
+
+// Key builds a key in the namespace from its parts
+func (ns Namespace) Key(parts ...[]byte) []byte {
+	key := []byte(ns)
+	for _, part := range parts {
+		key = append(key, part...)
+	}
+	return key
+}
+
+var (
+	// SchemaVersionKey stores the version of the layout of the keys in the store
+	SchemaVersionKey = NamespaceMeta.Key([]byte("schema_version"))
+
+	// LastKey held a full copy of the tip block up to schema version 1, TipKey replaced it
+	LastKey = NamespaceMeta.Key([]byte("last"))
+)
+
+// SchemaVersion is the version of the key layout written by this code
+const SchemaVersion uint32 = 3
+
+// Migration upgrades the store from the previous schema version to Version
+type Migration struct {
+	Version     uint32
+	Description string
+	Migrate     func(s *Store) error
+}
+
+// migrations lists every migration in version order, a new schema version appends its migration here
+var migrations = []Migration{
+	{Version: 1, Description: "move the flat keyspace into namespaces", Migrate: migrateNamespaces},
+	{Version: 2, Description: "store the tip as a hash instead of a copy of the block", Migrate: migrateTip},
+	{Version: 3, Description: "move the blocks into CRC protected block files", Migrate: migrateBlockFiles},
+}
+
+// migrate brings the store up to SchemaVersion
+//
+// Process
+//   - A store without a schema version is either brand new (it is stamped with SchemaVersion)
+//     or was written before versioning (it is treated as version 0)
+//   - Every migration above the stored version runs in order, the version is stored after each one,
+//     so an interrupted upgrade resumes where it stopped
+//
+// Returns
+//   - err(error): Returns the error of the first failing migration, or when the store is newer than this code
+func (s *Store) migrate() (err error) {
+	version, found, err := s.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if !found {
+		empty, err := s.isEmpty()
+		if err != nil {
+			return err
+		}
+		if empty {
+			return s.setSchemaVersion(SchemaVersion)
+		}
+		version = 0
+	}
+
+	if version > SchemaVersion {
+		return fmt.Errorf("store schema version %d is newer than supported version %d", version, SchemaVersion)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		s.logger.Info("migrating store", slog.Uint64("version", uint64(m.Version)), slog.String("migration", m.Description))
+		if err = m.Migrate(s); err != nil {
+			return fmt.Errorf("migration to version %d failed: %w", m.Version, err)
+		}
+		if err = s.setSchemaVersion(m.Version); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *Store) schemaVersion() (version uint32, found bool, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(SchemaVersionKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		return item.Value(func(val []byte) error {
+			if len(val) != 4 {
+				return fmt.Errorf("malformed schema version %x", val)
+			}
+			version = binary.BigEndian.Uint32(val)
+			return nil
+		})
+	})
+	return version, found, err
+}
+
+func (s *Store) setSchemaVersion(version uint32) error {
+	return s.store.Update(func(txn *badger.Txn) error {
+		return txn.Set(SchemaVersionKey, binary.BigEndian.AppendUint32(nil, version))
+	})
+}
+
+func (s *Store) isEmpty() (empty bool, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{})
+		defer it.Close()
+		it.Rewind()
+		empty = !it.Valid()
+		return nil
+	})
+	return empty, err
+}
+
+// isNamespaced tells whether the key already lives in a namespace
+func isNamespaced(key []byte) bool {
+	for _, ns := range namespaces {
+		if bytes.HasPrefix(key, ns.Prefix()) {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateNamespaces moves the keys of the version 0 flat keyspace into their namespaces
+//
+// Process
+//   - "LAST", "height:", "tx:", "addr:", "addrout:" and the index markers are renamed into their namespaces
+//   - Any other key is a block hash, the block is moved and its header is written next to it
+//   - A key whose value is not a block can only come from the wallets store, it is moved to the wallets namespace
+//
+// NOTE
+//   - Keys already in a namespace are skipped, this makes the migration safe to run again after a crash
+func migrateNamespaces(s *Store) error {
+	db, logger := s.store, s.logger
+
+	renames := []struct {
+		legacy []byte
+		ns     Namespace
+	}{
+		{[]byte("height:"), NamespaceHeight},
+		{[]byte("tx:"), NamespaceTxIndex},
+		{[]byte("addrout:"), NamespaceAddrOut},
+		{[]byte("addr:"), NamespaceAddrIndex},
+	}
+	markers := map[string][]byte{
+		"LAST":           LastKey,
+		"txindex:best":   TxIndexBestKey,
+		"addrindex:best": AddrIndexBestKey,
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+	Keys:
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if isNamespaced(key) {
+				continue
+			}
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err = wb.Delete(key); err != nil {
+				return err
+			}
+
+			if newKey, ok := markers[string(key)]; ok {
+				if err = wb.Set(newKey, val); err != nil {
+					return err
+				}
+				continue
+			}
+
+			for _, r := range renames {
+				if bytes.HasPrefix(key, r.legacy) {
+					if err = wb.Set(r.ns.Key(key[len(r.legacy):]), val); err != nil {
+						return err
+					}
+					continue Keys
+				}
+			}
+
+			var b block.Block
+			if err = b.Deserialize(val); err != nil || b.GetHash() != string(key) {
+				logger.Warn("moving non-block key into the wallets namespace", slog.String("key", string(key)))
+				if err = wb.Set(NamespaceWallets.Key(key), val); err != nil {
+					return err
+				}
+				continue
+			}
+
+			header := b.Header()
+			headerData, err := header.Serialize()
+			if err != nil {
+				return err
+			}
+			if err = wb.Set(NamespaceBlocks.Key(key), val); err != nil {
+				return err
+			}
+			if err = wb.Set(NamespaceHeaders.Key(key), headerData); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return wb.Flush()
+}
+
+// migrateTip replaces the copy of the tip block under LastKey with the hash of the block under TipKey
+//
+// NOTE
+//   - The block copy is written into the blocks namespace first, it may be the only copy when a crash
+//     happened between storing the block and moving "LAST"
+//   - The UTXO set did not exist before this version, recover builds it when the store is opened
+func migrateTip(s *Store) error {
+	return s.store.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(LastKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		data, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		var tip block.Block
+		if err = tip.Deserialize(data); err != nil {
+			return err
+		}
+		header := tip.Header()
+		headerData, err := header.Serialize()
+		if err != nil {
+			return err
+		}
+
+		// blocks are still stored in badger at this version, migrateBlockFiles moves them
+		if err = txn.Set(NamespaceBlocks.Key([]byte(tip.GetHash())), data); err != nil {
+			return err
+		}
+		if err = txn.Set(NamespaceHeaders.Key([]byte(tip.GetHash())), headerData); err != nil {
+			return err
+		}
+		if err = txn.Set(TipKey, []byte(tip.GetHash())); err != nil {
+			return err
+		}
+		return txn.Delete(LastKey)
+	})
+}
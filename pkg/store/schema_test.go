@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+func TestStore_MigrateLegacyKeyspace(t *testing.T) {
+	path := t.TempDir()
+	genesis := block.NewGenesisBlock(transactions.Transaction{Id: "cb", Outputs: []transactions.TxnOutput{{Value: 100}}}, testClock)
+	genesisData, err := genesis.Serialize()
+	assert.NoError(t, err)
+
+	// write the flat keyspace used before namespaces existed
+	db, err := badger.Open(badger.DefaultOptions(path).WithLogger(nil))
+	assert.NoError(t, err)
+	assert.NoError(t, db.Update(func(txn *badger.Txn) error {
+		assert.NoError(t, txn.Set([]byte(genesis.GetHash()), genesisData))
+		assert.NoError(t, txn.Set([]byte("LAST"), genesisData))
+		assert.NoError(t, txn.Set(append([]byte("height:"), 0, 0, 0, 0), []byte(genesis.GetHash())))
+		return txn.Set([]byte("legacy-wallet"), []byte("wallet bytes"))
+	}))
+	assert.NoError(t, db.Close())
+
+	s, err := Open(path)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	version, found, err := s.(*Store).schemaVersion()
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, SchemaVersion, version)
+
+	last, err := s.FindLastBlock(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, genesis.GetHash(), last.GetHash())
+
+	byHeight, err := s.FindBlockByHeight(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, genesis.GetHash(), byHeight.GetHash())
+	assert.Equal(t, "cb", byHeight.GetTransaction()[0].GetId())
+
+	// the UTXO set did not exist before the tip became a hash, it is built on open
+	utxo, err := s.FindUTXO(ctx, "cb", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), utxo.Height)
+
+	header, err := s.FindHeaderByHash(ctx, genesis.GetHash())
+	assert.NoError(t, err)
+	assert.Empty(t, header.GetTransaction())
+
+	// the blocks moved out of badger into the block files
+	assert.FileExists(t, filepath.Join(path, BlockFileName(0)))
+
+	wallets, err := s.FindAllWallets(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("wallet bytes")}, wallets)
+}
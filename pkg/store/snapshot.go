@@ -0,0 +1,501 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/toolkit"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+const (
+	// UTXOSnapshotMagic starts every snapshot written by DumpUTXOs
+	UTXOSnapshotMagic uint32 = 0xB10C5E70
+
+	// UTXOSnapshotVersion is the version of the UTXO snapshot format
+	UTXOSnapshotVersion uint32 = 1
+
+	// snapshotBatch is the number of headers or outputs written to badger in one transaction while loading
+	snapshotBatch = 1000
+
+	// maxRecordSize bounds the length of a record read from a snapshot before allocating it, the base block is the
+	// largest record
+	maxRecordSize = 32 << 20
+)
+
+// SnapshotKey marks a store loaded from a UTXO snapshot whose history was not validated yet
+var SnapshotKey = NamespaceMeta.Key([]byte("snapshot"))
+
+// ErrBadSnapshot is returned when a UTXO snapshot is malformed or does not hash to the expected value
+var ErrBadSnapshot = errors.New("bad UTXO snapshot")
+
+// UTXOSnapshotHeader describes a UTXO snapshot
+type UTXOSnapshotHeader struct {
+	// BaseHash is the hash of the block the UTXO set is in sync with
+	BaseHash string `json:"base_hash"`
+
+	// Height is the height of the base block
+	Height int32 `json:"height"`
+
+	// Count is the number of outputs in the snapshot
+	Count uint64 `json:"count"`
+
+	// Hash is the content hash of the snapshot (see UTXOSetHash)
+	Hash string `json:"hash"`
+}
+
+// Serialize serializes the header
+func (h UTXOSnapshotHeader) Serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := toolkit.SerializeString(&buf, h.BaseHash); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, binary.BigEndian, h.Height); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, binary.BigEndian, h.Count); err != nil {
+		return nil, err
+	}
+	if err := toolkit.SerializeString(&buf, h.Hash); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Deserialize deserializes the header
+func (h *UTXOSnapshotHeader) Deserialize(data []byte) (err error) {
+	buf := bytes.NewReader(data)
+	if h.BaseHash, err = toolkit.DeserializeString(buf); err != nil {
+		return err
+	}
+	if err = binary.Read(buf, binary.BigEndian, &h.Height); err != nil {
+		return err
+	}
+	if err = binary.Read(buf, binary.BigEndian, &h.Count); err != nil {
+		return err
+	}
+	h.Hash, err = toolkit.DeserializeString(buf)
+	return err
+}
+
+// utxoHasher computes the content hash of a UTXO set, the outputs must be added in the order of their keys
+type utxoHasher struct {
+	hash hash.Hash
+}
+
+func newUTXOHasher(baseHash string, height int32) *utxoHasher {
+	h := &utxoHasher{hash: sha256.New()}
+	var buf bytes.Buffer
+	_ = toolkit.SerializeString(&buf, baseHash)
+	_ = binary.Write(&buf, binary.BigEndian, height)
+	h.hash.Write(buf.Bytes())
+	return h
+}
+
+func (h *utxoHasher) add(record []byte) {
+	h.hash.Write(record)
+}
+
+func (h *utxoHasher) sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
+
+// UTXOSetHash returns the content hash a snapshot of the outputs taken at the base block has
+//
+// NOTE
+//   - It does not depend on the order of utxos, the chain uses it to check a snapshot against a replayed history
+func UTXOSetHash(baseHash string, height int32, utxos []transactions.UTXO) (string, error) {
+	sorted := slices.Clone(utxos)
+	slices.SortFunc(sorted, func(a, b transactions.UTXO) int {
+		return bytes.Compare(utxoKey(a.TxnId, a.Vout), utxoKey(b.TxnId, b.Vout))
+	})
+
+	h := newUTXOHasher(baseHash, height)
+	for _, utxo := range sorted {
+		record, err := serializeUTXO(utxo)
+		if err != nil {
+			return "", err
+		}
+		h.add(record)
+	}
+	return h.sum(), nil
+}
+
+// serializeUTXO converts an output of the set into a snapshot record (txid, vout, height, value, script)
+func serializeUTXO(utxo transactions.UTXO) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := toolkit.SerializeString(&buf, utxo.TxnId); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, utxo.Vout); err != nil {
+		return nil, err
+	}
+	if err := writeUTXOValue(&buf, utxo); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func deserializeUTXO(data []byte) (utxo transactions.UTXO, err error) {
+	buf := bytes.NewReader(data)
+	if utxo.TxnId, err = toolkit.DeserializeString(buf); err != nil {
+		return utxo, err
+	}
+	if err = binary.Read(buf, binary.LittleEndian, &utxo.Vout); err != nil {
+		return utxo, err
+	}
+	err = readUTXOValue(buf, &utxo)
+	return utxo, err
+}
+
+// DumpUTXOs writes the UTXO set at the tip together with the header chain to w
+//
+// Process:
+//   - Every record is length prefixed, the first one is MAGIC + VERSION + UTXOSnapshotHeader without its hash
+//   - Writes the headers from the genesis up to the base, then the base block itself
+//   - Writes every output of the set in key order, then the content hash of the outputs
+//   - Ends with the SHA256 of everything written before it, it also covers the headers and the base block
+//
+// NOTE
+//   - Everything is read in a single badger transaction, the snapshot is consistent while blocks keep arriving
+//
+// Returns
+//   - header(UTXOSnapshotHeader): The header of the snapshot with its content hash
+//   - err(error): Returns the error during the dump
+func (s *Store) DumpUTXOs(ctx context.Context, out io.Writer) (header UTXOSnapshotHeader, err error) {
+	checksum := sha256.New()
+	w := io.MultiWriter(out, checksum)
+
+	err = s.store.View(func(txn *badger.Txn) error {
+		if header.BaseHash, err = getTipHash(txn); err != nil {
+			return fmt.Errorf("an empty store has no UTXO set: %w", err)
+		}
+		if best, err := getMeta(txn, UTXOBestKey, len(header.BaseHash)); err != nil || string(best) != header.BaseHash {
+			return fmt.Errorf("UTXO set is not in sync with the tip %s", header.BaseHash)
+		}
+		base, err := s.getBlock(txn, header.BaseHash)
+		if err != nil {
+			return err
+		}
+		header.Height = base.GetHeight()
+		header.Count = uint64(countKeys(txn, NamespaceUTXO))
+
+		headerData, err := header.Serialize()
+		if err != nil {
+			return err
+		}
+		prefix := binary.BigEndian.AppendUint32(nil, UTXOSnapshotMagic)
+		prefix = binary.BigEndian.AppendUint32(prefix, UTXOSnapshotVersion)
+		if err = writeRecord(w, append(prefix, headerData...)); err != nil {
+			return err
+		}
+
+		for height := int32(0); height < header.Height; height++ {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			hash, err := getHeightHash(txn, height)
+			if err != nil {
+				return err
+			}
+			b, err := getHeader(txn, hash)
+			if err != nil {
+				return err
+			}
+			data, err := b.Serialize()
+			if err != nil {
+				return err
+			}
+			if err = writeRecord(w, data); err != nil {
+				return err
+			}
+		}
+		data, err := base.Serialize()
+		if err != nil {
+			return err
+		}
+		if err = writeRecord(w, data); err != nil {
+			return err
+		}
+
+		hasher := newUTXOHasher(header.BaseHash, header.Height)
+		err = forEachUTXO(txn, func(utxo transactions.UTXO) error {
+			record, err := serializeUTXO(utxo)
+			if err != nil {
+				return err
+			}
+			hasher.add(record)
+			return writeRecord(w, record)
+		})
+		if err != nil {
+			return err
+		}
+		header.Hash = hasher.sum()
+		if err = writeRecord(w, []byte(header.Hash)); err != nil {
+			return err
+		}
+		_, err = out.Write(checksum.Sum(nil))
+		return err
+	})
+	return header, err
+}
+
+// LoadUTXOs initializes an empty store from a snapshot written by DumpUTXOs
+//
+// Parameters:
+//   - r(io.Reader): The snapshot
+//   - check(func): Called with the header and the computed content hash before the snapshot is committed,
+//     an error aborts the load
+//
+// Process:
+//   - Checks the headers link from the genesis to the base block and writes them with the height index
+//   - Writes the UTXO set in batches while hashing it, the hash must match the one at the end of the snapshot
+//     and the snapshot must match its checksum
+//   - Commits the base block as the tip, the bodies below it are reported as pruned until the history is
+//     validated, the snapshot is remembered under SnapshotKey until then
+//
+// NOTE
+//   - Everything written is dropped again when the load fails
+//
+// Returns
+//   - header(UTXOSnapshotHeader): The header of the snapshot
+//   - err(error): ErrBadSnapshot when the snapshot is malformed or its content hash is wrong
+func (s *Store) LoadUTXOs(ctx context.Context, r io.Reader, check func(header UTXOSnapshotHeader) error) (header UTXOSnapshotHeader, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		if tip, err := getTipHash(txn); !errors.Is(err, ErrNotFound) {
+			return errors.Join(err, fmt.Errorf("store already has a chain at %s", tip))
+		}
+		return nil
+	})
+	if err != nil {
+		return header, err
+	}
+
+	// a load that was interrupted before leaves headers and outputs behind
+	drop := func() error {
+		return s.store.DropPrefix(NamespaceHeaders.Prefix(), NamespaceHeight.Prefix(), NamespaceUTXO.Prefix())
+	}
+	if err = drop(); err != nil {
+		return header, err
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, drop())
+		}
+	}()
+
+	checksum := sha256.New()
+	in, r := r, io.TeeReader(r, checksum)
+
+	prefix, err := readRecord(r)
+	if err != nil {
+		return header, err
+	}
+	if len(prefix) < 8 || binary.BigEndian.Uint32(prefix) != UTXOSnapshotMagic {
+		return header, fmt.Errorf("%w: bad magic", ErrBadSnapshot)
+	}
+	if version := binary.BigEndian.Uint32(prefix[4:]); version != UTXOSnapshotVersion {
+		return header, fmt.Errorf("%w: unsupported version %d", ErrBadSnapshot, version)
+	}
+	if err = header.Deserialize(prefix[8:]); err != nil {
+		return header, fmt.Errorf("%w: malformed header: %v", ErrBadSnapshot, err)
+	}
+
+	base, err := s.loadHeaders(ctx, r, header)
+	if err != nil {
+		return header, err
+	}
+
+	hasher := newUTXOHasher(header.BaseHash, header.Height)
+	for loaded := uint64(0); loaded < header.Count; {
+		if err = ctx.Err(); err != nil {
+			return header, err
+		}
+		err = s.store.Update(func(txn *badger.Txn) error {
+			for end := min(loaded+snapshotBatch, header.Count); loaded < end; loaded++ {
+				record, err := readRecord(r)
+				if err != nil {
+					return err
+				}
+				utxo, err := deserializeUTXO(record)
+				if err != nil {
+					return fmt.Errorf("%w: malformed output: %v", ErrBadSnapshot, err)
+				}
+				hasher.add(record)
+				if err = setUTXO(txn, utxo); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return header, err
+		}
+	}
+
+	header.Hash = hasher.sum()
+	declared, err := readRecord(r)
+	if err != nil {
+		return header, err
+	}
+	if string(declared) != header.Hash {
+		return header, fmt.Errorf("%w: content hash %s does not match the outputs (%s)", ErrBadSnapshot, declared, header.Hash)
+	}
+	sum := make([]byte, sha256.Size)
+	if _, err = io.ReadFull(in, sum); err != nil {
+		return header, fmt.Errorf("%w: missing checksum: %v", ErrBadSnapshot, err)
+	}
+	if !bytes.Equal(sum, checksum.Sum(nil)) {
+		return header, fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+	}
+	if check != nil {
+		if err = check(header); err != nil {
+			return header, err
+		}
+	}
+
+	marker, err := header.Serialize()
+	if err != nil {
+		return header, err
+	}
+	err = s.update(func(txn *badger.Txn) error {
+		if err := s.putBlock(txn, base); err != nil {
+			return err
+		}
+		if err := txn.Set(UTXOBestKey, []byte(base.GetHash())); err != nil {
+			return err
+		}
+		if err := txn.Set(PruneHeightKey, binary.BigEndian.AppendUint32(nil, uint32(base.GetHeight()))); err != nil {
+			return err
+		}
+		if err := txn.Set(SnapshotKey, marker); err != nil {
+			return err
+		}
+		return txn.Set(TipKey, []byte(base.GetHash()))
+	})
+	return header, err
+}
+
+// loadHeaders writes the headers of the snapshot and the height index, it returns the base block
+func (s *Store) loadHeaders(ctx context.Context, r io.Reader, header UTXOSnapshotHeader) (base block.Block, err error) {
+	prev := ""
+	for height := int32(0); height <= header.Height; {
+		if err = ctx.Err(); err != nil {
+			return base, err
+		}
+		err = s.store.Update(func(txn *badger.Txn) error {
+			for batch := 0; height <= header.Height && batch < snapshotBatch; batch, height = batch+1, height+1 {
+				data, err := readRecord(r)
+				if err != nil {
+					return err
+				}
+				var b block.Block
+				if err = b.Deserialize(data); err != nil {
+					return fmt.Errorf("%w: malformed header at height %d: %v", ErrBadSnapshot, height, err)
+				}
+				if b.GetHeight() != height || b.GetPrevBlockHash() != prev {
+					return fmt.Errorf("%w: header %s does not link to height %d", ErrBadSnapshot, b.GetHash(), height)
+				}
+				prev = b.GetHash()
+
+				if height == header.Height {
+					// the base block is committed with the tip
+					if b.GetHash() != header.BaseHash {
+						return fmt.Errorf("%w: base block %s, the header expects %s", ErrBadSnapshot, b.GetHash(), header.BaseHash)
+					}
+					base = b
+				} else {
+					h := b.Header()
+					headerData, err := h.Serialize()
+					if err != nil {
+						return err
+					}
+					if err = txn.Set(NamespaceHeaders.Key([]byte(b.GetHash())), headerData); err != nil {
+						return err
+					}
+				}
+				if err = txn.Set(heightKey(height), []byte(b.GetHash())); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return base, err
+		}
+	}
+	return base, nil
+}
+
+// FindSnapshot returns the UTXO snapshot the store was loaded from while its history is not validated
+//
+// Returns
+//   - header(UTXOSnapshotHeader): The header of the snapshot
+//   - err(error): ErrNotFound when the store was not loaded from a snapshot or its history was validated
+func (s *Store) FindSnapshot(_ context.Context) (header UTXOSnapshotHeader, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(SnapshotKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(header.Deserialize)
+	})
+	return header, err
+}
+
+// CompleteSnapshot forgets the snapshot once its history was validated and the bodies below the base were stored
+//
+// NOTE
+//   - The store stays pruned when Prune deleted block files in the meantime
+func (s *Store) CompleteSnapshot(_ context.Context) error {
+	return s.store.Update(func(txn *badger.Txn) error {
+		pruned, err := getMeta(txn, BlockFilePrunedKey, 4)
+		if err != nil {
+			return err
+		}
+		if pruned == nil {
+			if err = txn.Delete(PruneHeightKey); err != nil {
+				return err
+			}
+		}
+		return txn.Delete(SnapshotKey)
+	})
+}
+
+// writeRecord writes the data prefixed with its length, the prefix is little endian like toolkit.SerializeString
+func writeRecord(w io.Writer, data []byte) error {
+	if _, err := w.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(data)))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func readRecord(r io.Reader) ([]byte, error) {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(r, length); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+	}
+	size := binary.LittleEndian.Uint32(length)
+	if size > maxRecordSize {
+		return nil, fmt.Errorf("%w: record of %d bytes exceeds the size of %d", ErrBadSnapshot, size, maxRecordSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+	}
+	return data, nil
+}
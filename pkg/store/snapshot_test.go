@@ -0,0 +1,146 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+func utxoSet(t *testing.T, s Storage) (utxos []transactions.UTXO) {
+	assert.NoError(t, s.ForEachUTXO(context.Background(), func(utxo transactions.UTXO) error {
+		utxos = append(utxos, utxo)
+		return nil
+	}))
+	return utxos
+}
+
+func TestStorage_DumpLoadUTXOs(t *testing.T) {
+	conformance(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		genesis, next, _ := testChain(t, s)
+
+		var snapshot bytes.Buffer
+		header, err := s.DumpUTXOs(ctx, &snapshot)
+		assert.NoError(t, err)
+		assert.Equal(t, next.GetHash(), header.BaseHash)
+		assert.Equal(t, int32(1), header.Height)
+		assert.Equal(t, uint64(2), header.Count)
+		hash, err := UTXOSetHash(next.GetHash(), 1, utxoSet(t, s))
+		assert.NoError(t, err)
+		assert.Equal(t, hash, header.Hash)
+
+		loaded, err := OpenInMemory()
+		assert.NoError(t, err)
+		defer loaded.Close()
+		var checked UTXOSnapshotHeader
+		got, err := loaded.LoadUTXOs(ctx, &snapshot, func(h UTXOSnapshotHeader) error {
+			checked = h
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, header, got)
+		assert.Equal(t, header, checked)
+
+		// the tip and the UTXO set are there, the history below the base is not
+		tip, err := loaded.FindLastBlock(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, next.GetHash(), tip.GetHash())
+		assert.ElementsMatch(t, utxoSet(t, s), utxoSet(t, loaded))
+		_, err = loaded.FindHeaderByHash(ctx, genesis.GetHash())
+		assert.NoError(t, err)
+		_, err = loaded.FindBlockByHeight(ctx, 0)
+		assert.ErrorIs(t, err, ErrPruned)
+		// the height index is complete, the chain id is known without the genesis body
+		hash, err = loaded.FindHashByHeight(ctx, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, genesis.GetHash(), hash)
+		pending, err := loaded.FindSnapshot(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, header, pending)
+
+		// once the history is stored the snapshot is complete
+		assert.NoError(t, loaded.CreateBlock(ctx, genesis.GetHash(), genesis))
+		assert.NoError(t, loaded.CompleteSnapshot(ctx))
+		_, err = loaded.FindBlockByHeight(ctx, 0)
+		assert.NoError(t, err)
+		_, err = loaded.FindSnapshot(ctx)
+		assert.ErrorIs(t, err, ErrNotFound)
+		pruneHeight, err := loaded.FindPruneHeight(ctx)
+		assert.NoError(t, err)
+		assert.Zero(t, pruneHeight)
+	})
+}
+
+func TestStore_LoadUTXOsRejectsBadSnapshots(t *testing.T) {
+	s, err := OpenInMemory()
+	assert.NoError(t, err)
+	defer s.Close()
+	testChain(t, s)
+
+	var snapshot bytes.Buffer
+	_, err = s.DumpUTXOs(context.Background(), &snapshot)
+	assert.NoError(t, err)
+
+	load := func(data []byte, check func(UTXOSnapshotHeader) error) error {
+		loaded, err := OpenInMemory()
+		assert.NoError(t, err)
+		defer loaded.Close()
+
+		_, err = loaded.LoadUTXOs(context.Background(), bytes.NewReader(data), check)
+		// nothing is left behind
+		assert.Empty(t, utxoSet(t, loaded))
+		_, tipErr := loaded.FindLastBlock(context.Background())
+		assert.ErrorIs(t, tipErr, ErrNotFound)
+		return err
+	}
+
+	// the outputs come last, a changed output no longer matches the content hash
+	tampered := bytes.Clone(snapshot.Bytes())
+	at := bytes.LastIndex(tampered, []byte("bob"))
+	copy(tampered[at:], "eve")
+	assert.ErrorIs(t, load(tampered, nil), ErrBadSnapshot)
+
+	// a changed base block no longer matches the checksum
+	tampered = bytes.Replace(snapshot.Bytes(), []byte("bob"), []byte("eve"), 1)
+	assert.ErrorIs(t, load(tampered, nil), ErrBadSnapshot)
+
+	assert.ErrorIs(t, load(snapshot.Bytes()[:snapshot.Len()-10], nil), ErrBadSnapshot)
+
+	// a record length too large to allocate
+	tampered = bytes.Clone(snapshot.Bytes())
+	binary.LittleEndian.PutUint32(tampered, 1<<31)
+	err = load(tampered, nil)
+	assert.ErrorIs(t, err, ErrBadSnapshot)
+	assert.ErrorContains(t, err, "record of")
+
+	wrongHash := errors.New("unexpected hash")
+	assert.ErrorIs(t, load(snapshot.Bytes(), func(UTXOSnapshotHeader) error { return wrongHash }), wrongHash)
+
+	// a store that already has a chain is never overwritten
+	_, err = s.LoadUTXOs(context.Background(), bytes.NewReader(snapshot.Bytes()), nil)
+	assert.Error(t, err)
+	_, err = s.FindBlockByHeight(context.Background(), 0)
+	assert.NoError(t, err)
+}
+
+func TestUTXOSetHash_OrderIndependent(t *testing.T) {
+	utxos := []transactions.UTXO{
+		{TxnId: "b", Vout: 0, TxnOutput: transactions.TxnOutput{Value: 1}},
+		{TxnId: "a", Vout: 1, TxnOutput: transactions.TxnOutput{Value: 2}},
+		{TxnId: "a", Vout: 0, TxnOutput: transactions.TxnOutput{Value: 3}},
+	}
+	first, err := UTXOSetHash("base", 1, utxos)
+	assert.NoError(t, err)
+	second, err := UTXOSetHash("base", 1, []transactions.UTXO{utxos[2], utxos[0], utxos[1]})
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	other, err := UTXOSetHash("base", 2, utxos)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, other)
+}
@@ -0,0 +1,327 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+// testClock stamps the blocks of the tests a minute apart
+var testClock = block.StepClock(time.Unix(1700000000, 0), time.Minute)
+
+// backends opens an empty store of every Storage implementation, the conformance tests run against each of them
+var backends = map[string]func(t *testing.T, opts ...Option) Storage{
+	"badger": func(t *testing.T, opts ...Option) Storage {
+		s, err := Open(t.TempDir(), opts...)
+		assert.NoError(t, err)
+		return s
+	},
+	"memory": func(t *testing.T, opts ...Option) Storage {
+		s, err := OpenInMemory(opts...)
+		assert.NoError(t, err)
+		return s
+	},
+}
+
+// conformance runs the test against every backend opened with the options
+func conformance(t *testing.T, test func(t *testing.T, s Storage), opts ...Option) {
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			s := open(t, opts...)
+			t.Cleanup(func() {
+				assert.NoError(t, s.Close())
+			})
+			test(t, s)
+		})
+	}
+}
+
+// testChain connects a genesis paying 100 to alice and a block where alice pays bob
+func testChain(t *testing.T, s Storage) (genesis, next block.Block, spent transactions.UTXO) {
+	ctx := context.Background()
+	genesis = block.NewGenesisBlock(transactions.Transaction{
+		Id:      "cb",
+		Inputs:  []transactions.TxnInput{{TxnId: "", Output: -1}},
+		Outputs: []transactions.TxnOutput{{Value: 100, ScriptPubKey: "alice"}},
+	}, testClock)
+	assert.NoError(t, s.ConnectBlock(ctx, genesis, nil))
+
+	spent, err := s.FindUTXO(ctx, "cb", 0)
+	assert.NoError(t, err)
+
+	next = block.New(transactions.Transaction{
+		Id:      "tx1",
+		Inputs:  []transactions.TxnInput{{TxnId: "cb", Output: 0, ScriptSignature: "alice"}},
+		Outputs: []transactions.TxnOutput{{Value: 60, ScriptPubKey: "bob"}, {Value: 40, ScriptPubKey: "alice"}},
+	}, genesis.GetHash(), 1, testClock)
+	assert.NoError(t, s.ConnectBlock(ctx, next, UndoData{spent}))
+	return genesis, next, spent
+}
+
+func TestStorage_EmptyStore(t *testing.T) {
+	conformance(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		_, err := s.FindLastBlock(ctx)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.FindBlockByHash(ctx, "missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.FindBlockByHeight(ctx, 0)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.FindUTXO(ctx, "missing", 0)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// a chain starts from a genesis block
+		b := block.New(transactions.Transaction{Id: "tx1"}, "parent", 1, testClock)
+		assert.ErrorIs(t, s.ConnectBlock(ctx, b, nil), ErrNotOnTip)
+		_, err = s.FindLastBlock(ctx)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestStorage_Blocks(t *testing.T) {
+	conformance(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		genesis, next, _ := testChain(t, s)
+
+		// a stored block is not part of the main chain
+		side := block.New(transactions.Transaction{Id: "side"}, genesis.GetHash(), 1, testClock)
+		assert.NoError(t, s.CreateBlock(ctx, side.GetHash(), side))
+		assert.Error(t, s.CreateBlock(ctx, "other", side))
+
+		tip, err := s.FindLastBlock(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, next.GetHash(), tip.GetHash())
+
+		found, err := s.FindBlockByHash(ctx, side.GetHash())
+		assert.NoError(t, err)
+		assert.Equal(t, "side", found.GetTransaction()[0].GetId())
+
+		header, err := s.FindHeaderByHash(ctx, next.GetHash())
+		assert.NoError(t, err)
+		assert.Equal(t, next.GetHash(), header.GetHash())
+		assert.Empty(t, header.GetTransaction())
+
+		byHeight, err := s.FindBlockByHeight(ctx, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, next.GetHash(), byHeight.GetHash())
+
+		blocks, err := s.FindBlockRange(ctx, 0, 10)
+		assert.NoError(t, err)
+		assert.Len(t, blocks, 2)
+		assert.Equal(t, genesis.GetHash(), blocks[0].GetHash())
+	})
+}
+
+func TestStorage_ConnectDisconnectBlock(t *testing.T) {
+	conformance(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		s.SetIndexes(Indexes{Tx: true, Addr: true})
+		genesis, next, spent := testChain(t, s)
+
+		// the block, the tip, the UTXO set and every index moved together
+		_, err := s.FindUTXO(ctx, "cb", 0)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.FindUTXO(ctx, "tx1", 1)
+		assert.NoError(t, err)
+		loc, err := s.FindTxLocation(ctx, "tx1")
+		assert.NoError(t, err)
+		assert.Equal(t, TxLocation{BlockHash: next.GetHash(), Position: 0}, loc)
+		best, err := s.FindAddrIndexBest(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, next.GetHash(), best)
+
+		var utxos []transactions.UTXO
+		assert.NoError(t, s.ForEachUTXO(ctx, func(utxo transactions.UTXO) error {
+			utxos = append(utxos, utxo)
+			return nil
+		}))
+		assert.Len(t, utxos, 2)
+
+		// the genesis is not the tip, it can't be disconnected
+		assert.Error(t, s.DisconnectBlock(ctx, genesis))
+
+		assert.NoError(t, s.DisconnectBlock(ctx, next))
+		tip, err := s.FindLastBlock(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, genesis.GetHash(), tip.GetHash())
+		restored, err := s.FindUTXO(ctx, "cb", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, spent, restored)
+		_, err = s.FindUTXO(ctx, "tx1", 0)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.FindTxLocation(ctx, "tx1")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.FindBlockByHeight(ctx, 1)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// the disconnected block is still stored
+		_, err = s.FindBlockByHash(ctx, next.GetHash())
+		assert.NoError(t, err)
+
+		// only a child of the tip is connected, nothing is written otherwise
+		orphan := block.New(transactions.Transaction{Id: "tx2", Outputs: []transactions.TxnOutput{{Value: 5}}}, next.GetHash(), 2, testClock)
+		assert.ErrorIs(t, s.ConnectBlock(ctx, orphan, nil), ErrNotOnTip)
+		skipped := block.New(transactions.Transaction{Id: "tx2", Outputs: []transactions.TxnOutput{{Value: 5}}}, genesis.GetHash(), 2, testClock)
+		assert.ErrorIs(t, s.ConnectBlock(ctx, skipped, nil), ErrNotOnTip)
+		assert.ErrorIs(t, s.ConnectBlock(ctx, genesis, nil), ErrNotOnTip)
+		tip, err = s.FindLastBlock(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, genesis.GetHash(), tip.GetHash())
+		_, err = s.FindUTXO(ctx, "tx2", 0)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.FindBlockByHash(ctx, orphan.GetHash())
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, s.ConnectBlock(ctx, next, UndoData{spent}))
+	})
+}
+
+func TestStorage_DataOutputs(t *testing.T) {
+	conformance(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		_, next, _ := testChain(t, s)
+
+		data, err := transactions.NewDataOutput([]byte("anchor"))
+		assert.NoError(t, err)
+		anchored := block.New(transactions.Transaction{
+			Id:      "tx2",
+			Inputs:  []transactions.TxnInput{{TxnId: "tx1", Output: 0, ScriptSignature: "bob"}},
+			Outputs: []transactions.TxnOutput{{Value: 60, ScriptPubKey: "bob"}, data},
+		}, next.GetHash(), 2, testClock)
+		spent, err := s.FindUTXO(ctx, "tx1", 0)
+		assert.NoError(t, err)
+		assert.NoError(t, s.ConnectBlock(ctx, anchored, UndoData{spent}))
+
+		// nothing can spend the data output, it never enters the UTXO set
+		_, err = s.FindUTXO(ctx, "tx2", 0)
+		assert.NoError(t, err)
+		_, err = s.FindUTXO(ctx, "tx2", 1)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		assert.NoError(t, s.DisconnectBlock(ctx, anchored))
+		_, err = s.FindUTXO(ctx, "tx1", 0)
+		assert.NoError(t, err)
+	})
+}
+
+func TestStorage_Indexes(t *testing.T) {
+	conformance(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		genesis, next, _ := testChain(t, s)
+
+		// nothing is indexed while the indexes are disabled
+		_, err := s.FindTxLocation(ctx, "tx1")
+		assert.ErrorIs(t, err, ErrNotFound)
+		best, err := s.FindTxIndexBest(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, best)
+
+		for _, b := range []block.Block{genesis, next} {
+			assert.NoError(t, s.IndexTransactions(ctx, b))
+			assert.NoError(t, s.IndexAddresses(ctx, b))
+		}
+
+		outputs, err := s.FindAddressOutputs(ctx, "alice")
+		assert.NoError(t, err)
+		assert.Len(t, outputs, 2)
+		for _, out := range outputs {
+			if out.TxnId == "cb" {
+				assert.Equal(t, "tx1", out.SpentBy)
+			} else {
+				assert.Empty(t, out.SpentBy)
+			}
+		}
+
+		assert.NoError(t, s.UnindexAddresses(ctx, next))
+		outputs, err = s.FindAddressOutputs(ctx, "alice")
+		assert.NoError(t, err)
+		assert.Len(t, outputs, 1)
+		assert.Empty(t, outputs[0].SpentBy)
+
+		assert.NoError(t, s.DropTxIndex(ctx))
+		assert.NoError(t, s.DropAddrIndex(ctx))
+		_, err = s.FindTxLocation(ctx, "cb")
+		assert.ErrorIs(t, err, ErrNotFound)
+		outputs, err = s.FindAddressOutputs(ctx, "alice")
+		assert.NoError(t, err)
+		assert.Empty(t, outputs)
+	})
+}
+
+func TestStorage_Wallets(t *testing.T) {
+	conformance(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		testChain(t, s)
+		assert.NoError(t, s.CreateWallet(ctx, "a", []byte("wallet a")))
+		assert.NoError(t, s.CreateWallet(ctx, "b", []byte("wallet b")))
+
+		// blocks never show up as wallets and every wallet is returned
+		wallets, err := s.FindAllWallets(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("wallet a"), []byte("wallet b")}, wallets)
+	})
+}
+
+func TestStorage_Scripts(t *testing.T) {
+	conformance(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		assert.NoError(t, s.CreateWallet(ctx, "a", []byte("wallet a")))
+		assert.NoError(t, s.CreateScript(ctx, "p2sh", []byte{0x51}))
+
+		scripts, err := s.FindAllScripts(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"p2sh": {0x51}}, scripts)
+		wallets, err := s.FindAllWallets(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, wallets, 1)
+	})
+}
+
+func TestStorage_Prune(t *testing.T) {
+	conformance(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		blocks := connectBlocks(t, s, 6)
+
+		pruneHeight, err := s.FindPruneHeight(ctx)
+		assert.NoError(t, err)
+		assert.Zero(t, pruneHeight)
+
+		// only whole files below the kept depth are deleted, the file being written to is always kept
+		pruneHeight, err = s.Prune(ctx, 3)
+		assert.NoError(t, err)
+		assert.Greater(t, pruneHeight, int32(0))
+		assert.LessOrEqual(t, pruneHeight, int32(4))
+
+		stored, err := s.FindPruneHeight(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, pruneHeight, stored)
+
+		for _, b := range blocks {
+			_, err = s.FindBlockByHash(ctx, b.GetHash())
+			if b.GetHeight() < pruneHeight {
+				assert.ErrorIs(t, err, ErrPruned)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// headers and the height index survive
+			_, err = s.FindHeaderByHash(ctx, b.GetHash())
+			assert.NoError(t, err)
+		}
+		_, err = s.FindBlockByHeight(ctx, 0)
+		assert.ErrorIs(t, err, ErrPruned)
+
+		// the UTXO set replaces the pruned bodies
+		_, err = s.FindUTXO(ctx, "cb", 0)
+		assert.NoError(t, err)
+
+		// pruning again without new blocks deletes nothing more
+		again, err := s.Prune(ctx, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, pruneHeight, again)
+	}, WithMaxBlockFileSize(300))
+}
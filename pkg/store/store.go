@@ -1,64 +1,193 @@
 package store
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 
 	"github.com/dgraph-io/badger/v4"
 	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/transactions"
 )
 
-// LastKey tracks the block at the "LAST" position
-var LastKey = []byte("LAST")
+// ErrNotFound is returned when the requested key does not exist in the storage
+var ErrNotFound = errors.New("not found")
+
+// ErrPruned is returned when the body of a block was deleted by Prune, its header is still stored
+var ErrPruned = errors.New("block pruned")
 
 type Storage interface {
 	CreateBlock(ctx context.Context, key string, b block.Block) error
+	ConnectBlock(ctx context.Context, b block.Block, undo UndoData) error
+	DisconnectBlock(ctx context.Context, b block.Block) error
+	SetIndexes(indexes Indexes)
 	FindBlockByHash(ctx context.Context, hash string) (block.Block, error)
 	FindLastBlock(ctx context.Context) (block.Block, error)
-	UpdateLastBlock(ctx context.Context, b block.Block) error
+	FindBlockByHeight(ctx context.Context, height int32) (block.Block, error)
+	FindHashByHeight(ctx context.Context, height int32) (string, error)
+	FindBlockRange(ctx context.Context, from int32, limit int) ([]block.Block, error)
+	FindUTXO(ctx context.Context, txnId string, vout int32) (transactions.UTXO, error)
+	ForEachUTXO(ctx context.Context, fn func(utxo transactions.UTXO) error) error
+	IndexTransactions(ctx context.Context, b block.Block) error
+	UnindexTransactions(ctx context.Context, b block.Block) error
+	FindTxLocation(ctx context.Context, id string) (TxLocation, error)
+	FindTxIndexBest(ctx context.Context) (string, error)
+	DropTxIndex(ctx context.Context) error
+	IndexAddresses(ctx context.Context, b block.Block) error
+	UnindexAddresses(ctx context.Context, b block.Block) error
+	FindAddressOutputs(ctx context.Context, address string) ([]AddressOutput, error)
+	FindAddrIndexBest(ctx context.Context) (string, error)
+	DropAddrIndex(ctx context.Context) error
+	FindHeaderByHash(ctx context.Context, hash string) (block.Block, error)
+	CreateWallet(ctx context.Context, key string, data []byte) error
 	FindAllWallets(ctx context.Context) ([][]byte, error)
+	CreateScript(ctx context.Context, address string, redeem []byte) error
+	FindAllScripts(ctx context.Context) (map[string][]byte, error)
+	Prune(ctx context.Context, depth int32) (int32, error)
+	FindPruneHeight(ctx context.Context) (int32, error)
+	Backup(ctx context.Context, w io.Writer, wallets Storage) (BackupHeader, error)
+	DumpUTXOs(ctx context.Context, w io.Writer) (UTXOSnapshotHeader, error)
+	LoadUTXOs(ctx context.Context, r io.Reader, check func(header UTXOSnapshotHeader) error) (UTXOSnapshotHeader, error)
+	FindSnapshot(ctx context.Context) (UTXOSnapshotHeader, error)
+	CompleteSnapshot(ctx context.Context) error
+	SaveGenesis(ctx context.Context, definition []byte) error
+	FindGenesis(ctx context.Context) ([]byte, error)
+	Close() error
 }
 
 type Store struct {
-	store  *badger.DB
-	logger *slog.Logger
+	store   *badger.DB
+	files   *blockFiles
+	indexes Indexes
+	logger  *slog.Logger
+}
+
+// Open opens or creates the store at the given path
+//
+// Process:
+//   - Opens the badger database at the path
+//   - Migrates the keys of an older store to the current SchemaVersion
+//   - Repairs the state a crash left behind (see recover)
+//
+// Returns
+//   - s(Storage): The opened store
+//   - err(error): Returns the error of opening the database, the migration or the recovery
+func Open(path string, opts ...Option) (s Storage, err error) {
+	// disable storage logs
+	return open(badger.DefaultOptions(path).WithLogger(nil), opts...)
 }
 
-func Open(path string) (s Storage, err error) {
-	// Set the in-memory store for the chain and disable storage logs
-	options := badger.DefaultOptions(path).WithLogger(nil)
+// OpenInMemory creates an empty store that lives in memory only
+//
+// NOTE
+//   - It is the same Store as the one Open returns, backed by badger's in-memory mode, so it behaves
+//     exactly like a store on disk and everything is lost once it is garbage collected
+//   - Every call returns an independent store, tests using it can run in parallel
+func OpenInMemory(opts ...Option) (s Storage, err error) {
+	return open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil), opts...)
+}
 
+func open(options badger.Options, opts ...Option) (s Storage, err error) {
 	store, err := badger.Open(options)
 	if err != nil {
-		panic(fmt.Errorf("failed to create chain %v", err))
+		return nil, fmt.Errorf("failed to open store: %w", err)
 	}
 
 	ss := Store{store: store, logger: slog.Default()}
+	if options.InMemory {
+		ss.files = newMemoryBlockFiles(ss.logger)
+	} else {
+		// the block files live next to badger's own files
+		ss.files = newDiskBlockFiles(options.Dir, ss.logger)
+	}
+	for _, opt := range opts {
+		opt(&ss)
+	}
+
+	if err = ss.loadBlockFiles(); err != nil {
+		_ = ss.Close()
+		return nil, fmt.Errorf("failed to load block files: %w", err)
+	}
+	if err = ss.migrate(); err != nil {
+		_ = ss.Close()
+		return nil, fmt.Errorf("failed to migrate store: %w", err)
+	}
+	if err = ss.recover(); err != nil {
+		_ = ss.Close()
+		return nil, fmt.Errorf("failed to recover store: %w", err)
+	}
 
 	return &ss, err
 }
 
-func (s *Store) FindAllWallets(ctx context.Context) (wa [][]byte, err error) {
+// Close closes the database and the block files, the store can't be used afterwards
+func (s *Store) Close() error {
+	return errors.Join(s.files.close(), s.store.Close())
+}
+
+// CreateWallet stores a serialized wallet in the wallets namespace
+//
+// Parameters:
+//   - key(string): The key of the wallet, usually its address
+//   - data([]byte): The serialized wallet
+func (s *Store) CreateWallet(_ context.Context, key string, data []byte) error {
+	return s.store.Update(func(txn *badger.Txn) error {
+		return txn.Set(NamespaceWallets.Key([]byte(key)), data)
+	})
+}
+
+// FindAllWallets returns every serialized wallet in the wallets namespace
+func (s *Store) FindAllWallets(_ context.Context) (wa [][]byte, err error) {
 	err = s.store.View(func(txn *badger.Txn) (err error) {
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchSize = 10
-		opts.Reverse = false
+		opts.Prefix = NamespaceWallets.Prefix()
 		it := txn.NewIterator(opts)
 		defer it.Close()
 
 		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			return item.Value(func(val []byte) (err error) {
-				wa = append(wa, val)
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
 				return err
-			})
+			}
+			wa = append(wa, val)
 		}
 		return err
 	})
 	return wa, err
 }
 
+// CreateScript stores the redeem script of a script address in the scripts namespace
+func (s *Store) CreateScript(_ context.Context, address string, redeem []byte) error {
+	return s.store.Update(func(txn *badger.Txn) error {
+		return txn.Set(NamespaceScripts.Key([]byte(address)), redeem)
+	})
+}
+
+// FindAllScripts returns every redeem script in the scripts namespace by script address
+func (s *Store) FindAllScripts(_ context.Context) (scripts map[string][]byte, err error) {
+	scripts = make(map[string][]byte)
+	err = s.store.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = NamespaceScripts.Prefix()
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			scripts[string(bytes.TrimPrefix(it.Item().Key(), NamespaceScripts.Prefix()))] = val
+		}
+		return nil
+	})
+	return scripts, err
+}
+
 // CreateBlock this creates new block on the chain
 //
 // Parameters:
@@ -67,23 +196,48 @@ func (s *Store) FindAllWallets(ctx context.Context) (wa [][]byte, err error) {
 //
 // Process:
 //   - Serializes the block
-//   - Inserts the key (block's hash) & serialized block in bytes into the storage
+//   - Appends the serialized block to the block files and inserts its location under the key (block's hash)
+//     into the blocks namespace
+//   - Inserts the block's header into the headers namespace
+//
+// NOTE
+//   - The block is only stored, ConnectBlock makes a block part of the main chain
 //
 // Returns
 //   - error: Returns the error during a block creation process
 func (s *Store) CreateBlock(_ context.Context, key string, b block.Block) error {
-	err := s.store.Update(func(txn *badger.Txn) (err error) {
-		data, err := b.Serialize()
-		if err != nil {
-			return err
-		}
-		err = txn.Set([]byte(key), data)
-		if err != nil {
-			return err
-		}
+	if key != b.GetHash() {
+		return fmt.Errorf("key %s is not the hash of block %s", key, b.GetHash())
+	}
+	return s.update(func(txn *badger.Txn) error {
+		return s.putBlock(txn, b)
+	})
+}
+
+// FindHeaderByHash finds the header of a block by the given hash
+//
+// Returns
+//   - b(block): Returns the block without its transactions
+//   - err(error): ErrNotFound when the header does not exist
+func (s *Store) FindHeaderByHash(_ context.Context, hash string) (b block.Block, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		b, err = getHeader(txn, hash)
 		return err
 	})
-	return err
+	return b, err
+}
+
+// getHeader reads and deserializes the header stored under the hash
+func getHeader(txn *badger.Txn, hash string) (b block.Block, err error) {
+	item, err := txn.Get(NamespaceHeaders.Key([]byte(hash)))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return b, fmt.Errorf("header %s: %w", hash, ErrNotFound)
+	}
+	if err != nil {
+		return b, err
+	}
+	err = item.Value(b.Deserialize)
+	return b, err
 }
 
 // FindBlockByHash finds a block by the given hash
@@ -99,62 +253,31 @@ func (s *Store) CreateBlock(_ context.Context, key string, b block.Block) error
 //   - b(block): Returns the block just found
 //   - err(error): Returns the error during search
 func (s *Store) FindBlockByHash(_ context.Context, hash string) (b block.Block, err error) {
-	b = block.Block{}
 	err = s.store.View(func(txn *badger.Txn) error {
-		lastBlock, err := txn.Get([]byte(hash))
-		if err != nil {
-			return err
-		}
-		// deserialize the bytes into a Block struct
-		return lastBlock.Value(func(val []byte) error {
-			return b.Deserialize(val)
-		})
+		b, err = s.getBlock(txn, hash)
+		return err
 	})
 
 	return b, err
 }
 
-// FindLastBlock finds a block by the given hash
+// FindLastBlock finds the block at the tip of the chain
 //
 // Process:
-//   - Retrieves the block in bytes if it exists, else returns error
-//   - Deserializes the bytes into a block
+//   - Reads the hash of the tip
+//   - Retrieves the block with that hash
 //
 // Returns
 //   - block: Returns the block found
-//   - error: Returns the error during search
-func (s *Store) FindLastBlock(_ context.Context) (block.Block, error) {
-	b := &block.Block{}
-	err := s.store.View(func(txn *badger.Txn) error {
-		lastBlock, err := txn.Get(LastKey)
-		if err != nil {
-			return err
-		}
-		// deserialize the bytes into a Block struct
-		return lastBlock.Value(func(val []byte) error {
-			return b.Deserialize(val)
-		})
-	})
-
-	return *b, err
-}
-
-// UpdateLastBlock This updates a special key on our chain called "LAST", this key stores the last block on the chain
-//
-// Process:
-//   - Serializes the block
-//   - Inserts the LastKey ("LAST") & serialized block in bytes into the storage
-//
-// Returns
-//   - error: Returns the error during an update process
-func (s *Store) UpdateLastBlock(_ context.Context, b block.Block) (err error) {
-	err = s.store.Update(func(txn *badger.Txn) error {
-		data, err := b.Serialize()
+//   - error: ErrNotFound when the chain has no block yet
+func (s *Store) FindLastBlock(_ context.Context) (b block.Block, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		hash, err := getTipHash(txn)
 		if err != nil {
 			return err
 		}
-		err = txn.Set(LastKey, data)
+		b, err = s.getBlock(txn, hash)
 		return err
 	})
-	return err
+	return b, err
 }
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/toolkit"
+)
+
+// TxIndexBestKey stores the hash of the last block the transaction index is in sync with
+var TxIndexBestKey = NamespaceMeta.Key([]byte("txindex_best"))
+
+// TxLocation is where a transaction lives on the chain
+type TxLocation struct {
+	// BlockHash is the hash of the block that contains the transaction
+	BlockHash string
+
+	// Position is the index of the transaction in the block's transactions
+	Position int32
+}
+
+// Serialize converts the location into bytes (block hash, then position)
+func (l *TxLocation) Serialize() (val []byte, err error) {
+	var buf bytes.Buffer
+	if err = toolkit.SerializeString(&buf, l.BlockHash); err != nil {
+		return val, err
+	}
+	if err = binary.Write(&buf, binary.LittleEndian, l.Position); err != nil {
+		return val, err
+	}
+	return buf.Bytes(), err
+}
+
+// Deserialize converts bytes written by Serialize back into the location
+func (l *TxLocation) Deserialize(data []byte) (err error) {
+	buf := bytes.NewReader(data)
+	if l.BlockHash, err = toolkit.DeserializeString(buf); err != nil {
+		return err
+	}
+	return binary.Read(buf, binary.LittleEndian, &l.Position)
+}
+
+func txKey(id string) []byte {
+	return NamespaceTxIndex.Key([]byte(id))
+}
+
+// IndexTransactions adds the transactions of a connected block to the transaction index
+//
+// Process:
+//   - Maps the id of every transaction in the block to the block's hash and the transaction's position
+//   - Moves the index's best block to the block
+//
+// NOTE
+//   - Transactions without an id can't be looked up, so they are skipped
+func (s *Store) IndexTransactions(_ context.Context, b block.Block) error {
+	return s.store.Update(func(txn *badger.Txn) error {
+		return indexTransactions(txn, b)
+	})
+}
+
+// UnindexTransactions removes the transactions of a disconnected block from the transaction index
+//
+// Process:
+//   - Deletes the entries pointing at the block
+//   - Moves the index's best block back to the block's parent
+func (s *Store) UnindexTransactions(_ context.Context, b block.Block) error {
+	return s.store.Update(func(txn *badger.Txn) error {
+		return unindexTransactions(txn, b)
+	})
+}
+
+func indexTransactions(txn *badger.Txn, b block.Block) error {
+	for pos, tx := range b.GetTransaction() {
+		if tx.GetId() == "" {
+			continue
+		}
+		loc := TxLocation{BlockHash: b.GetHash(), Position: int32(pos)}
+		data, err := loc.Serialize()
+		if err != nil {
+			return err
+		}
+		if err = txn.Set(txKey(tx.GetId()), data); err != nil {
+			return err
+		}
+	}
+	return txn.Set(TxIndexBestKey, []byte(b.GetHash()))
+}
+
+func unindexTransactions(txn *badger.Txn, b block.Block) error {
+	for _, tx := range b.GetTransaction() {
+		if tx.GetId() == "" {
+			continue
+		}
+		loc, err := getTxLocation(txn, tx.GetId())
+		if errors.Is(err, ErrNotFound) || (err == nil && loc.BlockHash != b.GetHash()) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = txn.Delete(txKey(tx.GetId())); err != nil {
+			return err
+		}
+	}
+	return txn.Set(TxIndexBestKey, []byte(b.GetPrevBlockHash()))
+}
+
+// FindTxLocation looks a transaction up in the transaction index
+//
+// Returns
+//   - loc(TxLocation): Where the transaction is on the chain
+//   - err(error): ErrNotFound when the transaction is not indexed
+func (s *Store) FindTxLocation(_ context.Context, id string) (loc TxLocation, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		loc, err = getTxLocation(txn, id)
+		return err
+	})
+	return loc, err
+}
+
+// FindTxIndexBest returns the hash of the last block the transaction index is in sync with
+//
+// Returns
+//   - hash(string): The hash of the block, empty when the index was never built
+//   - err(error): Returns the error during the search
+func (s *Store) FindTxIndexBest(_ context.Context) (hash string, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(TxIndexBestKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		val, err := item.ValueCopy(nil)
+		hash = string(val)
+		return err
+	})
+	return hash, err
+}
+
+// DropTxIndex deletes the whole transaction index
+func (s *Store) DropTxIndex(_ context.Context) error {
+	if err := s.store.DropPrefix(NamespaceTxIndex.Prefix()); err != nil {
+		return fmt.Errorf("failed to drop transaction index: %w", err)
+	}
+	return s.store.Update(func(txn *badger.Txn) error {
+		return txn.Delete(TxIndexBestKey)
+	})
+}
+
+func getTxLocation(txn *badger.Txn, id string) (loc TxLocation, err error) {
+	item, err := txn.Get(txKey(id))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return loc, fmt.Errorf("transaction %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return loc, err
+	}
+	err = item.Value(func(val []byte) error {
+		return loc.Deserialize(val)
+	})
+	return loc, err
+}
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/tdadadavid/block/pkg/block"
+	"github.com/tdadadavid/block/pkg/toolkit"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+// UTXOBestKey stores the hash of the last block the UTXO set is in sync with
+var UTXOBestKey = NamespaceMeta.Key([]byte("utxo_best"))
+
+// UndoData is what a block removed from the UTXO set, it is everything needed to disconnect the block again
+//
+// NOTE
+//   - Only outputs created by earlier blocks are listed, outputs created and spent inside the block never reach the set
+type UndoData []transactions.UTXO
+
+// Serialize converts the undo data into bytes (count, then txid, vout, height, value and script of every output)
+func (u UndoData) Serialize() (val []byte, err error) {
+	var buf bytes.Buffer
+	if err = binary.Write(&buf, binary.LittleEndian, int32(len(u))); err != nil {
+		return val, err
+	}
+	for _, utxo := range u {
+		if err = toolkit.SerializeString(&buf, utxo.TxnId); err != nil {
+			return val, err
+		}
+		if err = binary.Write(&buf, binary.LittleEndian, utxo.Vout); err != nil {
+			return val, err
+		}
+		if err = writeUTXOValue(&buf, utxo); err != nil {
+			return val, err
+		}
+	}
+	return buf.Bytes(), err
+}
+
+// Deserialize converts bytes written by Serialize back into the undo data
+func (u *UndoData) Deserialize(data []byte) (err error) {
+	buf := bytes.NewReader(data)
+	var count int32
+	if err = binary.Read(buf, binary.LittleEndian, &count); err != nil {
+		return err
+	}
+
+	*u = make(UndoData, 0, count)
+	for range count {
+		var utxo transactions.UTXO
+		if utxo.TxnId, err = toolkit.DeserializeString(buf); err != nil {
+			return err
+		}
+		if err = binary.Read(buf, binary.LittleEndian, &utxo.Vout); err != nil {
+			return err
+		}
+		if err = readUTXOValue(buf, &utxo); err != nil {
+			return err
+		}
+		*u = append(*u, utxo)
+	}
+	return err
+}
+
+// writeUTXOValue writes the part of a UTXO that is not in its key (height, value, script)
+func writeUTXOValue(buf *bytes.Buffer, utxo transactions.UTXO) error {
+	if err := binary.Write(buf, binary.LittleEndian, utxo.Height); err != nil {
+		return err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, utxo.Value); err != nil {
+		return err
+	}
+	return toolkit.SerializeString(buf, utxo.ScriptPubKey)
+}
+
+func readUTXOValue(buf *bytes.Reader, utxo *transactions.UTXO) (err error) {
+	if err = binary.Read(buf, binary.LittleEndian, &utxo.Height); err != nil {
+		return err
+	}
+	if err = binary.Read(buf, binary.LittleEndian, &utxo.Value); err != nil {
+		return err
+	}
+	utxo.ScriptPubKey, err = toolkit.DeserializeString(buf)
+	return err
+}
+
+func utxoKey(txnId string, vout int32) []byte {
+	return NamespaceUTXO.Key([]byte(txnId), binary.BigEndian.AppendUint32(nil, uint32(vout)))
+}
+
+func undoKey(hash string) []byte {
+	return NamespaceUndo.Key([]byte(hash))
+}
+
+// FindUTXO looks an unspent output up in the UTXO set
+//
+// Returns
+//   - utxo(UTXO): The unspent output
+//   - err(error): ErrNotFound when the output does not exist or was spent
+func (s *Store) FindUTXO(_ context.Context, txnId string, vout int32) (utxo transactions.UTXO, err error) {
+	err = s.store.View(func(txn *badger.Txn) error {
+		utxo, err = getUTXO(txn, txnId, vout)
+		return err
+	})
+	return utxo, err
+}
+
+// ForEachUTXO calls fn with every output of the UTXO set, it stops at the first error fn returns
+func (s *Store) ForEachUTXO(_ context.Context, fn func(utxo transactions.UTXO) error) error {
+	return s.store.View(func(txn *badger.Txn) error {
+		return forEachUTXO(txn, fn)
+	})
+}
+
+// forEachUTXO calls fn with every output of the UTXO set in key order
+func forEachUTXO(txn *badger.Txn, fn func(utxo transactions.UTXO) error) error {
+	prefix := NamespaceUTXO.Prefix()
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix, PrefetchValues: true, PrefetchSize: 100})
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		// the rest of the key is (txid, vout)
+		rest := it.Item().Key()[len(prefix):]
+		utxo := transactions.UTXO{
+			TxnId: string(rest[:len(rest)-4]),
+			Vout:  int32(binary.BigEndian.Uint32(rest[len(rest)-4:])),
+		}
+		err := it.Item().Value(func(val []byte) error {
+			return readUTXOValue(bytes.NewReader(val), &utxo)
+		})
+		if err != nil {
+			return err
+		}
+		if err = fn(utxo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getUTXO(txn *badger.Txn, txnId string, vout int32) (utxo transactions.UTXO, err error) {
+	item, err := txn.Get(utxoKey(txnId, vout))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return utxo, fmt.Errorf("output %s:%d: %w", txnId, vout, ErrNotFound)
+	}
+	if err != nil {
+		return utxo, err
+	}
+	utxo.TxnId, utxo.Vout = txnId, vout
+	err = item.Value(func(val []byte) error {
+		return readUTXOValue(bytes.NewReader(val), &utxo)
+	})
+	return utxo, err
+}
+
+func setUTXO(txn *badger.Txn, utxo transactions.UTXO) error {
+	var buf bytes.Buffer
+	if err := writeUTXOValue(&buf, utxo); err != nil {
+		return err
+	}
+	return txn.Set(utxoKey(utxo.TxnId, utxo.Vout), buf.Bytes())
+}
+
+// applyUTXOs moves the UTXO set forward over a block
+//
+// Process
+//   - Transactions are applied in block order, each one removes the outputs it spends and adds the outputs it creates,
+//     so an output created and spent inside the block never stays in the set
+//
+// NOTE
+//   - Transactions without an id can't be referenced by an input, their outputs are not added
+//   - Unspendable outputs, like the data outputs, are never added since nothing can spend them
+func applyUTXOs(txn *badger.Txn, b block.Block) error {
+	for _, tx := range b.GetTransaction() {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.GetInputs() {
+				if err := txn.Delete(utxoKey(in.TxnId, in.Output)); err != nil {
+					return err
+				}
+			}
+		}
+		if tx.GetId() == "" {
+			continue
+		}
+		for vout, out := range tx.GetOutputs() {
+			if out.IsUnspendable() {
+				continue
+			}
+			utxo := transactions.UTXO{TxnId: tx.GetId(), Vout: int32(vout), Height: b.GetHeight(), TxnOutput: out}
+			if err := setUTXO(txn, utxo); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// revertUTXOs moves the UTXO set back over a block, it removes the block's outputs and restores the undo data
+func revertUTXOs(txn *badger.Txn, b block.Block, undo UndoData) error {
+	for _, tx := range b.GetTransaction() {
+		for vout := range tx.GetOutputs() {
+			if err := txn.Delete(utxoKey(tx.GetId(), int32(vout))); err != nil {
+				return err
+			}
+		}
+	}
+	for _, utxo := range undo {
+		if err := setUTXO(txn, utxo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undoDataFor collects the outputs of the UTXO set a block is about to spend
+func undoDataFor(txn *badger.Txn, b block.Block) (undo UndoData, err error) {
+	created := make(map[string]bool)
+	for _, tx := range b.GetTransaction() {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.GetInputs() {
+				if created[in.TxnId] {
+					continue
+				}
+				utxo, err := getUTXO(txn, in.TxnId, in.Output)
+				if errors.Is(err, ErrNotFound) {
+					continue
+				}
+				if err != nil {
+					return undo, err
+				}
+				undo = append(undo, utxo)
+			}
+		}
+		created[tx.GetId()] = true
+	}
+	return undo, err
+}
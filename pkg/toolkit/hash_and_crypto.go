@@ -1,11 +1,14 @@
 package toolkit
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"fmt"
+	"math/big"
+
 	"github.com/mr-tron/base58"
 	"golang.org/x/crypto/ripemd160"
 )
@@ -53,6 +56,37 @@ func Base58Decode(data []byte) (v []byte, err error) {
 	return decoded, err
 }
 
+// Base58CheckDecode decodes data encoded as Base58(VERSION + PAYLOAD + CHECKSUM)
+//
+// Process
+//   - Base58 decodes the data
+//   - Recomputes the checksum over VERSION + PAYLOAD and compares it with the trailing checksum
+//
+// Parameters
+//   - data(string): The encoded data, eg. a wallet address
+//   - checkSumLength(int): The length of the trailing checksum
+//
+// Returns
+//   - version(byte): The leading version byte
+//   - payload(byte): The bytes between the version and the checksum
+//   - err(error): The error when the data is not valid Base58 or the checksum does not match
+func Base58CheckDecode(data string, checkSumLength int) (version byte, payload []byte, err error) {
+	decoded, err := Base58Decode([]byte(data))
+	if err != nil {
+		return version, payload, err
+	}
+	if len(decoded) < 1+checkSumLength {
+		return version, payload, fmt.Errorf("base58check data too short: %d bytes", len(decoded))
+	}
+
+	body, checkSum := decoded[:len(decoded)-checkSumLength], decoded[len(decoded)-checkSumLength:]
+	if !bytes.Equal(CheckSum(body, checkSumLength), checkSum) {
+		return version, payload, fmt.Errorf("base58check checksum mismatch")
+	}
+
+	return body[0], body[1:], err
+}
+
 // CheckSum calculates the checksum of the given data
 //
 // Process
@@ -106,8 +140,7 @@ func PublicKeyHash(data []byte) (hash []byte, err error) {
 //
 // NOTE
 //   - The private key is a 32-byte big-endian integer
-//   - The public key is a 65-byte big-endian integer
-//   - The public key is the concatenation of the private key's x-coordinate and y-coordinate
+//   - The public key is the concatenation of the 32-byte big-endian x-coordinate and y-coordinate of the key
 //
 // Returns
 //   - priKey(ecdsa.PrivateKey): The private key for the wallet
@@ -121,7 +154,40 @@ func NewKeyPair() (priKey *ecdsa.PrivateKey, pubKey []byte, err error) {
 	}
 
 	// a public key is the concatenation of the private key's x-coordinate and y-coordinate
-	pubKey = append(priKey.X.Bytes(), priKey.Y.Bytes()...)
+	pubKey = make([]byte, 64)
+	priKey.X.FillBytes(pubKey[:32])
+	priKey.Y.FillBytes(pubKey[32:])
 
 	return priKey, pubKey, err
 }
+
+// ParsePublicKey decodes a public key created by NewKeyPair
+//
+// NOTE
+//   - Keys created before the coordinates were padded to 32 bytes are shorter than 64 bytes, the split that puts the
+//     point on the curve is used for them
+//
+// Returns
+//   - pubKey(*ecdsa.PublicKey): The public key
+//   - err(error): The error when the data is no point of the curve
+func ParsePublicKey(data []byte) (pubKey *ecdsa.PublicKey, err error) {
+	curve := elliptic.P256()
+	splits := []int{len(data) / 2}
+	if len(data) < 64 {
+		splits = nil
+		for x := len(data) - 32; x <= 32; x++ {
+			splits = append(splits, x)
+		}
+	}
+
+	for _, x := range splits {
+		if x <= 0 || x >= len(data) {
+			continue
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(data[:x]), Y: new(big.Int).SetBytes(data[x:])}
+		if curve.IsOnCurve(key.X, key.Y) {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("public key of %d bytes is not on the curve", len(data))
+}
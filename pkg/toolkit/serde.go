@@ -3,6 +3,7 @@ package toolkit
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
 )
 
 // SerializeString a string (prefix length, then data)
@@ -23,7 +24,8 @@ func DeserializeString(buf *bytes.Reader) (val string, err error) {
 	}
 
 	strBytes := make([]byte, strLen)
-	if _, err := buf.Read(strBytes); err != nil {
+	// io.ReadFull also succeeds for an empty string at the end of the buffer, where buf.Read returns io.EOF
+	if _, err := io.ReadFull(buf, strBytes); err != nil {
 		return val, err
 	}
 	val = string(strBytes)
@@ -0,0 +1,65 @@
+package transactions
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tdadadavid/block/pkg/script"
+)
+
+// ErrDataTooLarge is returned when an unspendable output carries more than script.MaxDataSize bytes
+var ErrDataTooLarge = errors.New("data output too large")
+
+// NewDataOutput returns an output anchoring data on the chain
+//
+// NOTE
+//   - The output is locked by a script.NullData script, it is provably unspendable so it never enters the UTXO set
+//
+// Returns
+//   - `TxnOutput`: The output, it carries no value
+//   - `error`: ErrDataTooLarge when the data is larger than script.MaxDataSize
+func NewDataOutput(data []byte) (TxnOutput, error) {
+	s, err := script.NullData(data)
+	if err != nil {
+		return TxnOutput{}, fmt.Errorf("%w: %v", ErrDataTooLarge, err)
+	}
+	return TxnOutput{Value: 0, ScriptPubKey: s.Hex()}, nil
+}
+
+// IsUnspendable tells whether the output is locked by a script starting with OP_RETURN, nothing can spend it
+//
+// NOTE
+//   - Addresses are never valid hexadecimal scripts starting with OP_RETURN, so the network is not needed
+func (to *TxnOutput) IsUnspendable() bool {
+	s, err := script.ParseHex(to.ScriptPubKey)
+	return err == nil && s.IsUnspendable()
+}
+
+// Data returns the data an output created by NewDataOutput carries
+//
+// Returns
+//   - `[]byte`: The data
+//   - `bool`: false when the output is not a data output
+func (to *TxnOutput) Data() ([]byte, bool) {
+	s, err := script.ParseHex(to.ScriptPubKey)
+	if err != nil {
+		return nil, false
+	}
+	return s.NullData()
+}
+
+// CheckOutputs checks every unspendable output of the transaction is a data output within the size limit
+//
+// Returns
+//   - `error`: ErrDataTooLarge naming the first output that is not
+func (t *Transaction) CheckOutputs() error {
+	for vout, out := range t.Outputs {
+		if !out.IsUnspendable() {
+			continue
+		}
+		if _, ok := out.Data(); !ok {
+			return fmt.Errorf("%w: output %d is not OP_RETURN followed by at most %d bytes", ErrDataTooLarge, vout, script.MaxDataSize)
+		}
+	}
+	return nil
+}
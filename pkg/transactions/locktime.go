@@ -0,0 +1,66 @@
+package transactions
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFinal is returned when a transaction is checked for a block below its lock time
+	ErrNotFinal = errors.New("lock time not reached")
+
+	// ErrSequenceLock is returned when an input spends an output that is not buried deep enough for its sequence
+	ErrSequenceLock = errors.New("relative lock time not reached")
+)
+
+// CheckLockTime checks the transaction can be mined in a block
+//
+// Parameters
+//   - `height int32`: The height of the block
+//   - `timestamp int64`: The time of the block
+//
+// NOTE
+//   - A lock time below LockTimeThreshold is a height, the block must be at least that high
+//   - Any other lock time is a unix time, the block must be at least that late
+//
+// Returns
+//   - `error`: ErrNotFinal when the lock time is not reached
+func (t *Transaction) CheckLockTime(height int32, timestamp int64) error {
+	switch {
+	case t.LockTime <= 0:
+		return nil
+	case t.LockTime < LockTimeThreshold && int64(height) < t.LockTime:
+		return fmt.Errorf("%w: height %d of %d", ErrNotFinal, height, t.LockTime)
+	case t.LockTime >= LockTimeThreshold && timestamp < t.LockTime:
+		return fmt.Errorf("%w: time %d of %d", ErrNotFinal, timestamp, t.LockTime)
+	}
+	return nil
+}
+
+// CheckSequence checks the input can spend an output in a block
+//
+// Parameters
+//   - `spentHeight int32`: The height of the block the spent output was mined in
+//   - `height int32`: The height of the block spending it
+//
+// Returns
+//   - `error`: ErrSequenceLock when fewer than Sequence blocks were mined since the spent output's block
+func (in *TxnInput) CheckSequence(spentHeight, height int32) error {
+	if in.Sequence > 0 && height-spentHeight < in.Sequence {
+		return fmt.Errorf("%w: %s:%d is %d of %d blocks deep", ErrSequenceLock, in.TxnId, in.Output, height-spentHeight, in.Sequence)
+	}
+	return nil
+}
+
+// hasLocks tells whether the lock time or the sequence of an input is set
+func (t *Transaction) hasLocks() bool {
+	if t.LockTime != 0 {
+		return true
+	}
+	for _, in := range t.Inputs {
+		if in.Sequence != 0 {
+			return true
+		}
+	}
+	return false
+}
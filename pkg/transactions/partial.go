@@ -0,0 +1,293 @@
+package transactions
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/tdadadavid/block/pkg/script"
+	"github.com/tdadadavid/block/pkg/toolkit"
+)
+
+var (
+	// ErrBadSignature is returned when a signature added to a partial transaction is not valid
+	ErrBadSignature = errors.New("invalid signature")
+
+	// ErrIncomplete is returned when a partial transaction is finalized before every input has enough signatures
+	ErrIncomplete = errors.New("not enough signatures")
+)
+
+// PartialTransaction is a transaction whose inputs are signed by several signers, it travels between them as JSON
+//
+// NOTE
+//   - Every signer signs the same transaction, its inputs and outputs can't change once the first signature is added
+//   - The spent outputs are carried along so signers don't need the chain to know what they sign
+type PartialTransaction struct {
+	Txn    Transaction    `json:"txn"`
+	Inputs []PartialInput `json:"inputs"`
+}
+
+// PartialInput is what is known about an input of a PartialTransaction
+type PartialInput struct {
+	// Spent is the output the input spends
+	Spent TxnOutput `json:"spent"`
+
+	// RedeemScript is the hexadecimal script a PayToScriptHash output commits to, the signatures sign it
+	RedeemScript string `json:"redeem_script,omitempty"`
+
+	// Signatures are the hexadecimal signatures collected so far, by hexadecimal public key
+	Signatures map[string]string `json:"signatures,omitempty"`
+}
+
+// NewPartial starts collecting the signatures of a transaction
+//
+// Parameters
+//   - `txn Transaction`: The transaction, its ScriptSignatures are ignored, its lock times are signed
+//   - `spent []TxnOutput`: The output every input spends, in input order
+//
+// Returns
+//   - `*PartialTransaction`: The transaction without signatures
+//   - `error`: When there is not one spent output per input
+func NewPartial(txn Transaction, spent []TxnOutput) (*PartialTransaction, error) {
+	if len(spent) != len(txn.Inputs) {
+		return nil, fmt.Errorf("%d spent outputs for %d inputs", len(spent), len(txn.Inputs))
+	}
+
+	p := &PartialTransaction{Txn: Transaction{Inputs: make([]TxnInput, len(txn.Inputs)), Outputs: txn.Outputs, LockTime: txn.LockTime}}
+	for i, in := range txn.Inputs {
+		p.Txn.Inputs[i] = TxnInput{TxnId: in.TxnId, Output: in.Output, Sequence: in.Sequence}
+		p.Inputs = append(p.Inputs, PartialInput{Spent: spent[i]})
+	}
+	return p, nil
+}
+
+// SubScript returns the script the signatures of an input commit to: the locking script of the output it spends,
+// or the redeem script when the output is a PayToScriptHash output
+func (p *PartialTransaction) SubScript(index int, versions AddressVersions) (script.Script, error) {
+	if index < 0 || index >= len(p.Inputs) {
+		return nil, fmt.Errorf("input %d of %d is out of range", index, len(p.Inputs))
+	}
+	lockingScript, err := p.Inputs[index].Spent.LockingScript(versions)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := lockingScript.ScriptHash(); !ok {
+		return lockingScript, nil
+	}
+
+	if p.Inputs[index].RedeemScript == "" {
+		return nil, fmt.Errorf("%w: input %d spends a script address whose redeem script is unknown", ErrNonStandard, index)
+	}
+	return script.ParseHex(p.Inputs[index].RedeemScript)
+}
+
+// SetRedeemScript reveals the redeem script of an input spending a PayToScriptHash output
+//
+// Returns
+//   - `error`: When the input does not spend a PayToScriptHash output or the script does not hash to it
+func (p *PartialTransaction) SetRedeemScript(index int, redeem script.Script, versions AddressVersions) error {
+	if index < 0 || index >= len(p.Inputs) {
+		return fmt.Errorf("input %d of %d is out of range", index, len(p.Inputs))
+	}
+	lockingScript, err := p.Inputs[index].Spent.LockingScript(versions)
+	if err != nil {
+		return err
+	}
+	scriptHash, ok := lockingScript.ScriptHash()
+	if !ok {
+		return fmt.Errorf("input %d does not spend a script address", index)
+	}
+	hash, err := redeem.Hash160()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(hash, scriptHash) {
+		return fmt.Errorf("the redeem script does not hash to the script address input %d spends", index)
+	}
+	p.Inputs[index].RedeemScript = redeem.Hex()
+	return nil
+}
+
+// Signers returns the public keys that can sign an input, the key of a PayToPubKeyHash output is unknown
+// until it signs so none is returned for it
+func (p *PartialTransaction) Signers(index int, versions AddressVersions) (required int, pubKeys [][]byte, err error) {
+	subScript, err := p.SubScript(index, versions)
+	if err != nil {
+		return 0, nil, err
+	}
+	if m, keys, ok := subScript.MultiSigKeys(); ok {
+		return m, keys, nil
+	}
+	if _, ok := subScript.PubKeyHash(); ok {
+		return 1, nil, nil
+	}
+	return 0, nil, fmt.Errorf("%w: input %d is locked by %s", ErrNonStandard, index, subScript)
+}
+
+// AddSignature adds the signature of an input by a public key
+//
+// Returns
+//   - `error`: ErrBadSignature when the signature is not valid for the input or the key can't sign it
+func (p *PartialTransaction) AddSignature(index int, pubKey, sig []byte, versions AddressVersions) error {
+	subScript, err := p.SubScript(index, versions)
+	if err != nil {
+		return err
+	}
+	if !p.canSign(subScript, pubKey) {
+		return fmt.Errorf("%w: key %x can't sign input %d", ErrBadSignature, pubKey, index)
+	}
+	checker := inputChecker{txn: &p.Txn, index: index}
+	if !checker.CheckSig(sig, pubKey, subScript) {
+		return fmt.Errorf("%w: signature of input %d by %x", ErrBadSignature, index, pubKey)
+	}
+
+	in := &p.Inputs[index]
+	if in.Signatures == nil {
+		in.Signatures = make(map[string]string)
+	}
+	in.Signatures[hex.EncodeToString(pubKey)] = hex.EncodeToString(sig)
+	return nil
+}
+
+// canSign tells whether the key is one of the keys the script checks signatures of
+func (p *PartialTransaction) canSign(subScript script.Script, pubKey []byte) bool {
+	if _, keys, ok := subScript.MultiSigKeys(); ok {
+		for _, key := range keys {
+			if bytes.Equal(key, pubKey) {
+				return true
+			}
+		}
+		return false
+	}
+	pubKeyHash, ok := subScript.PubKeyHash()
+	if !ok {
+		return false
+	}
+	hash, err := toolkit.PublicKeyHash(pubKey)
+	return err == nil && bytes.Equal(hash, pubKeyHash)
+}
+
+// Combine merges the signatures another signer collected for the same transaction
+//
+// NOTE
+//   - Every signature is checked like AddSignature does, a bad signature is never merged
+//
+// Returns
+//   - `error`: When the other partial transaction is not for the same transaction or has a bad signature
+func (p *PartialTransaction) Combine(other PartialTransaction, versions AddressVersions) error {
+	mine, err := p.Txn.Serialize()
+	if err != nil {
+		return err
+	}
+	theirs, err := other.Txn.Serialize()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(mine, theirs) || len(other.Inputs) != len(p.Inputs) {
+		return fmt.Errorf("the partial transactions are not for the same transaction")
+	}
+
+	for index, in := range other.Inputs {
+		if in.Spent != p.Inputs[index].Spent {
+			return fmt.Errorf("input %d spends different outputs", index)
+		}
+		if in.RedeemScript != "" && p.Inputs[index].RedeemScript == "" {
+			redeem, err := script.ParseHex(in.RedeemScript)
+			if err == nil {
+				err = p.SetRedeemScript(index, redeem, versions)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		for pubKey, sig := range in.Signatures {
+			decodedKey, errKey := hex.DecodeString(pubKey)
+			decodedSig, errSig := hex.DecodeString(sig)
+			if err = errors.Join(errKey, errSig); err != nil {
+				return fmt.Errorf("%w: input %d: %v", ErrBadSignature, index, err)
+			}
+			if err = p.AddSignature(index, decodedKey, decodedSig, versions); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Finalize builds the signature script of every input and returns the signed transaction
+//
+// Process
+//   - A PayToPubKeyHash input is unlocked by its signature and public key
+//   - A MultiSig input is unlocked by the first m signatures in the order of the public keys
+//   - The redeem script of an input spending a PayToScriptHash output follows its signatures
+//   - Generates the id of the signed transaction
+//
+// Returns
+//   - `Transaction`: The signed transaction, the chain still checks it unlocks its outputs
+//   - `error`: ErrIncomplete when an input lacks signatures or ErrNonStandard for an input nobody can sign
+func (p *PartialTransaction) Finalize(versions AddressVersions) (txn Transaction, err error) {
+	txn = Transaction{Inputs: make([]TxnInput, len(p.Txn.Inputs)), Outputs: p.Txn.Outputs, LockTime: p.Txn.LockTime}
+	copy(txn.Inputs, p.Txn.Inputs)
+
+	for index, in := range p.Inputs {
+		required, pubKeys, err := p.Signers(index, versions)
+		if err != nil {
+			return txn, err
+		}
+
+		var sigScript script.Script
+		if pubKeys == nil {
+			// a PayToPubKeyHash input has a single signer
+			for pubKey, sig := range in.Signatures {
+				if sigScript, err = decodedScript(sig, pubKey); err != nil {
+					return txn, err
+				}
+			}
+		} else {
+			var sigs [][]byte
+			for _, pubKey := range pubKeys {
+				if sig, ok := in.Signatures[hex.EncodeToString(pubKey)]; ok && len(sigs) < required {
+					decoded, err := hex.DecodeString(sig)
+					if err != nil {
+						return txn, err
+					}
+					sigs = append(sigs, decoded)
+				}
+			}
+			if len(sigs) == required {
+				if sigScript, err = script.MultiSigScript(sigs); err != nil {
+					return txn, err
+				}
+			}
+		}
+		if sigScript == nil {
+			return txn, fmt.Errorf("%w: input %d has %d of %d", ErrIncomplete, index, len(in.Signatures), required)
+		}
+		if in.RedeemScript != "" {
+			redeem, err := script.ParseHex(in.RedeemScript)
+			if err == nil {
+				sigScript, err = script.RedeemScript(sigScript, redeem)
+			}
+			if err != nil {
+				return txn, err
+			}
+		}
+		txn.Inputs[index].ScriptSignature = sigScript.Hex()
+	}
+	txn.GenId()
+	return txn, nil
+}
+
+// decodedScript builds the PayToPubKeyHash signature script of a hexadecimal signature and public key
+func decodedScript(sig, pubKey string) (script.Script, error) {
+	decodedSig, err := hex.DecodeString(sig)
+	if err != nil {
+		return nil, err
+	}
+	decodedKey, err := hex.DecodeString(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return script.SignatureScript(decodedSig, decodedKey)
+}
@@ -0,0 +1,169 @@
+package transactions
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/tdadadavid/block/pkg/script"
+	"github.com/tdadadavid/block/pkg/toolkit"
+)
+
+// ErrNonStandard is returned when the ScriptPubKey of an output is neither an address nor a script
+var ErrNonStandard = errors.New("non-standard output")
+
+// LockTimeThreshold separates the lock times that are heights, below it, from the ones that are unix times
+const LockTimeThreshold = 500_000_000
+
+// AddressVersions are the version bytes of the addresses of a network
+type AddressVersions struct {
+	// PubKeyHash is the version of wallet addresses, outputs paying them are locked by a PayToPubKeyHash script
+	PubKeyHash byte
+
+	// ScriptHash is the version of script addresses, outputs paying them are locked by a PayToScriptHash script
+	ScriptHash byte
+}
+
+// ScriptContext is what the scripts of a transaction are checked against
+type ScriptContext struct {
+	// Versions are the address versions of the network
+	Versions AddressVersions
+
+	// Height is the height of the block the transaction is in, or will be in when it is still in the mempool
+	Height int32
+
+	// Time is the time of the block the transaction is in, or the current time when it is still in the mempool
+	Time int64
+}
+
+// LockingScript returns the script locking the output
+//
+// Process
+//   - A ScriptPubKey that is a wallet address of the network is locked by the standard PayToPubKeyHash script,
+//     so every output paid to a wallet address is a P2PKH output
+//   - A ScriptPubKey that is a script address of the network is locked by a PayToScriptHash script
+//   - Any other ScriptPubKey is the hexadecimal encoding of the script (see script.Script.Hex)
+//
+// Parameters
+//   - `versions AddressVersions`: The address versions of the network
+//
+// Returns
+//   - `script.Script`: The locking script
+//   - `error`: ErrNonStandard when the ScriptPubKey is neither, eg. the names used by old chains
+func (to *TxnOutput) LockingScript(versions AddressVersions) (script.Script, error) {
+	// addresses end with a 4 byte checksum, see wallet.CheckSumLength
+	if v, hash, err := toolkit.Base58CheckDecode(to.ScriptPubKey, 4); err == nil && len(hash) == 20 {
+		switch v {
+		case versions.PubKeyHash:
+			return script.PayToPubKeyHash(hash)
+		case versions.ScriptHash:
+			return script.PayToScriptHash(hash)
+		}
+	}
+	s, err := script.ParseHex(to.ScriptPubKey)
+	if err != nil || len(s) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrNonStandard, to.ScriptPubKey)
+	}
+	return s, nil
+}
+
+// SignatureHash returns the hash an input's signatures sign
+//
+// Process
+//   - Copies the transaction without its id and blanks the ScriptSignature of every input, a signature can't sign itself
+//   - The signed input carries the hexadecimal subScript, the script the signature is checked by
+//   - Hashes the serialized copy followed by script.SigHashAll twice with SHA256
+//
+// Parameters
+//   - `index int`: The input being signed
+//   - `subScript script.Script`: The script locking the output the input spends, the redeem script of a
+//     PayToScriptHash output
+//
+// Returns
+//   - `[]byte`: The hash to sign
+//   - `error`: An index out of range or an error while serializing
+func (t *Transaction) SignatureHash(index int, subScript script.Script) ([]byte, error) {
+	if index < 0 || index >= len(t.Inputs) {
+		return nil, fmt.Errorf("input %d of %d is out of range", index, len(t.Inputs))
+	}
+
+	txn := Transaction{Inputs: make([]TxnInput, len(t.Inputs)), Outputs: t.Outputs, LockTime: t.LockTime}
+	for i, in := range t.Inputs {
+		txn.Inputs[i] = TxnInput{TxnId: in.TxnId, Output: in.Output, Sequence: in.Sequence}
+	}
+	txn.Inputs[index].ScriptSignature = subScript.Hex()
+
+	data, err := txn.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	first := sha256.Sum256(append(data, script.SigHashAll))
+	second := sha256.Sum256(first[:])
+	return second[:], nil
+}
+
+// VerifyInput checks the input unlocks the output it spends
+//
+// Process
+//   - The ScriptSignature of the input is the hexadecimal encoding of its signature script
+//   - Executes the signature script followed by the locking script of the output (see script.Execute)
+//
+// Parameters
+//   - `index int`: The input to check
+//   - `spent TxnOutput`: The output the input spends
+//   - `ctx ScriptContext`: The network and block the transaction is checked for
+//
+// Returns
+//   - `error`: ErrNonStandard, or an error wrapping the script error when the input does not unlock the output
+func (t *Transaction) VerifyInput(index int, spent TxnOutput, ctx ScriptContext) error {
+	if index < 0 || index >= len(t.Inputs) {
+		return fmt.Errorf("input %d of %d is out of range", index, len(t.Inputs))
+	}
+	in := t.Inputs[index]
+
+	pubKeyScript, err := spent.LockingScript(ctx.Versions)
+	if err != nil {
+		return fmt.Errorf("input %d spends %s:%d: %w", index, in.TxnId, in.Output, err)
+	}
+	sigScript, err := script.ParseHex(in.ScriptSignature)
+	if err != nil {
+		return fmt.Errorf("input %d: %w", index, err)
+	}
+	checker := inputChecker{txn: t, index: index, ctx: ctx}
+	if err = script.Execute(sigScript, pubKeyScript, checker); err != nil {
+		return fmt.Errorf("input %d does not unlock %s:%d: %w", index, in.TxnId, in.Output, err)
+	}
+	return nil
+}
+
+// inputChecker checks the signatures and lock times of an input's scripts
+type inputChecker struct {
+	txn   *Transaction
+	index int
+	ctx   ScriptContext
+}
+
+// CheckSig verifies an ASN.1 ECDSA signature followed by script.SigHashAll
+func (c inputChecker) CheckSig(sig, pubKey []byte, subScript script.Script) bool {
+	if len(sig) < 2 || sig[len(sig)-1] != script.SigHashAll {
+		return false
+	}
+	key, err := toolkit.ParsePublicKey(pubKey)
+	if err != nil {
+		return false
+	}
+	hash, err := c.txn.SignatureHash(c.index, subScript)
+	if err != nil {
+		return false
+	}
+	return ecdsa.VerifyASN1(key, hash, sig[:len(sig)-1])
+}
+
+// CheckLockTime tells whether the block the transaction is checked for reached the lock time
+func (c inputChecker) CheckLockTime(lockTime int64) bool {
+	if lockTime < LockTimeThreshold {
+		return int64(c.ctx.Height) >= lockTime
+	}
+	return c.ctx.Time >= lockTime
+}
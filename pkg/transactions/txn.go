@@ -10,13 +10,15 @@ import (
 	"github.com/tdadadavid/block/pkg/toolkit"
 )
 
-var COINBASE_DATA = "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"
-
 // Transaction represents the shape of transactions that occurs on the chain
 type Transaction struct {
 	Id      string      `json:"id"`
 	Inputs  []TxnInput  `json:"vin"`
 	Outputs []TxnOutput `json:"vout"`
+
+	// LockTime is the height, below LockTimeThreshold, or the unix time, from it, before which the transaction
+	// can't be mined. 0 means the transaction is never locked (see CheckLockTime)
+	LockTime int64 `json:"locktime,omitempty"`
 }
 
 // GetId returns transaction id
@@ -39,12 +41,13 @@ func (t *Transaction) GetOutputs() []TxnOutput {
 // Parameters
 //   - `data string`: The input to the transaction
 //   - `to string`: The address where this should be //FIXME
+//   - `value int64`: The block subsidy paid to the address
 //
 // # Process
 //
 // Returns
 //   - `txn *Transaction`: The new coinbase transactions.
-func NewCoinbase(to, data string) (txn *Transaction) {
+func NewCoinbase(to, data string, value int64) (txn *Transaction) {
 	if data == "" {
 		data = fmt.Sprintf("Reward to %s", to)
 	}
@@ -60,7 +63,7 @@ func NewCoinbase(to, data string) (txn *Transaction) {
 		},
 		Outputs: []TxnOutput{
 			{
-				Value:        100,
+				Value:        value,
 				ScriptPubKey: to,
 			},
 		},
@@ -69,6 +72,21 @@ func NewCoinbase(to, data string) (txn *Transaction) {
 	return txn
 }
 
+// NewAllocation creates a coinbase that pays every output, genesis blocks use it to fund many addresses at once
+//
+// Parameters
+//   - `data string`: The input to the transaction
+//   - `outputs []TxnOutput`: The amounts and the addresses they are paid to
+//
+// Returns
+//   - `txn *Transaction`: The new coinbase transaction, without an id
+func NewAllocation(data string, outputs []TxnOutput) (txn *Transaction) {
+	return &Transaction{
+		Inputs:  []TxnInput{{TxnId: "", Output: -1, ScriptSignature: data}},
+		Outputs: outputs,
+	}
+}
+
 // GenId generates id for a transaction
 //
 // Process
@@ -76,32 +94,44 @@ func NewCoinbase(to, data string) (txn *Transaction) {
 //   - Hash it then convert it to hexadecimal string
 //   - Store hexcode in transaction id
 func (t *Transaction) GenId() {
-	bytez, err := t.Serialize()
+	id, err := t.Hash()
 	if err != nil {
 		fmt.Println("err serializing transactions: " + err.Error())
 		return
 	}
+	t.Id = id
+}
+
+// Hash returns the id the transaction must have, the hexadecimal SHA256 of the transaction serialized without its id
+func (t *Transaction) Hash() (string, error) {
+	unsigned := *t
+	unsigned.Id = ""
+	bytez, err := unsigned.Serialize()
+	if err != nil {
+		return "", err
+	}
 	hash := sha256.Sum256(bytez)
-	hex := hex.EncodeToString(hash[:])
-	t.Id = hex
+	return hex.EncodeToString(hash[:]), nil
 }
 
 // IsCoinbase checks if the transaction is the first transaction
 //
 // Process
-//   - Check if outputs is equal to 1,the first input transaction ID is an empty string
-//     the first input output is -1
+//   - Check it has outputs, a single input whose transaction ID is an empty string
+//     and whose output is -1
 //
 // Returns
 //   - bool: True or false informing the caller whether it is coinbase transaction
 func (t *Transaction) IsCoinbase() bool {
-	return len(t.Outputs) == 1 && t.Inputs[0].TxnId == "" && t.Inputs[0].Output == -1
+	return len(t.Outputs) > 0 && len(t.Inputs) == 1 && t.Inputs[0].TxnId == "" && t.Inputs[0].Output == -1
 }
 
 // Serialize converts a Transaction into a byte slice
 //
 // Process
 //   - First serializes the transaction ID, then iterates through the `Outputs` & `Input` and serializes them
+//   - The lock time and the sequence of every input follow the outputs, only when one of them is set so the
+//     transactions written before they existed keep their bytes and their ids
 //
 // Returns
 //   - `val []byte`: The byte value of the current transaction
@@ -155,6 +185,18 @@ func (t *Transaction) Serialize() (val []byte, err error) {
 		}
 	}
 
+	// Write the lock times
+	if t.hasLocks() {
+		if err := binary.Write(buf, binary.LittleEndian, t.LockTime); err != nil {
+			return val, err
+		}
+		for _, input := range t.Inputs {
+			if err := binary.Write(buf, binary.LittleEndian, input.Sequence); err != nil {
+				return val, err
+			}
+		}
+	}
+
 	val = buf.Bytes()
 	return val, err
 }
@@ -202,7 +244,7 @@ func (t *Transaction) Deserialize(data []byte) (err error) {
 			return err
 		}
 
-		t.Inputs[i] = TxnInput{txnId, output, scriptSig}
+		t.Inputs[i] = TxnInput{TxnId: txnId, Output: output, ScriptSignature: scriptSig}
 	}
 
 	// Deserialize Outputs
@@ -217,12 +259,26 @@ func (t *Transaction) Deserialize(data []byte) (err error) {
 			return err
 		}
 
-		var value int32
+		// Value is written as an int64, reading it back as anything smaller corrupts every following output
+		var value int64
 		if err := binary.Read(buf, binary.LittleEndian, &value); err != nil {
 			return err
 		}
 
-		t.Outputs[i] = TxnOutput{int64(value), scriptPubKey}
+		t.Outputs[i] = TxnOutput{value, scriptPubKey}
+	}
+
+	// Deserialize the lock times, they are only written when one of them is set
+	if buf.Len() == 0 {
+		return err
+	}
+	if err = binary.Read(buf, binary.LittleEndian, &t.LockTime); err != nil {
+		return err
+	}
+	for i := range t.Inputs {
+		if err = binary.Read(buf, binary.LittleEndian, &t.Inputs[i].Sequence); err != nil {
+			return err
+		}
 	}
 
 	return err
@@ -6,6 +6,10 @@ type TxnInput struct {
 	TxnId           string `json:"id"`
 	Output          int32  `json:"out"`
 	ScriptSignature string `json:"signature"`
+
+	// Sequence is the number of blocks that must be mined since the block of the spent output before the input can
+	// spend it, 0 means the input is not locked (see CheckSequence)
+	Sequence int32 `json:"sequence,omitempty"`
 }
 
 type TxnInputs struct {
@@ -1,18 +1,21 @@
 package transactions
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/script"
 )
 
 func TestTransactions_NewCoinbase(t *testing.T) {
-	coinbase := NewCoinbase("0x00", "data")
+	coinbase := NewCoinbase("0x00", "data", 50)
 	assert.NotNil(t, coinbase)
 
 	assert.Empty(t, coinbase.Id)
 	assert.Empty(t, coinbase.Inputs[0].TxnId)
 	assert.Equal(t, coinbase.Inputs[0].Output, int32(-1))
+	assert.Equal(t, int64(50), coinbase.Outputs[0].Value)
 }
 
 func TestTransactions_Serialize_Deserialize(t *testing.T) {
@@ -38,6 +41,59 @@ func TestTransactions_Serialize_Deserialize(t *testing.T) {
 	assert.ElementsMatch(t, txn.GetOutputs(), txn1.GetOutputs())
 }
 
+func TestTransactions_Serialize_LockTimes(t *testing.T) {
+	txn := Transaction{
+		Inputs:  []TxnInput{{TxnId: "prevTxn1", Output: 0}, {TxnId: "prevTxn2", Output: 1, Sequence: 10}},
+		Outputs: []TxnOutput{{Value: 100, ScriptPubKey: "pubKey1"}},
+	}
+	unlocked := Transaction{Inputs: []TxnInput{txn.Inputs[0], {TxnId: "prevTxn2", Output: 1}}, Outputs: txn.Outputs}
+	before, err := unlocked.Serialize()
+	assert.NoError(t, err)
+
+	// lock times are only written when one is set, the bytes of unlocked transactions don't change
+	after, err := txn.Serialize()
+	assert.NoError(t, err)
+	assert.Equal(t, before, after[:len(before)])
+	assert.Len(t, after, len(before)+8+4*len(txn.Inputs))
+
+	txn.LockTime = 1234
+	data, err := txn.Serialize()
+	assert.NoError(t, err)
+	var decoded Transaction
+	assert.NoError(t, decoded.Deserialize(data))
+	assert.Equal(t, txn, decoded)
+}
+
+func TestTransactions_CheckLockTime(t *testing.T) {
+	tests := map[string]struct {
+		lockTime  int64
+		height    int32
+		timestamp int64
+		err       error
+	}{
+		"unlocked":       {lockTime: 0, height: 1},
+		"height reached": {lockTime: 10, height: 10},
+		"height not yet": {lockTime: 10, height: 9, timestamp: LockTimeThreshold + 100, err: ErrNotFinal},
+		"time reached":   {lockTime: LockTimeThreshold + 100, height: 1, timestamp: LockTimeThreshold + 100},
+		"time not yet":   {lockTime: LockTimeThreshold + 100, height: 1_000_000, timestamp: LockTimeThreshold, err: ErrNotFinal},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			txn := Transaction{LockTime: tc.lockTime}
+			err := txn.CheckLockTime(tc.height, tc.timestamp)
+			if tc.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.err)
+			}
+		})
+	}
+
+	in := TxnInput{Sequence: 3}
+	assert.ErrorIs(t, in.CheckSequence(5, 7), ErrSequenceLock)
+	assert.NoError(t, in.CheckSequence(5, 8))
+}
+
 func TestTransactions_IsCoinBase(t *testing.T) {
 	tests := map[string]struct {
 		txn  Transaction
@@ -62,6 +118,10 @@ func TestTransactions_IsCoinBase(t *testing.T) {
 			},
 			itIs: true,
 		},
+		"allocation": {
+			txn:  *NewAllocation("genesis", []TxnOutput{{Value: 1, ScriptPubKey: "a"}, {Value: 2, ScriptPubKey: "b"}}),
+			itIs: true,
+		},
 		"not coinbase transactions": {
 			txn:  Transaction{},
 			itIs: false,
@@ -78,3 +138,83 @@ func TestTransactions_IsCoinBase(t *testing.T) {
 		})
 	}
 }
+
+func TestTransactions_Serialize_Deserialize_MultipleOutputs(t *testing.T) {
+	txn := Transaction{
+		Id:     "tx123",
+		Inputs: []TxnInput{{TxnId: "prevTxn1", Output: 0, ScriptSignature: "sig1"}},
+		Outputs: []TxnOutput{
+			{Value: 60, ScriptPubKey: "pubKey1"},
+			{Value: 1 << 40, ScriptPubKey: "pubKey2"},
+		},
+	}
+
+	bytes, err := txn.Serialize()
+	assert.NoError(t, err)
+
+	txn1 := Transaction{}
+	assert.NoError(t, txn1.Deserialize(bytes))
+	assert.Equal(t, txn.GetOutputs(), txn1.GetOutputs())
+}
+
+func TestTransactions_DataOutput(t *testing.T) {
+	out, err := NewDataOutput([]byte("anchor"))
+	assert.NoError(t, err)
+	assert.Zero(t, out.Value)
+	assert.True(t, out.IsUnspendable())
+	data, ok := out.Data()
+	assert.True(t, ok)
+	assert.Equal(t, []byte("anchor"), data)
+
+	_, err = NewDataOutput(make([]byte, script.MaxDataSize+1))
+	assert.ErrorIs(t, err, ErrDataTooLarge)
+
+	// addresses and spendable scripts are not data outputs
+	paid := TxnOutput{Value: 10, ScriptPubKey: "mxVFsFW5N4mu1HPkxPttorvocvzeZ7KZyk"}
+	assert.False(t, paid.IsUnspendable())
+	_, ok = paid.Data()
+	assert.False(t, ok)
+
+	txn := Transaction{Outputs: []TxnOutput{paid, out}}
+	assert.NoError(t, txn.CheckOutputs())
+	oversized, err := script.NewBuilder().AddOp(script.OP_RETURN).AddData(make([]byte, script.MaxDataSize+1)).Script()
+	assert.NoError(t, err)
+	txn.Outputs = append(txn.Outputs, TxnOutput{ScriptPubKey: oversized.Hex()})
+	assert.ErrorIs(t, txn.CheckOutputs(), ErrDataTooLarge)
+}
+
+func TestTransactions_CheckInputsAndValue(t *testing.T) {
+	txn := Transaction{Outputs: []TxnOutput{{Value: 10}, {Value: 0}}}
+	assert.ErrorIs(t, txn.CheckInputs(), ErrNoInputs)
+	value, err := txn.OutputValue()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), value)
+
+	txn.Inputs = []TxnInput{{TxnId: "a", Output: 0}, {TxnId: "a", Output: 1}}
+	assert.NoError(t, txn.CheckInputs())
+	txn.Inputs = append(txn.Inputs, TxnInput{TxnId: "a", Output: 0})
+	assert.ErrorIs(t, txn.CheckInputs(), ErrDuplicateInput)
+
+	txn.Outputs = []TxnOutput{{Value: -1}}
+	_, err = txn.OutputValue()
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	txn.Outputs = []TxnOutput{{Value: math.MaxInt64}, {Value: 1}}
+	_, err = txn.OutputValue()
+	assert.ErrorIs(t, err, ErrInvalidValue)
+}
+
+func TestTransactions_CheckId(t *testing.T) {
+	txn := Transaction{Inputs: []TxnInput{{TxnId: "a", Output: 0}}, Outputs: []TxnOutput{{Value: 10, ScriptPubKey: "bob"}}}
+	assert.ErrorIs(t, txn.CheckId(), ErrInvalidId)
+	txn.GenId()
+	assert.NoError(t, txn.CheckId())
+
+	// the id does not depend on the id it had, generating it twice gives the same id
+	id := txn.GetId()
+	txn.GenId()
+	assert.Equal(t, id, txn.GetId())
+
+	other := txn
+	other.Outputs = []TxnOutput{{Value: 10, ScriptPubKey: "mallory"}}
+	assert.ErrorIs(t, other.CheckId(), ErrInvalidId)
+}
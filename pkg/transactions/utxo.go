@@ -0,0 +1,19 @@
+package transactions
+
+// UTXO is an unspent transaction output together with the position that identifies it on the chain
+//
+// NOTE
+//   - `TxnOutputs` only carries the outputs, a UTXO also remembers the transaction id and output index (vout)
+//     which are needed to reference the output from a future transaction input
+type UTXO struct {
+	// TxnId is the id of the transaction that created the output
+	TxnId string `json:"txid"`
+
+	// Vout is the index of the output in the transaction's outputs
+	Vout int32 `json:"vout"`
+
+	// Height is the height of the block that contains the transaction
+	Height int32 `json:"height"`
+
+	TxnOutput
+}
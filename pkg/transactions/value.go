@@ -0,0 +1,74 @@
+package transactions
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	// ErrNoInputs is returned when a transaction that is not a coinbase spends nothing
+	ErrNoInputs = errors.New("transaction has no inputs")
+
+	// ErrDuplicateInput is returned when a transaction spends the same output twice
+	ErrDuplicateInput = errors.New("output spent twice")
+
+	// ErrInvalidId is returned when the id of a transaction is not the hash of its content
+	ErrInvalidId = errors.New("id is not the hash of the transaction")
+
+	// ErrInvalidValue is returned when the outputs of a transaction pay a negative value or more than its inputs
+	ErrInvalidValue = errors.New("invalid value")
+)
+
+// CheckId checks the id of the transaction is its Hash, an id claimed by the sender is never trusted
+//
+// Returns
+//   - `error`: ErrInvalidId when the id is empty or is not the hash of the transaction
+func (t *Transaction) CheckId() error {
+	id, err := t.Hash()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidId, err)
+	}
+	if t.Id != id {
+		return fmt.Errorf("%w: %q, it hashes to %s", ErrInvalidId, t.Id, id)
+	}
+	return nil
+}
+
+// CheckInputs checks a transaction that is not a coinbase spends at least one output and never the same one twice
+//
+// Returns
+//   - `error`: ErrNoInputs or ErrDuplicateInput
+func (t *Transaction) CheckInputs() error {
+	if len(t.Inputs) == 0 {
+		return ErrNoInputs
+	}
+	spent := make(map[string]int, len(t.Inputs))
+	for index, in := range t.Inputs {
+		key := fmt.Sprintf("%s:%d", in.TxnId, in.Output)
+		if first, ok := spent[key]; ok {
+			return fmt.Errorf("%w: inputs %d and %d spend %s", ErrDuplicateInput, first, index, key)
+		}
+		spent[key] = index
+	}
+	return nil
+}
+
+// OutputValue returns the sum of the values the outputs of the transaction pay
+//
+// Returns
+//   - `int64`: The sum
+//   - `error`: ErrInvalidValue when an output pays a negative value or the sum overflows
+func (t *Transaction) OutputValue() (int64, error) {
+	var value int64
+	for vout, out := range t.Outputs {
+		if out.Value < 0 {
+			return 0, fmt.Errorf("%w: output %d pays %d", ErrInvalidValue, vout, out.Value)
+		}
+		if value > math.MaxInt64-out.Value {
+			return 0, fmt.Errorf("%w: the outputs pay more than %d", ErrInvalidValue, int64(math.MaxInt64))
+		}
+		value += out.Value
+	}
+	return value, nil
+}
@@ -0,0 +1,115 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/tdadadavid/block/pkg/script"
+	"github.com/tdadadavid/block/pkg/toolkit"
+	"github.com/tdadadavid/block/pkg/transactions"
+)
+
+// ErrNotOwner is returned when a wallet signs an input spending an output that is not paid to it
+var ErrNotOwner = errors.New("output is not paid to the wallet")
+
+// Sign signs a signature hash (see transactions.Transaction.SignatureHash)
+//
+// Returns
+//   - `sig []byte`: The ASN.1 ECDSA signature followed by script.SigHashAll, the form scripts check
+//   - `err error`: The error while signing
+func (w *Wallet) Sign(hash []byte) (sig []byte, err error) {
+	sig, err = ecdsa.SignASN1(rand.Reader, &w.SecretKey, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return append(sig, script.SigHashAll), nil
+}
+
+// SignInput unlocks an input spending an output paid to the wallet's address
+//
+// Process
+//   - Checks the output is locked by the standard PayToPubKeyHash script of the wallet's public key
+//   - Signs the input and sets its ScriptSignature to the hexadecimal signature script: <signature> <pubkey>
+//
+// Parameters
+//   - `txn *transactions.Transaction`: The spending transaction, its outputs must be final since they are signed
+//   - `index int`: The input to sign
+//   - `spent transactions.TxnOutput`: The output the input spends
+//   - `versions transactions.AddressVersions`: The version bytes of the addresses of the network
+//
+// NOTE
+//   - The transaction id covers the signatures, it is generated once every input is signed
+//
+// Returns
+//   - `error`: ErrNotOwner, transactions.ErrNonStandard or the error while signing
+func (w *Wallet) SignInput(txn *transactions.Transaction, index int, spent transactions.TxnOutput, versions transactions.AddressVersions) error {
+	lockingScript, err := spent.LockingScript(versions)
+	if err != nil {
+		return err
+	}
+	pubKeyHash, err := toolkit.PublicKeyHash(w.PublicKey)
+	if err != nil {
+		return err
+	}
+	if locked, ok := lockingScript.PubKeyHash(); !ok || !bytes.Equal(locked, pubKeyHash) {
+		return fmt.Errorf("%w: %s", ErrNotOwner, spent.ScriptPubKey)
+	}
+
+	hash, err := txn.SignatureHash(index, lockingScript)
+	if err != nil {
+		return err
+	}
+	sig, err := w.Sign(hash)
+	if err != nil {
+		return err
+	}
+	sigScript, err := script.SignatureScript(sig, w.PublicKey)
+	if err != nil {
+		return err
+	}
+	txn.Inputs[index].ScriptSignature = sigScript.Hex()
+	return nil
+}
+
+// SignPartial adds the wallet's signature to every input of the partial transaction it can sign
+//
+// Parameters
+//   - `p *transactions.PartialTransaction`: The transaction being signed by several signers
+//   - `versions transactions.AddressVersions`: The version bytes of the addresses of the network
+//
+// NOTE
+//   - Inputs spending a script address are signed once their redeem script is set, see Wallets.SetRedeemScripts
+//
+// Returns
+//   - `signed int`: The number of inputs the wallet signed, inputs locked to other keys are left alone
+//   - `err error`: An input spending an output that is neither an address nor a script, or the error while signing
+func (w *Wallet) SignPartial(p *transactions.PartialTransaction, versions transactions.AddressVersions) (signed int, err error) {
+	for index := range p.Inputs {
+		subScript, err := p.SubScript(index, versions)
+		if err != nil {
+			return signed, err
+		}
+		hash, err := p.Txn.SignatureHash(index, subScript)
+		if err != nil {
+			return signed, err
+		}
+		sig, err := w.Sign(hash)
+		if err != nil {
+			return signed, err
+		}
+
+		// the signature is valid, it is only refused when the wallet's key does not sign the input
+		err = p.AddSignature(index, w.PublicKey, sig, versions)
+		if errors.Is(err, transactions.ErrBadSignature) {
+			continue
+		}
+		if err != nil {
+			return signed, err
+		}
+		signed++
+	}
+	return signed, nil
+}
@@ -4,18 +4,26 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"errors"
 	"fmt"
-	"github.com/tdadadavid/block/pkg/toolkit"
 	"math/big"
+
+	"github.com/tdadadavid/block/pkg/script"
+	"github.com/tdadadavid/block/pkg/toolkit"
 )
 
 const (
 	// CheckSumLength is the length of the checksum we are interested in
 	CheckSumLength = 4
-	// VERSION is the version of the address
+	// VERSION is the version of the address on mainnet, other networks define theirs in their parameters
 	VERSION = 0x00
+	// SCRIPT_VERSION is the version of script addresses on mainnet, they pay to the hash of a redeem script (P2SH)
+	SCRIPT_VERSION = 0x05
 )
 
+// ErrInvalidAddress is returned when an address is not a valid base58 wallet address
+var ErrInvalidAddress = errors.New("invalid address")
+
 // Wallet represents a wallet
 type Wallet struct {
 	//SecretKey is the Private key for the wallet used to verify transaction
@@ -88,6 +96,11 @@ func (w *Wallet) GetPublicKey() []byte {
 //   - address(string): The address generated for the wallet
 //   - error(error): The error during the process of generating the address
 func (w *Wallet) GenAddress() (address []byte, err error) {
+	return w.GenAddressFor(VERSION)
+}
+
+// GenAddressFor generates the address of the wallet like GenAddress with the version byte of a network
+func (w *Wallet) GenAddressFor(version byte) (address []byte, err error) {
 	// get the public key hash
 	pubKeyHash, err := toolkit.PublicKeyHash(w.PublicKey)
 	if err != nil {
@@ -96,19 +109,82 @@ func (w *Wallet) GenAddress() (address []byte, err error) {
 	}
 
 	// version + hash + checksum
-	version := []byte{VERSION}
-	addr := append(version, pubKeyHash...) // version + hash
+	addr := append([]byte{version}, pubKeyHash...) // version + hash
 	checkSum := toolkit.CheckSum(addr, CheckSumLength)
 	addr = append(addr, checkSum...) // version + hash + checksum
 
-	address = toolkit.Base58Encode(addr)
-
 	// base58 encode the address
-	fmt.Printf("base58 address for wallet 0x%x\n", address)
+	address = toolkit.Base58Encode(addr)
 
 	return address, err
 }
 
+// ScriptAddress returns the mainnet script address of a redeem script, see ScriptAddressFor
+func ScriptAddress(redeem script.Script) (address []byte, err error) {
+	return ScriptAddressFor(redeem, SCRIPT_VERSION)
+}
+
+// ScriptAddressFor returns the script address of a redeem script with the script version byte of a network
+//
+// Process
+//   - Script addresses are built like wallet addresses: VERSION + HASH160 + CHECKSUM, the HASH160 is the hash
+//     of the redeem script instead of a public key
+//   - Outputs paid to a script address are locked by a PayToScriptHash script, the sender never sees the redeem script
+//
+// Returns
+//   - address(byte): The base58 script address
+//   - err(error): The error while hashing the script
+func ScriptAddressFor(redeem script.Script, version byte) (address []byte, err error) {
+	scriptHash, err := redeem.Hash160()
+	if err != nil {
+		return address, fmt.Errorf("err generating script hash: %w", err)
+	}
+
+	return EncodeAddress(scriptHash, version), nil
+}
+
+// EncodeAddress returns the address of a public key hash or a script hash: base58(VERSION + HASH160 + CHECKSUM)
+func EncodeAddress(hash []byte, version byte) (address []byte) {
+	addr := append([]byte{version}, hash...)
+	addr = append(addr, toolkit.CheckSum(addr, CheckSumLength)...)
+	return toolkit.Base58Encode(addr)
+}
+
+// DecodeAddress validates an address generated by GenAddress and returns its public key hash
+//
+// Process
+//   - Base58 decodes the address and verifies its CHECKSUM over VERSION + HASH160
+//   - Checks the version byte and the length of the HASH160
+//
+// Parameters
+//   - address(string): The address to decode
+//
+// Returns
+//   - pubKeyHash(byte): The HASH160 of the public key the address was generated from
+//   - err(error): ErrInvalidAddress when the address is malformed
+func DecodeAddress(address string) (pubKeyHash []byte, err error) {
+	return DecodeAddressFor(address, VERSION)
+}
+
+// DecodeAddressFor decodes an address like DecodeAddress, the address must have the version byte of a network
+//
+// NOTE
+//   - Script addresses are decoded with the script version byte of the network, they return the hash of the redeem script
+func DecodeAddressFor(address string, want byte) (pubKeyHash []byte, err error) {
+	version, pubKeyHash, err := toolkit.Base58CheckDecode(address, CheckSumLength)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	if version != want {
+		return nil, fmt.Errorf("%w: unknown version 0x%x", ErrInvalidAddress, version)
+	}
+	if len(pubKeyHash) != 20 {
+		return nil, fmt.Errorf("%w: unexpected public key hash length %d", ErrInvalidAddress, len(pubKeyHash))
+	}
+
+	return pubKeyHash, err
+}
+
 func (w *Wallet) Serialize() (data []byte, err error) {
 	// Create a buffer to store the serialized data
 	var buf bytes.Buffer
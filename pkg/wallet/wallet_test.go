@@ -2,6 +2,8 @@ package wallet
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/tdadadavid/block/pkg/params"
+	"github.com/tdadadavid/block/pkg/script"
 	"github.com/tdadadavid/block/pkg/toolkit"
 	"testing"
 )
@@ -44,3 +46,59 @@ func TestWallet_Hash(t *testing.T) {
 	assert.NotEmpty(t, hash)
 	assert.Equal(t, len(hash), 20)
 }
+
+func TestWallet_DecodeAddress(t *testing.T) {
+	w, err := New()
+	assert.NoError(t, err)
+
+	address, err := w.GenAddress()
+	assert.NoError(t, err)
+
+	pubKeyHash, err := DecodeAddress(string(address))
+	assert.NoError(t, err)
+	hash, err := toolkit.PublicKeyHash(w.GetPublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, hash, pubKeyHash)
+
+	tampered := []byte(string(address))
+	tampered[len(tampered)-1] ^= 1
+	_, err = DecodeAddress(string(tampered))
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+
+	_, err = DecodeAddress("bob")
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func TestWallet_AddressForNetwork(t *testing.T) {
+	w, err := New()
+	assert.NoError(t, err)
+
+	assert.Equal(t, byte(VERSION), params.Mainnet.AddressVersion)
+	address, err := w.GenAddressFor(params.Testnet.AddressVersion)
+	assert.NoError(t, err)
+
+	_, err = DecodeAddressFor(string(address), params.Testnet.AddressVersion)
+	assert.NoError(t, err)
+	// an address of one network is not valid on another
+	_, err = DecodeAddress(string(address))
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func TestWallet_ScriptAddress(t *testing.T) {
+	redeem := script.Script{byte(script.OP_1)}
+	address, err := ScriptAddressFor(redeem, params.Testnet.ScriptAddressVersion)
+	assert.NoError(t, err)
+
+	scriptHash, err := DecodeAddressFor(string(address), params.Testnet.ScriptAddressVersion)
+	assert.NoError(t, err)
+	hash, err := redeem.Hash160()
+	assert.NoError(t, err)
+	assert.Equal(t, hash, scriptHash)
+	// a script address is not a wallet address
+	_, err = DecodeAddressFor(string(address), params.Testnet.AddressVersion)
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+
+	mainnet, err := ScriptAddress(redeem)
+	assert.NoError(t, err)
+	assert.NotEqual(t, address, mainnet)
+}
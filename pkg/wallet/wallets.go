@@ -3,22 +3,51 @@ package wallet
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/tdadadavid/block/pkg/params"
+	"github.com/tdadadavid/block/pkg/script"
 	"github.com/tdadadavid/block/pkg/store"
+	"github.com/tdadadavid/block/pkg/transactions"
 )
 
 // Wallets store all the available wallets in a chain
 type Wallets struct {
 	wallets map[string]*Wallet
+	store   store.Storage
+
+	// scripts are the redeem scripts of the script addresses the wallets spend, by script address
+	scripts map[string]script.Script
+
+	// params are the network the addresses of the wallets are for
+	params *params.Params
+}
+
+// StorePath returns the path of the wallet store of the network in the data directory
+func StorePath(p *params.Params, dataDir string) string {
+	return filepath.Join(p.DataDir(dataDir), "wallets")
 }
 
 // NewWallets create a new wallets
-func NewWallets() (w Wallets) {
+//
+// Parameters
+//   - `p *params.Params`: The network of the wallets, its addresses carry its version byte
+//   - `dataDir string`: The data directory, the wallets are kept in the one of the network
+func NewWallets(p *params.Params, dataDir string) (w Wallets) {
 	// open the wallet store
-	ws, err := store.Open("/data/wallets")
+	ws, err := store.Open(StorePath(p, dataDir))
 	if err != nil {
 		panic(fmt.Errorf("failed to create wallets %v", err))
 	}
 
+	w = Wallets{
+		wallets: make(map[string]*Wallet),
+		scripts: make(map[string]script.Script),
+		store:   ws,
+		params:  p,
+	}
+
 	// find all the wallets in the store
 	data, err := ws.FindAllWallets(context.Background())
 	if err != nil {
@@ -36,7 +65,126 @@ func NewWallets() (w Wallets) {
 		w.wallets[string(wallet.PublicKey)] = &wallet
 	}
 
+	// load the redeem scripts of the script addresses
+	scripts, err := ws.FindAllScripts(context.Background())
+	if err != nil {
+		panic(fmt.Errorf("failed to create wallets %v", err))
+	}
+	for address, redeem := range scripts {
+		w.scripts[address] = redeem
+	}
+
 	return w
 }
 
-func (w *Wallets) AddWallet(wallet *Wallet) {}
+// AddWallet keeps the wallet in memory and persists it in the wallets namespace of the store
+func (w *Wallets) AddWallet(wallet *Wallet) error {
+	data, err := wallet.Serialize()
+	if err != nil {
+		return fmt.Errorf("failed to serialize wallet: %w", err)
+	}
+
+	address, err := wallet.GenAddressFor(w.params.AddressVersion)
+	if err != nil {
+		return err
+	}
+
+	if err = w.store.CreateWallet(context.Background(), string(address), data); err != nil {
+		return fmt.Errorf("failed to store wallet: %w", err)
+	}
+	w.wallets[string(wallet.PublicKey)] = wallet
+
+	return err
+}
+
+// GetWallet returns the wallet of an address of the network
+//
+// Returns
+//   - `*Wallet`: The wallet
+//   - `error`: ErrInvalidAddress when no wallet has the address
+func (w *Wallets) GetWallet(address string) (*Wallet, error) {
+	for _, wallet := range w.wallets {
+		addr, err := wallet.GenAddressFor(w.params.AddressVersion)
+		if err != nil {
+			return nil, err
+		}
+		if string(addr) == address {
+			return wallet, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no wallet has the address %s", ErrInvalidAddress, address)
+}
+
+// Addresses returns the addresses of the network of every wallet, sorted
+func (w *Wallets) Addresses() (addresses []string, err error) {
+	for _, wallet := range w.wallets {
+		addr, err := wallet.GenAddressFor(w.params.AddressVersion)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, string(addr))
+	}
+	slices.Sort(addresses)
+	return addresses, nil
+}
+
+// AddScript keeps a redeem script so the wallets can spend the outputs paid to its script address
+//
+// Returns
+//   - `address string`: The script address of the network outputs are paid to
+//   - `err error`: The error while hashing or storing the script
+func (w *Wallets) AddScript(redeem script.Script) (address string, err error) {
+	addr, err := ScriptAddressFor(redeem, w.params.ScriptAddressVersion)
+	if err != nil {
+		return address, err
+	}
+
+	if err = w.store.CreateScript(context.Background(), string(addr), redeem); err != nil {
+		return address, fmt.Errorf("failed to store script: %w", err)
+	}
+	w.scripts[string(addr)] = redeem
+	return string(addr), nil
+}
+
+// GetScript returns the redeem script of a script address of the network
+//
+// Returns
+//   - `script.Script`: The redeem script
+//   - `error`: ErrInvalidAddress when no script has the address
+func (w *Wallets) GetScript(address string) (script.Script, error) {
+	redeem, ok := w.scripts[address]
+	if !ok {
+		return nil, fmt.Errorf("%w: no script has the address %s", ErrInvalidAddress, address)
+	}
+	return redeem, nil
+}
+
+// SetRedeemScripts reveals the redeem scripts the wallets know of the inputs of a partial transaction that spend
+// script addresses
+//
+// Returns
+//   - `set int`: The number of redeem scripts set, inputs whose redeem script is already set are skipped
+//   - `err error`: The error while setting a redeem script
+func (w *Wallets) SetRedeemScripts(p *transactions.PartialTransaction) (set int, err error) {
+	for index, in := range p.Inputs {
+		redeem, ok := w.scripts[in.Spent.ScriptPubKey]
+		if !ok || in.RedeemScript != "" {
+			continue
+		}
+		if err = p.SetRedeemScript(index, redeem, w.params.Versions()); err != nil {
+			return set, err
+		}
+		set++
+	}
+	return set, nil
+}
+
+// Store returns the store the wallets are kept in, chain.Chain.Backup backs it up with the chain
+func (w *Wallets) Store() store.Storage {
+	return w.store
+}
+
+// Close closes the wallets' store
+func (w *Wallets) Close() error {
+	return w.store.Close()
+}